@@ -0,0 +1,364 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"managerfact/internal/domain/models"
+	"managerfact/internal/domain/repositories"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrApiKeyInvalida: token desconocido, mal formado, vencido o
+	// revocado. Mismo mensaje en todos los casos.
+	ErrApiKeyInvalida = errors.New("API key inválida, vencida o revocada")
+	// ErrApiKeyNoEncontrada: no hay key con ese ID.
+	ErrApiKeyNoEncontrada = errors.New("API key no encontrada")
+	// ErrApiKeyDatosInvalidos: nombre, permisos o vencimiento inválidos.
+	ErrApiKeyDatosInvalidos = errors.New("datos de API key inválidos")
+	// ErrApiKeyExcedeCreador: la key tendría permisos o sucursales que
+	// quien la crea o edita no tiene.
+	ErrApiKeyExcedeCreador = errors.New("la API key no puede tener permisos ni sucursales que usted no tiene")
+)
+
+// permisosNoDelegables no se pueden dar a una key: con ellos una
+// integración podría crearse usuarios o keys propias, o administrar el
+// sistema.
+var permisosNoDelegables = map[string]bool{
+	models.PermisoUsuariosEditar: true,
+	models.PermisoApiKeysEditar:  true,
+	models.PermisoSistemaAdmin:   true,
+}
+
+// usoApiKeyIntervalo: ultimo_uso se actualiza como mucho una vez por
+// intervalo, no en cada request.
+const usoApiKeyIntervalo = time.Minute
+
+// ApiKeyService administra las API keys de integraciones y las valida para
+// RequireAuth. Cada key se crea con su cuenta de servicio (ver
+// models.ApiKey): los accesos por sucursal de la key son los de esa cuenta.
+type ApiKeyService struct {
+	repo     *repositories.ApiKeyRepository
+	usuarios *repositories.UsuarioRepository
+	roles    *repositories.RolRepository
+}
+
+func NewApiKeyService(repo *repositories.ApiKeyRepository, usuarios *repositories.UsuarioRepository, roles *repositories.RolRepository) *ApiKeyService {
+	return &ApiKeyService{repo: repo, usuarios: usuarios, roles: roles}
+}
+
+// ApiKeyInput es lo que se configura de una key. Accesos dice qué
+// sucursales ve (igual que los accesos de un usuario).
+type ApiKeyInput struct {
+	Nombre   string
+	Permisos []string
+	ExpiraEn *time.Time
+	Accesos  AccesosInput
+}
+
+// normalizar valida el input y deja los permisos sin repetir, en el orden
+// del catálogo.
+func (input *ApiKeyInput) normalizar(ahora time.Time) error {
+	input.Nombre = strings.TrimSpace(input.Nombre)
+	if input.Nombre == "" || len(input.Nombre) > 100 {
+		return fmt.Errorf("%w: el nombre es requerido y no puede pasar de 100 caracteres", ErrApiKeyDatosInvalidos)
+	}
+	if input.ExpiraEn != nil && !input.ExpiraEn.After(ahora) {
+		return fmt.Errorf("%w: expira_en tiene que ser futura", ErrApiKeyDatosInvalidos)
+	}
+	if a := input.Accesos; a.VigenteDesde != nil && a.VigenteHasta != nil && !a.VigenteHasta.After(*a.VigenteDesde) {
+		return fmt.Errorf("%w: %w", ErrApiKeyDatosInvalidos, ErrVigenciaInvalida)
+	}
+	elegidos := map[string]bool{}
+	for _, permiso := range input.Permisos {
+		if !models.EsPermiso(permiso) {
+			return fmt.Errorf("%w: permiso desconocido %q", ErrApiKeyDatosInvalidos, permiso)
+		}
+		if permisosNoDelegables[permiso] {
+			return fmt.Errorf("%w: el permiso %q no se puede dar a una API key", ErrApiKeyDatosInvalidos, permiso)
+		}
+		elegidos[permiso] = true
+	}
+	if len(elegidos) == 0 {
+		return fmt.Errorf("%w: la key necesita al menos un permiso", ErrApiKeyDatosInvalidos)
+	}
+	input.Permisos = []string{}
+	for _, permiso := range models.Permisos {
+		if elegidos[permiso.Nombre] {
+			input.Permisos = append(input.Permisos, permiso.Nombre)
+		}
+	}
+	return nil
+}
+
+// verificarCreador rechaza una key con permisos que el rol de actorID no
+// tiene, o con sucursales fuera de su alcance vigente: con api_keys.gestionar
+// no se delega más de lo que uno mismo puede hacer.
+func (s *ApiKeyService) verificarCreador(input ApiKeyInput, actorID uint) error {
+	rol, err := s.roles.DeUsuario(actorID)
+	if err != nil {
+		return err
+	}
+	var faltantes []string
+	for _, permiso := range input.Permisos {
+		if rol == nil || !rol.Tiene(permiso) {
+			faltantes = append(faltantes, permiso)
+		}
+	}
+	if len(faltantes) > 0 {
+		return fmt.Errorf("%w: permisos %s", ErrApiKeyExcedeCreador, strings.Join(faltantes, ", "))
+	}
+
+	total, err := s.usuarios.TieneAccesoTotal(actorID)
+	if err != nil || total {
+		return err
+	}
+	if input.Accesos.AccesoTotal {
+		return fmt.Errorf("%w: acceso_total", ErrApiKeyExcedeCreador)
+	}
+	catalogo, err := s.usuarios.GetSucursalesCatalogo()
+	if err != nil {
+		return err
+	}
+	permitidas, err := s.usuarios.SucursalesPermitidas(actorID)
+	if err != nil {
+		return err
+	}
+	if fuera := sucursalesFueraDeAlcance(catalogo, permitidas, input.Accesos); len(fuera) > 0 {
+		return fmt.Errorf("%w: sucursales %v", ErrApiKeyExcedeCreador, fuera)
+	}
+	return nil
+}
+
+// sucursalesFueraDeAlcance devuelve los IDs de las sucursales del catálogo
+// que pide accesos (elegidas una por una o por su regional) y que no están
+// entre las permitidas.
+func sucursalesFueraDeAlcance(catalogo, permitidas []models.SucursalCatalogo, accesos AccesosInput) []uint {
+	propias := map[uint]bool{}
+	for _, sucursal := range permitidas {
+		propias[sucursal.ID] = true
+	}
+	fuera := []uint{}
+	for _, sucursal := range sucursalesPedidas(catalogo, accesos) {
+		if !propias[sucursal.ID] {
+			fuera = append(fuera, sucursal.ID)
+		}
+	}
+	return fuera
+}
+
+// sucursalesPedidas resuelve contra el catálogo las sucursales que pide
+// accesos, elegidas una por una o por su regional (como SetAccesos).
+func sucursalesPedidas(catalogo []models.SucursalCatalogo, accesos AccesosInput) []models.SucursalCatalogo {
+	regionales := map[uint]bool{}
+	for _, id := range accesos.RegionalesIDs {
+		regionales[id] = true
+	}
+	sueltas := map[uint]bool{}
+	for _, id := range accesos.SucursalesIDs {
+		sueltas[id] = true
+	}
+	pedidas := []models.SucursalCatalogo{}
+	for _, sucursal := range catalogo {
+		if sueltas[sucursal.ID] || regionales[sucursal.RegionalID] {
+			pedidas = append(pedidas, sucursal)
+		}
+	}
+	return pedidas
+}
+
+// nuevaApiKey genera el token "mfk_<prefijo>_<secreto>", su prefijo y su
+// hash.
+func nuevaApiKey() (token, prefijo, hash string, err error) {
+	bytes := make([]byte, 36)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", "", "", fmt.Errorf("error generando API key: %w", err)
+	}
+	prefijo = hex.EncodeToString(bytes[:4])
+	token = models.PrefijoApiKey + prefijo + "_" + base64.RawURLEncoding.EncodeToString(bytes[4:])
+	return token, prefijo, hashApiKey(token), nil
+}
+
+func hashApiKey(token string) string {
+	suma := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(suma[:])
+}
+
+// Crear da de alta la key con su cuenta de servicio y sus accesos.
+// Devuelve el token en claro: es la única vez que se puede ver. La key no
+// puede tener más permisos ni sucursales que creadaPorID.
+func (s *ApiKeyService) Crear(input ApiKeyInput, creadaPorID uint) (*models.ApiKey, string, error) {
+	if err := input.normalizar(time.Now()); err != nil {
+		return nil, "", err
+	}
+	if err := s.verificarCreador(input, creadaPorID); err != nil {
+		return nil, "", err
+	}
+	token, prefijo, hash, err := nuevaApiKey()
+	if err != nil {
+		return nil, "", err
+	}
+
+	key := &models.ApiKey{
+		Nombre:      input.Nombre,
+		Prefijo:     prefijo,
+		Hash:        hash,
+		Permisos:    input.Permisos,
+		ExpiraEn:    input.ExpiraEn,
+		CreadaPorID: &creadaPorID,
+	}
+	err = s.repo.Transaccion(func(keys *repositories.ApiKeyRepository, usuarios *repositories.UsuarioRepository) error {
+		// la cuenta no tiene contraseña utilizable ni rol con permisos: lo
+		// que puede hacer sale de key.Permisos
+		cuenta := &models.Usuario{
+			Nombre:        "API key: " + input.Nombre,
+			CI:            "apikey-" + prefijo,
+			Cargo:         "Cuenta de servicio",
+			CodigoUsuario: "apikey-" + prefijo,
+			PasswordHash:  "-",
+			IsActive:      true,
+			Rol:           models.RolAuditor,
+			EsServicio:    true,
+		}
+		if err := usuarios.Create(cuenta); err != nil {
+			return err
+		}
+		key.UsuarioID = cuenta.ID
+		if err := keys.Create(key); err != nil {
+			return err
+		}
+		a := input.Accesos
+		return usuarios.SetAccesos(cuenta.ID, a.AccesoTotal, a.RegionalesIDs, a.SucursalesIDs, a.VigenteDesde, a.VigenteHasta)
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	return key, token, nil
+}
+
+func (s *ApiKeyService) Listar() ([]models.ApiKey, error) {
+	return s.repo.GetAll()
+}
+
+func (s *ApiKeyService) obtener(id uint) (*models.ApiKey, error) {
+	key, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, fmt.Errorf("%w: %d", ErrApiKeyNoEncontrada, id)
+	}
+	if key.Usuario == nil {
+		return nil, fmt.Errorf("la cuenta de servicio de la API key %d no existe", id)
+	}
+	return key, nil
+}
+
+// Obtener devuelve la key y los accesos de su cuenta de servicio.
+func (s *ApiKeyService) Obtener(id uint) (*models.ApiKey, *repositories.AccesosResueltos, error) {
+	key, err := s.obtener(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	accesos, err := s.usuarios.GetAccesos(key.UsuarioID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return key, accesos, nil
+}
+
+// Actualizar reemplaza nombre, permisos, vencimiento y accesos de la key
+// (el token sigue siendo el mismo). Una key revocada no se modifica, y
+// con los mismos límites que al crearla respecto de actorID.
+func (s *ApiKeyService) Actualizar(id uint, input ApiKeyInput, actorID uint) (*models.ApiKey, error) {
+	if err := input.normalizar(time.Now()); err != nil {
+		return nil, err
+	}
+	if err := s.verificarCreador(input, actorID); err != nil {
+		return nil, err
+	}
+	key, err := s.obtener(id)
+	if err != nil {
+		return nil, err
+	}
+	if key.RevocadaEn != nil {
+		return nil, fmt.Errorf("%w: la key está revocada", ErrApiKeyDatosInvalidos)
+	}
+
+	key.Nombre = input.Nombre
+	key.Permisos = input.Permisos
+	key.ExpiraEn = input.ExpiraEn
+	err = s.repo.Transaccion(func(keys *repositories.ApiKeyRepository, usuarios *repositories.UsuarioRepository) error {
+		if err := keys.Guardar(key); err != nil {
+			return err
+		}
+		key.Usuario.Nombre = "API key: " + input.Nombre
+		if err := usuarios.Update(key.Usuario); err != nil {
+			return err
+		}
+		a := input.Accesos
+		return usuarios.SetAccesos(key.UsuarioID, a.AccesoTotal, a.RegionalesIDs, a.SucursalesIDs, a.VigenteDesde, a.VigenteHasta)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Revocar deja la key inutilizable de inmediato y desactiva su cuenta de
+// servicio. Se conserva para el historial (lo que hizo sigue a su nombre).
+func (s *ApiKeyService) Revocar(id uint) error {
+	key, err := s.obtener(id)
+	if err != nil {
+		return err
+	}
+	if key.RevocadaEn != nil {
+		return nil
+	}
+	ahora := time.Now()
+	key.RevocadaEn = &ahora
+	return s.repo.Transaccion(func(keys *repositories.ApiKeyRepository, usuarios *repositories.UsuarioRepository) error {
+		if err := keys.Guardar(key); err != nil {
+			return err
+		}
+		key.Usuario.IsActive = false
+		return usuarios.Update(key.Usuario)
+	})
+}
+
+// Autenticar valida el token de una request: existe, el hash coincide, no
+// está vencida ni revocada y su cuenta de servicio sigue activa. Anota el
+// último uso (un error ahí no corta la request).
+func (s *ApiKeyService) Autenticar(token, ip string) (*models.ApiKey, error) {
+	resto, ok := strings.CutPrefix(token, models.PrefijoApiKey)
+	if !ok {
+		return nil, ErrApiKeyInvalida
+	}
+	prefijo, _, ok := strings.Cut(resto, "_")
+	if !ok || prefijo == "" {
+		return nil, ErrApiKeyInvalida
+	}
+	key, err := s.repo.PorPrefijo(prefijo)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil || subtle.ConstantTimeCompare([]byte(key.Hash), []byte(hashApiKey(token))) != 1 {
+		return nil, ErrApiKeyInvalida
+	}
+	ahora := time.Now()
+	if !key.Activa(ahora) || key.Usuario == nil || !key.Usuario.IsActive {
+		return nil, ErrApiKeyInvalida
+	}
+
+	if err := s.repo.RegistrarUso(key.ID, ahora, recortar(ip, 64), usoApiKeyIntervalo); err != nil {
+		log.Printf("[ApiKeyService] %v", err)
+	}
+	return key, nil
+}
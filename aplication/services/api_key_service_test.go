@@ -0,0 +1,37 @@
+package services
+
+import (
+	"managerfact/internal/domain/models"
+	"reflect"
+	"testing"
+)
+
+func TestSucursalesFueraDeAlcance(t *testing.T) {
+	catalogo := []models.SucursalCatalogo{
+		{ID: 1, RegionalID: 10},
+		{ID: 2, RegionalID: 10},
+		{ID: 3, RegionalID: 20},
+		{ID: 4, RegionalID: 20},
+	}
+	permitidas := []models.SucursalCatalogo{catalogo[0], catalogo[1], catalogo[2]}
+
+	casos := []struct {
+		nombre  string
+		accesos AccesosInput
+		fuera   []uint
+	}{
+		{"sin accesos", AccesosInput{}, []uint{}},
+		{"sucursales propias", AccesosInput{SucursalesIDs: []uint{1, 3}}, []uint{}},
+		{"regional completa propia", AccesosInput{RegionalesIDs: []uint{10}}, []uint{}},
+		{"sucursal ajena", AccesosInput{SucursalesIDs: []uint{1, 4}}, []uint{4}},
+		{"regional con una sucursal ajena", AccesosInput{RegionalesIDs: []uint{20}}, []uint{4}},
+		{"regional y sucursal ajena a la vez", AccesosInput{RegionalesIDs: []uint{20}, SucursalesIDs: []uint{4}}, []uint{4}},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			if fuera := sucursalesFueraDeAlcance(catalogo, permitidas, c.accesos); !reflect.DeepEqual(fuera, c.fuera) {
+				t.Errorf("sucursalesFueraDeAlcance = %v, se esperaba %v", fuera, c.fuera)
+			}
+		})
+	}
+}
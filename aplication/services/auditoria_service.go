@@ -0,0 +1,207 @@
+package services
+
+import (
+	"encoding/json"
+	"io"
+	"log"
+	"managerfact/internal/domain/models"
+	"managerfact/internal/domain/repositories"
+	"strconv"
+	"time"
+)
+
+// Actor es quién hace una acción auditada y desde dónde (lo arman los
+// handlers con lo que dejó RequireAuth).
+type Actor struct {
+	UsuarioID uint
+	Autor     string
+	IP        string
+}
+
+// EventoAuditoria es una acción a registrar. Antes/Despues se guardan como
+// JSON y no deben llevar secretos (tokens, contraseñas): los handlers
+// pasan las mismas respuestas que devuelven al cliente.
+type EventoAuditoria struct {
+	Accion    string
+	Entidad   string
+	EntidadID any
+	Antes     any
+	Despues   any
+}
+
+// PaginaAuditoria es una página de GET /auditoria.
+type PaginaAuditoria struct {
+	Data       []models.Auditoria `json:"data"`
+	Total      int64              `json:"total"`
+	Page       int                `json:"page"`
+	PageSize   int                `json:"page_size"`
+	TotalPages int                `json:"total_pages"`
+}
+
+// AuditoriaService registra y consulta la auditoría de acciones (quién
+// creó un usuario, cambió accesos, editó una sucursal facturador, eliminó
+// una conexión, importó un lote o mandó a facturar).
+type AuditoriaService struct {
+	repo          *repositories.AuditoriaRepository
+	usuarios      *repositories.UsuarioRepository
+	exportaciones *ExportacionesService
+}
+
+func NewAuditoriaService(repo *repositories.AuditoriaRepository, usuarios *repositories.UsuarioRepository, exportaciones *ExportacionesService) *AuditoriaService {
+	return &AuditoriaService{repo: repo, usuarios: usuarios, exportaciones: exportaciones}
+}
+
+// Registrar guarda el evento. Se llama después de que la acción se hizo:
+// si falla la auditoría solo se loguea, la acción no se deshace.
+func (s *AuditoriaService) Registrar(actor Actor, evento EventoAuditoria) {
+	registro := &models.Auditoria{
+		Autor:   recortar(actor.Autor, 100),
+		Accion:  evento.Accion,
+		Entidad: evento.Entidad,
+		Antes:   evento.Antes,
+		Despues: evento.Despues,
+		IP:      recortar(actor.IP, 64),
+	}
+	if evento.EntidadID != nil {
+		registro.EntidadID = recortar(fmtEntidadID(evento.EntidadID), 50)
+	}
+	if actor.UsuarioID != 0 {
+		registro.UsuarioID = &actor.UsuarioID
+		if usuario, err := s.usuarios.GetByID(actor.UsuarioID); err == nil {
+			registro.CodigoUsuario = usuario.CodigoUsuario
+		}
+	}
+	if err := s.repo.Create(registro); err != nil {
+		log.Printf("[Auditoria] %s.%s %s: %v", evento.Entidad, evento.Accion, registro.EntidadID, err)
+	}
+}
+
+func fmtEntidadID(id any) string {
+	switch v := id.(type) {
+	case string:
+		return v
+	case uint:
+		return strconv.FormatUint(uint64(v), 10)
+	case int:
+		return strconv.Itoa(v)
+	default:
+		texto, _ := json.Marshal(v)
+		return string(texto)
+	}
+}
+
+// Listar devuelve una página de la auditoría, lo más reciente primero.
+func (s *AuditoriaService) Listar(filtro repositories.AuditoriaFiltro, page, pageSize int) (*PaginaAuditoria, error) {
+	total, err := s.repo.Contar(filtro)
+	if err != nil {
+		return nil, err
+	}
+	registros, err := s.repo.GetPagina(filtro, page, pageSize)
+	if err != nil {
+		return nil, err
+	}
+	return &PaginaAuditoria{
+		Data:       registros,
+		Total:      total,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalPages: int((total + int64(pageSize) - 1) / int64(pageSize)),
+	}, nil
+}
+
+var columnasAuditoria = []ColumnaExportacion{
+	{Titulo: "Fecha", Tipo: ColumnaFecha, Ancho: 9},
+	{Titulo: "Usuario", Tipo: ColumnaTexto, Ancho: 7},
+	{Titulo: "Autor", Tipo: ColumnaTexto, Ancho: 9},
+	{Titulo: "IP", Tipo: ColumnaTexto, Ancho: 7},
+	{Titulo: "Entidad", Tipo: ColumnaTexto, Ancho: 8},
+	{Titulo: "ID entidad", Tipo: ColumnaTexto, Ancho: 5},
+	{Titulo: "Acción", Tipo: ColumnaTexto, Ancho: 7},
+	{Titulo: "Antes", Tipo: ColumnaTexto, Ancho: 20},
+	{Titulo: "Después", Tipo: ColumnaTexto, Ancho: 20},
+}
+
+// máximo de caracteres de Antes/Después por celda (el límite de una celda
+// de Excel es 32767).
+const maxJSONCeldaAuditoria = 30000
+
+func filaAuditoria(r *models.Auditoria) []any {
+	return []any{
+		r.CreatedAt,
+		r.CodigoUsuario,
+		r.Autor,
+		r.IP,
+		r.Entidad,
+		r.EntidadID,
+		r.Accion,
+		jsonCelda(r.Antes),
+		jsonCelda(r.Despues),
+	}
+}
+
+func jsonCelda(valor any) string {
+	if valor == nil {
+		return ""
+	}
+	texto, err := json.Marshal(valor)
+	if err != nil {
+		return ""
+	}
+	return recortar(string(texto), maxJSONCeldaAuditoria)
+}
+
+func reporteAuditoria(filtro repositories.AuditoriaFiltro, generadoPor string) *ReporteExportacion {
+	var filtros []FiltroAplicado
+	if filtro.UsuarioID != 0 {
+		filtros = agregarFiltro(filtros, "Usuario ID", strconv.FormatUint(uint64(filtro.UsuarioID), 10))
+	}
+	filtros = agregarFiltro(filtros, "Entidad", filtro.Entidad)
+	filtros = agregarFiltro(filtros, "ID entidad", filtro.EntidadID)
+	filtros = agregarFiltro(filtros, "Acción", filtro.Accion)
+	if filtro.Desde != nil {
+		filtros = agregarFiltro(filtros, "Desde", filtro.Desde.Format("2006-01-02"))
+	}
+	if filtro.Hasta != nil {
+		// Hasta es exclusivo (día siguiente al pedido)
+		filtros = agregarFiltro(filtros, "Hasta", filtro.Hasta.AddDate(0, 0, -1).Format("2006-01-02"))
+	}
+
+	return &ReporteExportacion{
+		Titulo:      "Auditoría",
+		NombreBase:  "auditoria",
+		Filtros:     filtros,
+		Columnas:    columnasAuditoria,
+		GeneradoPor: generadoPor,
+		GeneradoEn:  time.Now(),
+	}
+}
+
+// Exportar genera la auditoría filtrada, en orden cronológico, en el
+// formato pedido: el archivo si entra en ExportacionesService.UmbralSincrono
+// filas, o un TrabajoExportacion en segundo plano si no (un PDF más grande
+// se rechaza con ErrPDFDemasiadasFilas).
+func (s *AuditoriaService) Exportar(filtro repositories.AuditoriaFiltro, formato FormatoExportacion, usuarioID uint, generadoPor string) (*ArchivoExportado, *TrabajoExportacion, error) {
+	reporte := reporteAuditoria(filtro, generadoPor)
+	fuente := func(emitir func(fila []any) error) error {
+		return s.repo.Recorrer(filtro, func(registro *models.Auditoria) error {
+			return emitir(filaAuditoria(registro))
+		})
+	}
+
+	total, err := s.repo.Contar(filtro)
+	if err != nil {
+		return nil, nil, err
+	}
+	if total <= int64(s.exportaciones.UmbralSincrono(formato)) {
+		archivo, err := generarEnMemoria(formato, reporte, fuente)
+		return archivo, nil, err
+	}
+	if err := encolable(formato); err != nil {
+		return nil, nil, err
+	}
+
+	trabajo := s.exportaciones.Encolar(usuarioID, formato, reporte.NombreArchivo(formato), func(w io.Writer) (int, error) {
+		return GenerarReporte(w, formato, reporte, fuente)
+	})
+	return nil, trabajo, nil
+}
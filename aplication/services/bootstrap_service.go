@@ -0,0 +1,185 @@
+package services
+
+import (
+	"fmt"
+	"managerfact/internal/domain/models"
+	"managerfact/internal/domain/repositories"
+	"strings"
+)
+
+// CatalogoBootstrap es el archivo (YAML o JSON) de regionales y sucursales
+// que carga "managerfact bootstrap catalogo" — ver doc/Bootstrap.md.
+type CatalogoBootstrap struct {
+	Regionales []RegionalBootstrap `json:"regionales" yaml:"regionales"`
+}
+
+type RegionalBootstrap struct {
+	Nombre     string              `json:"nombre" yaml:"nombre"`
+	Sucursales []SucursalBootstrap `json:"sucursales" yaml:"sucursales"`
+}
+
+type SucursalBootstrap struct {
+	CodigoSucursalSin int    `json:"codigo_sucursal_sin" yaml:"codigo_sucursal_sin"`
+	Nombre            string `json:"nombre" yaml:"nombre"`
+}
+
+// AdminBootstrap es el archivo del usuario administrador inicial que carga
+// "managerfact bootstrap admin". A diferencia de UsuarioService.Crear la
+// contraseña no es el CI: viene en el archivo (o en
+// BOOTSTRAP_ADMIN_PASSWORD, ver cmd/managerfact).
+type AdminBootstrap struct {
+	Nombre        string `json:"nombre" yaml:"nombre"`
+	CI            string `json:"ci" yaml:"ci"`
+	Cargo         string `json:"cargo" yaml:"cargo"`
+	CodigoUsuario string `json:"codigo_usuario" yaml:"codigo_usuario"`
+	Password      string `json:"password" yaml:"password"`
+}
+
+// ResultadoBootstrap cuenta lo que hizo un bootstrap; Detalle tiene una
+// línea por cada registro creado o actualizado.
+type ResultadoBootstrap struct {
+	Creados      int      `json:"creados"`
+	Actualizados int      `json:"actualizados"`
+	SinCambios   int      `json:"sin_cambios"`
+	Detalle      []string `json:"detalle"`
+}
+
+func (r *ResultadoBootstrap) registrar(resultado, descripcion string) {
+	switch resultado {
+	case repositories.CatalogoCreado:
+		r.Creados++
+		r.Detalle = append(r.Detalle, "creado: "+descripcion)
+	case repositories.CatalogoActualizado:
+		r.Actualizados++
+		r.Detalle = append(r.Detalle, "actualizado: "+descripcion)
+	default:
+		r.SinCambios++
+	}
+}
+
+// BootstrapService carga los datos iniciales desde archivos, en vez de
+// sembrarlos en el arranque del servidor. Es idempotente: correrlo de nuevo
+// con el mismo archivo no cambia nada.
+type BootstrapService struct {
+	catalogo *repositories.CatalogoRepository
+	usuarios *repositories.UsuarioRepository
+}
+
+func NewBootstrapService(catalogo *repositories.CatalogoRepository, usuarios *repositories.UsuarioRepository) *BootstrapService {
+	return &BootstrapService{catalogo: catalogo, usuarios: usuarios}
+}
+
+// validarCatalogo exige nombres y códigos SIN únicos en todo el archivo.
+func validarCatalogo(catalogo CatalogoBootstrap) error {
+	if len(catalogo.Regionales) == 0 {
+		return fmt.Errorf("el catálogo no tiene regionales")
+	}
+	regionales := map[string]bool{}
+	codigos := map[int]string{}
+	for _, regional := range catalogo.Regionales {
+		nombre := strings.TrimSpace(regional.Nombre)
+		if nombre == "" {
+			return fmt.Errorf("hay una regional sin nombre")
+		}
+		if regionales[nombre] {
+			return fmt.Errorf("la regional %s está repetida", nombre)
+		}
+		regionales[nombre] = true
+		for _, sucursal := range regional.Sucursales {
+			if strings.TrimSpace(sucursal.Nombre) == "" {
+				return fmt.Errorf("la sucursal %d (regional %s) no tiene nombre", sucursal.CodigoSucursalSin, nombre)
+			}
+			if sucursal.CodigoSucursalSin < 0 {
+				return fmt.Errorf("la sucursal %s tiene un código SIN negativo", sucursal.Nombre)
+			}
+			if otra, ok := codigos[sucursal.CodigoSucursalSin]; ok {
+				return fmt.Errorf("el código SIN %d está repetido (%s y %s)", sucursal.CodigoSucursalSin, otra, sucursal.Nombre)
+			}
+			codigos[sucursal.CodigoSucursalSin] = sucursal.Nombre
+		}
+	}
+	return nil
+}
+
+// Catalogo crea o corrige las regionales y sucursales del archivo en una
+// sola transacción. El archivo manda: una sucursal existente con otro
+// nombre o regional se actualiza, una eliminada se restaura. Las que no
+// están en el archivo no se tocan.
+func (s *BootstrapService) Catalogo(catalogo CatalogoBootstrap) (*ResultadoBootstrap, error) {
+	if err := validarCatalogo(catalogo); err != nil {
+		return nil, err
+	}
+
+	resultado := &ResultadoBootstrap{}
+	err := s.catalogo.Transaccion(func(repo *repositories.CatalogoRepository) error {
+		for _, r := range catalogo.Regionales {
+			nombreRegional := strings.TrimSpace(r.Nombre)
+			regional, estado, err := repo.AsegurarRegional(nombreRegional)
+			if err != nil {
+				return err
+			}
+			resultado.registrar(estado, "regional "+nombreRegional)
+
+			for _, sucursal := range r.Sucursales {
+				nombre := strings.TrimSpace(sucursal.Nombre)
+				estado, err := repo.AsegurarSucursal(sucursal.CodigoSucursalSin, nombre, regional.ID)
+				if err != nil {
+					return err
+				}
+				resultado.registrar(estado, fmt.Sprintf("sucursal %d %s (%s)", sucursal.CodigoSucursalSin, nombre, nombreRegional))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resultado, nil
+}
+
+// Admin crea el usuario administrador inicial (rol admin, acceso total) si
+// todavía no existe un usuario con ese código. Si ya existe no lo toca: no
+// se pisa la contraseña que el admin haya cambiado después.
+func (s *BootstrapService) Admin(admin AdminBootstrap) (*ResultadoBootstrap, error) {
+	admin.Nombre = strings.TrimSpace(admin.Nombre)
+	admin.CI = strings.TrimSpace(admin.CI)
+	admin.CodigoUsuario = strings.TrimSpace(admin.CodigoUsuario)
+	if admin.Nombre == "" || admin.CI == "" || admin.CodigoUsuario == "" {
+		return nil, fmt.Errorf("nombre, ci y codigo_usuario son requeridos")
+	}
+	// La contraseña la eligió quien corre el bootstrap: tiene que cumplir la
+	// política y no obliga a cambiarla.
+	if err := PoliticaPasswordDesdeEnv().Validar(admin.Password, admin.CI, admin.CodigoUsuario); err != nil {
+		return nil, err
+	}
+
+	resultado := &ResultadoBootstrap{}
+	existe, err := s.usuarios.ExisteCodigoUsuario(admin.CodigoUsuario)
+	if err != nil {
+		return nil, err
+	}
+	if existe {
+		resultado.registrar(repositories.CatalogoSinCambios, "usuario "+admin.CodigoUsuario)
+		return resultado, nil
+	}
+
+	passwordHash, err := hashPassword(admin.Password)
+	if err != nil {
+		return nil, err
+	}
+	usuario := &models.Usuario{
+		Nombre:        admin.Nombre,
+		CI:            admin.CI,
+		Cargo:         admin.Cargo,
+		CodigoUsuario: admin.CodigoUsuario,
+		PasswordHash:  passwordHash,
+		Rol:           models.RolAdmin,
+		AccesoTotal:   true,
+		IsActive:      true,
+	}
+	if err := s.usuarios.Create(usuario); err != nil {
+		return nil, err
+	}
+	resultado.registrar(repositories.CatalogoCreado, "usuario admin "+admin.CodigoUsuario)
+	return resultado, nil
+}
@@ -0,0 +1,268 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"managerfact/internal/domain/models"
+	"managerfact/internal/domain/repositories"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrCatalogoNoEncontrado: la regional o sucursal no existe (o está
+	// eliminada).
+	ErrCatalogoNoEncontrado = errors.New("registro del catálogo no encontrado")
+	// ErrCatalogoDuplicado: ya hay una regional con ese nombre o una
+	// sucursal con ese código SIN.
+	ErrCatalogoDuplicado = errors.New("ya existe en el catálogo")
+	// ErrRegionalConSucursales: no se elimina una regional que todavía
+	// tiene sucursales, hay que moverlas o eliminarlas antes.
+	ErrRegionalConSucursales = errors.New("la regional todavía tiene sucursales")
+)
+
+// CatalogoService administra regionales y sucursales_catalogo. Los accesos
+// de los usuarios apuntan al ID de la sucursal (usuario_sucursal_acceso),
+// así que renombrarla, moverla o cambiarle el código no los afecta;
+// eliminarla los borra en la misma transacción.
+type CatalogoService struct {
+	repo *repositories.CatalogoRepository
+}
+
+func NewCatalogoService(repo *repositories.CatalogoRepository) *CatalogoService {
+	return &CatalogoService{repo: repo}
+}
+
+// noEncontrado traduce el not found del repositorio a ErrCatalogoNoEncontrado.
+func noEncontrado(err error, descripcion string) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("%w: %s", ErrCatalogoNoEncontrado, descripcion)
+	}
+	return err
+}
+
+// CrearRegional crea la regional; si había una eliminada con el mismo nombre
+// la restaura.
+func (s *CatalogoService) CrearRegional(nombre string) (*models.Regional, error) {
+	nombre = strings.TrimSpace(nombre)
+	var regional *models.Regional
+	err := s.repo.Transaccion(func(repo *repositories.CatalogoRepository) error {
+		existente, err := repo.RegionalPorNombre(nombre)
+		if err != nil {
+			return err
+		}
+		if existente != nil && !existente.DeletedAt.Valid {
+			return fmt.Errorf("%w: regional %s", ErrCatalogoDuplicado, nombre)
+		}
+		regional = existente
+		if regional == nil {
+			regional = &models.Regional{Nombre: nombre}
+		}
+		regional.DeletedAt = gorm.DeletedAt{}
+		return repo.GuardarRegional(regional)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return regional, nil
+}
+
+func (s *CatalogoService) RenombrarRegional(id uint, nombre string) (*models.Regional, error) {
+	nombre = strings.TrimSpace(nombre)
+	var regional *models.Regional
+	err := s.repo.Transaccion(func(repo *repositories.CatalogoRepository) error {
+		var err error
+		regional, err = repo.RegionalPorID(id)
+		if err != nil {
+			return noEncontrado(err, fmt.Sprintf("regional %d", id))
+		}
+		existente, err := repo.RegionalPorNombre(nombre)
+		if err != nil {
+			return err
+		}
+		if existente != nil && existente.ID != id {
+			return fmt.Errorf("%w: regional %s%s", ErrCatalogoDuplicado, nombre, sufijoEliminada(existente.DeletedAt))
+		}
+		regional.Nombre = nombre
+		return repo.GuardarRegional(regional)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return regional, nil
+}
+
+// Regional devuelve la regional id, o ErrCatalogoNoEncontrado.
+func (s *CatalogoService) Regional(id uint) (*models.Regional, error) {
+	regional, err := s.repo.RegionalPorID(id)
+	if err != nil {
+		return nil, noEncontrado(err, fmt.Sprintf("regional %d", id))
+	}
+	return regional, nil
+}
+
+// Sucursal devuelve la sucursal id del catálogo, o ErrCatalogoNoEncontrado.
+func (s *CatalogoService) Sucursal(id uint) (*models.SucursalCatalogo, error) {
+	sucursal, err := s.repo.SucursalPorID(id)
+	if err != nil {
+		return nil, noEncontrado(err, fmt.Sprintf("sucursal %d", id))
+	}
+	return sucursal, nil
+}
+
+// EliminarRegional hace soft delete de una regional sin sucursales.
+func (s *CatalogoService) EliminarRegional(id uint) error {
+	return s.repo.Transaccion(func(repo *repositories.CatalogoRepository) error {
+		if _, err := repo.RegionalPorID(id); err != nil {
+			return noEncontrado(err, fmt.Sprintf("regional %d", id))
+		}
+		total, err := repo.ContarSucursalesDeRegional(id)
+		if err != nil {
+			return err
+		}
+		if total > 0 {
+			return fmt.Errorf("%w: tiene %d sucursales", ErrRegionalConSucursales, total)
+		}
+		return repo.EliminarRegional(id)
+	})
+}
+
+type SucursalCatalogoInput struct {
+	CodigoSucursalSin int
+	Nombre            string
+	RegionalID        uint
+}
+
+// ResultadoSucursalCatalogo es la sucursal guardada y cuántos usuarios
+// cambiaron sus accesos por eso.
+type ResultadoSucursalCatalogo struct {
+	Sucursal             *models.SucursalCatalogo `json:"sucursal,omitempty"`
+	UsuariosActualizados int                      `json:"usuarios_actualizados"`
+}
+
+// CrearSucursal da de alta una sucursal; si había una eliminada con el
+// mismo código SIN la restaura con los datos nuevos (el índice único del
+// código incluye las eliminadas).
+func (s *CatalogoService) CrearSucursal(input SucursalCatalogoInput) (*ResultadoSucursalCatalogo, error) {
+	var resultado *ResultadoSucursalCatalogo
+	err := s.repo.Transaccion(func(repo *repositories.CatalogoRepository) error {
+		var err error
+		resultado, err = crearSucursal(repo, input)
+		return err
+	})
+	return resultado, err
+}
+
+// ActualizarSucursal renombra, mueve de regional y/o cambia el código SIN
+// de la sucursal. Si cambia el código, los usuarios que tenían acceso al
+// viejo pasan a tenerlo al nuevo.
+func (s *CatalogoService) ActualizarSucursal(id uint, input SucursalCatalogoInput) (*ResultadoSucursalCatalogo, error) {
+	var resultado *ResultadoSucursalCatalogo
+	err := s.repo.Transaccion(func(repo *repositories.CatalogoRepository) error {
+		var err error
+		resultado, err = actualizarSucursal(repo, id, input)
+		return err
+	})
+	return resultado, err
+}
+
+// EliminarSucursal hace soft delete de la sucursal y la quita de los
+// accesos de los usuarios: si más adelante se restaura, nadie recupera el
+// acceso sin que se lo vuelvan a dar.
+func (s *CatalogoService) EliminarSucursal(id uint) (*ResultadoSucursalCatalogo, error) {
+	var resultado *ResultadoSucursalCatalogo
+	err := s.repo.Transaccion(func(repo *repositories.CatalogoRepository) error {
+		var err error
+		resultado, err = eliminarSucursal(repo, id)
+		return err
+	})
+	return resultado, err
+}
+
+// crearSucursal, actualizarSucursal y eliminarSucursal trabajan sobre el
+// repo de una transacción abierta; también las usa la sincronización con
+// SFE_SUCURSAL para aplicar varios cambios juntos.
+func crearSucursal(repo *repositories.CatalogoRepository, input SucursalCatalogoInput) (*ResultadoSucursalCatalogo, error) {
+	input.Nombre = strings.TrimSpace(input.Nombre)
+	if _, err := repo.RegionalPorID(input.RegionalID); err != nil {
+		return nil, noEncontrado(err, fmt.Sprintf("regional %d", input.RegionalID))
+	}
+	sucursal, err := repo.SucursalPorCodigo(input.CodigoSucursalSin)
+	if err != nil {
+		return nil, err
+	}
+	if sucursal != nil && !sucursal.DeletedAt.Valid {
+		return nil, fmt.Errorf("%w: sucursal con código SIN %d (%s)", ErrCatalogoDuplicado, input.CodigoSucursalSin, sucursal.Nombre)
+	}
+	if sucursal == nil {
+		sucursal = &models.SucursalCatalogo{CodigoSucursalSin: input.CodigoSucursalSin}
+	}
+	sucursal.Nombre = input.Nombre
+	sucursal.RegionalID = input.RegionalID
+	sucursal.DeletedAt = gorm.DeletedAt{}
+	if err := repo.GuardarSucursal(sucursal); err != nil {
+		return nil, err
+	}
+	guardada, err := repo.SucursalPorID(sucursal.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &ResultadoSucursalCatalogo{Sucursal: guardada}, nil
+}
+
+func actualizarSucursal(repo *repositories.CatalogoRepository, id uint, input SucursalCatalogoInput) (*ResultadoSucursalCatalogo, error) {
+	input.Nombre = strings.TrimSpace(input.Nombre)
+	sucursal, err := repo.SucursalPorID(id)
+	if err != nil {
+		return nil, noEncontrado(err, fmt.Sprintf("sucursal %d", id))
+	}
+	if _, err := repo.RegionalPorID(input.RegionalID); err != nil {
+		return nil, noEncontrado(err, fmt.Sprintf("regional %d", input.RegionalID))
+	}
+
+	codigoViejo := sucursal.CodigoSucursalSin
+	if input.CodigoSucursalSin != codigoViejo {
+		otra, err := repo.SucursalPorCodigo(input.CodigoSucursalSin)
+		if err != nil {
+			return nil, err
+		}
+		if otra != nil {
+			return nil, fmt.Errorf("%w: sucursal con código SIN %d (%s%s)", ErrCatalogoDuplicado, input.CodigoSucursalSin, otra.Nombre, sufijoEliminada(otra.DeletedAt))
+		}
+	}
+
+	sucursal.CodigoSucursalSin = input.CodigoSucursalSin
+	sucursal.Nombre = input.Nombre
+	sucursal.RegionalID = input.RegionalID
+	if err := repo.GuardarSucursal(sucursal); err != nil {
+		return nil, err
+	}
+	resultado := &ResultadoSucursalCatalogo{}
+	resultado.Sucursal, err = repo.SucursalPorID(id)
+	if err != nil {
+		return nil, err
+	}
+	return resultado, nil
+}
+
+func eliminarSucursal(repo *repositories.CatalogoRepository, id uint) (*ResultadoSucursalCatalogo, error) {
+	if _, err := repo.SucursalPorID(id); err != nil {
+		return nil, noEncontrado(err, fmt.Sprintf("sucursal %d", id))
+	}
+	if err := repo.EliminarSucursal(id); err != nil {
+		return nil, err
+	}
+	actualizados, err := repo.QuitarAccesosSucursal(id)
+	if err != nil {
+		return nil, err
+	}
+	return &ResultadoSucursalCatalogo{UsuariosActualizados: actualizados}, nil
+}
+
+func sufijoEliminada(deletedAt gorm.DeletedAt) string {
+	if deletedAt.Valid {
+		return ", eliminada"
+	}
+	return ""
+}
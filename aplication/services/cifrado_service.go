@@ -0,0 +1,284 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"managerfact/internal/domain/repositories"
+	"managerfact/pkg/utils"
+	"sync"
+	"time"
+)
+
+// Estados de EstadoRecifrado.
+const (
+	EstadoRecifradoSinEjecutar = "sin_ejecutar"
+	EstadoRecifradoProcesando  = "procesando"
+	EstadoRecifradoListo       = "listo"
+	EstadoRecifradoError       = "error"
+)
+
+// ErrRecifradoEnCurso se devuelve al pedir un recifrado mientras otro
+// todavía corre.
+var ErrRecifradoEnCurso = errors.New("ya hay un recifrado en curso")
+
+// máximo de errores que se guardan en EstadoRecifrado.Errores (el resto
+// solo suma al contador).
+const maxErroresRecifrado = 50
+
+// EstadoRecifrado es el progreso de la última ejecución de
+// CifradoService.Recifrar.
+type EstadoRecifrado struct {
+	Estado      string     `json:"estado"`
+	ClaveActual string     `json:"clave_actual,omitempty"`
+	Total       int        `json:"total"`
+	Procesados  int        `json:"procesados"`
+	Recifrados  int        `json:"recifrados"`
+	ConError    int        `json:"con_error"`
+	Conflictos  int        `json:"conflictos"`
+	Errores     []string   `json:"errores,omitempty"`
+	IniciadoEn  *time.Time `json:"iniciado_en,omitempty"`
+	TerminadoEn *time.Time `json:"terminado_en,omitempty"`
+}
+
+// InventarioClaves cuenta los secretos guardados por id de clave
+// ("sin_prefijo": cifrados antes de la rotación; "en_claro": contraseñas de
+// conexiones todavía sin cifrar). Una clave vieja se puede quitar de
+// FACTURADOR_TOKEN_KEYS cuando ya no aparece acá.
+type InventarioClaves struct {
+	ClavesCargadas   []string       `json:"claves_cargadas"`
+	ClaveActual      string         `json:"clave_actual"`
+	SecretosPorClave map[string]int `json:"secretos_por_clave"`
+}
+
+// errSecretoModificado indica que el secreto cambió en la base entre la
+// lectura y la escritura del recifrado (una edición concurrente); el valor
+// nuevo no se guarda y la edición se respeta.
+var errSecretoModificado = errors.New("el secreto fue modificado durante el recifrado")
+
+// secretoGuardado es un valor cifrado de la base junto con cómo
+// reemplazarlo. guardar solo escribe si la base todavía tiene el valor
+// anterior y devuelve false si no.
+type secretoGuardado struct {
+	descripcion string
+	valor       string
+	enClaro     bool
+	guardar     func(anterior, nuevo string) (bool, error)
+}
+
+// CifradoService rota la clave de los secretos cifrados con utils.Encrypt:
+// el token de cada sucursal facturador, la contraseña de cada
+// db_connection y el secreto TOTP de cada usuario. Recifrar corre en segundo plano (una ejecución a la vez) y
+// su progreso se consulta con Estado.
+type CifradoService struct {
+	sucursales *repositories.SucursalFacturadorRepository
+	conexiones repositories.DbConnectionRepository
+	usuarios   *repositories.UsuarioRepository
+
+	mu     sync.Mutex
+	estado EstadoRecifrado
+}
+
+func NewCifradoService(sucursales *repositories.SucursalFacturadorRepository, conexiones repositories.DbConnectionRepository, usuarios *repositories.UsuarioRepository) *CifradoService {
+	return &CifradoService{
+		sucursales: sucursales,
+		conexiones: conexiones,
+		usuarios:   usuarios,
+		estado:     EstadoRecifrado{Estado: EstadoRecifradoSinEjecutar},
+	}
+}
+
+func (s *CifradoService) secretos() ([]secretoGuardado, error) {
+	var secretos []secretoGuardado
+
+	sucursales, err := s.sucursales.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, sucursal := range sucursales {
+		if sucursal.TokenAcceso == "" {
+			continue
+		}
+		id := sucursal.ID
+		secretos = append(secretos, secretoGuardado{
+			descripcion: fmt.Sprintf("token de sucursal facturador '%s' (ID %d)", sucursal.Nombre, id),
+			valor:       sucursal.TokenAcceso,
+			guardar: func(anterior, nuevo string) (bool, error) {
+				return s.sucursales.ActualizarTokenAcceso(id, anterior, nuevo)
+			},
+		})
+	}
+
+	conexiones, err := s.conexiones.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, conexion := range conexiones {
+		id := conexion.ID
+		secretos = append(secretos, secretoGuardado{
+			descripcion: fmt.Sprintf("contraseña de conexión '%s' (ID %d)", conexion.ServerName, id),
+			valor:       conexion.Password,
+			enClaro:     !conexion.PasswordCifrado,
+			guardar: func(anterior, nuevo string) (bool, error) {
+				return s.conexiones.UpdatePassword(id, anterior, nuevo)
+			},
+		})
+	}
+
+	usuarios, err := s.usuarios.ConSecretoTotp()
+	if err != nil {
+		return nil, err
+	}
+	for _, usuario := range usuarios {
+		id := usuario.ID
+		secretos = append(secretos, secretoGuardado{
+			descripcion: fmt.Sprintf("secreto TOTP del usuario '%s' (ID %d)", usuario.CodigoUsuario, id),
+			valor:       usuario.TotpSecreto,
+			guardar: func(anterior, nuevo string) (bool, error) {
+				return s.usuarios.ActualizarSecretoTotp(id, anterior, nuevo)
+			},
+		})
+	}
+	return secretos, nil
+}
+
+// Inventario cuenta los secretos guardados por clave.
+func (s *CifradoService) Inventario() (*InventarioClaves, error) {
+	ids, err := utils.IDsClavesCifrado()
+	if err != nil {
+		return nil, err
+	}
+	secretos, err := s.secretos()
+	if err != nil {
+		return nil, err
+	}
+
+	inventario := &InventarioClaves{
+		ClavesCargadas:   ids,
+		ClaveActual:      ids[0],
+		SecretosPorClave: map[string]int{},
+	}
+	for _, secreto := range secretos {
+		clave := utils.IDClaveDe(secreto.valor)
+		switch {
+		case secreto.enClaro:
+			clave = "en_claro"
+		case clave == "":
+			clave = "sin_prefijo"
+		}
+		inventario.SecretosPorClave[clave]++
+	}
+	return inventario, nil
+}
+
+// Estado devuelve el progreso del último recifrado.
+func (s *CifradoService) Estado() EstadoRecifrado {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	copia := s.estado
+	copia.Errores = append([]string(nil), s.estado.Errores...)
+	return copia
+}
+
+// Recifrar arranca en segundo plano el recifrado de todos los secretos con
+// la clave actual (la primera de FACTURADOR_TOKEN_KEYS) y devuelve el
+// estado inicial. Los que ya están con la clave actual se saltean; un
+// secreto que no se puede descifrar (su clave ya no está cargada) queda
+// como error y no se toca; uno que se editó mientras corría el recifrado
+// cuenta como conflicto y conserva la edición.
+func (s *CifradoService) Recifrar() (EstadoRecifrado, error) {
+	ids, err := utils.IDsClavesCifrado()
+	if err != nil {
+		return EstadoRecifrado{}, err
+	}
+
+	s.mu.Lock()
+	if s.estado.Estado == EstadoRecifradoProcesando {
+		s.mu.Unlock()
+		return EstadoRecifrado{}, ErrRecifradoEnCurso
+	}
+	ahora := time.Now()
+	s.estado = EstadoRecifrado{Estado: EstadoRecifradoProcesando, ClaveActual: ids[0], IniciadoEn: &ahora}
+	s.mu.Unlock()
+
+	secretos, err := s.secretos()
+	if err != nil {
+		s.terminar(err)
+		return s.Estado(), err
+	}
+	s.actualizar(func(e *EstadoRecifrado) { e.Total = len(secretos) })
+
+	go s.ejecutar(secretos)
+	return s.Estado(), nil
+}
+
+func (s *CifradoService) ejecutar(secretos []secretoGuardado) {
+	for _, secreto := range secretos {
+		cambiado, err := recifrarSecreto(secreto)
+		s.actualizar(func(e *EstadoRecifrado) {
+			e.Procesados++
+			if errors.Is(err, errSecretoModificado) {
+				e.Conflictos++
+				return
+			}
+			if err != nil {
+				e.ConError++
+				if len(e.Errores) < maxErroresRecifrado {
+					e.Errores = append(e.Errores, secreto.descripcion+": "+err.Error())
+				}
+				return
+			}
+			if cambiado {
+				e.Recifrados++
+			}
+		})
+	}
+
+	estado := s.Estado()
+	log.Printf("[Cifrado] recifrado con clave '%s' terminado: %d recifrados, %d con error, %d modificados durante el recifrado, de %d",
+		estado.ClaveActual, estado.Recifrados, estado.ConError, estado.Conflictos, estado.Total)
+	s.terminar(nil)
+}
+
+func recifrarSecreto(secreto secretoGuardado) (bool, error) {
+	var nuevo string
+	if secreto.enClaro {
+		cifrado, err := utils.Encrypt(secreto.valor)
+		if err != nil {
+			return false, err
+		}
+		nuevo = cifrado
+	} else {
+		recifrado, cambiado, err := utils.Recifrar(secreto.valor)
+		if err != nil || !cambiado {
+			return false, err
+		}
+		nuevo = recifrado
+	}
+	guardado, err := secreto.guardar(secreto.valor, nuevo)
+	if err != nil {
+		return false, err
+	}
+	if !guardado {
+		return false, errSecretoModificado
+	}
+	return true, nil
+}
+
+func (s *CifradoService) actualizar(cambio func(e *EstadoRecifrado)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cambio(&s.estado)
+}
+
+func (s *CifradoService) terminar(err error) {
+	ahora := time.Now()
+	s.actualizar(func(e *EstadoRecifrado) {
+		e.TerminadoEn = &ahora
+		e.Estado = EstadoRecifradoListo
+		if err != nil {
+			e.Estado = EstadoRecifradoError
+			e.Errores = append(e.Errores, err.Error())
+		}
+	})
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"managerfact/pkg/utils"
+	"testing"
+)
+
+// tablaSecreto simula la columna de un secreto: guardar solo escribe si
+// todavía tiene el valor anterior, como los UPDATE condicionales de los
+// repositorios.
+type tablaSecreto struct{ valor string }
+
+func (t *tablaSecreto) guardar(anterior, nuevo string) (bool, error) {
+	if t.valor != anterior {
+		return false, nil
+	}
+	t.valor = nuevo
+	return true, nil
+}
+
+func TestEjecutarRecifradoRespetaEdicionesConcurrentes(t *testing.T) {
+	t.Setenv("FACTURADOR_TOKEN_KEYS", "v1=frase vieja")
+	viejo, err := utils.Encrypt("token")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	t.Setenv("FACTURADOR_TOKEN_KEYS", "v2=frase nueva,v1=frase vieja")
+	editado, err := utils.Encrypt("token editado")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	intacto := &tablaSecreto{valor: viejo}
+	// el admin cambió el token después de que el recifrado leyó viejo
+	concurrente := &tablaSecreto{valor: editado}
+
+	s := &CifradoService{estado: EstadoRecifrado{Estado: EstadoRecifradoProcesando}}
+	s.ejecutar([]secretoGuardado{
+		{descripcion: "intacto", valor: viejo, guardar: intacto.guardar},
+		{descripcion: "concurrente", valor: viejo, guardar: concurrente.guardar},
+	})
+
+	estado := s.Estado()
+	if estado.Recifrados != 1 || estado.Conflictos != 1 || estado.ConError != 0 {
+		t.Errorf("recifrados=%d conflictos=%d con_error=%d, se esperaba 1/1/0",
+			estado.Recifrados, estado.Conflictos, estado.ConError)
+	}
+	if utils.IDClaveDe(intacto.valor) != "v2" {
+		t.Errorf("el secreto intacto no se recifró: %q", intacto.valor)
+	}
+	if concurrente.valor != editado {
+		t.Error("el recifrado pisó la edición concurrente")
+	}
+}
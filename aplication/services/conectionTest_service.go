@@ -2,12 +2,8 @@ package services
 
 import (
 	"context"
-	"database/sql"
-	"fmt"
 	"managerfact/internal/domain/models"
 	"time"
-
-	_ "github.com/microsoft/go-mssqldb"
 )
 
 // TestConnectionResult resultado simple de prueba
@@ -23,18 +19,18 @@ func TestConnection(config *models.DbConnection) *TestConnectionResult {
 	start := time.Now()
 	result := &TestConnectionResult{Success: false}
 
-	// Construir connection string
-	connString := fmt.Sprintf(
-		"server=%s;port=%d;database=%s;user id=%s;password=%s;encrypt=false;connection timeout=10",
-		config.Host, config.Port, config.DatabaseName, config.Username, config.Password,
-	)
+	if _, err := completarDriver(config); err != nil {
+		result.Message = "Driver de base de datos no soportado"
+		result.Error = err.Error()
+		return result
+	}
 
 	// Crear contexto con timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	// Intentar conexión
-	db, err := sql.Open("mssql", connString)
+	db, err := abrirSQL(config)
 	if err != nil {
 		result.Message = "Error abriendo conexión"
 		result.Error = err.Error()
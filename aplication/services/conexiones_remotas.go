@@ -0,0 +1,258 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"managerfact/internal/domain/models"
+	"managerfact/internal/domain/repositories"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ConexionesRemotas mantiene un pool (*sql.DB, vía gorm) abierto por cada
+// DbConnection usada por ConsultasService, en vez de abrir, hacer ping y
+// cerrar una conexión nueva contra el servidor remoto (con el dialector de
+// su Driver) en cada request HTTP. El pool se crea la primera vez que se pide un
+// DbConnection.ID y se reutiliza hasta que DbConnectionService lo invalida
+// (al actualizar o eliminar esa conexión), de modo que un cambio de
+// host/usuario/contraseña aplica en la siguiente consulta.
+type ConexionesRemotas struct {
+	repo     repositories.DbConnectionRepository
+	mu       sync.Mutex
+	pools    map[uint]*conexionRemota
+	abriendo map[uint]*aperturaPool
+}
+
+// aperturaPool es una apertura en curso de un pool: los demás requests por
+// el mismo id esperan listo en vez de abrir otro.
+type aperturaPool struct {
+	listo chan struct{}
+	err   error
+}
+
+type conexionRemota struct {
+	db        *gorm.DB
+	sqlDB     *sql.DB
+	servidor  models.DbConnection
+	creadoEn  time.Time
+	ultimoUso time.Time
+}
+
+func NewConexionesRemotas(repo repositories.DbConnectionRepository) *ConexionesRemotas {
+	return &ConexionesRemotas{
+		repo:     repo,
+		pools:    map[uint]*conexionRemota{},
+		abriendo: map[uint]*aperturaPool{},
+	}
+}
+
+// enteroEnv lee una variable de entorno entera, con valor por defecto si no
+// está definida o no es un número positivo.
+func enteroEnv(clave string, porDefecto int) int {
+	valor, err := strconv.Atoi(strings.TrimSpace(os.Getenv(clave)))
+	if err != nil || valor <= 0 {
+		return porDefecto
+	}
+	return valor
+}
+
+// Obtener devuelve el pool de la DbConnection id (creándolo si todavía no
+// existe) junto con la configuración con la que se abrió. El pool se abre
+// fuera de m.mu: un servidor que no responde solo demora a quienes piden
+// ese mismo id (que esperan la misma apertura), no al resto de las
+// consultas ni a /connections/stats.
+func (m *ConexionesRemotas) Obtener(id uint) (*gorm.DB, *models.DbConnection, error) {
+	for {
+		m.mu.Lock()
+		if conexion, ok := m.pools[id]; ok {
+			conexion.ultimoUso = time.Now()
+			servidor := conexion.servidor
+			m.mu.Unlock()
+			return conexion.db, &servidor, nil
+		}
+		apertura, enCurso := m.abriendo[id]
+		if !enCurso {
+			apertura = &aperturaPool{listo: make(chan struct{})}
+			m.abriendo[id] = apertura
+		}
+		m.mu.Unlock()
+
+		if enCurso {
+			// otro request ya la está abriendo: se espera su resultado y se
+			// vuelve a mirar m.pools (pudo invalidarse entretanto)
+			<-apertura.listo
+			if apertura.err != nil {
+				return nil, nil, apertura.err
+			}
+			continue
+		}
+
+		conexion, err := m.abrir(id)
+		m.mu.Lock()
+		// si Invalidar corrió durante la apertura, este pool ya nació con
+		// la configuración vieja: no se guarda
+		vigente := m.abriendo[id] == apertura
+		if vigente {
+			delete(m.abriendo, id)
+			if err == nil {
+				m.pools[id] = conexion
+			}
+		}
+		m.mu.Unlock()
+		apertura.err = err
+		close(apertura.listo)
+
+		if err != nil {
+			return nil, nil, err
+		}
+		if !vigente {
+			conexion.sqlDB.Close()
+			continue
+		}
+		log.Printf("[ConexionesRemotas] pool abierto para conexión %d (%s)", id, conexion.servidor.ServerName)
+		servidor := conexion.servidor
+		return conexion.db, &servidor, nil
+	}
+}
+
+// abrir crea el pool de la DbConnection id y verifica que el servidor
+// responda, con CONN_PING_TIMEOUT_SEGUNDOS como límite. No toca m.mu.
+func (m *ConexionesRemotas) abrir(id uint) (*conexionRemota, error) {
+	servidor, err := m.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	driver, dsn, err := dsnConexion(servidor)
+	if err != nil {
+		return nil, err
+	}
+	// el ping automático de gorm.Open no tiene timeout propio: se hace
+	// abajo con PingContext
+	db, err := gorm.Open(driver.Dialector(dsn), &gorm.Config{DisableAutomaticPing: true})
+	if err != nil {
+		return nil, fmt.Errorf("no se pudo conectar: %w", err)
+	}
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, err
+	}
+
+	// Límites del pool desde .env (ver .env.example), iguales para todas
+	// las conexiones remotas.
+	sqlDB.SetMaxOpenConns(enteroEnv("MAX_OPEN_CONNS", 10))
+	sqlDB.SetMaxIdleConns(enteroEnv("MAX_IDLE_CONNS", 5))
+	sqlDB.SetConnMaxLifetime(time.Duration(enteroEnv("CONN_MAX_LIFETIME_MINUTES", 30)) * time.Minute)
+	sqlDB.SetConnMaxIdleTime(time.Duration(enteroEnv("CONN_MAX_IDLE_TIME_MINUTES", 10)) * time.Minute)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(enteroEnv("CONN_PING_TIMEOUT_SEGUNDOS", 15))*time.Second)
+	defer cancel()
+	if err := sqlDB.PingContext(ctx); err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("error de conectividad: %w", err)
+	}
+
+	ahora := time.Now()
+	return &conexionRemota{db: db, sqlDB: sqlDB, servidor: *servidor, creadoEn: ahora, ultimoUso: ahora}, nil
+}
+
+// Configuracion devuelve la DbConnection id tal como está guardada, sin
+// abrir ni tocar su pool.
+func (m *ConexionesRemotas) Configuracion(id uint) (*models.DbConnection, error) {
+	return m.repo.GetByID(id)
+}
+
+// Activas lista las DbConnection activas cuyo Type es alguno de tipos
+// (comparación exacta sin distinguir mayúsculas; GetAllActiveByType usa
+// LIKE y "duas" también traería "duas_local").
+func (m *ConexionesRemotas) Activas(tipos ...string) ([]models.DbConnection, error) {
+	todas, err := m.repo.GetAllActive()
+	if err != nil {
+		return nil, err
+	}
+	var activas []models.DbConnection
+	for _, conexion := range todas {
+		for _, tipo := range tipos {
+			if strings.EqualFold(strings.TrimSpace(conexion.Type), tipo) {
+				activas = append(activas, conexion)
+				break
+			}
+		}
+	}
+	return activas, nil
+}
+
+// Invalidar cierra y descarta el pool de la DbConnection id, si existía. Lo
+// llama DbConnectionService al actualizar o eliminar la conexión.
+func (m *ConexionesRemotas) Invalidar(id uint) {
+	m.mu.Lock()
+	conexion, ok := m.pools[id]
+	delete(m.pools, id)
+	// una apertura en curso queda descartada (ver Obtener)
+	delete(m.abriendo, id)
+	m.mu.Unlock()
+
+	if !ok {
+		return
+	}
+	if err := conexion.sqlDB.Close(); err != nil {
+		log.Printf("[ConexionesRemotas] error cerrando pool de conexión %d: %v", id, err)
+		return
+	}
+	log.Printf("[ConexionesRemotas] pool de conexión %d invalidado", id)
+}
+
+// EstadisticasPool es el estado de un pool abierto, expuesto en
+// /connections/stats.
+type EstadisticasPool struct {
+	ConnectionID      uint      `json:"connection_id"`
+	ServerName        string    `json:"server_name"`
+	OpenConnections   int       `json:"open_connections"`
+	InUse             int       `json:"in_use"`
+	Idle              int       `json:"idle"`
+	MaxOpenConns      int       `json:"max_open_connections"`
+	WaitCount         int64     `json:"wait_count"`
+	WaitDurationMs    int64     `json:"wait_duration_ms"`
+	MaxIdleClosed     int64     `json:"max_idle_closed"`
+	MaxIdleTimeClosed int64     `json:"max_idle_time_closed"`
+	MaxLifetimeClosed int64     `json:"max_lifetime_closed"`
+	CreadoEn          time.Time `json:"creado_en"`
+	UltimoUso         time.Time `json:"ultimo_uso"`
+}
+
+// Estadisticas lista el estado de todos los pools abiertos, ordenados por
+// ID de conexión.
+func (m *ConexionesRemotas) Estadisticas() []EstadisticasPool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	estadisticas := make([]EstadisticasPool, 0, len(m.pools))
+	for id, conexion := range m.pools {
+		stats := conexion.sqlDB.Stats()
+		estadisticas = append(estadisticas, EstadisticasPool{
+			ConnectionID:      id,
+			ServerName:        conexion.servidor.ServerName,
+			OpenConnections:   stats.OpenConnections,
+			InUse:             stats.InUse,
+			Idle:              stats.Idle,
+			MaxOpenConns:      stats.MaxOpenConnections,
+			WaitCount:         stats.WaitCount,
+			WaitDurationMs:    stats.WaitDuration.Milliseconds(),
+			MaxIdleClosed:     stats.MaxIdleClosed,
+			MaxIdleTimeClosed: stats.MaxIdleTimeClosed,
+			MaxLifetimeClosed: stats.MaxLifetimeClosed,
+			CreadoEn:          conexion.creadoEn,
+			UltimoUso:         conexion.ultimoUso,
+		})
+	}
+	sort.Slice(estadisticas, func(i, j int) bool { return estadisticas[i].ConnectionID < estadisticas[j].ConnectionID })
+	return estadisticas
+}
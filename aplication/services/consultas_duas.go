@@ -0,0 +1,98 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"managerfact/internal/domain/models"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrSinServidoresDuas se devuelve cuando el usuario no tiene acceso a
+// ninguna conexión DUAS activa.
+var ErrSinServidoresDuas = errors.New("no hay servidores DUAS activos a los que tenga acceso")
+
+// BuscarDuasTodos ejecuta BuscarDuas en paralelo sobre todas las
+// DbConnection activas de tipo DUAS (models.TiposConexionDuas) que
+// permitido acepte (el handler filtra por los accesos del usuario), como
+// máximo DUAS_MAX_PARALELO a la vez. Cada servidor corre con su propio
+// QueryTimeout; uno caído o lento no tumba la búsqueda: su error queda en
+// Servidores y se devuelven los resultados de los demás.
+func (s *ConsultasService) BuscarDuasTodos(ctx context.Context, params models.DuasBusquedaParams, permitido func(*models.DbConnection) bool) (*models.DuasResultadoGlobal, error) {
+	activas, err := s.conexiones.Activas(models.TiposConexionDuas...)
+	if err != nil {
+		return nil, err
+	}
+	var servidores []models.DbConnection
+	for i := range activas {
+		if permitido(&activas[i]) {
+			servidores = append(servidores, activas[i])
+		}
+	}
+	if len(servidores) == 0 {
+		return nil, ErrSinServidoresDuas
+	}
+
+	parciales := make([]*models.DuasResultado, len(servidores))
+	estados := make([]models.DuasEstadoServidor, len(servidores))
+	semaforo := make(chan struct{}, enteroEnv("DUAS_MAX_PARALELO", 4))
+
+	var wg sync.WaitGroup
+	for i, servidor := range servidores {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			estado := models.DuasEstadoServidor{IDServidor: servidor.ID, Servidor: servidor.ServerName, Tipo: servidor.Type}
+			defer func() { estados[i] = estado }()
+
+			select {
+			case semaforo <- struct{}{}:
+				defer func() { <-semaforo }()
+			case <-ctx.Done():
+				estado.Error = ctx.Err().Error()
+				estado.Timeout = true
+				return
+			}
+
+			inicio := time.Now()
+			resultado, err := s.BuscarDuas(ctx, strconv.FormatUint(uint64(servidor.ID), 10), params)
+			estado.DuracionMs = time.Since(inicio).Milliseconds()
+			if err != nil {
+				estado.Error = err.Error()
+				estado.Timeout = errors.Is(err, ErrConsultaTimeout)
+				return
+			}
+			estado.Resultados = len(resultado.ResultadosCentral) + len(resultado.ResultadosLocal)
+			parciales[i] = resultado
+		}()
+	}
+	wg.Wait()
+
+	global := &models.DuasResultadoGlobal{
+		DuasResultado: models.DuasResultado{
+			ResultadosLocal:   []models.DuasResultadoLocal{},
+			ResultadosCentral: []models.DuasResultadoCentral{},
+		},
+		Servidores: estados,
+	}
+	for _, parcial := range parciales {
+		if parcial == nil {
+			continue
+		}
+		global.ResultadosCentral = append(global.ResultadosCentral, parcial.ResultadosCentral...)
+		global.ResultadosLocal = append(global.ResultadosLocal, parcial.ResultadosLocal...)
+	}
+	return global, nil
+}
+
+// ServidoresConError indica cuántos servidores de la búsqueda fallaron.
+func ServidoresConError(resultado *models.DuasResultadoGlobal) int {
+	fallidos := 0
+	for _, estado := range resultado.Servidores {
+		if estado.Error != "" {
+			fallidos++
+		}
+	}
+	return fallidos
+}
@@ -0,0 +1,294 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"managerfact/internal/domain/models"
+	"strings"
+	"time"
+)
+
+// ArchivoExportado es una exportación generada dentro del mismo request,
+// lista para enviarse como adjunto.
+type ArchivoExportado struct {
+	NombreArchivo string
+	ContentType   string
+	Contenido     []byte
+}
+
+// columnasFacturas son las columnas exportadas del reporte de facturación
+// (un subconjunto de SFEReporteFacturador, ver filaFactura). Solo se
+// totalizan cantidad y subtotal: monto_total es del documento y se repite en
+// cada línea de detalle, sumarlo lo duplicaría.
+var columnasFacturas = []ColumnaExportacion{
+	{Titulo: "Fecha registro", Tipo: ColumnaFecha, Ancho: 9},
+	{Titulo: "Fecha emisión", Tipo: ColumnaFecha, Ancho: 9},
+	{Titulo: "Nro. factura", Tipo: ColumnaTexto, Ancho: 6},
+	{Titulo: "Código integración", Tipo: ColumnaTexto, Ancho: 10},
+	{Titulo: "CUF", Tipo: ColumnaTexto, Ancho: 14},
+	{Titulo: "Sucursal", Tipo: ColumnaTexto, Ancho: 10},
+	{Titulo: "Cód. sucursal SIN", Tipo: ColumnaTexto, Ancho: 5},
+	{Titulo: "Tipo emisión", Tipo: ColumnaEntero, Ancho: 4},
+	{Titulo: "Estado", Tipo: ColumnaTexto, Ancho: 7},
+	{Titulo: "NIT/CI", Tipo: ColumnaTexto, Ancho: 7},
+	{Titulo: "Razón social", Tipo: ColumnaTexto, Ancho: 12},
+	{Titulo: "Cód. producto", Tipo: ColumnaTexto, Ancho: 6},
+	{Titulo: "Descripción", Tipo: ColumnaTexto, Ancho: 14},
+	{Titulo: "Cantidad", Tipo: ColumnaDecimal, Totalizar: true, Ancho: 5},
+	{Titulo: "Subtotal", Tipo: ColumnaDecimal, Totalizar: true, Ancho: 7},
+	{Titulo: "Monto total documento", Tipo: ColumnaDecimal, Ancho: 7},
+	{Titulo: "Usuario emisión", Tipo: ColumnaTexto, Ancho: 7},
+}
+
+func filaFactura(f *models.SFEReporteFacturador) []any {
+	return []any{
+		f.CreatedDate,
+		f.FechaEmision,
+		f.NumeroFactura,
+		f.CodigoIntegracion,
+		f.CUF,
+		f.NombreSucursal,
+		f.CodigoSucursalSin,
+		f.TipoEmision,
+		f.EstadoDocumentoFiscal,
+		f.NumeroDocumento,
+		f.NombreRazonSocial,
+		f.CodigoProductoSfe,
+		f.Descripcion,
+		f.Cantidad,
+		f.SubTotal,
+		f.MontoTotal,
+		f.UsuarioEmision,
+	}
+}
+
+// agregarFiltro suma al encabezado el filtro nombre solo si vino con valor.
+func agregarFiltro(filtros []FiltroAplicado, nombre, valor string) []FiltroAplicado {
+	if strings.TrimSpace(valor) == "" {
+		return filtros
+	}
+	return append(filtros, FiltroAplicado{Nombre: nombre, Valor: valor})
+}
+
+func reporteFacturas(data models.Json_consulta_data, generadoPor string) *ReporteExportacion {
+	var filtros []FiltroAplicado
+	filtros = agregarFiltro(filtros, "Servidor", data.IdFacturador)
+	filtros = agregarFiltro(filtros, "Fecha desde", data.FechaDesde)
+	filtros = agregarFiltro(filtros, "Fecha hasta", data.FechaHasta)
+	filtros = agregarFiltro(filtros, "Nro. factura", data.NumeroFactura)
+	filtros = agregarFiltro(filtros, "NIT/CI", data.NumeroDocumento)
+	filtros = agregarFiltro(filtros, "Códigos de producto", strings.Join(data.CodigoProducto, ", "))
+	filtros = agregarFiltro(filtros, "Sucursal", data.Sucursal)
+	filtros = agregarFiltro(filtros, "Código integración", data.CodigoIntegracion)
+	filtros = agregarFiltro(filtros, "Código cliente", data.CodigoCliente)
+	filtros = agregarFiltro(filtros, "CUF", data.CUF)
+	filtros = agregarFiltro(filtros, "Estado", data.EstadoDocumentoFiscal)
+	filtros = agregarFiltro(filtros, "Cód. sucursal SIN", data.CodigoSucursalSin)
+	filtros = agregarFiltro(filtros, "Tipo emisión", data.TipoEmision)
+
+	return &ReporteExportacion{
+		Titulo:      "Reporte de facturación",
+		NombreBase:  "facturas",
+		Filtros:     filtros,
+		Columnas:    columnasFacturas,
+		GeneradoPor: generadoPor,
+		GeneradoEn:  time.Now(),
+	}
+}
+
+// generarEnMemoria genera el reporte completo en un buffer.
+func generarEnMemoria(formato FormatoExportacion, reporte *ReporteExportacion, fuente FuenteFilas) (*ArchivoExportado, error) {
+	var buffer bytes.Buffer
+	if _, err := GenerarReporte(&buffer, formato, reporte, fuente); err != nil {
+		return nil, err
+	}
+	return &ArchivoExportado{
+		NombreArchivo: reporte.NombreArchivo(formato),
+		ContentType:   formato.ContentType(),
+		Contenido:     buffer.Bytes(),
+	}, nil
+}
+
+// ExportarFacturas genera el reporte de DataFacturas en el formato pedido.
+// Si el resultado entra en ExportacionesService.UmbralSincrono filas se
+// devuelve el archivo; si no, se encola un TrabajoExportacion que vuelve a
+// ejecutar la consulta en modo streaming (StreamFacturas) y se devuelve el
+// trabajo (salvo en PDF, que se rechaza con ErrPDFDemasiadasFilas).
+func (s *ConsultasService) ExportarFacturas(ctx context.Context, data models.Json_consulta_data, formato FormatoExportacion, usuarioID uint, generadoPor string) (*ArchivoExportado, *TrabajoExportacion, error) {
+	reporte := reporteFacturas(data, generadoPor)
+
+	pagina, err := s.DataFacturas(ctx, data, "", s.exportaciones.UmbralSincrono(formato))
+	if errors.Is(err, ErrSinFacturas) {
+		// un rango sin facturas igual se exporta: encabezado y filtros
+		// sin filas
+		pagina, err = &PaginaFacturas{}, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !pagina.HayMas {
+		filas := make([][]any, len(pagina.Data))
+		for i := range pagina.Data {
+			filas[i] = filaFactura(&pagina.Data[i])
+		}
+		archivo, err := generarEnMemoria(formato, reporte, FilasEnMemoria(filas))
+		return archivo, nil, err
+	}
+	if err := encolable(formato); err != nil {
+		return nil, nil, err
+	}
+
+	trabajo := s.exportaciones.Encolar(usuarioID, formato, reporte.NombreArchivo(formato), func(w io.Writer) (int, error) {
+		// Contexto propio (el request HTTP ya terminó cuando corre el
+		// trabajo) y con el timeout de exportaciones, no el interactivo.
+		filas, err := s.streamFacturas(context.Background(), data, s.exportaciones.TimeoutConsulta())
+		if err != nil {
+			return 0, err
+		}
+		defer filas.Cerrar()
+
+		return GenerarReporte(w, formato, reporte, func(emitir func(fila []any) error) error {
+			var fila models.SFEReporteFacturador
+			for {
+				ok, err := filas.Siguiente(&fila)
+				if err != nil {
+					return err
+				}
+				if !ok {
+					return nil
+				}
+				if err := emitir(filaFactura(&fila)); err != nil {
+					return err
+				}
+			}
+		})
+	})
+	return nil, trabajo, nil
+}
+
+// columnasDuas unifican los resultados de servidores duas (central) y
+// duas_local; las columnas que un tipo no trae quedan vacías.
+var columnasDuas = []ColumnaExportacion{
+	{Titulo: "Servidor", Tipo: ColumnaTexto, Ancho: 7},
+	{Titulo: "Origen datos", Tipo: ColumnaTexto, Ancho: 5},
+	{Titulo: "Nro. factura", Tipo: ColumnaTexto, Ancho: 6},
+	{Titulo: "Fecha emisión", Tipo: ColumnaFecha, Ancho: 9},
+	{Titulo: "Vuelo", Tipo: ColumnaTexto, Ancho: 5},
+	{Titulo: "Pasajero", Tipo: ColumnaTexto, Ancho: 12},
+	{Titulo: "PNR", Tipo: ColumnaTexto, Ancho: 5},
+	{Titulo: "Ruta", Tipo: ColumnaTexto, Ancho: 5},
+	{Titulo: "Asiento", Tipo: ColumnaTexto, Ancho: 4},
+	{Titulo: "Ticket", Tipo: ColumnaTexto, Ancho: 8},
+	{Titulo: "Detalle (BCBP)", Tipo: ColumnaTexto, Ancho: 22},
+	{Titulo: "Monto", Tipo: ColumnaDecimal, Totalizar: true, Ancho: 6},
+	{Titulo: "CUF", Tipo: ColumnaTexto, Ancho: 14},
+	{Titulo: "Estado", Tipo: ColumnaTexto, Ancho: 7},
+	{Titulo: "Código integración", Tipo: ColumnaTexto, Ancho: 10},
+	{Titulo: "URL SIN", Tipo: ColumnaTexto, Ancho: 16},
+}
+
+func filasDuas(resultado *models.DuasResultado) [][]any {
+	filas := make([][]any, 0, len(resultado.ResultadosCentral)+len(resultado.ResultadosLocal))
+	for _, r := range resultado.ResultadosCentral {
+		filas = append(filas, []any{
+			r.Servidor, "central", r.FACNroFactura, r.FacFechaEmisionFactura, r.FACNroVuelo,
+			r.Pasajero, r.PNR, rutaBCBP(r.DatosBCBP), r.Asiento, r.NumeroTicket,
+			r.FACDetalleFactura, r.FACMonto, "", "", "", r.URLSin,
+		})
+	}
+	for _, r := range resultado.ResultadosLocal {
+		filas = append(filas, []any{
+			r.Servidor, "local", r.NumeroFactura, r.FacFechaEmisionFactura, r.FACNroVuelo,
+			r.Pasajero, r.PNR, rutaBCBP(r.DatosBCBP), r.Asiento, r.NumeroTicket,
+			r.FACDetalleFactura, r.FACMonto, r.CUF, r.EstadoDocumentoFiscal, r.CodigoIntegracion, r.URLSin,
+		})
+	}
+	return filas
+}
+
+// rutaBCBP arma "LPB-VVI-MIA" con los tramos del boarding pass.
+func rutaBCBP(datos models.DatosBCBP) string {
+	if len(datos.Tramos) == 0 {
+		return ""
+	}
+	ruta := []string{datos.Tramos[0].Origen}
+	for _, tramo := range datos.Tramos {
+		ruta = append(ruta, tramo.Destino)
+	}
+	return strings.Join(ruta, "-")
+}
+
+func reporteDuas(idServer string, params models.DuasBusquedaParams, generadoPor string) *ReporteExportacion {
+	var filtros []FiltroAplicado
+	filtros = agregarFiltro(filtros, "Servidor", idServer)
+	filtros = agregarFiltro(filtros, "Nombre", params.Nombre)
+	filtros = agregarFiltro(filtros, "Apellido", params.Apellido)
+	filtros = agregarFiltro(filtros, "Vuelo", params.NumeroVuelo)
+	filtros = agregarFiltro(filtros, "Asiento", params.Asiento)
+	filtros = agregarFiltro(filtros, "Ticket", params.Ticket)
+	filtros = agregarFiltro(filtros, "Origen", params.Origen)
+	filtros = agregarFiltro(filtros, "Destino", params.Destino)
+	filtros = agregarFiltro(filtros, "PNR", params.PNR)
+	filtros = agregarFiltro(filtros, "Fecha desde", params.FechaDesde)
+	filtros = agregarFiltro(filtros, "Fecha hasta", params.FechaHasta)
+
+	return &ReporteExportacion{
+		Titulo:      "Búsqueda DUAS",
+		NombreBase:  "duas",
+		Filtros:     filtros,
+		Columnas:    columnasDuas,
+		GeneradoPor: generadoPor,
+		GeneradoEn:  time.Now(),
+	}
+}
+
+// ExportarDuas genera el resultado de BuscarDuas en el formato pedido.
+func (s *ConsultasService) ExportarDuas(ctx context.Context, idServer string, params models.DuasBusquedaParams, formato FormatoExportacion, usuarioID uint, generadoPor string) (*ArchivoExportado, *TrabajoExportacion, error) {
+	resultado, err := s.BuscarDuas(ctx, idServer, params)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.exportarDuas(resultado, reporteDuas(idServer, params, generadoPor), formato, usuarioID)
+}
+
+// ExportarDuasTodos genera el resultado de BuscarDuasTodos en el formato
+// pedido. Los servidores que fallaron se listan en el encabezado para que el
+// archivo no pase por completo sin estarlo.
+func (s *ConsultasService) ExportarDuasTodos(ctx context.Context, params models.DuasBusquedaParams, permitido func(*models.DbConnection) bool, formato FormatoExportacion, usuarioID uint, generadoPor string) (*ArchivoExportado, *TrabajoExportacion, error) {
+	resultado, err := s.BuscarDuasTodos(ctx, params, permitido)
+	if err != nil {
+		return nil, nil, err
+	}
+	reporte := reporteDuas("Todos", params, generadoPor)
+	var fallidos []string
+	for _, estado := range resultado.Servidores {
+		if estado.Error != "" {
+			fallidos = append(fallidos, estado.Servidor)
+		}
+	}
+	reporte.Filtros = agregarFiltro(reporte.Filtros, "Servidores con error", strings.Join(fallidos, ", "))
+	return s.exportarDuas(&resultado.DuasResultado, reporte, formato, usuarioID)
+}
+
+// exportarDuas arma el archivo de una búsqueda DUAS. La consulta DUAS no
+// pagina, así que las filas ya están en memoria: por encima del umbral solo
+// el armado del archivo pasa a segundo plano.
+func (s *ConsultasService) exportarDuas(resultado *models.DuasResultado, reporte *ReporteExportacion, formato FormatoExportacion, usuarioID uint) (*ArchivoExportado, *TrabajoExportacion, error) {
+	filas := filasDuas(resultado)
+
+	if len(filas) <= s.exportaciones.UmbralSincrono(formato) {
+		archivo, err := generarEnMemoria(formato, reporte, FilasEnMemoria(filas))
+		return archivo, nil, err
+	}
+	if err := encolable(formato); err != nil {
+		return nil, nil, err
+	}
+
+	trabajo := s.exportaciones.Encolar(usuarioID, formato, reporte.NombreArchivo(formato), func(w io.Writer) (int, error) {
+		return GenerarReporte(w, formato, reporte, FilasEnMemoria(filas))
+	})
+	return nil, trabajo, nil
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"managerfact/internal/domain/models"
+	"strings"
+)
+
+// agrupacionResumen define cómo se agrupa ResumenFacturas: la expresión SQL
+// de la clave, la de su descripción legible y si monto_total del documento
+// se puede sumar sin duplicarse.
+type agrupacionResumen struct {
+	clave          string
+	descripcion    string
+	montoDocumento bool
+}
+
+// agrupacionesResumen son los valores aceptados en ?agrupar=. Las fechas
+// agrupan por created_date, igual que el rango de fechas del reporte.
+var agrupacionesResumen = map[string]agrupacionResumen{
+	"dia":             {clave: "CONVERT(varchar(10), sdf.created_date, 23)", descripcion: "NULL", montoDocumento: true},
+	"mes":             {clave: "CONVERT(varchar(7), sdf.created_date, 23)", descripcion: "NULL", montoDocumento: true},
+	"sucursal":        {clave: "CAST(ss.codigo_sucursal_sin AS varchar(20))", descripcion: "ss.nombre", montoDocumento: true},
+	"codigo_producto": {clave: "sddf.codigo_producto_sfe", descripcion: "sddf.descripcion", montoDocumento: false},
+	"tipo_emision":    {clave: "CAST(sdf.tipo_emision AS varchar(10))", descripcion: "NULL", montoDocumento: true},
+	"estado":          {clave: "sdf.estado_documento_fiscal", descripcion: "NULL", montoDocumento: true},
+}
+
+// resumenFacturasQuery agrega las líneas de detalle filtradas igual que
+// dataFacturasQuery. primera_linea marca una sola línea por documento para
+// sumar monto_total sin repetirlo por cada detalle. GROUPING SETS agrega la
+// fila de totales generales (es_total = 1), donde COUNT(DISTINCT) cuenta bien
+// los documentos aunque aparezcan en varios grupos.
+const resumenFacturasQuery = declaracionesFacturasSQL + `
+SELECT
+    t.clave,
+    MAX(t.descripcion)                  AS descripcion,
+    COUNT(DISTINCT t.id_documento)      AS cantidad_documentos,
+    COUNT(*)                            AS cantidad_items,
+    SUM(t.cantidad)                     AS cantidad,
+    SUM(t.sub_total)                    AS total_detalle,
+    {{MONTO_DOCUMENTOS}}                AS monto_total_documentos,
+    CAST(GROUPING(t.clave) AS bit)      AS es_total
+FROM (
+    SELECT
+        {{CLAVE}}                       AS clave,
+        {{DESCRIPCION}}                 AS descripcion,
+        sdf.id                          AS id_documento,
+        sdf.monto_total,
+        sddf.cantidad,
+        sddf.sub_total,
+        ROW_NUMBER() OVER (PARTITION BY sdf.id ORDER BY sddf.id) AS primera_linea
+    FROM FacturacionNaabol.dbo.sfe_documento_fiscal sdf
+    JOIN FacturacionNaabol.dbo.sfe_detalle_documento_fiscal sddf
+        ON sddf.id_sfe_documento_fiscal = sdf.id
+    JOIN FacturacionNaabol.dbo.sfe_sucursal ss
+        ON ss.id = sdf.id_sfe_sucursal
+` + condicionesFacturasSQL + `
+) t
+GROUP BY GROUPING SETS ((t.clave), ())
+ORDER BY GROUPING(t.clave), t.clave;
+`
+
+// ResumenFacturas es la respuesta de ResumenFacturas: los grupos y la fila
+// de totales generales del período.
+type ResumenFacturas struct {
+	Agrupacion string                      `json:"agrupacion"`
+	Grupos     []models.ResumenFacturacion `json:"grupos"`
+	Totales    *models.ResumenFacturacion  `json:"totales"`
+}
+
+// AgrupacionResumenValida indica si agrupar es un valor aceptado por
+// ResumenFacturas.
+func AgrupacionResumenValida(agrupar string) bool {
+	_, ok := agrupacionesResumen[agrupar]
+	return ok
+}
+
+// ResumenFacturas devuelve totales y cantidades de facturación agrupados por
+// agrupar (dia, mes, sucursal, codigo_producto, tipo_emision o estado), con
+// los mismos filtros que DataFacturas. El agregado lo hace SQL Server: no se
+// traen filas de detalle.
+func (s *ConsultasService) ResumenFacturas(ctx context.Context, data models.Json_consulta_data, agrupar string) (*ResumenFacturas, error) {
+	agrupacion, ok := agrupacionesResumen[agrupar]
+	if !ok {
+		return nil, fmt.Errorf("agrupación '%s' no soportada", agrupar)
+	}
+
+	montoDocumentos := "SUM(CASE WHEN t.primera_linea = 1 THEN t.monto_total END)"
+	if !agrupacion.montoDocumento {
+		montoDocumentos = "CAST(NULL AS numeric(19,2))"
+	}
+	query := strings.NewReplacer(
+		"{{CLAVE}}", agrupacion.clave,
+		"{{DESCRIPCION}}", agrupacion.descripcion,
+		"{{MONTO_DOCUMENTOS}}", montoDocumentos,
+	).Replace(resumenFacturasQuery)
+
+	query, args, err := filtrosFacturas(query, data)
+	if err != nil {
+		return nil, err
+	}
+
+	db, server, err := s.conexionSQLServer(data.IdFacturador)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := contextoConsulta(ctx, server)
+	defer cancel()
+
+	var filas []models.ResumenFacturacion
+	if err := db.WithContext(ctx).Raw(query, args...).Scan(&filas).Error; err != nil {
+		return nil, errorConsulta(ctx, err, "error al resumir facturas")
+	}
+
+	resumen := &ResumenFacturas{Agrupacion: agrupar, Grupos: []models.ResumenFacturacion{}}
+	for i := range filas {
+		if filas[i].EsTotal {
+			total := filas[i]
+			total.Clave = "TOTAL"
+			resumen.Totales = &total
+			continue
+		}
+		resumen.Grupos = append(resumen.Grupos, filas[i])
+	}
+	return resumen, nil
+}
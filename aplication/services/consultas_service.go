@@ -1,14 +1,18 @@
 package services
 
 import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"managerfact/internal/domain/models"
 	"managerfact/internal/domain/repositories"
+	"managerfact/pkg/bcbp"
 	"strconv"
 	"strings"
 	"time"
 
-	"gorm.io/driver/sqlserver"
 	"gorm.io/gorm"
 )
 
@@ -21,21 +25,95 @@ func toNullString(s string) any {
 	return s
 }
 
+// ErrConsultaTimeout se devuelve cuando una consulta remota supera el
+// QueryTimeout de su DbConnection; el handler lo traduce a 504.
+var ErrConsultaTimeout = errors.New("la consulta al servidor remoto excedió el tiempo máximo")
+
 type ConsultasService struct {
 	ConsultasRepo repositories.ConsutasRepository
+	conexiones    *ConexionesRemotas
+	exportaciones *ExportacionesService
 }
 
-func NewConsultasService(r *repositories.ConsutasRepository) *ConsultasService {
+func NewConsultasService(r *repositories.ConsutasRepository, conexiones *ConexionesRemotas, exportaciones *ExportacionesService) *ConsultasService {
 	return &ConsultasService{
 		ConsultasRepo: *r,
+		conexiones:    conexiones,
+		exportaciones: exportaciones,
 	}
 }
 
-// dataFacturasQuery es el reporte completo de facturación: documento fiscal +
-// detalle + sucursal + paquete (offline/contingencia) + evento + usuario que
-// registró el documento. Todos los filtros son opcionales salvo el rango de
-// fechas, que se aplica sobre created_date (fecha de registro del documento).
-const dataFacturasQuery = `
+// conexion resuelve idServer (tal como llega del front) al pool de esa
+// DbConnection — ver ConexionesRemotas.
+func (s *ConsultasService) conexion(idServer string) (*gorm.DB, *models.DbConnection, error) {
+	id, err := strconv.ParseUint(idServer, 10, 64)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s.conexiones.Obtener(uint(id))
+}
+
+// Servidor devuelve la configuración de la DbConnection idServer sin abrir
+// su pool, para verificar accesos antes de consultar.
+func (s *ConsultasService) Servidor(idServer string) (*models.DbConnection, error) {
+	id, err := strconv.ParseUint(idServer, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return s.conexiones.Configuracion(uint(id))
+}
+
+// ErrConsultaSoloSQLServer se devuelve al pedir un reporte del facturador
+// SFE (escrito en T-SQL: variables declare, TOP) sobre una conexión cuyo
+// Driver no es SQL Server.
+var ErrConsultaSoloSQLServer = errors.New("esta consulta solo corre en conexiones SQL Server")
+
+// ErrSinFacturas lo devuelve DataFacturas cuando la primera página viene
+// vacía; el handler lo traduce a 404 y ExportarFacturas genera el reporte
+// sin filas.
+var ErrSinFacturas = errors.New("no se encontraron facturas")
+
+// conexionSQLServer es conexion para las consultas en T-SQL, que no corren
+// en los otros motores.
+func (s *ConsultasService) conexionSQLServer(idServer string) (*gorm.DB, *models.DbConnection, error) {
+	db, server, err := s.conexion(idServer)
+	if err != nil {
+		return nil, nil, err
+	}
+	if server.DriverNormalizado() != models.DriverSQLServer {
+		return nil, nil, fmt.Errorf("%w (la conexión '%s' usa %s)", ErrConsultaSoloSQLServer, server.ServerName, server.DriverNormalizado())
+	}
+	return db, server, nil
+}
+
+// contextoConsulta limita ctx al QueryTimeout del servidor. Al vencer, el
+// driver aborta la consulta en el servidor remoto (go-mssqldb envía un
+// attention TDS, pgx y go-sql-driver/mysql cancelan la query) en vez de
+// dejarla corriendo. El contexto del request de fasthttp no se cancela
+// cuando el cliente se desconecta, así que un cliente que abandona no corta
+// la consulta antes del timeout (salvo en el stream NDJSON, que la cancela
+// al fallar la escritura).
+func contextoConsulta(ctx context.Context, server *models.DbConnection) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, server.QueryTimeout())
+}
+
+// errorConsulta envuelve el error de una consulta remota: si el contexto
+// venció o se canceló devuelve ErrConsultaTimeout (con el detalle), si no,
+// el error original con el mensaje dado.
+func errorConsulta(ctx context.Context, err error, mensaje string) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return fmt.Errorf("%w (%v)", ErrConsultaTimeout, ctxErr)
+	}
+	return fmt.Errorf("%s: %w", mensaje, err)
+}
+
+// declaracionesFacturasSQL y condicionesFacturasSQL son los filtros de
+// Json_consulta_data sobre sfe_documento_fiscal (sdf), su detalle (sddf) y
+// sfe_sucursal (ss), compartidos por el reporte (dataFacturasQuery) y los
+// agregados (resumenFacturasQuery). Los argumentos los arma filtrosFacturas.
+// Todos los filtros son opcionales salvo el rango de fechas, que se aplica
+// sobre created_date (fecha de registro del documento).
+const declaracionesFacturasSQL = `
 declare @NumeroFactura         numeric(19,2) = ?
 declare @CodigoIntegracion     varchar(50)   = ?
 declare @CodigoCliente         varchar(100)  = ?
@@ -47,8 +125,30 @@ declare @TipoEmision           int           = ?
 declare @IdSucursal            int           = ?
 declare @FechaDesde            datetime2     = ?
 declare @FechaHasta            datetime2     = ?
+`
+
+const condicionesFacturasSQL = `
+WHERE sdf.created_date >= @FechaDesde
+  AND sdf.created_date <  @FechaHasta
+  AND (@NumeroFactura         IS NULL OR sdf.numero_factura        = @NumeroFactura)
+  AND (@CodigoIntegracion     IS NULL OR sdf.codigo_integracion    = @CodigoIntegracion)
+  AND (@CodigoCliente         IS NULL OR sdf.codigo_cliente        = @CodigoCliente)
+  AND (@NumeroDocumento       IS NULL OR sdf.numero_documento      = @NumeroDocumento)
+  AND (@CUF                   IS NULL OR sdf.cuf                   = @CUF)
+  AND (@EstadoDocumentoFiscal IS NULL OR sdf.estado_documento_fiscal = @EstadoDocumentoFiscal)
+  AND (@CodigoSucursalSIN     IS NULL OR ss.codigo_sucursal_sin    = @CodigoSucursalSIN)
+  AND (@TipoEmision           IS NULL OR sdf.tipo_emision          = @TipoEmision)
+  AND (@IdSucursal            IS NULL OR ss.id                     = @IdSucursal)
+  {{CODIGO_PRODUCTO_FILTER}}
+`
 
-SELECT
+// dataFacturasQuery es el reporte completo de facturación: documento fiscal +
+// detalle + sucursal + paquete (offline/contingencia) + evento + usuario que
+// registró el documento.
+// El orden (created_date, id documento, id detalle) es total y estable: es la
+// clave de la paginación por cursor ({{CURSOR_FILTER}}, ver CursorFacturas).
+const dataFacturasQuery = declaracionesFacturasSQL + `
+SELECT {{TOP}}
     sdf.id                              AS id_documento_fiscal,
     sdf.numero_factura,
     sdf.codigo_integracion,
@@ -91,6 +191,7 @@ SELECT
     se.state_evento,
     se.fecha_inicio                     AS evento_fecha_inicio,
     se.fecha_fin                        AS evento_fecha_fin,
+    sddf.id                             AS id_detalle,
     sddf.cantidad,
     sddf.codigo_producto_sfe,
     sddf.descripcion,
@@ -108,72 +209,92 @@ LEFT JOIN FacturacionNaabol.dbo.sfe_evento se
     ON se.id = sdf.id_evento
 LEFT JOIN FacturacionNaabol.dbo.auth_usuario au
     ON au.id = sdf.created_by
+` + condicionesFacturasSQL + `
+  {{CURSOR_FILTER}}
 
-WHERE sdf.created_date >= @FechaDesde
-  AND sdf.created_date <  @FechaHasta
-  AND (@NumeroFactura         IS NULL OR sdf.numero_factura        = @NumeroFactura)
-  AND (@CodigoIntegracion     IS NULL OR sdf.codigo_integracion    = @CodigoIntegracion)
-  AND (@CodigoCliente         IS NULL OR sdf.codigo_cliente        = @CodigoCliente)
-  AND (@NumeroDocumento       IS NULL OR sdf.numero_documento      = @NumeroDocumento)
-  AND (@CUF                   IS NULL OR sdf.cuf                   = @CUF)
-  AND (@EstadoDocumentoFiscal IS NULL OR sdf.estado_documento_fiscal = @EstadoDocumentoFiscal)
-  AND (@CodigoSucursalSIN     IS NULL OR ss.codigo_sucursal_sin    = @CodigoSucursalSIN)
-  AND (@TipoEmision           IS NULL OR sdf.tipo_emision          = @TipoEmision)
-  AND (@IdSucursal            IS NULL OR ss.id                     = @IdSucursal)
-  {{CODIGO_PRODUCTO_FILTER}}
-
-ORDER BY sdf.created_date DESC;
+ORDER BY sdf.created_date DESC, sdf.id DESC, sddf.id DESC;
 `
 
-func (s *ConsultasService) DataFacturas(data models.Json_consulta_data) (*[]models.SFEReporteFacturador, error) {
-	idServer, err := strconv.ParseInt(data.IdFacturador, 10, 64)
+// Límites de DataFacturas: LimiteFacturasPorDefecto filas por página si el
+// cliente no indica limit, y nunca más de LimiteFacturasMaximo (para más,
+// usar el modo NDJSON de StreamFacturas).
+const (
+	LimiteFacturasPorDefecto = 1000
+	LimiteFacturasMaximo     = 10000
+)
+
+// CursorFacturas es la posición de la última fila entregada en una página de
+// DataFacturas. Viaja al front como texto opaco (Codificar) y vuelve en el
+// siguiente request para pedir las filas que siguen en el orden del reporte,
+// sin OFFSET: el costo de cada página no crece con la profundidad.
+type CursorFacturas struct {
+	CreatedDate       time.Time
+	IDDocumentoFiscal uint
+	IDDetalle         uint
+}
+
+// Codificar serializa el cursor como base64 URL-safe de
+// "created_date|id_documento|id_detalle".
+func (c CursorFacturas) Codificar() string {
+	texto := fmt.Sprintf("%s|%d|%d", c.CreatedDate.Format(time.RFC3339Nano), c.IDDocumentoFiscal, c.IDDetalle)
+	return base64.RawURLEncoding.EncodeToString([]byte(texto))
+}
+
+// DecodificarCursorFacturas es la inversa de CursorFacturas.Codificar.
+// Un texto vacío devuelve nil (primera página).
+func DecodificarCursorFacturas(texto string) (*CursorFacturas, error) {
+	if texto == "" {
+		return nil, nil
+	}
+	crudo, err := base64.RawURLEncoding.DecodeString(texto)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("cursor inválido: %w", err)
 	}
-	server, errServer := s.ConsultasRepo.GetServidorById(idServer)
-	if errServer != nil {
-		return nil, errServer
+	partes := strings.Split(string(crudo), "|")
+	if len(partes) != 3 {
+		return nil, fmt.Errorf("cursor inválido")
 	}
-	// Construcción del DSN (Data Source Name) para SQL Server
-	dsn := fmt.Sprintf("sqlserver://%s:%s@%s:%d?database=%s",
-		server.Username,
-		server.Password,
-		server.Host,
-		server.Port,
-		server.DatabaseName,
-	)
-
-	var db *gorm.DB
-
-	// Intentar conectar primero para verificar si hay conexión activa
-	db, err = gorm.Open(sqlserver.Open(dsn), &gorm.Config{})
+	fecha, err := time.Parse(time.RFC3339Nano, partes[0])
 	if err != nil {
-		return nil, fmt.Errorf("no se pudo conectar: %w", err)
+		return nil, fmt.Errorf("cursor inválido: %w", err)
 	}
-
-	// Verificar si la conexión está activa
-	sqlDB, err := db.DB()
+	idDocumento, err := strconv.ParseUint(partes[1], 10, 64)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("cursor inválido: %w", err)
 	}
-	defer sqlDB.Close()
-
-	// Ping para confirmar conexión
-	if err := sqlDB.Ping(); err != nil {
-		// Si falla, intentar crear nueva conexión
-		db, err = gorm.Open(sqlserver.Open(dsn), &gorm.Config{})
-		if err != nil {
-			return nil, fmt.Errorf("error al crear nueva conexión: %w", err)
-		}
+	idDetalle, err := strconv.ParseUint(partes[2], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("cursor inválido: %w", err)
 	}
+	return &CursorFacturas{CreatedDate: fecha, IDDocumentoFiscal: uint(idDocumento), IDDetalle: uint(idDetalle)}, nil
+}
+
+// PaginaFacturas es una página de DataFacturas. SiguienteCursor viene vacío
+// en la última página.
+type PaginaFacturas struct {
+	Data []models.SFEReporteFacturador `json:"data"`
+	PaginacionFacturas
+}
 
+// PaginacionFacturas es solo la metadata de la página (el "pagination" de
+// la respuesta), sin las filas.
+type PaginacionFacturas struct {
+	Limite          int    `json:"limit"`
+	HayMas          bool   `json:"has_more"`
+	SiguienteCursor string `json:"next_cursor,omitempty"`
+}
+
+// filtrosFacturas arma los argumentos de declaracionesFacturasSQL (en orden)
+// a partir de Json_consulta_data y reemplaza {{CODIGO_PRODUCTO_FILTER}} en
+// query, agregando al final los argumentos del IN.
+func filtrosFacturas(query string, data models.Json_consulta_data) (string, []any, error) {
 	fechaDesde, err := time.Parse("2006-01-02", data.FechaDesde)
 	if err != nil {
-		return nil, fmt.Errorf("fechaDesde inválida: %w", err)
+		return "", nil, fmt.Errorf("fechaDesde inválida: %w", err)
 	}
 	fechaHasta, err := time.Parse("2006-01-02", data.FechaHasta)
 	if err != nil {
-		return nil, fmt.Errorf("fechaHasta inválida: %w", err)
+		return "", nil, fmt.Errorf("fechaHasta inválida: %w", err)
 	}
 	// Límite superior exclusivo (inicio del día siguiente).
 	fechaHastaExclusiva := fechaHasta.AddDate(0, 0, 1)
@@ -182,7 +303,7 @@ func (s *ConsultasService) DataFacturas(data models.Json_consulta_data) (*[]mode
 	if data.NumeroFactura != "" {
 		nf, errNf := strconv.ParseFloat(data.NumeroFactura, 64)
 		if errNf != nil {
-			return nil, fmt.Errorf("numeroFactura inválido: %w", errNf)
+			return "", nil, fmt.Errorf("numeroFactura inválido: %w", errNf)
 		}
 		numeroFactura = nf
 	}
@@ -191,7 +312,7 @@ func (s *ConsultasService) DataFacturas(data models.Json_consulta_data) (*[]mode
 	if data.TipoEmision != "" {
 		te, errTe := strconv.Atoi(data.TipoEmision)
 		if errTe != nil {
-			return nil, fmt.Errorf("tipoEmision inválido: %w", errTe)
+			return "", nil, fmt.Errorf("tipoEmision inválido: %w", errTe)
 		}
 		tipoEmision = te
 	}
@@ -200,7 +321,7 @@ func (s *ConsultasService) DataFacturas(data models.Json_consulta_data) (*[]mode
 	if data.CodigoSucursalSin != "" {
 		cs, errCs := strconv.Atoi(data.CodigoSucursalSin)
 		if errCs != nil {
-			return nil, fmt.Errorf("codigoSucursalSin inválido: %w", errCs)
+			return "", nil, fmt.Errorf("codigoSucursalSin inválido: %w", errCs)
 		}
 		codigoSucursalSin = cs
 	}
@@ -209,14 +330,13 @@ func (s *ConsultasService) DataFacturas(data models.Json_consulta_data) (*[]mode
 	if data.Sucursal != "" {
 		sid, errSid := strconv.Atoi(data.Sucursal)
 		if errSid != nil {
-			return nil, fmt.Errorf("sucursal inválida: %w", errSid)
+			return "", nil, fmt.Errorf("sucursal inválida: %w", errSid)
 		}
 		idSucursal = sid
 	}
 
 	// El filtro de código de producto admite selección múltiple, por lo que se
 	// arma un IN (...) con tantos placeholders como códigos se hayan enviado.
-	query := dataFacturasQuery
 	args := []any{
 		numeroFactura,
 		toNullString(data.CodigoIntegracion),
@@ -240,264 +360,436 @@ func (s *ConsultasService) DataFacturas(data models.Json_consulta_data) (*[]mode
 	} else {
 		query = strings.Replace(query, "{{CODIGO_PRODUCTO_FILTER}}", "", 1)
 	}
+	return query, args, nil
+}
 
-	var facturas []models.SFEReporteFacturador
-	if err := db.Raw(query, args...).Scan(&facturas).Error; err != nil {
-		return nil, fmt.Errorf("error al buscar facturas: %w", err)
+// consultaFacturas arma dataFacturasQuery con sus argumentos a partir de los
+// filtros de Json_consulta_data. cursor nil es la primera página; limite 0
+// no aplica TOP (modo streaming).
+func consultaFacturas(data models.Json_consulta_data, cursor *CursorFacturas, limite int) (string, []any, error) {
+	query, args, err := filtrosFacturas(dataFacturasQuery, data)
+	if err != nil {
+		return "", nil, err
 	}
 
-	if len(facturas) == 0 {
-		return nil, fmt.Errorf("no se encontraron facturas")
+	if cursor != nil {
+		query = strings.Replace(query, "{{CURSOR_FILTER}}", `AND (sdf.created_date < ?
+       OR (sdf.created_date = ? AND (sdf.id < ? OR (sdf.id = ? AND sddf.id < ?))))`, 1)
+		args = append(args, cursor.CreatedDate, cursor.CreatedDate,
+			cursor.IDDocumentoFiscal, cursor.IDDocumentoFiscal, cursor.IDDetalle)
+	} else {
+		query = strings.Replace(query, "{{CURSOR_FILTER}}", "", 1)
+	}
+
+	top := ""
+	if limite > 0 {
+		top = "TOP (" + strconv.Itoa(limite) + ")"
 	}
+	query = strings.Replace(query, "{{TOP}}", top, 1)
 
-	return &facturas, nil
+	return query, args, nil
 }
 
-// BuscarDuas ejecuta la consulta DUAS contra la base de datos seleccionada
-func (s *ConsultasService) BuscarDuas(idServer string, params models.DuasBusquedaParams) (*models.DuasResultado, error) {
-	idServerParse, err := strconv.ParseInt(idServer, 10, 64)
+// DataFacturas devuelve una página del reporte de facturación: hasta limite
+// filas a partir de cursor (texto vacío = desde el inicio).
+func (s *ConsultasService) DataFacturas(ctx context.Context, data models.Json_consulta_data, cursor string, limite int) (*PaginaFacturas, error) {
+	if limite <= 0 {
+		limite = LimiteFacturasPorDefecto
+	}
+	if limite > LimiteFacturasMaximo {
+		limite = LimiteFacturasMaximo
+	}
+	posicion, err := DecodificarCursorFacturas(cursor)
 	if err != nil {
 		return nil, err
 	}
 
-	Server, errServer := s.ConsultasRepo.GetServidorById(idServerParse)
-	if errServer != nil {
-		return nil, errServer
+	// Se pide una fila de más solo para saber si hay otra página.
+	query, args, err := consultaFacturas(data, posicion, limite+1)
+	if err != nil {
+		return nil, err
 	}
 
-	// Construcción del DSN para SQL Server
-	dsn := fmt.Sprintf("sqlserver://%s:%s@%s:%d?database=%s",
-		Server.Username,
-		Server.Password,
-		Server.Host,
-		Server.Port,
-		Server.DatabaseName,
-	)
+	db, server, err := s.conexionSQLServer(data.IdFacturador)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := contextoConsulta(ctx, server)
+	defer cancel()
+
+	var facturas []models.SFEReporteFacturador
+	if err := db.WithContext(ctx).Raw(query, args...).Scan(&facturas).Error; err != nil {
+		return nil, errorConsulta(ctx, err, "error al buscar facturas")
+	}
+
+	if len(facturas) == 0 && posicion == nil {
+		return nil, ErrSinFacturas
+	}
+
+	pagina := &PaginaFacturas{PaginacionFacturas: PaginacionFacturas{Limite: limite}}
+	if len(facturas) > limite {
+		facturas = facturas[:limite]
+		ultima := facturas[limite-1]
+		pagina.HayMas = true
+		pagina.SiguienteCursor = CursorFacturas{
+			CreatedDate:       ultima.CreatedDate,
+			IDDocumentoFiscal: ultima.IDDocumentoFiscal,
+			IDDetalle:         ultima.IDDetalle,
+		}.Codificar()
+	}
+	pagina.Data = facturas
+	return pagina, nil
+}
+
+// FilasFacturas recorre el reporte de facturación fila por fila a medida que
+// llega de SQL Server, sin cargarlo entero en memoria. Siempre debe cerrarse
+// con Cerrar, que además cancela la consulta si no se leyó completa.
+type FilasFacturas struct {
+	db     *gorm.DB
+	rows   *sql.Rows
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Siguiente lee la próxima fila en fila. Devuelve false al terminar el
+// resultado o ante un error.
+func (f *FilasFacturas) Siguiente(fila *models.SFEReporteFacturador) (bool, error) {
+	if !f.rows.Next() {
+		if err := f.rows.Err(); err != nil {
+			return false, errorConsulta(f.ctx, err, "error leyendo facturas")
+		}
+		return false, nil
+	}
+	*fila = models.SFEReporteFacturador{}
+	if err := f.db.ScanRows(f.rows, fila); err != nil {
+		return false, errorConsulta(f.ctx, err, "error leyendo facturas")
+	}
+	return true, nil
+}
 
-	db, err := gorm.Open(sqlserver.Open(dsn), &gorm.Config{})
+// Cerrar libera la conexión del pool y cancela la consulta en el servidor
+// remoto si todavía estaba corriendo (p. ej. el cliente cortó la descarga).
+func (f *FilasFacturas) Cerrar() {
+	f.cancel()
+	f.rows.Close()
+}
+
+// StreamFacturas ejecuta el reporte completo (mismos filtros que
+// DataFacturas, sin paginar) y devuelve las filas para leerlas de a una. El
+// QueryTimeout de la conexión aplica a toda la lectura, no solo a la
+// ejecución.
+func (s *ConsultasService) StreamFacturas(ctx context.Context, data models.Json_consulta_data) (*FilasFacturas, error) {
+	return s.streamFacturas(ctx, data, 0)
+}
+
+// streamFacturas es StreamFacturas con un tiempo máximo propio para toda la
+// lectura; timeout 0 usa el QueryTimeout de la conexión. Las exportaciones
+// en segundo plano pasan EXPORT_TIMEOUT_MINUTOS, porque leer cientos de
+// miles de filas tarda más que una consulta interactiva.
+func (s *ConsultasService) streamFacturas(ctx context.Context, data models.Json_consulta_data, timeout time.Duration) (*FilasFacturas, error) {
+	query, args, err := consultaFacturas(data, nil, 0)
 	if err != nil {
-		return nil, fmt.Errorf("no se pudo conectar: %w", err)
+		return nil, err
 	}
 
-	sqlDB, err := db.DB()
+	db, server, err := s.conexionSQLServer(data.IdFacturador)
 	if err != nil {
 		return nil, err
 	}
-	defer sqlDB.Close()
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	} else {
+		ctx, cancel = contextoConsulta(ctx, server)
+	}
+
+	db = db.WithContext(ctx)
+	rows, err := db.Raw(query, args...).Rows()
+	if err != nil {
+		cancel()
+		return nil, errorConsulta(ctx, err, "error al buscar facturas")
+	}
+	return &FilasFacturas{db: db, rows: rows, ctx: ctx, cancel: cancel}, nil
+}
+
+// Las consultas DUAS corren sobre SQL Server, PostgreSQL o MySQL (algunas
+// réplicas DUAS viejas no son SQL Server, ver DbConnection.Driver), así que
+// se escriben en SQL portable: sin variables T-SQL, con los criterios
+// armados en Go (condicionesDuas) y cada columna con un alias entre comillas
+// dobles, que los tres motores aceptan y que conserva las mayúsculas que
+// espera el gorm:"column:..." de los modelos (PostgreSQL devolvería los
+// nombres sin alias en minúsculas).
+
+// duasCentralSQL es la consulta de servidores "duas": solo
+// TES_FACTURAITINERARIO, sin el documento fiscal.
+const duasCentralSQL = `
+select tf.IDTES_FACTURA_ITINERARIO as "IDTES_FACTURA_ITINERARIO", tf.FAC_NROVUELO as "FAC_NROVUELO",
+	tf.FAC_FECHAEMISION_FACTURA as "FAC_FECHAEMISION_FACTURA", tf.FAC_DETALLEFACTURA as "FAC_DETALLEFACTURA",
+	tf.FAC_MONTO as "FAC_MONTO", tf.FECHACREACION as "FECHACREACION", tf.IDTES_FACTURAONLINE as "IDTES_FACTURAONLINE",
+	tf.IDTES_FACTURAONLINE as "ID_DOCUMENTO", tf.FAC_NROFACTURA as "NUMEROFACTURA",
+	tf.FAC_FECHAEMISION_FACTURA as "FECHA_EMISION", tf.URL_SIN as "URL_SIN"
+from TES_FACTURAITINERARIO tf
+`
+
+// duasCentralVuelosSQL es la consulta de servidores "duas_central", cuyo
+// TES_FACTURAITINERARIO trae fecha/hora del vuelo, estado y usuario de
+// creación; el rango de fechas se aplica a la fecha del vuelo.
+const duasCentralVuelosSQL = `
+select tf.IDTES_FACTURA_ITINERARIO as "IDTES_FACTURA_ITINERARIO", tf.FAC_NROFACTURA as "NUMEROFACTURA",
+	tf.FAC_NROVUELO as "FAC_NROVUELO", tf.FAC_FECHAHORA_VUELO as "FAC_FECHAHORA_VUELO", tf.FAC_MONTO as "FAC_MONTO",
+	tf.IDA_ESTADOFACTURA as "IDA_ESTADOFACTURA", tf.FECHACREACION as "FECHACREACION",
+	tf.USUARIOCREACION as "USUARIOCREACION", tf.URL_SIN as "URL_SIN", tf.FAC_DETALLEFACTURA as "FAC_DETALLEFACTURA",
+	tf.FAC_FECHAEMISION_FACTURA as "FAC_FECHAEMISION_FACTURA"
+from TES_FACTURAITINERARIO tf
+`
+
+// duasLocalSQL es la consulta de servidores "duas_local", con el documento
+// fiscal (TES_FACTURAONLINE) de cada itinerario.
+const duasLocalSQL = `
+select tf.IDTES_FACTURA_ITINERARIO as "IDTES_FACTURA_ITINERARIO", tf.FAC_NROVUELO as "FAC_NROVUELO",
+	tf.FAC_FECHAEMISION_FACTURA as "FAC_FECHAEMISION_FACTURA", tf.FAC_DETALLEFACTURA as "FAC_DETALLEFACTURA",
+	tf.FAC_MONTO as "FAC_MONTO", tf.FECHACREACION as "FECHACREACION", tf.IDTES_FACTURAONLINE as "IDTES_FACTURAONLINE",
+	tf2.CODIGO as "CODIGO", tf2.ID_DOCUMENTO as "ID_DOCUMENTO", tf2.CUF as "CUF", tf2.CUFD as "CUFD",
+	tf2.CUIS as "CUIS", tf2.NUMEROFACTURA as "NUMEROFACTURA", tf2.FECHA_EMISION as "FECHA_EMISION",
+	tf2.ESTADO_DOCUMENTO_FISCAL as "ESTADO_DOCUMENTO_FISCAL", tf2.CODIGO_INTEGRACION as "CODIGO_INTEGRACION",
+	tf2.URL_SIN as "URL_SIN"
+from TES_FACTURAITINERARIO tf
+join TES_FACTURAONLINE tf2 on tf.IDTES_FACTURAONLINE = tf2.ID_DOCUMENTO
+`
+
+// condicionesDuas arma el where de DuasBusquedaParams sobre
+// TES_FACTURAITINERARIO (tf) con sus argumentos, solo con los criterios no
+// vacíos. Los LIKE sobre FAC_DETALLEFACTURA (el BCBP) solo acotan
+// candidatos: el filtro fino por campo se hace en Go sobre el BCBP
+// decodificado (coincideBCBP). El rango de fechas puede ser abierto en
+// cualquiera de sus extremos y se aplica sobre columnaFecha; el handler ya
+// validó el formato de las fechas.
+func condicionesDuas(params models.DuasBusquedaParams, columnaFecha string) (string, []any) {
+	var condiciones []string
+	var args []any
+	contiene := func(prefijo, valor string) {
+		if valor == "" {
+			return
+		}
+		condiciones = append(condiciones, "tf.FAC_DETALLEFACTURA like ?")
+		args = append(args, "%"+prefijo+valor+"%")
+	}
+	contiene("", params.Nombre)
+	contiene("", params.Ticket)
+	contiene("M_", params.Apellido)
+	contiene("", params.NumeroVuelo)
+	contiene("", params.Asiento)
+	contiene("", params.Origen)
+	contiene("", params.Destino)
+	contiene("", params.PNR)
 
-	if err := sqlDB.Ping(); err != nil {
-		return nil, fmt.Errorf("error de conectividad: %w", err)
+	if desde, err := time.Parse("2006-01-02", params.FechaDesde); err == nil {
+		condiciones = append(condiciones, columnaFecha+" >= ?")
+		args = append(args, desde)
 	}
+	if hasta, err := time.Parse("2006-01-02", params.FechaHasta); err == nil {
+		// Límite superior exclusivo (inicio del día siguiente).
+		condiciones = append(condiciones, columnaFecha+" < ?")
+		args = append(args, hasta.AddDate(0, 0, 1))
+	}
+
+	if len(condiciones) == 0 {
+		return "", nil
+	}
+	return "where " + strings.Join(condiciones, "\nand ") + "\n", args
+}
+
+// consultaDuas arma la consulta completa de un tipo de servidor DUAS,
+// aplicando el rango de fechas sobre columnaFecha.
+func consultaDuas(seleccion, columnaFecha string, params models.DuasBusquedaParams) (string, []any) {
+	condiciones, args := condicionesDuas(params, columnaFecha)
+	return seleccion + condiciones + "order by " + columnaFecha + " desc", args
+}
+
+// BuscarDuas ejecuta la consulta DUAS contra la base de datos seleccionada
+func (s *ConsultasService) BuscarDuas(ctx context.Context, idServer string, params models.DuasBusquedaParams) (*models.DuasResultado, error) {
+	db, Server, err := s.conexion(idServer)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := contextoConsulta(ctx, Server)
+	defer cancel()
+	db = db.WithContext(ctx)
 
 	var Resultados models.DuasResultado
 	var ResultadosCentral []models.DuasResultadoCentral
 	var ResultadosLocal []models.DuasResultadoLocal
 
-	// toNull convierte un string vacío en NULL para respetar la semántica
-	// "@param IS NULL" del query (clave para los parámetros DATE: '' no es
-	// convertible a DATE en SQL Server y rompería la consulta).
-	toNull := toNullString
-	var Query string
-	if Server.Type == "duas" {
-		Query = `
-		declare @etkt varchar(50) = ?
-		declare @nombre varchar(100) = ?
-		declare @apellido varchar(50)= ?
-		declare @vuelo varchar(10)=?
-		declare @asiento varchar(5)= ?
-		declare @origen varchar(3)= ?
-		declare @fechaA varchar(50)=?
-		declare @fechaB varchar(50)=?
-
-		 select tf.IDTES_FACTURA_ITINERARIO ,tf.FAC_NROVUELO ,tf.FAC_FECHAEMISION_FACTURA ,tf.FAC_DETALLEFACTURA ,tf.FAC_MONTO ,tf.FECHACREACION,tf.IDTES_FACTURAONLINE  ,tf.IDTES_FACTURAONLINE as "ID_DOCUMENTO" ,tf.FAC_NROFACTURA as "NUMEROFACTURA" ,tf.FAC_FECHAEMISION_FACTURA as "FECHA_EMISION"   ,tf.URL_SIN as "URL_SIN" 
-                from TES_FACTURAITINERARIO tf 
-                where (@nombre is null or tf.FAC_DETALLEFACTURA like '%' + @nombre + '%')
-                and (@etkt is null or tf.FAC_DETALLEFACTURA like '%2A' + @etkt + '%') 
-                and (@apellido is null or tf.FAC_DETALLEFACTURA like '%M1' + @apellido + '%')
-                and (@vuelo is null or tf.FAC_DETALLEFACTURA like '%' + @vuelo + '%')
-                and (@asiento is null or tf.FAC_DETALLEFACTURA like '%' + @asiento + '%')
-                and (@origen is null or tf.FAC_DETALLEFACTURA like '% ' + @origen + '%')
-                and tf.FAC_FECHAEMISION_FACTURA between @fechaA and @fechaB;
-		`
-		if err := db.Raw(Query,
-			toNull(params.Ticket),
-			toNull(params.Nombre),
-			toNull(params.Apellido),
-			toNull(params.NumeroVuelo),
-			toNull(params.Asiento),
-			nil, // @origen: sin parámetro de búsqueda por ahora
-			toNull(params.FechaDesde),
-			toNull(params.FechaHasta),
-		).Scan(&ResultadosCentral).Error; err != nil {
-			return nil, fmt.Errorf("error ejecutando consulta DUAS Central: %w", err)
+	switch strings.ToLower(strings.TrimSpace(Server.Type)) {
+	case models.TipoConexionDuas:
+		query, args := consultaDuas(duasCentralSQL, "tf.FAC_FECHAEMISION_FACTURA", params)
+		if err := db.Raw(query, args...).Scan(&ResultadosCentral).Error; err != nil {
+			return nil, errorConsulta(ctx, err, "error ejecutando consulta DUAS Central")
 		}
-	}
-	if Server.Type == "duas_local" {
-		Query = `
-		declare @etkt varchar(50) = ?
-		declare @nombre varchar(100) = ?
-		declare @apellido varchar(50)= ?
-		declare @vuelo varchar(10)=?
-		declare @asiento varchar(5)= ?
-		declare @origen varchar(3)= ?
-		declare @fechaA varchar(50)=?
-		declare @fechaB varchar(50)=?
-
-		select tf.IDTES_FACTURA_ITINERARIO ,tf.FAC_NROVUELO ,tf.FAC_FECHAEMISION_FACTURA ,tf.FAC_DETALLEFACTURA ,tf.FAC_MONTO ,tf.FECHACREACION,tf.IDTES_FACTURAONLINE ,tf2.CODIGO ,tf2.ID_DOCUMENTO ,tf2.CUF ,tf2.CUFD ,tf2.CUIS ,tf2.NUMEROFACTURA ,tf2.FECHA_EMISION ,tf2.ESTADO_DOCUMENTO_FISCAL ,tf2.CODIGO_INTEGRACION ,tf2.URL_SIN 
-		from TES_FACTURAITINERARIO tf 
-		join TES_FACTURAONLINE tf2 on tf.IDTES_FACTURAONLINE = tf2.ID_DOCUMENTO 
-		where (@nombre is null or tf.FAC_DETALLEFACTURA like '%' + @nombre + '%')
-		and (@etkt is null or tf.FAC_DETALLEFACTURA like '%2A' + @etkt + '%') 
-		and (@apellido is null or tf.FAC_DETALLEFACTURA like '%M1' + @apellido + '%')
-		and (@vuelo is null or tf.FAC_DETALLEFACTURA like '%' + @vuelo + '%')
-		and (@asiento is null or tf.FAC_DETALLEFACTURA like '%' + @asiento + '%')
-		and (@origen is null or tf.FAC_DETALLEFACTURA like '% ' + @origen + '%')
-		and tf.FAC_FECHAEMISION_FACTURA between @fechaA and @fechaB;
-		`
-		if err := db.Raw(Query,
-			toNull(params.Ticket),
-			toNull(params.Nombre),
-			toNull(params.Apellido),
-			toNull(params.NumeroVuelo),
-			toNull(params.Asiento),
-			nil, // @origen: sin parámetro de búsqueda por ahora
-			toNull(params.FechaDesde),
-			toNull(params.FechaHasta),
-		).Scan(&ResultadosLocal).Error; err != nil {
-			return nil, fmt.Errorf("error ejecutando consulta DUAS Local: %w", err)
+	case models.TipoConexionDuasCentral:
+		query, args := consultaDuas(duasCentralVuelosSQL, "tf.FAC_FECHAHORA_VUELO", params)
+		if err := db.Raw(query, args...).Scan(&ResultadosCentral).Error; err != nil {
+			return nil, errorConsulta(ctx, err, "error ejecutando consulta DUAS Central")
+		}
+	case models.TipoConexionDuasLocal:
+		query, args := consultaDuas(duasLocalSQL, "tf.FAC_FECHAEMISION_FACTURA", params)
+		if err := db.Raw(query, args...).Scan(&ResultadosLocal).Error; err != nil {
+			return nil, errorConsulta(ctx, err, "error ejecutando consulta DUAS Local")
 		}
+	default:
+		return nil, fmt.Errorf("la conexión '%s' (tipo '%s') no es un servidor DUAS", Server.ServerName, Server.Type)
 	}
-	// 	if Server.Type == "duas_central" {
-	// 		Query = `
-	// 			DECLARE @nombre      NVARCHAR(50) = ?
-	// 			DECLARE @apellido    NVARCHAR(50) = ?
-	// 			DECLARE @vuelo       NVARCHAR(10) = ?
-	// 			DECLARE @fecha_desde DATE         = ?
-	// 			DECLARE @fecha_hasta DATE         = ?
-	// 			DECLARE @asiento     NVARCHAR(10) = ?
-	// 			DECLARE @ticket      NVARCHAR(13) = ?
-
-	// 			SELECT
-	// 				t.IDTES_FACTURA_ITINERARIO,
-	// 				t.FAC_NROFACTURA,
-	// 				t.FAC_NROVUELO,
-	// 				t.FAC_FECHAHORA_VUELO,
-	// 				t.FAC_MONTO,
-	// 				t.IDA_ESTADOFACTURA,
-	// 				t.FECHACREACION,
-	// 				t.USUARIOCREACION,
-	// 				t.URL_SIN,
-	// 				t.FAC_DETALLEFACTURA,
-	// 				t.FAC_FECHAEMISION_FACTURA
-
-	// 			FROM TES_FACTURAITINERARIO t
-	// 			CROSS APPLY (
-	// 				SELECT
-	// 					UPPER(SUBSTRING(t.FAC_DETALLEFACTURA, 3, 20)) AS bloqueNombre
-	// 			) p
-	// 			WHERE
-	// 				(@apellido IS NULL OR p.bloqueNombre LIKE '%' + UPPER(@apellido) + '%')
-	// 				AND (@nombre   IS NULL OR p.bloqueNombre LIKE '%' + UPPER(@nombre)   + '%')
-	// 				AND (@vuelo    IS NULL OR t.FAC_NROVUELO = @vuelo)
-	// 				AND (
-	// 					@fecha_desde IS NULL
-	// 					OR (@fecha_hasta IS NULL     AND CAST(t.FAC_FECHAHORA_VUELO AS DATE) = @fecha_desde)
-	// 					OR (@fecha_hasta IS NOT NULL AND CAST(t.FAC_FECHAHORA_VUELO AS DATE) BETWEEN @fecha_desde AND @fecha_hasta)
-	// 				)
-	// 				AND (@asiento IS NULL OR t.FAC_DETALLEFACTURA LIKE '%' + @asiento + '%')
-	// 				AND (@ticket  IS NULL OR
-	// 					CASE WHEN CHARINDEX('2A', t.FAC_DETALLEFACTURA) > 0
-	// 						THEN SUBSTRING(t.FAC_DETALLEFACTURA, CHARINDEX('2A', t.FAC_DETALLEFACTURA) + 2, 13)
-	// 						ELSE NULL END = @ticket
-	// 				)
-
-	// 			ORDER BY t.FAC_FECHAHORA_VUELO DESC
-	// `
-	// 		if err := db.Raw(Query,
-	// 			toNull(params.Nombre),
-	// 			toNull(params.Apellido),
-	// 			toNull(params.NumeroVuelo),
-	// 			toNull(params.FechaDesde),
-	// 			toNull(params.FechaHasta),
-	// 			toNull(params.Asiento),
-	// 			toNull(params.Ticket),
-	// 		).Scan(&ResultadosCentral).Error; err != nil {
-	// 			return nil, fmt.Errorf("error ejecutando consulta DUAS Central: %w", err)
-	// 		}
-	// 	}
-	Resultados.ResultadosCentral = ResultadosCentral
-	Resultados.ResultadosLocal = ResultadosLocal
+
+	Resultados.ResultadosCentral = make([]models.DuasResultadoCentral, 0, len(ResultadosCentral))
+	Resultados.ResultadosLocal = make([]models.DuasResultadoLocal, 0, len(ResultadosLocal))
 
 	// Parsear el BCBP embebido en FAC_DETALLEFACTURA para poblar los campos
 	// que la tabla del front necesita (apellido, nombre, origen, etc.).
+	// Los LIKE del query solo acotan candidatos: el filtro fino se hace sobre
+	// los campos decodificados.
+	for _, r := range ResultadosCentral {
+		r.IDServidor, r.Servidor = Server.ID, Server.ServerName
+		r.DatosBCBP = datosBCBP(r.FACDetalleFactura, r.FacFechaEmisionFactura)
+		if coincideBCBP(r.DatosBCBP, params) {
+			Resultados.ResultadosCentral = append(Resultados.ResultadosCentral, r)
+		}
+	}
+	for _, r := range ResultadosLocal {
+		r.IDServidor, r.Servidor = Server.ID, Server.ServerName
+		r.DatosBCBP = datosBCBP(r.FACDetalleFactura, r.FacFechaEmisionFactura)
+		if coincideBCBP(r.DatosBCBP, params) {
+			Resultados.ResultadosLocal = append(Resultados.ResultadosLocal, r)
+		}
+	}
 
 	return &Resultados, nil
 }
 
-// sqlSubstring replica el comportamiento de SUBSTRING de SQL Server:
-// posición inicial 1-based y longitud recortada al final de la cadena.
-func sqlSubstring(s string, start, length int) string {
-	r := []rune(s)
-	if start < 1 {
-		length += start - 1
-		start = 1
+// coincideBCBP verifica los filtros de params contra el BCBP decodificado.
+// Si el detalle no se pudo decodificar la fila se conserva: el LIKE del
+// query es el único criterio disponible.
+func coincideBCBP(datos models.DatosBCBP, params models.DuasBusquedaParams) bool {
+	if len(datos.Tramos) == 0 {
+		return true
+	}
+	if params.Apellido != "" && !strings.HasPrefix(strings.ToUpper(datos.Apellido), strings.ToUpper(strings.TrimSpace(params.Apellido))) {
+		return false
 	}
-	if length <= 0 || start > len(r) {
-		return ""
+	if params.Nombre != "" && !strings.Contains(strings.ToUpper(datos.Pasajero), strings.ToUpper(strings.TrimSpace(params.Nombre))) {
+		return false
+	}
+	for _, tramo := range datos.Tramos {
+		if coincideTramo(tramo, params) {
+			return true
+		}
 	}
-	from := start - 1
-	to := min(from+length, len(r))
-	return string(r[from:to])
+	return false
 }
 
-// parseBCBP descompone FAC_DETALLEFACTURA (boarding pass BCBP) en los campos
-// del resultado, equivalente a las expresiones SUBSTRING/CHARINDEX del query.
+// coincideTramo compara vuelo, asiento, ticket, origen, destino y PNR con un
+// tramo (todos sobre el mismo tramo). El vuelo se acepta con o sin
+// transportista y con o sin ceros a la izquierda.
+func coincideTramo(tramo models.TramoBCBP, params models.DuasBusquedaParams) bool {
+	if vuelo := normalizarVuelo(params.NumeroVuelo); vuelo != "" {
+		sinTransportista := strings.TrimPrefix(tramo.Vuelo, tramo.Transportista)
+		if vuelo != tramo.Vuelo && vuelo != sinTransportista {
+			return false
+		}
+	}
+	if asiento := strings.TrimLeft(strings.ToUpper(strings.TrimSpace(params.Asiento)), "0"); asiento != "" && asiento != tramo.Asiento {
+		return false
+	}
+	if ticket := strings.TrimSpace(params.Ticket); ticket != "" && tramo.NumeroTicket != "" && !strings.HasSuffix(tramo.NumeroTicket, ticket) {
+		return false
+	}
+	if params.Origen != "" && !strings.EqualFold(params.Origen, tramo.Origen) {
+		return false
+	}
+	if params.Destino != "" && !strings.EqualFold(params.Destino, tramo.Destino) {
+		return false
+	}
+	if params.PNR != "" && !strings.EqualFold(params.PNR, tramo.PNR) {
+		return false
+	}
+	return true
+}
 
-func (s *ConsultasService) Sucursales(idServer string) (*[]models.SFE_sucursales, error) {
-	idServer_parse, err := strconv.ParseInt(idServer, 10, 64)
-	if err != nil {
-		return nil, err
+// normalizarVuelo lleva "OB 0760" / "0760" a "OB760" / "760".
+func normalizarVuelo(vuelo string) string {
+	vuelo = strings.ToUpper(strings.ReplaceAll(vuelo, " ", ""))
+	i := 0
+	for i < len(vuelo) && (vuelo[i] < '0' || vuelo[i] > '9') {
+		i++
 	}
-	server, errServer := s.ConsultasRepo.GetServidorById(idServer_parse)
-	if errServer != nil {
-		return nil, errServer
+	numero := strings.TrimLeft(vuelo[i:], "0")
+	if numero == "" {
+		return vuelo
 	}
-	// Construcción del DSN (Data Source Name) para SQL Server
-	dsn := fmt.Sprintf("sqlserver://%s:%s@%s:%d?database=%s",
-		server.Username,
-		server.Password,
-		server.Host,
-		server.Port,
-		server.DatabaseName,
-	)
+	return vuelo[:i] + numero
+}
 
-	var db *gorm.DB
+// datosBCBP decodifica el boarding pass de FAC_DETALLEFACTURA. La fecha
+// juliana del vuelo no trae año: se resuelve con la fecha de emisión de la
+// factura como referencia.
+func datosBCBP(detalle string, emision time.Time) models.DatosBCBP {
+	pase, err := bcbp.Buscar(detalle)
+	if pase == nil {
+		return models.DatosBCBP{ErrorBCBP: err.Error()}
+	}
 
-	// Intentar conectar primero para verificar si hay conexión activa
-	db, err = gorm.Open(sqlserver.Open(dsn), &gorm.Config{})
-	if err != nil {
-		return nil, fmt.Errorf("no se pudo conectar: %w", err)
+	datos := models.DatosBCBP{
+		Pasajero: pase.NombrePasajero,
+		Apellido: pase.Apellido,
+		Nombre:   pase.Nombre,
 	}
+	// Un BCBP truncado igual devuelve los tramos que alcanzó a leer.
+	if err != nil {
+		datos.ErrorBCBP = err.Error()
+	}
+	for _, tramo := range pase.Tramos {
+		t := models.TramoBCBP{
+			PNR:           tramo.PNR,
+			Origen:        tramo.Origen,
+			Destino:       tramo.Destino,
+			Transportista: tramo.Transportista,
+			Vuelo:         tramo.Vuelo(),
+			FechaJuliana:  tramo.FechaJuliana,
+			Asiento:       tramo.Asiento,
+			NumeroTicket:  tramo.NumeroTicket(),
+		}
+		if !emision.IsZero() {
+			if fecha := tramo.FechaVuelo(emision); !fecha.IsZero() {
+				t.FechaVuelo = &fecha
+			}
+		}
+		datos.Tramos = append(datos.Tramos, t)
+	}
+	if len(datos.Tramos) > 0 {
+		primero := datos.Tramos[0]
+		datos.PNR = primero.PNR
+		datos.Origen = primero.Origen
+		datos.Destino = primero.Destino
+		datos.Transportista = primero.Transportista
+		datos.Vuelo = primero.Vuelo
+		datos.FechaJuliana = primero.FechaJuliana
+		datos.FechaVuelo = primero.FechaVuelo
+		datos.Asiento = primero.Asiento
+		datos.NumeroTicket = primero.NumeroTicket
+	}
+	return datos
+}
 
-	// Verificar si la conexión está activa
-	sqlDB, err := db.DB()
+func (s *ConsultasService) Sucursales(ctx context.Context, idServer string) (*[]models.SFE_sucursales, error) {
+	db, server, err := s.conexion(idServer)
 	if err != nil {
 		return nil, err
 	}
-	defer sqlDB.Close()
-
-	// Ping para confirmar conexión
-	if err := sqlDB.Ping(); err != nil {
-		// Si falla, intentar crear nueva conexión
-		db, err = gorm.Open(sqlserver.Open(dsn), &gorm.Config{})
-		if err != nil {
-			return nil, fmt.Errorf("error al crear nueva conexión: %w", err)
-		}
-	}
+	ctx, cancel := contextoConsulta(ctx, server)
+	defer cancel()
 	var servidores []models.SFE_sucursales
-	errDataSuc := db.Table("sfe_sucursal").Find(&servidores).Error
+	errDataSuc := db.WithContext(ctx).Table("sfe_sucursal").Find(&servidores).Error
 	if errDataSuc != nil {
-		return nil, errDataSuc
+		return nil, errorConsulta(ctx, errDataSuc, "error obteniendo sucursales")
 	}
 	return &servidores, nil
 }
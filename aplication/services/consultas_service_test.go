@@ -0,0 +1,45 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"managerfact/internal/domain/models"
+	"testing"
+	"time"
+)
+
+func TestContextoConsultaUsaQueryTimeout(t *testing.T) {
+	servidor := &models.DbConnection{QueryTimeoutSeconds: 7}
+	antes := time.Now()
+	ctx, cancel := contextoConsulta(context.Background(), servidor)
+	defer cancel()
+
+	limite, ok := ctx.Deadline()
+	if !ok {
+		t.Fatal("el contexto no tiene deadline")
+	}
+	if d := limite.Sub(antes); d < 7*time.Second || d > 8*time.Second {
+		t.Errorf("deadline a %v, se esperaban 7s", d)
+	}
+}
+
+func TestErrorConsultaTimeout(t *testing.T) {
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	err := errorConsulta(ctx, errors.New("driver: i/o timeout"), "Error ejecutando consulta")
+	if !errors.Is(err, ErrConsultaTimeout) {
+		t.Errorf("err = %v, se esperaba ErrConsultaTimeout", err)
+	}
+}
+
+func TestErrorConsultaSinTimeout(t *testing.T) {
+	original := errors.New("sintaxis inválida")
+	err := errorConsulta(context.Background(), original, "Error ejecutando consulta")
+	if errors.Is(err, ErrConsultaTimeout) {
+		t.Errorf("err = %v, no debía ser ErrConsultaTimeout", err)
+	}
+	if !errors.Is(err, original) {
+		t.Errorf("err = %v, debía envolver el error original", err)
+	}
+}
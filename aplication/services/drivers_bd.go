@@ -0,0 +1,178 @@
+package services
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"managerfact/internal/domain/models"
+	"net"
+	"net/url"
+	"strconv"
+	"time"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlserver"
+	"gorm.io/gorm"
+)
+
+// DriverBD encapsula lo que depende del motor de una DbConnection: armar el
+// DSN, abrirla con database/sql (pruebas de conexión, chequeos de salud) o
+// con gorm (pools de ConexionesRemotas) y leer la información del servidor.
+// Se elige con DbConnection.Driver (ver driverDe).
+type DriverBD interface {
+	// PuertoPorDefecto es el que se usa si la conexión no define Port.
+	PuertoPorDefecto() int
+	// DSN arma la cadena de conexión con la contraseña ya descifrada.
+	DSN(conexion *models.DbConnection, password string) string
+	// NombreSQL es el nombre del driver registrado en database/sql.
+	NombreSQL() string
+	Dialector(dsn string) gorm.Dialector
+	InfoServidor(ctx context.Context, db *sql.DB) (*ServerInfo, error)
+}
+
+// timeoutConexionBD es el tope para establecer la conexión (no para las
+// consultas, que usan DbConnection.QueryTimeout).
+const timeoutConexionBD = 15 * time.Second
+
+var driversBD = map[string]DriverBD{
+	models.DriverSQLServer: driverSQLServer{},
+	models.DriverPostgres:  driverPostgres{},
+	models.DriverMySQL:     driverMySQL{},
+}
+
+// driverDe devuelve el DriverBD de la conexión.
+func driverDe(conexion *models.DbConnection) (DriverBD, error) {
+	driver, ok := driversBD[conexion.DriverNormalizado()]
+	if !ok {
+		return nil, fmt.Errorf("driver de base de datos no soportado: '%s' (sqlserver, postgres o mysql)", conexion.Driver)
+	}
+	return driver, nil
+}
+
+// dsnConexion descifra la contraseña de la conexión y arma su DSN con el
+// driver que corresponde.
+func dsnConexion(conexion *models.DbConnection) (DriverBD, string, error) {
+	driver, err := driverDe(conexion)
+	if err != nil {
+		return nil, "", err
+	}
+	password, err := conexion.PasswordPlano()
+	if err != nil {
+		return nil, "", err
+	}
+	return driver, driver.DSN(conexion, password), nil
+}
+
+// abrirSQL abre la conexión con database/sql (sin pool compartido), para
+// pruebas y chequeos puntuales; quien llama la cierra.
+func abrirSQL(conexion *models.DbConnection) (*sql.DB, error) {
+	driver, dsn, err := dsnConexion(conexion)
+	if err != nil {
+		return nil, err
+	}
+	db, err := sql.Open(driver.NombreSQL(), dsn)
+	if err != nil {
+		return nil, fmt.Errorf("error abriendo conexión: %w", err)
+	}
+	return db, nil
+}
+
+// driverSQLServer es go-mssqldb, el motor de los facturadores SFE y de la
+// mayoría de los servidores DUAS.
+type driverSQLServer struct{}
+
+func (driverSQLServer) PuertoPorDefecto() int { return 1433 }
+
+// DSN arma "sqlserver://". Usuario y contraseña van escapados con
+// url.UserPassword: una contraseña con "@", ":" o "/" rompía el DSN armado
+// a mano con fmt.Sprintf.
+func (driverSQLServer) DSN(conexion *models.DbConnection, password string) string {
+	dsn := url.URL{
+		Scheme: "sqlserver",
+		User:   url.UserPassword(conexion.Username, password),
+		Host:   net.JoinHostPort(conexion.Host, strconv.Itoa(conexion.Port)),
+		RawQuery: url.Values{
+			"database":           {conexion.DatabaseName},
+			"connection timeout": {strconv.Itoa(int(timeoutConexionBD.Seconds()))},
+		}.Encode(),
+	}
+	return dsn.String()
+}
+
+func (driverSQLServer) NombreSQL() string { return "sqlserver" }
+
+func (driverSQLServer) Dialector(dsn string) gorm.Dialector { return sqlserver.Open(dsn) }
+
+func (driverSQLServer) InfoServidor(ctx context.Context, db *sql.DB) (*ServerInfo, error) {
+	return leerInfoServidor(ctx, db, `
+		SELECT
+			@@VERSION as version,
+			SERVERPROPERTY('ProductName') as product_name,
+			SERVERPROPERTY('Edition') as edition
+	`)
+}
+
+// driverPostgres usa pgx (el mismo driver que la base principal).
+type driverPostgres struct{}
+
+func (driverPostgres) PuertoPorDefecto() int { return 5432 }
+
+func (driverPostgres) DSN(conexion *models.DbConnection, password string) string {
+	dsn := url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(conexion.Username, password),
+		Host:   net.JoinHostPort(conexion.Host, strconv.Itoa(conexion.Port)),
+		Path:   "/" + conexion.DatabaseName,
+		RawQuery: url.Values{
+			"sslmode":         {"disable"},
+			"connect_timeout": {strconv.Itoa(int(timeoutConexionBD.Seconds()))},
+		}.Encode(),
+	}
+	return dsn.String()
+}
+
+func (driverPostgres) NombreSQL() string { return "pgx" }
+
+func (driverPostgres) Dialector(dsn string) gorm.Dialector { return postgres.Open(dsn) }
+
+func (driverPostgres) InfoServidor(ctx context.Context, db *sql.DB) (*ServerInfo, error) {
+	return leerInfoServidor(ctx, db, `SELECT version(), 'PostgreSQL', current_setting('server_version')`)
+}
+
+// driverMySQL usa go-sql-driver/mysql; ParseTime para que DATETIME se lea
+// como time.Time igual que en los otros motores.
+type driverMySQL struct{}
+
+func (driverMySQL) PuertoPorDefecto() int { return 3306 }
+
+func (driverMySQL) DSN(conexion *models.DbConnection, password string) string {
+	config := mysqldriver.NewConfig()
+	config.User = conexion.Username
+	config.Passwd = password
+	config.Net = "tcp"
+	config.Addr = net.JoinHostPort(conexion.Host, strconv.Itoa(conexion.Port))
+	config.DBName = conexion.DatabaseName
+	config.ParseTime = true
+	config.Timeout = timeoutConexionBD
+	return config.FormatDSN()
+}
+
+func (driverMySQL) NombreSQL() string { return "mysql" }
+
+func (driverMySQL) Dialector(dsn string) gorm.Dialector { return mysql.Open(dsn) }
+
+func (driverMySQL) InfoServidor(ctx context.Context, db *sql.DB) (*ServerInfo, error) {
+	return leerInfoServidor(ctx, db, `SELECT version(), 'MySQL', @@version_comment`)
+}
+
+// leerInfoServidor ejecuta query, que devuelve versión, producto y edición
+// en ese orden.
+func leerInfoServidor(ctx context.Context, db *sql.DB, query string) (*ServerInfo, error) {
+	info := &ServerInfo{}
+	if err := db.QueryRowContext(ctx, query).Scan(&info.Version, &info.ProductName, &info.Edition); err != nil {
+		return nil, fmt.Errorf("error obteniendo información del servidor: %w", err)
+	}
+	return info, nil
+}
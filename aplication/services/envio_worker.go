@@ -90,7 +90,7 @@ func (w *EnvioWorker) procesarPrevaloradas() {
 		if !w.sucursalDisponible(factura.SucursalFacturador, fallidas) {
 			continue
 		}
-		if _, err := w.facturaPrevalorada.Facturar(factura.ID, "automatico"); err != nil {
+		if _, err := w.facturaPrevalorada.Facturar(factura.ID, "automatico", 0); err != nil {
 			log.Printf("[EnvioWorker] error facturando prevalorada id=%d: %v", factura.ID, err)
 			fallidas[factura.SucursalFacturadorID] = true
 		}
@@ -112,7 +112,7 @@ func (w *EnvioWorker) procesarAnulaciones() {
 		if !w.sucursalDisponible(factura.SucursalFacturador, fallidas) {
 			continue
 		}
-		if _, err := w.facturaAnulacion.Anular(factura.ID, "automatico"); err != nil {
+		if _, err := w.facturaAnulacion.Anular(factura.ID, "automatico", 0); err != nil {
 			log.Printf("[EnvioWorker] error anulando id=%d: %v", factura.ID, err)
 			fallidas[factura.SucursalFacturadorID] = true
 		}
@@ -0,0 +1,466 @@
+package services
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/johnfercher/maroto/v2"
+	"github.com/johnfercher/maroto/v2/pkg/components/col"
+	"github.com/johnfercher/maroto/v2/pkg/components/row"
+	"github.com/johnfercher/maroto/v2/pkg/components/text"
+	"github.com/johnfercher/maroto/v2/pkg/config"
+	"github.com/johnfercher/maroto/v2/pkg/consts/align"
+	"github.com/johnfercher/maroto/v2/pkg/consts/fontstyle"
+	"github.com/johnfercher/maroto/v2/pkg/consts/orientation"
+	"github.com/johnfercher/maroto/v2/pkg/consts/pagesize"
+	"github.com/johnfercher/maroto/v2/pkg/core"
+	"github.com/johnfercher/maroto/v2/pkg/props"
+	"github.com/xuri/excelize/v2"
+)
+
+// FormatoExportacion es el formato de archivo pedido con ?format= en los
+// endpoints de consultas.
+type FormatoExportacion string
+
+const (
+	FormatoXLSX FormatoExportacion = "xlsx"
+	FormatoCSV  FormatoExportacion = "csv"
+	FormatoPDF  FormatoExportacion = "pdf"
+)
+
+// LimiteFilasPDF es el máximo de filas de un PDF: maroto arma el documento
+// entero en memoria, así que un PDF no se genera en segundo plano y por
+// encima de este límite se pide xlsx o csv.
+const LimiteFilasPDF = 5000
+
+// ErrPDFDemasiadasFilas se devuelve al pedir un PDF de más de
+// LimiteFilasPDF filas; el handler lo traduce a 422.
+var ErrPDFDemasiadasFilas = fmt.Errorf("el PDF admite hasta %d filas: para resultados más grandes exportar en xlsx o csv", LimiteFilasPDF)
+
+// ParseFormatoExportacion valida el ?format= recibido. Devuelve "" (sin
+// error) si el texto viene vacío: la respuesta va en JSON como siempre.
+func ParseFormatoExportacion(texto string) (FormatoExportacion, error) {
+	switch formato := FormatoExportacion(strings.ToLower(strings.TrimSpace(texto))); formato {
+	case "", FormatoXLSX, FormatoCSV, FormatoPDF:
+		return formato, nil
+	default:
+		return "", fmt.Errorf("formato '%s' no soportado (usar xlsx, csv o pdf)", texto)
+	}
+}
+
+// ContentType es el MIME del archivo generado en este formato.
+func (f FormatoExportacion) ContentType() string {
+	switch f {
+	case FormatoXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case FormatoCSV:
+		return "text/csv; charset=utf-8"
+	case FormatoPDF:
+		return "application/pdf"
+	}
+	return "application/octet-stream"
+}
+
+// TipoColumna define cómo se escribe el valor de una columna exportada: en
+// xlsx como número/fecha reales (no texto), en csv/pdf con un formato fijo.
+type TipoColumna int
+
+const (
+	ColumnaTexto TipoColumna = iota
+	ColumnaEntero
+	ColumnaDecimal
+	ColumnaFecha
+)
+
+// ColumnaExportacion es una columna del reporte. Totalizar suma la columna
+// (solo ColumnaEntero/ColumnaDecimal) en la fila de totales. Ancho es el peso
+// relativo de la columna en el PDF y, x2, su ancho en el xlsx.
+type ColumnaExportacion struct {
+	Titulo    string
+	Tipo      TipoColumna
+	Totalizar bool
+	Ancho     int
+}
+
+// FiltroAplicado es un filtro con valor mostrado en el encabezado del
+// reporte, para que el archivo diga de qué consulta salió.
+type FiltroAplicado struct {
+	Nombre string
+	Valor  string
+}
+
+// ReporteExportacion describe el archivo a generar: título, encabezado
+// (filtros, usuario y fecha de generación) y columnas. Las filas llegan
+// aparte, por una FuenteFilas, para no exigir tenerlas todas en memoria.
+type ReporteExportacion struct {
+	Titulo      string
+	NombreBase  string
+	Filtros     []FiltroAplicado
+	Columnas    []ColumnaExportacion
+	GeneradoPor string
+	GeneradoEn  time.Time
+}
+
+// NombreArchivo arma "<nombre_base>_<fecha>.<formato>".
+func (r *ReporteExportacion) NombreArchivo(formato FormatoExportacion) string {
+	return fmt.Sprintf("%s_%s.%s", r.NombreBase, r.GeneradoEn.Format("20060102_150405"), formato)
+}
+
+// FuenteFilas recorre las filas del reporte llamando a emitir con cada una
+// (un valor por columna, en el orden de ReporteExportacion.Columnas). Si
+// emitir devuelve error la fuente debe cortar y devolverlo.
+type FuenteFilas func(emitir func(fila []any) error) error
+
+// FilasEnMemoria adapta filas ya cargadas a FuenteFilas.
+func FilasEnMemoria(filas [][]any) FuenteFilas {
+	return func(emitir func(fila []any) error) error {
+		for _, fila := range filas {
+			if err := emitir(fila); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// GenerarReporte escribe el reporte en w en el formato pedido y devuelve la
+// cantidad de filas de datos escritas.
+func GenerarReporte(w io.Writer, formato FormatoExportacion, reporte *ReporteExportacion, fuente FuenteFilas) (int, error) {
+	switch formato {
+	case FormatoXLSX:
+		return generarXLSX(w, reporte, fuente)
+	case FormatoCSV:
+		return generarCSV(w, reporte, fuente)
+	case FormatoPDF:
+		return generarPDF(w, reporte, fuente)
+	}
+	return 0, fmt.Errorf("formato '%s' no soportado", formato)
+}
+
+// encabezadoReporte son las líneas "clave: valor" que van antes de la tabla
+// en los tres formatos.
+func encabezadoReporte(reporte *ReporteExportacion) []FiltroAplicado {
+	lineas := make([]FiltroAplicado, 0, len(reporte.Filtros)+2)
+	lineas = append(lineas, reporte.Filtros...)
+	lineas = append(lineas,
+		FiltroAplicado{Nombre: "Generado por", Valor: reporte.GeneradoPor},
+		FiltroAplicado{Nombre: "Generado el", Valor: reporte.GeneradoEn.Format("2006-01-02 15:04:05")},
+	)
+	return lineas
+}
+
+// acumularTotales suma a totales los valores numéricos de las columnas con
+// Totalizar.
+func acumularTotales(columnas []ColumnaExportacion, totales []float64, fila []any) {
+	for i, columna := range columnas {
+		if !columna.Totalizar || i >= len(fila) {
+			continue
+		}
+		switch v := fila[i].(type) {
+		case float64:
+			totales[i] += v
+		case int:
+			totales[i] += float64(v)
+		case uint:
+			totales[i] += float64(v)
+		}
+	}
+}
+
+// tieneTotales indica si alguna columna pide fila de totales.
+func tieneTotales(columnas []ColumnaExportacion) bool {
+	for _, columna := range columnas {
+		if columna.Totalizar {
+			return true
+		}
+	}
+	return false
+}
+
+// textoCelda formatea un valor para csv/pdf según el tipo de su columna.
+func textoCelda(tipo TipoColumna, valor any) string {
+	switch v := valor.(type) {
+	case nil:
+		return ""
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return v.Format("2006-01-02 15:04:05")
+	case float64:
+		if tipo == ColumnaEntero {
+			return strconv.FormatFloat(v, 'f', 0, 64)
+		}
+		return strconv.FormatFloat(v, 'f', 2, 64)
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func generarCSV(w io.Writer, reporte *ReporteExportacion, fuente FuenteFilas) (int, error) {
+	// BOM UTF-8: sin él Excel abre el csv en ANSI y rompe tildes y eñes.
+	if _, err := io.WriteString(w, "\uFEFF"); err != nil {
+		return 0, err
+	}
+	escritor := csv.NewWriter(w)
+
+	escritor.Write([]string{reporte.Titulo})
+	for _, linea := range encabezadoReporte(reporte) {
+		escritor.Write([]string{linea.Nombre, linea.Valor})
+	}
+	escritor.Write(nil)
+
+	titulos := make([]string, len(reporte.Columnas))
+	for i, columna := range reporte.Columnas {
+		titulos[i] = columna.Titulo
+	}
+	escritor.Write(titulos)
+
+	totales := make([]float64, len(reporte.Columnas))
+	filas := 0
+	err := fuente(func(fila []any) error {
+		registro := make([]string, len(reporte.Columnas))
+		for i, columna := range reporte.Columnas {
+			if i < len(fila) {
+				registro[i] = textoCelda(columna.Tipo, fila[i])
+			}
+		}
+		acumularTotales(reporte.Columnas, totales, fila)
+		filas++
+		return escritor.Write(registro)
+	})
+	if err != nil {
+		return filas, err
+	}
+
+	if tieneTotales(reporte.Columnas) {
+		registro := make([]string, len(reporte.Columnas))
+		registro[0] = "TOTALES"
+		for i, columna := range reporte.Columnas {
+			if columna.Totalizar {
+				registro[i] = textoCelda(columna.Tipo, totales[i])
+			}
+		}
+		escritor.Write(registro)
+	}
+
+	escritor.Flush()
+	return filas, escritor.Error()
+}
+
+func generarXLSX(w io.Writer, reporte *ReporteExportacion, fuente FuenteFilas) (int, error) {
+	f := excelize.NewFile()
+	defer f.Close()
+	hoja := f.GetSheetName(0)
+
+	// StreamWriter escribe fila por fila a un archivo temporal de excelize:
+	// el reporte no se arma entero en memoria.
+	sw, err := f.NewStreamWriter(hoja)
+	if err != nil {
+		return 0, fmt.Errorf("error creando hoja: %w", err)
+	}
+
+	negrita := &excelize.Font{Bold: true}
+	estiloTitulo, _ := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true, Size: 14}})
+	estiloEtiqueta, _ := f.NewStyle(&excelize.Style{Font: negrita})
+	estiloCabecera, _ := f.NewStyle(&excelize.Style{
+		Font: negrita,
+		Fill: excelize.Fill{Type: "pattern", Pattern: 1, Color: []string{"D9D9D9"}},
+	})
+	estiloEntero, _ := f.NewStyle(&excelize.Style{NumFmt: 3})
+	estiloDecimal, _ := f.NewStyle(&excelize.Style{NumFmt: 4})
+	formatoFecha := "yyyy-mm-dd hh:mm:ss"
+	estiloFecha, _ := f.NewStyle(&excelize.Style{CustomNumFmt: &formatoFecha})
+	estiloTotalEntero, _ := f.NewStyle(&excelize.Style{Font: negrita, NumFmt: 3})
+	estiloTotalDecimal, _ := f.NewStyle(&excelize.Style{Font: negrita, NumFmt: 4})
+
+	for i, columna := range reporte.Columnas {
+		ancho := float64(columna.Ancho * 2)
+		if ancho < 10 {
+			ancho = 10
+		}
+		if err := sw.SetColWidth(i+1, i+1, ancho); err != nil {
+			return 0, err
+		}
+	}
+
+	numeroFila := 1
+	escribir := func(valores []any) error {
+		celda, _ := excelize.CoordinatesToCellName(1, numeroFila)
+		numeroFila++
+		return sw.SetRow(celda, valores)
+	}
+
+	escribir([]any{excelize.Cell{StyleID: estiloTitulo, Value: reporte.Titulo}})
+	for _, linea := range encabezadoReporte(reporte) {
+		escribir([]any{excelize.Cell{StyleID: estiloEtiqueta, Value: linea.Nombre}, linea.Valor})
+	}
+	numeroFila++
+
+	cabecera := make([]any, len(reporte.Columnas))
+	for i, columna := range reporte.Columnas {
+		cabecera[i] = excelize.Cell{StyleID: estiloCabecera, Value: columna.Titulo}
+	}
+	if err := escribir(cabecera); err != nil {
+		return 0, err
+	}
+
+	totales := make([]float64, len(reporte.Columnas))
+	filas := 0
+	err = fuente(func(fila []any) error {
+		valores := make([]any, len(reporte.Columnas))
+		for i, columna := range reporte.Columnas {
+			if i >= len(fila) {
+				continue
+			}
+			switch columna.Tipo {
+			case ColumnaEntero:
+				valores[i] = excelize.Cell{StyleID: estiloEntero, Value: fila[i]}
+			case ColumnaDecimal:
+				valores[i] = excelize.Cell{StyleID: estiloDecimal, Value: fila[i]}
+			case ColumnaFecha:
+				if fecha, ok := fila[i].(time.Time); ok && !fecha.IsZero() {
+					valores[i] = excelize.Cell{StyleID: estiloFecha, Value: fecha}
+				}
+			default:
+				valores[i] = fila[i]
+			}
+		}
+		acumularTotales(reporte.Columnas, totales, fila)
+		filas++
+		return escribir(valores)
+	})
+	if err != nil {
+		return filas, err
+	}
+
+	if tieneTotales(reporte.Columnas) {
+		valores := make([]any, len(reporte.Columnas))
+		valores[0] = excelize.Cell{StyleID: estiloEtiqueta, Value: "TOTALES"}
+		for i, columna := range reporte.Columnas {
+			if !columna.Totalizar {
+				continue
+			}
+			estilo := estiloTotalDecimal
+			if columna.Tipo == ColumnaEntero {
+				estilo = estiloTotalEntero
+			}
+			valores[i] = excelize.Cell{StyleID: estilo, Value: totales[i]}
+		}
+		escribir(valores)
+	}
+
+	if err := sw.Flush(); err != nil {
+		return filas, fmt.Errorf("error generando xlsx: %w", err)
+	}
+	if err := f.Write(w); err != nil {
+		return filas, fmt.Errorf("error generando xlsx: %w", err)
+	}
+	return filas, nil
+}
+
+func generarPDF(w io.Writer, reporte *ReporteExportacion, fuente FuenteFilas) (int, error) {
+	gris := &props.Color{Red: 217, Green: 217, Blue: 217}
+
+	// La grilla del PDF suma el Ancho de todas las columnas, así cada
+	// reporte reparte el ancho de la hoja según sus propias columnas.
+	grilla := 0
+	for _, columna := range reporte.Columnas {
+		grilla += columna.Ancho
+	}
+
+	cfg := config.NewBuilder().
+		WithPageSize(pagesize.A4).
+		WithOrientation(orientation.Horizontal).
+		WithMaxGridSize(grilla).
+		WithLeftMargin(8).
+		WithRightMargin(8).
+		WithTopMargin(8).
+		WithPageNumber().
+		WithTitle(reporte.Titulo, true).
+		WithAuthor(reporte.GeneradoPor, true).
+		WithCreationDate(reporte.GeneradoEn).
+		Build()
+	m := maroto.New(cfg)
+
+	m.AddAutoRow(text.NewCol(grilla, reporte.Titulo, props.Text{Size: 12, Style: fontstyle.Bold}))
+	for _, linea := range encabezadoReporte(reporte) {
+		m.AddAutoRow(text.NewCol(grilla, linea.Nombre+": "+linea.Valor, props.Text{Size: 8}))
+	}
+	m.AddRow(3, col.New(grilla))
+
+	estiloCabecera := props.Text{Size: 6, Style: fontstyle.Bold, Left: 0.5, Right: 0.5, Top: 0.5}
+	cabecera := make([]core.Col, 0, len(reporte.Columnas))
+	for _, columna := range reporte.Columnas {
+		cabecera = append(cabecera, text.NewCol(columna.Ancho, columna.Titulo, estiloCabecera))
+	}
+	m.AddRows(row.New().Add(cabecera...).WithStyle(&props.Cell{BackgroundColor: gris}))
+
+	totales := make([]float64, len(reporte.Columnas))
+	filas := 0
+	err := fuente(func(fila []any) error {
+		if filas >= LimiteFilasPDF {
+			return ErrPDFDemasiadasFilas
+		}
+		r := row.New()
+		for i, columna := range reporte.Columnas {
+			var valor any
+			if i < len(fila) {
+				valor = fila[i]
+			}
+			r.Add(text.NewCol(columna.Ancho, textoCelda(columna.Tipo, valor), estiloPDF(columna, false)))
+		}
+		acumularTotales(reporte.Columnas, totales, fila)
+		filas++
+		m.AddRows(r)
+		return nil
+	})
+	if err != nil {
+		return filas, err
+	}
+
+	if tieneTotales(reporte.Columnas) {
+		r := row.New()
+		for i, columna := range reporte.Columnas {
+			valor := ""
+			switch {
+			case i == 0:
+				valor = "TOTALES"
+			case columna.Totalizar:
+				valor = textoCelda(columna.Tipo, totales[i])
+			}
+			r.Add(text.NewCol(columna.Ancho, valor, estiloPDF(columna, true)))
+		}
+		m.AddRows(r.WithStyle(&props.Cell{BackgroundColor: gris}))
+	}
+
+	documento, err := m.Generate()
+	if err != nil {
+		return filas, fmt.Errorf("error generando pdf: %w", err)
+	}
+	buffer := bufio.NewWriter(w)
+	if _, err := buffer.Write(documento.GetBytes()); err != nil {
+		return filas, err
+	}
+	return filas, buffer.Flush()
+}
+
+// estiloPDF es el estilo de una celda de datos/totales: números alineados a
+// la derecha.
+func estiloPDF(columna ColumnaExportacion, negrita bool) props.Text {
+	estilo := props.Text{Size: 6, Left: 0.5, Right: 0.5, Top: 0.5}
+	if columna.Tipo == ColumnaEntero || columna.Tipo == ColumnaDecimal {
+		estilo.Align = align.Right
+	}
+	if negrita {
+		estilo.Style = fontstyle.Bold
+	}
+	return estilo
+}
@@ -0,0 +1,59 @@
+package services
+
+import (
+	"errors"
+	"managerfact/internal/domain/models"
+	"testing"
+)
+
+// Un rango sin facturas se exporta igual: ExportarFacturas genera el
+// reporte con encabezado y filtros pero sin filas.
+func TestGenerarReporteSinFilas(t *testing.T) {
+	data := models.Json_consulta_data{IdFacturador: "1", FechaDesde: "2026-01-01", FechaHasta: "2026-01-31"}
+	for _, formato := range []FormatoExportacion{FormatoXLSX, FormatoCSV, FormatoPDF} {
+		t.Run(string(formato), func(t *testing.T) {
+			archivo, err := generarEnMemoria(formato, reporteFacturas(data, "tester"), FilasEnMemoria(nil))
+			if err != nil {
+				t.Fatalf("generarEnMemoria: %v", err)
+			}
+			if len(archivo.Contenido) == 0 {
+				t.Error("el archivo está vacío, se esperaba al menos el encabezado")
+			}
+		})
+	}
+}
+
+// Un PDF corta al pasar LimiteFilasPDF sin seguir pidiendo filas a la
+// fuente, y nunca se encola.
+func TestGenerarPDFLimiteFilas(t *testing.T) {
+	reporte := reporteFacturas(models.Json_consulta_data{IdFacturador: "1"}, "tester")
+	pedidas := 0
+	fuente := func(emitir func(fila []any) error) error {
+		for i := 0; i < LimiteFilasPDF*2; i++ {
+			pedidas++
+			if err := emitir([]any{"x"}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	_, err := generarEnMemoria(FormatoPDF, reporte, fuente)
+	if !errors.Is(err, ErrPDFDemasiadasFilas) {
+		t.Fatalf("err = %v, se esperaba ErrPDFDemasiadasFilas", err)
+	}
+	if pedidas != LimiteFilasPDF+1 {
+		t.Errorf("se pidieron %d filas, se esperaba cortar en %d", pedidas, LimiteFilasPDF+1)
+	}
+
+	s := &ExportacionesService{umbral: LimiteFilasPDF * 10}
+	if umbral := s.UmbralSincrono(FormatoPDF); umbral != LimiteFilasPDF {
+		t.Errorf("UmbralSincrono(pdf) = %d, se esperaba %d", umbral, LimiteFilasPDF)
+	}
+	if !errors.Is(encolable(FormatoPDF), ErrPDFDemasiadasFilas) {
+		t.Error("un PDF no debería poder encolarse")
+	}
+	if err := encolable(FormatoXLSX); err != nil {
+		t.Errorf("encolable(xlsx) = %v, se esperaba nil", err)
+	}
+}
@@ -0,0 +1,224 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Estados de un TrabajoExportacion.
+const (
+	EstadoExportacionPendiente  = "pendiente"
+	EstadoExportacionProcesando = "procesando"
+	EstadoExportacionListo      = "listo"
+	EstadoExportacionError      = "error"
+)
+
+// ErrExportacionNoEncontrada se devuelve cuando el trabajo no existe, ya
+// expiró o pertenece a otro usuario (no se distingue a propósito).
+var ErrExportacionNoEncontrada = errors.New("exportación no encontrada")
+
+// TrabajoExportacion es una exportación grande que se genera en segundo
+// plano. El front consulta su estado con GET /exportaciones/:id y, cuando
+// está "listo", descarga el archivo desde URLDescarga.
+type TrabajoExportacion struct {
+	ID            string             `json:"id"`
+	UsuarioID     uint               `json:"usuario_id"`
+	Formato       FormatoExportacion `json:"formato"`
+	Estado        string             `json:"estado"`
+	Error         string             `json:"error,omitempty"`
+	Filas         int                `json:"filas"`
+	NombreArchivo string             `json:"nombre_archivo"`
+	URLDescarga   string             `json:"url_descarga,omitempty"`
+	CreadoEn      time.Time          `json:"creado_en"`
+	TerminadoEn   *time.Time         `json:"terminado_en,omitempty"`
+
+	ruta string
+}
+
+// ExportacionesService guarda en memoria los trabajos de exportación y sus
+// archivos en EXPORT_DIR. Los archivos se borran pasadas EXPORT_TTL_HORAS;
+// un reinicio del servidor pierde los trabajos en curso (el usuario vuelve a
+// pedir la exportación).
+type ExportacionesService struct {
+	dir      string
+	ttl      time.Duration
+	umbral   int
+	timeout  time.Duration
+	semaforo chan struct{}
+	mu       sync.Mutex
+	trabajos map[string]*TrabajoExportacion
+}
+
+func NewExportacionesService() *ExportacionesService {
+	dir := os.Getenv("EXPORT_DIR")
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "managerfact-exportaciones")
+	}
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		log.Printf("[Exportaciones] no se pudo crear %s: %v", dir, err)
+	}
+	return &ExportacionesService{
+		dir:      dir,
+		ttl:      time.Duration(enteroEnv("EXPORT_TTL_HORAS", 24)) * time.Hour,
+		umbral:   enteroEnv("EXPORT_SYNC_MAX_FILAS", 5000),
+		timeout:  time.Duration(enteroEnv("EXPORT_TIMEOUT_MINUTOS", 30)) * time.Minute,
+		semaforo: make(chan struct{}, enteroEnv("EXPORT_MAX_CONCURRENTES", 2)),
+		trabajos: map[string]*TrabajoExportacion{},
+	}
+}
+
+// UmbralSincrono es la cantidad máxima de filas que se exportan dentro del
+// mismo request; por encima se encola un TrabajoExportacion. Para PDF es
+// LimiteFilasPDF: un PDF nunca se encola (ver encolable).
+func (s *ExportacionesService) UmbralSincrono(formato FormatoExportacion) int {
+	if formato == FormatoPDF {
+		return LimiteFilasPDF
+	}
+	return s.umbral
+}
+
+// encolable indica si una exportación por encima de UmbralSincrono puede
+// ir a segundo plano: un PDF de ese tamaño se rechaza con
+// ErrPDFDemasiadasFilas.
+func encolable(formato FormatoExportacion) error {
+	if formato == FormatoPDF {
+		return ErrPDFDemasiadasFilas
+	}
+	return nil
+}
+
+// TimeoutConsulta es el tiempo máximo de la consulta remota de un trabajo
+// en segundo plano (EXPORT_TIMEOUT_MINUTOS), separado del QueryTimeout de
+// las consultas interactivas.
+func (s *ExportacionesService) TimeoutConsulta() time.Duration {
+	return s.timeout
+}
+
+// Encolar registra un trabajo y lo genera en segundo plano llamando a
+// generar con el archivo destino. generar devuelve la cantidad de filas
+// escritas.
+func (s *ExportacionesService) Encolar(usuarioID uint, formato FormatoExportacion, nombreArchivo string, generar func(w io.Writer) (int, error)) *TrabajoExportacion {
+	s.limpiarVencidos()
+
+	id := uuid.NewString()
+	trabajo := &TrabajoExportacion{
+		ID:            id,
+		UsuarioID:     usuarioID,
+		Formato:       formato,
+		Estado:        EstadoExportacionPendiente,
+		NombreArchivo: nombreArchivo,
+		URLDescarga:   "/api/v1/exportaciones/" + id + "/descargar",
+		CreadoEn:      time.Now(),
+		ruta:          filepath.Join(s.dir, id+"."+string(formato)),
+	}
+
+	s.mu.Lock()
+	s.trabajos[id] = trabajo
+	s.mu.Unlock()
+
+	go s.ejecutar(trabajo, generar)
+
+	copia := *trabajo
+	return &copia
+}
+
+func (s *ExportacionesService) ejecutar(trabajo *TrabajoExportacion, generar func(w io.Writer) (int, error)) {
+	s.semaforo <- struct{}{}
+	defer func() { <-s.semaforo }()
+
+	s.actualizar(trabajo.ID, func(t *TrabajoExportacion) { t.Estado = EstadoExportacionProcesando })
+
+	filas, err := s.escribirArchivo(trabajo.ruta, generar)
+	ahora := time.Now()
+	s.actualizar(trabajo.ID, func(t *TrabajoExportacion) {
+		t.Filas = filas
+		t.TerminadoEn = &ahora
+		if err != nil {
+			t.Estado = EstadoExportacionError
+			t.Error = err.Error()
+			return
+		}
+		t.Estado = EstadoExportacionListo
+	})
+
+	if err != nil {
+		log.Printf("[Exportaciones] trabajo %s falló: %v", trabajo.ID, err)
+		os.Remove(trabajo.ruta)
+		return
+	}
+	log.Printf("[Exportaciones] trabajo %s listo (%d filas, %s)", trabajo.ID, filas, ahora.Sub(trabajo.CreadoEn).Round(time.Millisecond))
+}
+
+func (s *ExportacionesService) escribirArchivo(ruta string, generar func(w io.Writer) (int, error)) (int, error) {
+	archivo, err := os.Create(ruta)
+	if err != nil {
+		return 0, fmt.Errorf("error creando archivo de exportación: %w", err)
+	}
+	filas, err := generar(archivo)
+	if errCerrar := archivo.Close(); err == nil && errCerrar != nil {
+		err = fmt.Errorf("error escribiendo archivo de exportación: %w", errCerrar)
+	}
+	return filas, err
+}
+
+func (s *ExportacionesService) actualizar(id string, cambio func(t *TrabajoExportacion)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if trabajo, ok := s.trabajos[id]; ok {
+		cambio(trabajo)
+	}
+}
+
+// Obtener devuelve el estado del trabajo id si pertenece a usuarioID.
+func (s *ExportacionesService) Obtener(id string, usuarioID uint) (*TrabajoExportacion, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	trabajo, ok := s.trabajos[id]
+	if !ok || trabajo.UsuarioID != usuarioID {
+		return nil, ErrExportacionNoEncontrada
+	}
+	copia := *trabajo
+	return &copia, nil
+}
+
+// RutaArchivo devuelve la ruta del archivo generado por el trabajo id, solo
+// si pertenece a usuarioID y ya está listo.
+func (s *ExportacionesService) RutaArchivo(id string, usuarioID uint) (string, *TrabajoExportacion, error) {
+	trabajo, err := s.Obtener(id, usuarioID)
+	if err != nil {
+		return "", nil, err
+	}
+	if trabajo.Estado != EstadoExportacionListo {
+		return "", trabajo, fmt.Errorf("la exportación todavía no está lista (estado: %s)", trabajo.Estado)
+	}
+	return trabajo.ruta, trabajo, nil
+}
+
+// limpiarVencidos borra los trabajos terminados hace más de ttl junto con su
+// archivo.
+func (s *ExportacionesService) limpiarVencidos() {
+	limite := time.Now().Add(-s.ttl)
+
+	s.mu.Lock()
+	var rutas []string
+	for id, trabajo := range s.trabajos {
+		if trabajo.TerminadoEn != nil && trabajo.TerminadoEn.Before(limite) {
+			rutas = append(rutas, trabajo.ruta)
+			delete(s.trabajos, id)
+		}
+	}
+	s.mu.Unlock()
+
+	for _, ruta := range rutas {
+		os.Remove(ruta)
+	}
+}
@@ -100,6 +100,7 @@ func (s *FacturaAnulacionService) ImportarExcel(usuarioID uint, archivo io.Reade
 			conError = append(conError, FilaConError{Fila: numeroFila, Motivo: err.Error()})
 			continue
 		}
+		factura.ImportadoPor = &usuarioID
 		validas = append(validas, *factura)
 	}
 
@@ -164,8 +165,9 @@ func (s *FacturaAnulacionService) ObtenerPorID(usuarioID, id uint) (*models.Fact
 // doc/EnvioFacturacion.md secciones 4 y 5). Guarda el resultado del intento
 // (aceptado/rechazado/error) incluso si la llamada falla, para no perder el
 // rastro del envío. origen es "manual" (botón del front) o "automatico"
-// (EnvioWorker) — solo se usa para el registro en logs_envio.
-func (s *FacturaAnulacionService) Anular(id uint, origen string) (*models.FacturaAnulacion, error) {
+// (EnvioWorker) y usuarioID quién lo disparó (0 para el EnvioWorker) —
+// solo se usan para el registro en logs_envio.
+func (s *FacturaAnulacionService) Anular(id uint, origen string, usuarioID uint) (*models.FacturaAnulacion, error) {
 	factura, err := s.repo.GetByID(id)
 	if err != nil {
 		return nil, err
@@ -202,7 +204,7 @@ func (s *FacturaAnulacionService) Anular(id uint, origen string) (*models.Factur
 		if marcarErr := s.sucursalFacturador.ActualizarEstadoConexion(factura.SucursalFacturadorID, "en_revision", err.Error(), &fechaRespuesta); marcarErr != nil {
 			log.Printf("[FacturaAnulacionService] error marcando sucursal %d en_revision: %v", factura.SucursalFacturadorID, marcarErr)
 		}
-		s.registrarLog(factura.ID, factura.CodigoIntegracion, factura.SucursalFacturadorID, origen, "error", err.Error())
+		s.registrarLog(factura.ID, factura.CodigoIntegracion, factura.SucursalFacturadorID, origen, usuarioID, "error", err.Error())
 		return factura, fmt.Errorf("error enviando la anulación al facturador: %w", err)
 	}
 
@@ -226,13 +228,13 @@ func (s *FacturaAnulacionService) Anular(id uint, origen string) (*models.Factur
 	if err := s.repo.Update(factura); err != nil {
 		return nil, err
 	}
-	s.registrarLog(factura.ID, factura.CodigoIntegracion, factura.SucursalFacturadorID, origen, factura.Estado, factura.MensajeRespuesta)
+	s.registrarLog(factura.ID, factura.CodigoIntegracion, factura.SucursalFacturadorID, origen, usuarioID, factura.Estado, factura.MensajeRespuesta)
 	return factura, nil
 }
 
 // registrarLog guarda el intento en logs_envio; un fallo acá no debe abortar
 // el flujo de anulación, solo se loguea a consola.
-func (s *FacturaAnulacionService) registrarLog(facturaID uint, codigoIntegracion string, sucursalFacturadorID uint, origen, resultado, mensaje string) {
+func (s *FacturaAnulacionService) registrarLog(facturaID uint, codigoIntegracion string, sucursalFacturadorID uint, origen string, usuarioID uint, resultado, mensaje string) {
 	entrada := &models.LogEnvio{
 		Tipo:                 "anulacion",
 		FacturaID:            facturaID,
@@ -242,35 +244,19 @@ func (s *FacturaAnulacionService) registrarLog(facturaID uint, codigoIntegracion
 		Resultado:            resultado,
 		Mensaje:              mensaje,
 	}
+	if usuarioID != 0 {
+		entrada.UsuarioID = &usuarioID
+	}
 	if err := s.logEnvio.Create(entrada); err != nil {
 		log.Printf("[FacturaAnulacionService] error guardando log de envío: %v", err)
 	}
 }
 
 // ListarTodos devuelve solo las facturas de anulación de sucursales que el
-// usuario tiene permitidas (ver codigosSucursalPermitidos).
+// usuario tiene permitidas; el filtro se resuelve en la consulta (ver
+// repositories.sucursalVisible).
 func (s *FacturaAnulacionService) ListarTodos(usuarioID uint, estado, loteID string) ([]models.FacturaAnulacion, error) {
-	facturas, err := s.repo.GetAll(estado, loteID)
-	if err != nil {
-		return nil, err
-	}
-	codigos := make([]int, 0, len(facturas))
-	for _, f := range facturas {
-		if f.SucursalFacturador != nil {
-			codigos = append(codigos, f.SucursalFacturador.CodigoSucursalSin)
-		}
-	}
-	permitidos, err := codigosSucursalPermitidos(s.usuarioService, usuarioID, codigos)
-	if err != nil {
-		return nil, err
-	}
-	visibles := make([]models.FacturaAnulacion, 0, len(facturas))
-	for _, f := range facturas {
-		if f.SucursalFacturador != nil && permitidos[f.SucursalFacturador.CodigoSucursalSin] {
-			visibles = append(visibles, f)
-		}
-	}
-	return visibles, nil
+	return s.repo.GetAll(usuarioID, estado, loteID)
 }
 
 // ListarPendientesParaEnvio expone las facturas de anulación pendientes
@@ -282,26 +268,8 @@ func (s *FacturaAnulacionService) ListarPendientesParaEnvio() ([]models.FacturaA
 // ListarLotes agrega las facturas de anulación por lote de importación,
 // filtrando a las sucursales permitidas del usuario; el detalle de cada
 // lote se obtiene después con ListarTodos(usuarioID, "", loteID).
-func (s *FacturaAnulacionService) ListarLotes(usuarioID uint) ([]repositories.LoteResumenAnulacion, error) {
-	lotes, err := s.repo.GetLotes()
-	if err != nil {
-		return nil, err
-	}
-	codigos := make([]int, 0, len(lotes))
-	for _, l := range lotes {
-		codigos = append(codigos, l.CodigoSucursalSin)
-	}
-	permitidos, err := codigosSucursalPermitidos(s.usuarioService, usuarioID, codigos)
-	if err != nil {
-		return nil, err
-	}
-	visibles := make([]repositories.LoteResumenAnulacion, 0, len(lotes))
-	for _, l := range lotes {
-		if permitidos[l.CodigoSucursalSin] {
-			visibles = append(visibles, l)
-		}
-	}
-	return visibles, nil
+func (s *FacturaAnulacionService) ListarLotes(usuarioID, importadoPor uint) ([]repositories.LoteResumenAnulacion, error) {
+	return s.repo.GetLotes(usuarioID, importadoPor)
 }
 
 // GenerarPlantilla arma el .xlsx de ejemplo con las columnas que espera
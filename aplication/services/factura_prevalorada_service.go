@@ -22,7 +22,7 @@ var ErrFacturaYaAceptada = errors.New("esta factura ya fue aceptada por el factu
 
 // ErrSinPermisoSucursal se devuelve cuando el usuario autenticado intenta
 // cargar un Excel o consultar facturas de una sucursal que no tiene entre
-// sus sucursales permitidas (usuarios.sucursales_permitidas_codigos).
+// sus sucursales permitidas (usuario_sucursal_acceso).
 var ErrSinPermisoSucursal = errors.New("no tienes permiso para esta sucursal")
 
 type FacturaPrevaloradaService struct {
@@ -41,33 +41,6 @@ func NewFacturaPrevaloradaService(
 	return &FacturaPrevaloradaService{repo: r, sucursalFacturador: sucursalFacturadorRepo, logEnvio: logEnvioRepo, usuarioService: usuarioService}
 }
 
-// codigosSucursalPermitidos resuelve, para el conjunto de codigo_sucursal_sin
-// dado, cuáles puede ver el usuario — usa el mismo chequeo directo que
-// TieneAccesoSucursal (acceso_total o coincidencia en
-// sucursales_permitidas_codigos) para cada código distinto, SIN pasar por el
-// catálogo sucursales_catalogo: SucursalFacturador es independiente de ese
-// catálogo (ver doc/EnvioFacturacion.md sección 1), así que un código de
-// sucursal facturador que no esté en el catálogo igual debe ser visible si
-// el usuario tiene permiso sobre ese código.
-func codigosSucursalPermitidos(usuarioService *UsuarioService, usuarioID uint, codigos []int) (map[int]bool, error) {
-	permitidos := make(map[int]bool, len(codigos))
-	vistos := make(map[int]bool, len(codigos))
-	for _, codigo := range codigos {
-		if vistos[codigo] {
-			continue
-		}
-		vistos[codigo] = true
-		ok, err := usuarioService.TieneAccesoSucursal(usuarioID, codigo)
-		if err != nil {
-			return nil, fmt.Errorf("error verificando accesos: %w", err)
-		}
-		if ok {
-			permitidos[codigo] = true
-		}
-	}
-	return permitidos, nil
-}
-
 // columnasEsperadas son los encabezados de columna del Excel de boletos
 // (ver doc/EnvioFacturacion.md sección 3).
 var columnasEsperadas = []string{
@@ -147,6 +120,7 @@ func (s *FacturaPrevaloradaService) ImportarExcel(usuarioID uint, archivo io.Rea
 			conError = append(conError, FilaConError{Fila: numeroFila, Motivo: err.Error()})
 			continue
 		}
+		factura.ImportadoPor = &usuarioID
 		validas = append(validas, *factura)
 	}
 
@@ -275,8 +249,9 @@ func (s *FacturaPrevaloradaService) ObtenerPorID(usuarioID, id uint) (*models.Fa
 // flujo, ver doc/EnvioFacturacion.md sección 2 y 5). Guarda el resultado del
 // intento (aceptado/rechazado/error) incluso si la llamada falla, para no
 // perder el rastro del envío. origen es "manual" (botón del front) o
-// "automatico" (EnvioWorker) — solo se usa para el registro en logs_envio.
-func (s *FacturaPrevaloradaService) Facturar(id uint, origen string) (*models.FacturaPrevalorada, error) {
+// "automatico" (EnvioWorker) y usuarioID quién lo disparó (0 para el
+// EnvioWorker) — solo se usan para el registro en logs_envio.
+func (s *FacturaPrevaloradaService) Facturar(id uint, origen string, usuarioID uint) (*models.FacturaPrevalorada, error) {
 	factura, err := s.repo.GetByID(id)
 	if err != nil {
 		return nil, err
@@ -313,7 +288,7 @@ func (s *FacturaPrevaloradaService) Facturar(id uint, origen string) (*models.Fa
 		if marcarErr := s.sucursalFacturador.ActualizarEstadoConexion(factura.SucursalFacturadorID, "en_revision", err.Error(), &fechaRespuesta); marcarErr != nil {
 			log.Printf("[FacturaPrevaloradaService] error marcando sucursal %d en_revision: %v", factura.SucursalFacturadorID, marcarErr)
 		}
-		s.registrarLog(factura.ID, factura.CodigoIntegracion, factura.SucursalFacturadorID, origen, "error", err.Error())
+		s.registrarLog(factura.ID, factura.CodigoIntegracion, factura.SucursalFacturadorID, origen, usuarioID, "error", err.Error())
 		return factura, fmt.Errorf("error enviando al facturador: %w", err)
 	}
 
@@ -342,13 +317,13 @@ func (s *FacturaPrevaloradaService) Facturar(id uint, origen string) (*models.Fa
 	if err := s.repo.Update(factura); err != nil {
 		return nil, err
 	}
-	s.registrarLog(factura.ID, factura.CodigoIntegracion, factura.SucursalFacturadorID, origen, factura.Estado, factura.MensajeRespuesta)
+	s.registrarLog(factura.ID, factura.CodigoIntegracion, factura.SucursalFacturadorID, origen, usuarioID, factura.Estado, factura.MensajeRespuesta)
 	return factura, nil
 }
 
 // registrarLog guarda el intento en logs_envio; un fallo acá no debe abortar
 // el flujo de facturación, solo se loguea a consola.
-func (s *FacturaPrevaloradaService) registrarLog(facturaID uint, codigoIntegracion string, sucursalFacturadorID uint, origen, resultado, mensaje string) {
+func (s *FacturaPrevaloradaService) registrarLog(facturaID uint, codigoIntegracion string, sucursalFacturadorID uint, origen string, usuarioID uint, resultado, mensaje string) {
 	entrada := &models.LogEnvio{
 		Tipo:                 "prevalorada",
 		FacturaID:            facturaID,
@@ -358,35 +333,19 @@ func (s *FacturaPrevaloradaService) registrarLog(facturaID uint, codigoIntegraci
 		Resultado:            resultado,
 		Mensaje:              mensaje,
 	}
+	if usuarioID != 0 {
+		entrada.UsuarioID = &usuarioID
+	}
 	if err := s.logEnvio.Create(entrada); err != nil {
 		log.Printf("[FacturaPrevaloradaService] error guardando log de envío: %v", err)
 	}
 }
 
-// ListarTodos devuelve solo las facturas de sucursales que el usuario tiene
-// permitidas (ver codigosSucursalPermitidos).
+// ListarTodos devuelve solo las facturas de sucursales que el
+// usuario tiene permitidas; el filtro se resuelve en la consulta (ver
+// repositories.sucursalVisible).
 func (s *FacturaPrevaloradaService) ListarTodos(usuarioID uint, estado, loteID string) ([]models.FacturaPrevalorada, error) {
-	facturas, err := s.repo.GetAll(estado, loteID)
-	if err != nil {
-		return nil, err
-	}
-	codigos := make([]int, 0, len(facturas))
-	for _, f := range facturas {
-		if f.SucursalFacturador != nil {
-			codigos = append(codigos, f.SucursalFacturador.CodigoSucursalSin)
-		}
-	}
-	permitidos, err := codigosSucursalPermitidos(s.usuarioService, usuarioID, codigos)
-	if err != nil {
-		return nil, err
-	}
-	visibles := make([]models.FacturaPrevalorada, 0, len(facturas))
-	for _, f := range facturas {
-		if f.SucursalFacturador != nil && permitidos[f.SucursalFacturador.CodigoSucursalSin] {
-			visibles = append(visibles, f)
-		}
-	}
-	return visibles, nil
+	return s.repo.GetAll(usuarioID, estado, loteID)
 }
 
 // ListarPendientesParaEnvio expone las facturas pendientes para el
@@ -398,26 +357,8 @@ func (s *FacturaPrevaloradaService) ListarPendientesParaEnvio() ([]models.Factur
 // ListarLotes agrega las facturas por lote de importación (registro de
 // lotes), filtrando a las sucursales permitidas del usuario; el detalle de
 // cada lote se obtiene después con ListarTodos(usuarioID, "", loteID).
-func (s *FacturaPrevaloradaService) ListarLotes(usuarioID uint) ([]repositories.LoteResumen, error) {
-	lotes, err := s.repo.GetLotes()
-	if err != nil {
-		return nil, err
-	}
-	codigos := make([]int, 0, len(lotes))
-	for _, l := range lotes {
-		codigos = append(codigos, l.CodigoSucursalSin)
-	}
-	permitidos, err := codigosSucursalPermitidos(s.usuarioService, usuarioID, codigos)
-	if err != nil {
-		return nil, err
-	}
-	visibles := make([]repositories.LoteResumen, 0, len(lotes))
-	for _, l := range lotes {
-		if permitidos[l.CodigoSucursalSin] {
-			visibles = append(visibles, l)
-		}
-	}
-	return visibles, nil
+func (s *FacturaPrevaloradaService) ListarLotes(usuarioID, importadoPor uint) ([]repositories.LoteResumen, error) {
+	return s.repo.GetLotes(usuarioID, importadoPor)
 }
 
 // GenerarPlantilla arma el .xlsx de ejemplo con las columnas que espera
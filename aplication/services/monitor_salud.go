@@ -0,0 +1,361 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"managerfact/internal/domain/models"
+	"managerfact/internal/domain/repositories"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Estados del ReporteDependencias.
+const (
+	EstadoSaludOk        = "ok"
+	EstadoSaludDegradado = "degradado"
+	EstadoSaludSinDatos  = "sin_datos"
+)
+
+// EstadoDependencia es el último chequeo de una dependencia más un resumen
+// de su historial de las últimas 24 horas.
+type EstadoDependencia struct {
+	Tipo               string     `json:"tipo"`
+	RecursoID          uint       `json:"recurso_id"`
+	Nombre             string     `json:"nombre"`
+	Destino            string     `json:"destino"`
+	Ok                 bool       `json:"ok"`
+	LatenciaMs         int64      `json:"latencia_ms"`
+	Mensaje            string     `json:"mensaje,omitempty"`
+	VerificadoEn       time.Time  `json:"verificado_en"`
+	FallasConsecutivas int        `json:"fallas_consecutivas"`
+	UltimoOk           *time.Time `json:"ultimo_ok"`
+	Chequeos24h        int64      `json:"chequeos_24h"`
+	Fallidos24h        int64      `json:"fallidos_24h"`
+	LatenciaPromedioMs float64    `json:"latencia_promedio_ms"`
+	Disponibilidad24h  float64    `json:"disponibilidad_24h"`
+}
+
+// ReporteDependencias es la respuesta de /health/dependencies.
+type ReporteDependencias struct {
+	Estado            string              `json:"estado"`
+	UltimaEjecucion   *time.Time          `json:"ultima_ejecucion"`
+	IntervaloSegundos int                 `json:"intervalo_segundos"`
+	Total             int                 `json:"total"`
+	Caidas            int                 `json:"caidas"`
+	Dependencias      []EstadoDependencia `json:"dependencias"`
+}
+
+// MonitorSalud revisa en background, cada SALUD_INTERVALO_SEGUNDOS, todas
+// las DbConnection activas (ping) y la URL base del facturador de cada
+// sucursal facturador activa (GET). Guarda cada resultado en
+// chequeos_salud y mantiene en memoria el último estado de cada
+// dependencia para /health/dependencies, así una caída se ve antes de que
+// falle un lote.
+//
+// Solo observa e informa: no toca el EstadoConexion de las sucursales (el
+// circuit breaker del EnvioWorker lo maneja solo a partir de los envíos).
+type MonitorSalud struct {
+	conexiones repositories.DbConnectionRepository
+	sucursales *repositories.SucursalFacturadorRepository
+	chequeos   *repositories.ChequeoSaludRepository
+	intervalo  time.Duration
+	timeout    time.Duration
+	retencion  time.Duration
+	paralelo   int
+	detener    chan struct{}
+
+	// ejecutando evita dos ciclos a la vez (el del ticker y uno pedido a
+	// mano con VerificarAhora).
+	ejecutando sync.Mutex
+
+	mu              sync.Mutex
+	estados         map[string]*EstadoDependencia
+	ultimaEjecucion *time.Time
+}
+
+func NewMonitorSalud(conexiones repositories.DbConnectionRepository, sucursales *repositories.SucursalFacturadorRepository, chequeos *repositories.ChequeoSaludRepository) *MonitorSalud {
+	return &MonitorSalud{
+		conexiones: conexiones,
+		sucursales: sucursales,
+		chequeos:   chequeos,
+		intervalo:  time.Duration(enteroEnv("SALUD_INTERVALO_SEGUNDOS", 60)) * time.Second,
+		timeout:    time.Duration(enteroEnv("SALUD_TIMEOUT_SEGUNDOS", 10)) * time.Second,
+		retencion:  time.Duration(enteroEnv("SALUD_RETENCION_DIAS", 7)) * 24 * time.Hour,
+		paralelo:   enteroEnv("SALUD_MAX_PARALELO", 8),
+		detener:    make(chan struct{}),
+		estados:    map[string]*EstadoDependencia{},
+	}
+}
+
+// Iniciar corre un ciclo de chequeos enseguida y luego uno por intervalo;
+// se llama con "go monitor.Iniciar()".
+func (m *MonitorSalud) Iniciar() {
+	log.Printf("[MonitorSalud] iniciado (intervalo=%s, timeout=%s, retencion=%s)", m.intervalo, m.timeout, m.retencion)
+	m.VerificarAhora()
+
+	ticker := time.NewTicker(m.intervalo)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.detener:
+			return
+		case <-ticker.C:
+			m.VerificarAhora()
+		}
+	}
+}
+
+// Detener corta el loop, igual que EnvioWorker.Detener.
+func (m *MonitorSalud) Detener() {
+	close(m.detener)
+}
+
+// dependencia es algo a chequear en un ciclo.
+type dependencia struct {
+	tipo      string
+	recursoID uint
+	nombre    string
+	destino   string
+	chequear  func(ctx context.Context) (string, error)
+}
+
+func claveDependencia(tipo string, id uint) string {
+	return fmt.Sprintf("%s:%d", tipo, id)
+}
+
+// VerificarAhora ejecuta un ciclo completo de chequeos y devuelve el
+// reporte resultante. Si ya hay un ciclo corriendo espera a que termine.
+func (m *MonitorSalud) VerificarAhora() *ReporteDependencias {
+	m.ejecutando.Lock()
+	defer m.ejecutando.Unlock()
+
+	dependencias, err := m.dependencias()
+	if err != nil {
+		log.Printf("[MonitorSalud] error listando dependencias: %v", err)
+		return m.Reporte()
+	}
+
+	chequeos := make([]models.ChequeoSalud, len(dependencias))
+	semaforo := make(chan struct{}, m.paralelo)
+	var wg sync.WaitGroup
+	for i, dep := range dependencias {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			semaforo <- struct{}{}
+			defer func() { <-semaforo }()
+
+			ctx, cancel := context.WithTimeout(context.Background(), m.timeout)
+			defer cancel()
+
+			inicio := time.Now()
+			mensaje, err := dep.chequear(ctx)
+			chequeo := models.ChequeoSalud{
+				Tipo:       dep.tipo,
+				RecursoID:  dep.recursoID,
+				Nombre:     dep.nombre,
+				Ok:         err == nil,
+				LatenciaMs: time.Since(inicio).Milliseconds(),
+				Mensaje:    mensaje,
+				CreatedAt:  time.Now(),
+			}
+			if err != nil {
+				chequeo.Mensaje = err.Error()
+			}
+			chequeos[i] = chequeo
+		}()
+	}
+	wg.Wait()
+
+	if err := m.chequeos.CreateLote(chequeos); err != nil {
+		log.Printf("[MonitorSalud] %v", err)
+	}
+	if borrados, err := m.chequeos.PurgarAnteriores(time.Now().Add(-m.retencion)); err != nil {
+		log.Printf("[MonitorSalud] %v", err)
+	} else if borrados > 0 {
+		log.Printf("[MonitorSalud] %d chequeos viejos purgados", borrados)
+	}
+
+	m.registrar(dependencias, chequeos)
+	return m.Reporte()
+}
+
+// registrar reemplaza el estado en memoria con el del ciclo: las
+// dependencias que ya no están activas desaparecen del reporte.
+func (m *MonitorSalud) registrar(dependencias []dependencia, chequeos []models.ChequeoSalud) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	estados := make(map[string]*EstadoDependencia, len(dependencias))
+	for i, dep := range dependencias {
+		chequeo := chequeos[i]
+		estado := &EstadoDependencia{
+			Tipo:         dep.tipo,
+			RecursoID:    dep.recursoID,
+			Nombre:       dep.nombre,
+			Destino:      dep.destino,
+			Ok:           chequeo.Ok,
+			LatenciaMs:   chequeo.LatenciaMs,
+			Mensaje:      chequeo.Mensaje,
+			VerificadoEn: chequeo.CreatedAt,
+		}
+		clave := claveDependencia(dep.tipo, dep.recursoID)
+		if anterior, ok := m.estados[clave]; ok {
+			estado.FallasConsecutivas = anterior.FallasConsecutivas
+			estado.UltimoOk = anterior.UltimoOk
+		}
+		if chequeo.Ok {
+			estado.FallasConsecutivas = 0
+			momento := chequeo.CreatedAt
+			estado.UltimoOk = &momento
+		} else {
+			estado.FallasConsecutivas++
+			if estado.FallasConsecutivas == 1 {
+				log.Printf("[MonitorSalud] %s '%s' (ID %d) no responde: %s", dep.tipo, dep.nombre, dep.recursoID, chequeo.Mensaje)
+			}
+		}
+		estados[clave] = estado
+	}
+
+	ahora := time.Now()
+	m.estados = estados
+	m.ultimaEjecucion = &ahora
+}
+
+func (m *MonitorSalud) dependencias() ([]dependencia, error) {
+	var dependencias []dependencia
+
+	conexiones, err := m.conexiones.GetAllActive()
+	if err != nil {
+		return nil, err
+	}
+	for _, conexion := range conexiones {
+		dependencias = append(dependencias, dependencia{
+			tipo:      models.DependenciaDbConnection,
+			recursoID: conexion.ID,
+			nombre:    conexion.ServerName,
+			destino:   fmt.Sprintf("%s:%d/%s", conexion.Host, conexion.Port, conexion.DatabaseName),
+			chequear:  func(ctx context.Context) (string, error) { return pingDbConnection(ctx, &conexion) },
+		})
+	}
+
+	sucursales, err := m.sucursales.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for _, sucursal := range sucursales {
+		if !sucursal.Activo || strings.TrimSpace(sucursal.UrlLinkFacturador) == "" {
+			continue
+		}
+		dependencias = append(dependencias, dependencia{
+			tipo:      models.DependenciaFacturador,
+			recursoID: sucursal.ID,
+			nombre:    sucursal.Nombre,
+			destino:   sucursal.UrlLinkFacturador,
+			chequear:  func(ctx context.Context) (string, error) { return pingFacturador(ctx, sucursal.UrlLinkFacturador) },
+		})
+	}
+	return dependencias, nil
+}
+
+// pingDbConnection abre una conexión propia (no el pool de
+// ConexionesRemotas, que bloquea mientras abre) y hace ping dentro de ctx.
+func pingDbConnection(ctx context.Context, conexion *models.DbConnection) (string, error) {
+	db, err := abrirSQL(conexion)
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(1)
+
+	if err := db.PingContext(ctx); err != nil {
+		return "", fmt.Errorf("error de conectividad: %w", err)
+	}
+	return "", nil
+}
+
+// pingFacturador hace GET a la URL base del facturador. Cualquier
+// respuesta HTTP cuenta como disponible; solo falla por transporte
+// (timeout, DNS, conexión rechazada, TLS).
+func pingFacturador(ctx context.Context, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return "", fmt.Errorf("URL inválida: %w", err)
+	}
+	resp, err := httpClienteFacturador.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("el facturador no responde: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	return fmt.Sprintf("HTTP %d", resp.StatusCode), nil
+}
+
+// Reporte arma el estado actual de todas las dependencias, con el resumen
+// de las últimas 24 horas de chequeos_salud.
+func (m *MonitorSalud) Reporte() *ReporteDependencias {
+	m.mu.Lock()
+	reporte := &ReporteDependencias{
+		Estado:            EstadoSaludSinDatos,
+		UltimaEjecucion:   m.ultimaEjecucion,
+		IntervaloSegundos: int(m.intervalo.Seconds()),
+		Dependencias:      make([]EstadoDependencia, 0, len(m.estados)),
+	}
+	for _, estado := range m.estados {
+		reporte.Dependencias = append(reporte.Dependencias, *estado)
+	}
+	m.mu.Unlock()
+
+	resumen, err := m.chequeos.Resumen(time.Now().Add(-24 * time.Hour))
+	if err != nil {
+		log.Printf("[MonitorSalud] %v", err)
+	}
+	porDependencia := make(map[string]repositories.ResumenChequeos, len(resumen))
+	for _, r := range resumen {
+		porDependencia[claveDependencia(r.Tipo, r.RecursoID)] = r
+	}
+
+	for i := range reporte.Dependencias {
+		dep := &reporte.Dependencias[i]
+		if r, ok := porDependencia[claveDependencia(dep.Tipo, dep.RecursoID)]; ok {
+			dep.Chequeos24h = r.Total
+			dep.Fallidos24h = r.Fallidos
+			dep.LatenciaPromedioMs = r.LatenciaPromedioMs
+			if r.Total > 0 {
+				dep.Disponibilidad24h = float64(r.Total-r.Fallidos) * 100 / float64(r.Total)
+			}
+			if dep.UltimoOk == nil {
+				dep.UltimoOk = r.UltimoOk
+			}
+		}
+		if !dep.Ok {
+			reporte.Caidas++
+		}
+	}
+	sort.Slice(reporte.Dependencias, func(i, j int) bool {
+		a, b := reporte.Dependencias[i], reporte.Dependencias[j]
+		if a.Tipo != b.Tipo {
+			return a.Tipo < b.Tipo
+		}
+		return a.Nombre < b.Nombre
+	})
+
+	reporte.Total = len(reporte.Dependencias)
+	if reporte.UltimaEjecucion != nil {
+		reporte.Estado = EstadoSaludOk
+		if reporte.Caidas > 0 {
+			reporte.Estado = EstadoSaludDegradado
+		}
+	}
+	return reporte
+}
+
+// Historial devuelve los últimos chequeos guardados de una dependencia.
+func (m *MonitorSalud) Historial(tipo string, recursoID uint, limit int) ([]models.ChequeoSalud, error) {
+	return m.chequeos.Historial(tipo, recursoID, limit)
+}
@@ -0,0 +1,90 @@
+package services
+
+import (
+	"errors"
+	"managerfact/internal/domain/models"
+	"time"
+)
+
+// ErrDemasiadosIntentos se devuelve cuando un login se rechaza sin mirar la
+// contraseña por el límite de intentos (del usuario o de la IP). El error
+// concreto es *EsperaLoginError, que dice hasta cuándo esperar.
+var ErrDemasiadosIntentos = errors.New("demasiados intentos fallidos, vuelve a intentar más tarde")
+
+// EsperaLoginError es ErrDemasiadosIntentos con la fecha a partir de la
+// cual se acepta el próximo intento (para el header Retry-After).
+type EsperaLoginError struct {
+	Hasta time.Time
+}
+
+func (e *EsperaLoginError) Error() string        { return ErrDemasiadosIntentos.Error() }
+func (e *EsperaLoginError) Is(target error) bool { return target == ErrDemasiadosIntentos }
+
+const (
+	// Los primeros fallos seguidos no tienen demora (errores de tipeo);
+	// después cada intento espera demoraBaseLogin, el doble, etc., hasta
+	// demoraMaxLogin.
+	fallosSinDemoraUsuario = 2
+	fallosSinDemoraIP      = 5
+	demoraBaseLogin        = time.Second
+	demoraMaxLogin         = 30 * time.Second
+)
+
+// PoliticaLogin son los límites de intentos de login. Por usuario: con
+// MaxIntentos fallos seguidos queda bloqueado por Bloqueo (y cada fallo
+// después de vencido el bloqueo lo vuelve a bloquear, hasta un login
+// exitoso o un desbloqueo manual). Por IP: con MaxIntentosIP fallos dentro
+// de VentanaIP no se aceptan más intentos desde esa IP hasta que pase
+// VentanaIP desde el último. Se configura con LOGIN_MAX_INTENTOS,
+// LOGIN_BLOQUEO_MINUTOS, LOGIN_MAX_INTENTOS_IP y LOGIN_VENTANA_IP_MINUTOS.
+type PoliticaLogin struct {
+	MaxIntentos   int
+	Bloqueo       time.Duration
+	MaxIntentosIP int
+	VentanaIP     time.Duration
+}
+
+func PoliticaLoginDesdeEnv() PoliticaLogin {
+	return PoliticaLogin{
+		MaxIntentos:   enteroEnv("LOGIN_MAX_INTENTOS", 5),
+		Bloqueo:       time.Duration(enteroEnv("LOGIN_BLOQUEO_MINUTOS", 15)) * time.Minute,
+		MaxIntentosIP: enteroEnv("LOGIN_MAX_INTENTOS_IP", 20),
+		VentanaIP:     time.Duration(enteroEnv("LOGIN_VENTANA_IP_MINUTOS", 15)) * time.Minute,
+	}
+}
+
+// demoraLogin es la espera progresiva después de fallos seguidos.
+func demoraLogin(fallos, sinDemora int) time.Duration {
+	if fallos <= sinDemora {
+		return 0
+	}
+	exceso := fallos - sinDemora - 1
+	if exceso >= 5 {
+		return demoraMaxLogin
+	}
+	return min(demoraBaseLogin<<exceso, demoraMaxLogin)
+}
+
+// esperaUsuario devuelve desde cuándo se acepta el próximo intento del
+// usuario (cero o pasado si ya se acepta) y el motivo.
+func (p PoliticaLogin) esperaUsuario(usuario *models.Usuario, ahora time.Time) (time.Time, string) {
+	if usuario.BloqueadoHasta != nil && usuario.BloqueadoHasta.After(ahora) {
+		return *usuario.BloqueadoHasta, "usuario bloqueado"
+	}
+	if usuario.UltimoIntentoFallido == nil {
+		return time.Time{}, ""
+	}
+	return usuario.UltimoIntentoFallido.Add(demoraLogin(usuario.IntentosFallidos, fallosSinDemoraUsuario)), "demora por intentos fallidos del usuario"
+}
+
+// esperaIP es lo mismo para una IP, a partir de sus fallos dentro de
+// VentanaIP.
+func (p PoliticaLogin) esperaIP(fallos int, ultimo *time.Time) (time.Time, string) {
+	if ultimo == nil {
+		return time.Time{}, ""
+	}
+	if fallos >= p.MaxIntentosIP {
+		return ultimo.Add(p.VentanaIP), "demasiados intentos fallidos desde la IP"
+	}
+	return ultimo.Add(demoraLogin(fallos, fallosSinDemoraIP)), "demora por intentos fallidos desde la IP"
+}
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"errors"
+	"managerfact/internal/domain/models"
+	"testing"
+	"time"
+)
+
+func TestDemoraLogin(t *testing.T) {
+	casos := []struct {
+		fallos    int
+		sinDemora int
+		demora    time.Duration
+	}{
+		{0, fallosSinDemoraUsuario, 0},
+		{fallosSinDemoraUsuario, fallosSinDemoraUsuario, 0},
+		{fallosSinDemoraUsuario + 1, fallosSinDemoraUsuario, demoraBaseLogin},
+		{fallosSinDemoraUsuario + 2, fallosSinDemoraUsuario, 2 * demoraBaseLogin},
+		{fallosSinDemoraUsuario + 5, fallosSinDemoraUsuario, 16 * demoraBaseLogin},
+		{fallosSinDemoraUsuario + 6, fallosSinDemoraUsuario, demoraMaxLogin},
+		{fallosSinDemoraUsuario + 100, fallosSinDemoraUsuario, demoraMaxLogin},
+		{fallosSinDemoraIP, fallosSinDemoraIP, 0},
+		{fallosSinDemoraIP + 1, fallosSinDemoraIP, demoraBaseLogin},
+	}
+	for _, c := range casos {
+		if demora := demoraLogin(c.fallos, c.sinDemora); demora != c.demora {
+			t.Errorf("demoraLogin(%d, %d) = %s, se esperaba %s", c.fallos, c.sinDemora, demora, c.demora)
+		}
+	}
+}
+
+func TestDemoraLoginNuncaSuperaElMaximo(t *testing.T) {
+	for fallos := 0; fallos < 200; fallos++ {
+		if demora := demoraLogin(fallos, 0); demora > demoraMaxLogin || demora < 0 {
+			t.Fatalf("demoraLogin(%d, 0) = %s, fuera de [0, %s]", fallos, demora, demoraMaxLogin)
+		}
+	}
+}
+
+func TestEsperaUsuario(t *testing.T) {
+	politica := PoliticaLogin{MaxIntentos: 5, Bloqueo: 15 * time.Minute}
+	ahora := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	hace := func(d time.Duration) *time.Time { t := ahora.Add(-d); return &t }
+	en := func(d time.Duration) *time.Time { t := ahora.Add(d); return &t }
+
+	casos := []struct {
+		nombre  string
+		usuario models.Usuario
+		hasta   time.Time
+		motivo  string
+	}{
+		{"sin fallos", models.Usuario{}, time.Time{}, ""},
+		{
+			"fallos sin demora",
+			models.Usuario{IntentosFallidos: fallosSinDemoraUsuario, UltimoIntentoFallido: hace(0)},
+			ahora, "demora por intentos fallidos del usuario",
+		},
+		{
+			"primer fallo con demora",
+			models.Usuario{IntentosFallidos: fallosSinDemoraUsuario + 1, UltimoIntentoFallido: hace(0)},
+			ahora.Add(demoraBaseLogin), "demora por intentos fallidos del usuario",
+		},
+		{
+			"bloqueado",
+			models.Usuario{IntentosFallidos: 5, UltimoIntentoFallido: hace(time.Minute), BloqueadoHasta: en(10 * time.Minute)},
+			ahora.Add(10 * time.Minute), "usuario bloqueado",
+		},
+		{
+			"bloqueo vencido vuelve a la demora",
+			models.Usuario{IntentosFallidos: 5, UltimoIntentoFallido: hace(20 * time.Minute), BloqueadoHasta: hace(5 * time.Minute)},
+			ahora.Add(-20 * time.Minute).Add(demoraLogin(5, fallosSinDemoraUsuario)), "demora por intentos fallidos del usuario",
+		},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			hasta, motivo := politica.esperaUsuario(&c.usuario, ahora)
+			if !hasta.Equal(c.hasta) || motivo != c.motivo {
+				t.Errorf("esperaUsuario = (%s, %q), se esperaba (%s, %q)", hasta, motivo, c.hasta, c.motivo)
+			}
+		})
+	}
+}
+
+func TestEsperaIP(t *testing.T) {
+	politica := PoliticaLogin{MaxIntentosIP: 20, VentanaIP: 15 * time.Minute}
+	ultimo := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	casos := []struct {
+		nombre string
+		fallos int
+		ultimo *time.Time
+		hasta  time.Time
+		motivo string
+	}{
+		{"sin fallos", 0, nil, time.Time{}, ""},
+		{"en el límite sin demora", fallosSinDemoraIP, &ultimo, ultimo, "demora por intentos fallidos desde la IP"},
+		{"pasado el límite sin demora", fallosSinDemoraIP + 1, &ultimo, ultimo.Add(demoraBaseLogin), "demora por intentos fallidos desde la IP"},
+		{"uno antes del máximo", 19, &ultimo, ultimo.Add(demoraMaxLogin), "demora por intentos fallidos desde la IP"},
+		{"en el máximo", 20, &ultimo, ultimo.Add(15 * time.Minute), "demasiados intentos fallidos desde la IP"},
+		{"sobre el máximo", 50, &ultimo, ultimo.Add(15 * time.Minute), "demasiados intentos fallidos desde la IP"},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			hasta, motivo := politica.esperaIP(c.fallos, c.ultimo)
+			if !hasta.Equal(c.hasta) || motivo != c.motivo {
+				t.Errorf("esperaIP(%d) = (%s, %q), se esperaba (%s, %q)", c.fallos, hasta, motivo, c.hasta, c.motivo)
+			}
+		})
+	}
+}
+
+func TestEsperaLoginErrorEsDemasiadosIntentos(t *testing.T) {
+	var err error = &EsperaLoginError{Hasta: time.Now()}
+	if !errors.Is(err, ErrDemasiadosIntentos) {
+		t.Error("EsperaLoginError debería cumplir errors.Is(err, ErrDemasiadosIntentos)")
+	}
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrPasswordInvalida se devuelve cuando una contraseña nueva no cumple la
+// política; el error envuelto lista qué reglas no cumple.
+var ErrPasswordInvalida = errors.New("la contraseña no cumple la política")
+
+// ErrPasswordActualIncorrecta: al cambiar la contraseña, la actual no
+// coincide.
+var ErrPasswordActualIncorrecta = errors.New("la contraseña actual es incorrecta")
+
+// bcrypt ignora todo lo que pasa de 72 bytes: una contraseña más larga se
+// rechaza en vez de truncarla en silencio.
+const maxLargoPassword = 72
+
+// PoliticaPassword son las reglas para las contraseñas que elige un usuario
+// (no para la inicial, que es el CI y obliga a cambiarla). Se configura con
+// PASSWORD_MIN_LARGO y PASSWORD_HISTORIAL.
+type PoliticaPassword struct {
+	MinLargo int
+	// Historial es cuántas contraseñas anteriores no se pueden reutilizar
+	// (además de la actual).
+	Historial int
+}
+
+func PoliticaPasswordDesdeEnv() PoliticaPassword {
+	return PoliticaPassword{
+		MinLargo:  enteroEnv("PASSWORD_MIN_LARGO", 10),
+		Historial: enteroEnv("PASSWORD_HISTORIAL", 5),
+	}
+}
+
+// Validar revisa las reglas que no dependen de contraseñas anteriores:
+// largo y que no sea el CI ni el código de usuario.
+func (p PoliticaPassword) Validar(password, ci, codigoUsuario string) error {
+	var incumplidas []string
+	if len(password) < p.MinLargo {
+		incumplidas = append(incumplidas, fmt.Sprintf("debe tener al menos %d caracteres", p.MinLargo))
+	}
+	if len(password) > maxLargoPassword {
+		incumplidas = append(incumplidas, fmt.Sprintf("no puede tener más de %d bytes", maxLargoPassword))
+	}
+	if ci != "" && strings.EqualFold(strings.TrimSpace(password), strings.TrimSpace(ci)) {
+		incumplidas = append(incumplidas, "no puede ser el CI")
+	}
+	if codigoUsuario != "" && strings.EqualFold(strings.TrimSpace(password), strings.TrimSpace(codigoUsuario)) {
+		incumplidas = append(incumplidas, "no puede ser el código de usuario")
+	}
+	if len(incumplidas) > 0 {
+		return fmt.Errorf("%w: %s", ErrPasswordInvalida, strings.Join(incumplidas, "; "))
+	}
+	return nil
+}
+
+// validarHistorial rechaza la contraseña si coincide con alguno de los
+// hashes dados (la actual y las anteriores).
+func validarHistorial(password string, hashes []string) error {
+	for _, hash := range hashes {
+		if bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil {
+			return fmt.Errorf("%w: no puede ser la actual ni una de las últimas usadas", ErrPasswordInvalida)
+		}
+	}
+	return nil
+}
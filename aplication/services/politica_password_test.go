@@ -0,0 +1,72 @@
+package services
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestPoliticaPasswordValidar(t *testing.T) {
+	politica := PoliticaPassword{MinLargo: 10}
+
+	casos := []struct {
+		nombre   string
+		password string
+		ci       string
+		codigo   string
+		valida   bool
+	}{
+		{"válida", "caballo-bateria", "1234567", "jperez", true},
+		{"en el mínimo", strings.Repeat("a", 10), "", "", true},
+		{"bajo el mínimo", strings.Repeat("a", 9), "", "", false},
+		{"72 bytes", strings.Repeat("a", 72), "", "", true},
+		{"73 bytes", strings.Repeat("a", 73), "", "", false},
+		{"72 bytes multibyte", strings.Repeat("ñ", 36), "", "", true},
+		{"más de 72 bytes en menos caracteres", strings.Repeat("ñ", 37), "", "", false},
+		{"igual al CI", "1234567890", "1234567890", "", false},
+		{"igual al CI con espacios", " 1234567890 ", "1234567890", "", false},
+		{"igual al código sin distinguir mayúsculas", "JPerez2026X", "", "jperez2026x", false},
+		{"contiene el código pero no es igual", "jperez2026x!", "", "jperez2026x", true},
+		{"CI vacío no se compara", strings.Repeat("b", 10), "", "", true},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			err := politica.Validar(c.password, c.ci, c.codigo)
+			if c.valida && err != nil {
+				t.Errorf("Validar = %v, se esperaba nil", err)
+			}
+			if !c.valida && !errors.Is(err, ErrPasswordInvalida) {
+				t.Errorf("Validar = %v, se esperaba ErrPasswordInvalida", err)
+			}
+		})
+	}
+}
+
+func TestPoliticaPasswordValidarListaTodasLasReglas(t *testing.T) {
+	err := PoliticaPassword{MinLargo: 10}.Validar("abc", "abc", "ABC")
+	if err == nil {
+		t.Fatal("Validar = nil, se esperaba error")
+	}
+	for _, regla := range []string{"al menos 10 caracteres", "no puede ser el CI", "no puede ser el código de usuario"} {
+		if !strings.Contains(err.Error(), regla) {
+			t.Errorf("el error %q no menciona %q", err, regla)
+		}
+	}
+}
+
+func TestValidarHistorial(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("anterior-123"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt: %v", err)
+	}
+	hashes := []string{string(hash)}
+
+	if err := validarHistorial("anterior-123", hashes); !errors.Is(err, ErrPasswordInvalida) {
+		t.Errorf("validarHistorial con una contraseña usada = %v, se esperaba ErrPasswordInvalida", err)
+	}
+	if err := validarHistorial("nueva-456789", hashes); err != nil {
+		t.Errorf("validarHistorial con una contraseña nueva = %v, se esperaba nil", err)
+	}
+}
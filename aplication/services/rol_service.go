@@ -0,0 +1,253 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"managerfact/internal/domain/models"
+	"managerfact/internal/domain/repositories"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+var (
+	// ErrRolNoEncontrado: el rol no existe.
+	ErrRolNoEncontrado = errors.New("rol no encontrado")
+	// ErrRolDuplicado: ya hay un rol con ese nombre.
+	ErrRolDuplicado = errors.New("ya existe un rol con ese nombre")
+	// ErrRolInvalido: nombre vacío o largo, o permiso fuera del catálogo.
+	ErrRolInvalido = errors.New("rol inválido")
+	// ErrRolSistema: los roles de sistema no se eliminan ni renombran, y
+	// los permisos de admin no se editan.
+	ErrRolSistema = errors.New("los roles de sistema no se pueden modificar así")
+	// ErrRolEnUso: no se elimina un rol que todavía tienen usuarios.
+	ErrRolEnUso = errors.New("el rol todavía tiene usuarios")
+	// ErrRolNoOtorgable: el actor quiere crear, editar o asignar un rol con
+	// permisos que él mismo no tiene.
+	ErrRolNoOtorgable = errors.New("no puede otorgar permisos que no tiene")
+)
+
+// verificarOtorgable revisa que actor (el rol de quien hace el cambio)
+// pueda dar el rol otorgado: todos sus permisos tienen que estar entre los
+// del actor, y admin (que tiene todos, incluidos los futuros) solo lo da un
+// admin o quien tenga sistema.administrar. Así usuarios.gestionar no
+// alcanza para darse más permisos de los que ya se tienen.
+func verificarOtorgable(actor, otorgado *models.Rol) error {
+	if actor == nil {
+		return fmt.Errorf("%w: el usuario no tiene rol", ErrRolNoOtorgable)
+	}
+	if actor.Nombre == models.RolAdmin {
+		return nil
+	}
+	if otorgado.Nombre == models.RolAdmin {
+		if !actor.Tiene(models.PermisoSistemaAdmin) {
+			return fmt.Errorf("%w: el rol %s solo lo asigna un admin o quien tenga %s", ErrRolNoOtorgable, models.RolAdmin, models.PermisoSistemaAdmin)
+		}
+		return nil
+	}
+	var faltantes []string
+	for _, permiso := range otorgado.PermisosEfectivos() {
+		if !actor.Tiene(permiso) {
+			faltantes = append(faltantes, permiso)
+		}
+	}
+	if len(faltantes) > 0 {
+		return fmt.Errorf("%w: %s", ErrRolNoOtorgable, strings.Join(faltantes, ", "))
+	}
+	return nil
+}
+
+// RolService administra los roles y resuelve los permisos de cada usuario
+// (ver middleware.RequirePermiso).
+type RolService struct {
+	repo *repositories.RolRepository
+}
+
+func NewRolService(repo *repositories.RolRepository) *RolService {
+	return &RolService{repo: repo}
+}
+
+func (s *RolService) Listar() ([]models.Rol, error) {
+	roles, err := s.repo.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	for i := range roles {
+		roles[i].Permisos = roles[i].PermisosEfectivos()
+	}
+	return roles, nil
+}
+
+// Existe indica si hay un rol con ese nombre (para validar Usuario.Rol).
+func (s *RolService) Existe(nombre string) (bool, error) {
+	rol, err := s.repo.GetByNombre(nombre)
+	return rol != nil, err
+}
+
+// PermisosDeUsuario devuelve los permisos efectivos del usuario (ninguno
+// si su rol no existe).
+func (s *RolService) PermisosDeUsuario(usuarioID uint) ([]string, error) {
+	rol, err := s.repo.DeUsuario(usuarioID)
+	if err != nil || rol == nil {
+		return []string{}, err
+	}
+	return rol.PermisosEfectivos(), nil
+}
+
+// TienePermiso indica si el rol del usuario tiene alguno de los permisos.
+func (s *RolService) TienePermiso(usuarioID uint, permisos ...string) (bool, error) {
+	rol, err := s.repo.DeUsuario(usuarioID)
+	if err != nil || rol == nil {
+		return false, err
+	}
+	return rol.Tiene(permisos...), nil
+}
+
+// PuedeOtorgar devuelve ErrRolNoOtorgable si el usuario actorID no puede
+// dar el rol otorgado (ver verificarOtorgable). Una API key actúa con el rol
+// de su cuenta de servicio (auditor), así que nunca da más que eso.
+func (s *RolService) PuedeOtorgar(actorID uint, otorgado *models.Rol) error {
+	actor, err := s.repo.DeUsuario(actorID)
+	if err != nil {
+		return err
+	}
+	return verificarOtorgable(actor, otorgado)
+}
+
+type RolInput struct {
+	Nombre      string
+	Descripcion string
+	Permisos    []string
+	Requiere2FA bool
+}
+
+// normalizar valida el input y deja los permisos sin repetir, en el orden
+// del catálogo.
+func (input *RolInput) normalizar() error {
+	input.Nombre = strings.ToLower(strings.TrimSpace(input.Nombre))
+	input.Descripcion = strings.TrimSpace(input.Descripcion)
+	if input.Nombre == "" || len(input.Nombre) > 20 {
+		return fmt.Errorf("%w: el nombre es requerido y no puede pasar de 20 caracteres", ErrRolInvalido)
+	}
+	elegidos := map[string]bool{}
+	for _, permiso := range input.Permisos {
+		if !models.EsPermiso(permiso) {
+			return fmt.Errorf("%w: permiso desconocido %q", ErrRolInvalido, permiso)
+		}
+		elegidos[permiso] = true
+	}
+	input.Permisos = []string{}
+	for _, permiso := range models.Permisos {
+		if elegidos[permiso.Nombre] {
+			input.Permisos = append(input.Permisos, permiso.Nombre)
+		}
+	}
+	return nil
+}
+
+// Crear guarda un rol nuevo; actorID no puede incluir permisos que no
+// tiene.
+func (s *RolService) Crear(input RolInput, actorID uint) (*models.Rol, error) {
+	if err := input.normalizar(); err != nil {
+		return nil, err
+	}
+	if err := s.PuedeOtorgar(actorID, &models.Rol{Nombre: input.Nombre, Permisos: input.Permisos}); err != nil {
+		return nil, err
+	}
+	existente, err := s.repo.GetByNombre(input.Nombre)
+	if err != nil {
+		return nil, err
+	}
+	if existente != nil {
+		return nil, fmt.Errorf("%w: %s", ErrRolDuplicado, input.Nombre)
+	}
+	rol := &models.Rol{Nombre: input.Nombre, Descripcion: input.Descripcion, Permisos: input.Permisos, Requiere2FA: input.Requiere2FA}
+	if err := s.repo.Guardar(rol); err != nil {
+		return nil, err
+	}
+	return rol, nil
+}
+
+// Actualizar cambia descripción, permisos y si exige segundo factor (y el
+// nombre, si no es de sistema y nadie lo usa). Los cambios aplican en el
+// próximo request de cada usuario del rol. actorID tiene que poder otorgar
+// el rol tanto antes como después del cambio (no edita un rol con más
+// permisos que los suyos, por ejemplo para quitarle el segundo factor).
+func (s *RolService) Actualizar(id uint, input RolInput, actorID uint) (*models.Rol, error) {
+	if err := input.normalizar(); err != nil {
+		return nil, err
+	}
+	rol, err := s.Obtener(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.PuedeOtorgar(actorID, rol); err != nil {
+		return nil, err
+	}
+	if input.Nombre != rol.Nombre {
+		if rol.Sistema {
+			return nil, fmt.Errorf("%w: %s no se puede renombrar", ErrRolSistema, rol.Nombre)
+		}
+		existente, err := s.repo.GetByNombre(input.Nombre)
+		if err != nil {
+			return nil, err
+		}
+		if existente != nil {
+			return nil, fmt.Errorf("%w: %s", ErrRolDuplicado, input.Nombre)
+		}
+		if err := s.sinUsuarios(rol.Nombre); err != nil {
+			return nil, err
+		}
+	}
+	if rol.Nombre == models.RolAdmin {
+		// admin tiene siempre todos: lo que venga se ignora
+		input.Permisos = rol.Permisos
+	}
+	if err := s.PuedeOtorgar(actorID, &models.Rol{Nombre: input.Nombre, Permisos: input.Permisos}); err != nil {
+		return nil, err
+	}
+
+	rol.Nombre = input.Nombre
+	rol.Descripcion = input.Descripcion
+	rol.Permisos = input.Permisos
+	rol.Requiere2FA = input.Requiere2FA
+	if err := s.repo.Guardar(rol); err != nil {
+		return nil, err
+	}
+	rol.Permisos = rol.PermisosEfectivos()
+	return rol, nil
+}
+
+func (s *RolService) Eliminar(id uint) error {
+	rol, err := s.Obtener(id)
+	if err != nil {
+		return err
+	}
+	if rol.Sistema {
+		return fmt.Errorf("%w: %s no se puede eliminar", ErrRolSistema, rol.Nombre)
+	}
+	if err := s.sinUsuarios(rol.Nombre); err != nil {
+		return err
+	}
+	return s.repo.Eliminar(id)
+}
+
+// Obtener devuelve el rol id, o ErrRolNoEncontrado.
+func (s *RolService) Obtener(id uint) (*models.Rol, error) {
+	rol, err := s.repo.GetByID(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("%w: %d", ErrRolNoEncontrado, id)
+	}
+	return rol, err
+}
+
+func (s *RolService) sinUsuarios(nombre string) error {
+	total, err := s.repo.ContarUsuarios(nombre)
+	if err != nil {
+		return err
+	}
+	if total > 0 {
+		return fmt.Errorf("%w: %s tiene %d usuarios", ErrRolEnUso, nombre, total)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package services
+
+import (
+	"errors"
+	"managerfact/internal/domain/models"
+	"testing"
+)
+
+func TestVerificarOtorgable(t *testing.T) {
+	admin := &models.Rol{Nombre: models.RolAdmin}
+	gestor := &models.Rol{Nombre: "gestor", Permisos: []string{models.PermisoUsuariosEditar, models.PermisoFacturasVer}}
+	sistemas := &models.Rol{Nombre: "sistemas", Permisos: []string{models.PermisoUsuariosEditar, models.PermisoSistemaAdmin}}
+
+	casos := []struct {
+		nombre    string
+		actor     *models.Rol
+		otorgado  *models.Rol
+		permitido bool
+	}{
+		{"admin da cualquier rol", admin, &models.Rol{Nombre: "x", Permisos: []string{models.PermisoApiKeysEditar}}, true},
+		{"admin da admin", admin, admin, true},
+		{"subconjunto de los propios", gestor, &models.Rol{Nombre: "lector", Permisos: []string{models.PermisoFacturasVer}}, true},
+		{"los mismos permisos", gestor, &models.Rol{Nombre: "copia", Permisos: gestor.Permisos}, true},
+		{"sin permisos", gestor, &models.Rol{Nombre: "vacio", Permisos: []string{}}, true},
+		{"un permiso que no tiene", gestor, &models.Rol{Nombre: "x", Permisos: []string{models.PermisoFacturasVer, models.PermisoSistemaAdmin}}, false},
+		{"api keys sin tenerlo", gestor, &models.Rol{Nombre: "x", Permisos: []string{models.PermisoApiKeysEditar}}, false},
+		{"admin sin sistema.administrar", gestor, admin, false},
+		{"admin con sistema.administrar", sistemas, admin, true},
+		{"actor sin rol", nil, &models.Rol{Nombre: "vacio"}, false},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			err := verificarOtorgable(c.actor, c.otorgado)
+			if c.permitido && err != nil {
+				t.Errorf("verificarOtorgable = %v, se esperaba nil", err)
+			}
+			if !c.permitido && !errors.Is(err, ErrRolNoOtorgable) {
+				t.Errorf("verificarOtorgable = %v, se esperaba ErrRolNoOtorgable", err)
+			}
+		})
+	}
+}
+
+func TestVerificarOtorgableListaLosFaltantes(t *testing.T) {
+	actor := &models.Rol{Nombre: "gestor", Permisos: []string{models.PermisoUsuariosEditar}}
+	otorgado := &models.Rol{Nombre: "x", Permisos: []string{models.PermisoUsuariosEditar, models.PermisoApiKeysEditar, models.PermisoSistemaAdmin}}
+
+	err := verificarOtorgable(actor, otorgado)
+	want := "no puede otorgar permisos que no tiene: api_keys.gestionar, sistema.administrar"
+	if err == nil || err.Error() != want {
+		t.Errorf("error = %v, se esperaba %q", err, want)
+	}
+}
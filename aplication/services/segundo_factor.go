@@ -0,0 +1,411 @@
+package services
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image/png"
+	"managerfact/internal/domain/models"
+	"managerfact/pkg/utils"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrCodigo2FAInvalido: el código TOTP (o de recuperación) no
+	// corresponde, ya se usó o venció.
+	ErrCodigo2FAInvalido = errors.New("código de verificación incorrecto")
+	// Err2FAYaActivo: se pidió enrolar a quien ya tiene el segundo factor.
+	Err2FAYaActivo = errors.New("el segundo factor ya está activo")
+	// Err2FANoActivo: la operación necesita el segundo factor activo.
+	Err2FANoActivo = errors.New("el segundo factor no está activo")
+	// Err2FASinIniciar: se quiso confirmar sin haber iniciado el
+	// enrolamiento.
+	Err2FASinIniciar = errors.New("no hay enrolamiento iniciado (POST /api/v1/auth/2fa/iniciar)")
+	// Err2FAObligatorio: el rol del usuario exige segundo factor, no se
+	// puede desactivar (sí lo puede resetear un admin).
+	Err2FAObligatorio = errors.New("tu rol exige segundo factor: no se puede desactivar")
+)
+
+const (
+	// periodoTotp es el paso de los códigos TOTP (el de Google
+	// Authenticator y compañía).
+	periodoTotp = 30
+	// cantidadCodigosRecuperacion se generan al activar y al regenerar.
+	cantidadCodigosRecuperacion = 10
+)
+
+// emisorTotpDesdeEnv es el nombre con el que aparece la cuenta en la app
+// autenticadora (TOTP_ISSUER).
+func emisorTotpDesdeEnv() string {
+	if emisor := strings.TrimSpace(os.Getenv("TOTP_ISSUER")); emisor != "" {
+		return emisor
+	}
+	return "ManagerFact"
+}
+
+// EstadoSegundoFactor es lo que ve el usuario de su segundo factor.
+type EstadoSegundoFactor struct {
+	Activo     bool       `json:"activo"`
+	ActivadoEn *time.Time `json:"activado_en"`
+	// Obligatorio: su rol lo exige (ver models.Rol.Requiere2FA).
+	Obligatorio bool `json:"obligatorio"`
+	// Pendiente: inició el enrolamiento pero todavía no lo confirmó.
+	Pendiente        bool  `json:"pendiente"`
+	CodigosRestantes int64 `json:"codigos_recuperacion_restantes"`
+}
+
+// EnrolamientoTotp es lo necesario para cargar la cuenta en la app
+// autenticadora: la URL otpauth:// (lo que codifica el QR), el secreto para
+// cargarlo a mano y el QR como data URI PNG.
+type EnrolamientoTotp struct {
+	URL     string `json:"otpauth_url"`
+	Secreto string `json:"secreto"`
+	QR      string `json:"qr"`
+}
+
+// rolExige2FA indica si el rol del usuario exige segundo factor.
+func (s *UsuarioService) rolExige2FA(usuario *models.Usuario) (bool, error) {
+	rol, err := s.roles.GetByNombre(usuario.Rol)
+	if err != nil {
+		return false, err
+	}
+	return rol != nil && rol.Requiere2FA, nil
+}
+
+// EstadoSegundoFactor devuelve el estado del segundo factor del usuario.
+func (s *UsuarioService) EstadoSegundoFactor(usuarioID uint) (*EstadoSegundoFactor, error) {
+	usuario, err := s.editable(usuarioID)
+	if err != nil {
+		return nil, err
+	}
+	obligatorio, err := s.rolExige2FA(usuario)
+	if err != nil {
+		return nil, err
+	}
+	estado := &EstadoSegundoFactor{
+		Activo:      usuario.TotpActivo,
+		ActivadoEn:  usuario.TotpActivadoEn,
+		Obligatorio: obligatorio,
+		Pendiente:   !usuario.TotpActivo && usuario.TotpSecreto != "",
+	}
+	if usuario.TotpActivo {
+		if estado.CodigosRestantes, err = s.repo.CodigosRecuperacionRestantes(usuarioID); err != nil {
+			return nil, err
+		}
+	}
+	return estado, nil
+}
+
+// RequiereEnrolar2FA indica si el usuario todavía no enroló el segundo
+// factor que su rol exige (ver middleware.Require2FAConfigurado). Las
+// cuentas de servicio no inician sesión y quedan afuera.
+func (s *UsuarioService) RequiereEnrolar2FA(usuarioID uint) (bool, error) {
+	usuario, err := s.repo.GetByID(usuarioID)
+	if err != nil {
+		return false, err
+	}
+	if usuario.EsServicio || usuario.TotpActivo {
+		return false, nil
+	}
+	return s.rolExige2FA(usuario)
+}
+
+// IniciarSegundoFactor genera un secreto TOTP nuevo y lo guarda cifrado,
+// pendiente de confirmar con ConfirmarSegundoFactor. Volver a llamarlo
+// antes de confirmar descarta el secreto anterior.
+func (s *UsuarioService) IniciarSegundoFactor(usuarioID uint) (*EnrolamientoTotp, error) {
+	usuario, err := s.editable(usuarioID)
+	if err != nil {
+		return nil, err
+	}
+	if usuario.TotpActivo {
+		return nil, Err2FAYaActivo
+	}
+
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: s.emisorTotp, AccountName: usuario.CodigoUsuario})
+	if err != nil {
+		return nil, fmt.Errorf("error generando secreto TOTP: %w", err)
+	}
+	cifrado, err := utils.Encrypt(key.Secret())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.IniciarTotp(usuario.ID, cifrado); err != nil {
+		return nil, err
+	}
+
+	imagen, err := key.Image(256, 256)
+	if err != nil {
+		return nil, fmt.Errorf("error generando QR: %w", err)
+	}
+	var qr bytes.Buffer
+	if err := png.Encode(&qr, imagen); err != nil {
+		return nil, fmt.Errorf("error generando QR: %w", err)
+	}
+	return &EnrolamientoTotp{
+		URL:     key.URL(),
+		Secreto: key.Secret(),
+		QR:      "data:image/png;base64," + base64.StdEncoding.EncodeToString(qr.Bytes()),
+	}, nil
+}
+
+// ConfirmarSegundoFactor activa el segundo factor si el código corresponde
+// al secreto iniciado, y devuelve los códigos de recuperación en claro
+// (única vez que se pueden ver).
+func (s *UsuarioService) ConfirmarSegundoFactor(usuarioID uint, codigo string) ([]string, error) {
+	usuario, err := s.editable(usuarioID)
+	if err != nil {
+		return nil, err
+	}
+	if usuario.TotpActivo {
+		return nil, Err2FAYaActivo
+	}
+	if usuario.TotpSecreto == "" {
+		return nil, Err2FASinIniciar
+	}
+	ahora := time.Now()
+	paso, ok, err := pasoTotp(usuario.TotpSecreto, normalizarCodigo2FA(codigo), ahora)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrCodigo2FAInvalido
+	}
+
+	codigos, hashes, err := nuevosCodigosRecuperacion()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.ActivarTotp(usuario.ID, paso, ahora, hashes); err != nil {
+		return nil, err
+	}
+	return codigos, nil
+}
+
+// RegenerarCodigosRecuperacion reemplaza los códigos de recuperación (los
+// anteriores dejan de servir). Pide un código TOTP vigente.
+func (s *UsuarioService) RegenerarCodigosRecuperacion(usuarioID uint, codigo string) ([]string, error) {
+	usuario, err := s.editable(usuarioID)
+	if err != nil {
+		return nil, err
+	}
+	if !usuario.TotpActivo {
+		return nil, Err2FANoActivo
+	}
+	ok, err := verificarTotp(s.repo, usuario, normalizarCodigo2FA(codigo), time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, ErrCodigo2FAInvalido
+	}
+
+	codigos, hashes, err := nuevosCodigosRecuperacion()
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repo.ReemplazarCodigosRecuperacion(usuario.ID, hashes); err != nil {
+		return nil, err
+	}
+	return codigos, nil
+}
+
+// DesactivarSegundoFactor lo quita a pedido del propio usuario, con su
+// contraseña y un código (TOTP o de recuperación). No se puede si su rol
+// lo exige.
+func (s *UsuarioService) DesactivarSegundoFactor(usuarioID uint, password, codigo string) error {
+	usuario, err := s.editable(usuarioID)
+	if err != nil {
+		return err
+	}
+	if !usuario.TotpActivo {
+		return Err2FANoActivo
+	}
+	obligatorio, err := s.rolExige2FA(usuario)
+	if err != nil {
+		return err
+	}
+	if obligatorio {
+		return Err2FAObligatorio
+	}
+	if bcrypt.CompareHashAndPassword([]byte(usuario.PasswordHash), []byte(password)) != nil {
+		return ErrPasswordActualIncorrecta
+	}
+	ok, _, err := verificarCodigo2FA(s.repo, usuario, codigo, time.Now())
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrCodigo2FAInvalido
+	}
+	return s.repo.QuitarTotp(usuario.ID)
+}
+
+// ResetearSegundoFactor es el reset de un admin (ej. el usuario perdió el
+// teléfono y los códigos): quita secreto y códigos y revoca sus sesiones.
+// Si su rol lo exige, en el próximo login tiene que enrolar de nuevo.
+func (s *UsuarioService) ResetearSegundoFactor(id, actorID uint) error {
+	if _, err := s.administrable(id, actorID); err != nil {
+		return err
+	}
+	if err := s.repo.QuitarTotp(id); err != nil {
+		return err
+	}
+	_, err := s.sesiones.RevocarDeUsuario(id, models.SesionSegundoFactorReseteado, time.Now())
+	return err
+}
+
+// VerificarSegundoFactor es el segundo paso del login de un usuario con
+// TOTP activo (el primero, Login, ya verificó la contraseña y emitió el
+// desafío). Acepta un código TOTP o uno de recuperación, y aplica los
+// mismos límites de intentos que Login: un código incorrecto cuenta como
+// login fallido.
+func (s *UsuarioService) VerificarSegundoFactor(usuarioID uint, codigo string, origen OrigenLogin) (*models.Usuario, error) {
+	ahora := time.Now()
+	usuario, err := s.repo.GetByID(usuarioID)
+	if err != nil {
+		return nil, err
+	}
+	intento := &models.IntentoLogin{
+		UsuarioID:     &usuario.ID,
+		CodigoUsuario: usuario.CodigoUsuario,
+		IP:            recortar(origen.IP, 64),
+		UserAgent:     recortar(origen.UserAgent, 255),
+	}
+
+	if err := s.verificarIP(intento, ahora); err != nil {
+		return nil, err
+	}
+	if hasta, motivo := s.login.esperaUsuario(usuario, ahora); hasta.After(ahora) {
+		return nil, s.rechazarLogin(intento, motivo, hasta)
+	}
+	if !usuario.IsActive || !usuario.TotpActivo {
+		return nil, s.loginFallido(intento, usuario, "segundo factor no disponible", ahora)
+	}
+	ok, recuperacion, err := verificarCodigo2FA(s.repo, usuario, codigo, ahora)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		// el fallo cuenta igual que en Login, pero la respuesta dice que lo
+		// incorrecto fue el código (la contraseña ya se verificó)
+		_ = s.loginFallido(intento, usuario, "código de segundo factor incorrecto", ahora)
+		return nil, ErrCodigo2FAInvalido
+	}
+	if recuperacion {
+		intento.Motivo = "con código de recuperación"
+	}
+	if err := s.loginExitoso(intento, usuario); err != nil {
+		return nil, err
+	}
+	return usuario, nil
+}
+
+// consumoCodigos2FA es la parte de UsuarioRepository que consume códigos
+// de segundo factor con UPDATE condicionales: un paso TOTP que no avanza
+// sobre totp_ultimo_paso, o un código de recuperación ya usado, no
+// actualiza ninguna fila (aun con dos requests a la vez).
+type consumoCodigos2FA interface {
+	AvanzarPasoTotp(id uint, paso int64) (bool, error)
+	UsarCodigoRecuperacion(usuarioID uint, hash string, ahora time.Time) (bool, error)
+}
+
+// verificarCodigo2FA acepta un código TOTP (6 dígitos) o uno de
+// recuperación, y lo consume. recuperacion indica cuál fue.
+func verificarCodigo2FA(consumo consumoCodigos2FA, usuario *models.Usuario, codigo string, ahora time.Time) (ok, recuperacion bool, err error) {
+	codigo = normalizarCodigo2FA(codigo)
+	if esCodigoTotp(codigo) {
+		ok, err := verificarTotp(consumo, usuario, codigo, ahora)
+		return ok, false, err
+	}
+	if codigo == "" {
+		return false, false, nil
+	}
+	ok, err = consumo.UsarCodigoRecuperacion(usuario.ID, hashCodigoRecuperacion(codigo), ahora)
+	return ok, true, err
+}
+
+// verificarTotp valida el código contra el secreto del usuario y lo
+// consume: el mismo código (o uno anterior) no se acepta dos veces.
+func verificarTotp(consumo consumoCodigos2FA, usuario *models.Usuario, codigo string, ahora time.Time) (bool, error) {
+	paso, ok, err := pasoTotp(usuario.TotpSecreto, codigo, ahora)
+	if err != nil || !ok {
+		return false, err
+	}
+	return consumo.AvanzarPasoTotp(usuario.ID, paso)
+}
+
+// pasoTotp busca el código en el paso actual y en el anterior y siguiente
+// (tolerancia a relojes desfasados) y devuelve en cuál coincide.
+func pasoTotp(secretoCifrado, codigo string, ahora time.Time) (int64, bool, error) {
+	if !esCodigoTotp(codigo) {
+		return 0, false, nil
+	}
+	secreto, err := utils.Decrypt(secretoCifrado)
+	if err != nil {
+		return 0, false, fmt.Errorf("error descifrando secreto TOTP: %w", err)
+	}
+	actual := ahora.Unix() / periodoTotp
+	for _, paso := range []int64{actual - 1, actual, actual + 1} {
+		esperado, err := totp.GenerateCode(secreto, time.Unix(paso*periodoTotp, 0))
+		if err != nil {
+			return 0, false, fmt.Errorf("error generando código TOTP: %w", err)
+		}
+		if subtle.ConstantTimeCompare([]byte(esperado), []byte(codigo)) == 1 {
+			return paso, true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// normalizarCodigo2FA quita espacios y guiones (los códigos de
+// recuperación se muestran "xxxxx-xxxxx") y pasa a minúsculas.
+func normalizarCodigo2FA(codigo string) string {
+	codigo = strings.ToLower(strings.TrimSpace(codigo))
+	return strings.NewReplacer("-", "", " ", "").Replace(codigo)
+}
+
+func esCodigoTotp(codigo string) bool {
+	if len(codigo) != 6 {
+		return false
+	}
+	for _, r := range codigo {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// nuevosCodigosRecuperacion genera los códigos de recuperación para
+// mostrar ("xxxxx-xxxxx") y sus hashes para guardar.
+func nuevosCodigosRecuperacion() ([]string, []string, error) {
+	codigos := make([]string, cantidadCodigosRecuperacion)
+	hashes := make([]string, cantidadCodigosRecuperacion)
+	aleatorio := make([]byte, 7)
+	for i := range codigos {
+		if _, err := rand.Read(aleatorio); err != nil {
+			return nil, nil, fmt.Errorf("error generando códigos de recuperación: %w", err)
+		}
+		codigo := strings.ToLower(base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(aleatorio))[:10]
+		codigos[i] = codigo[:5] + "-" + codigo[5:]
+		hashes[i] = hashCodigoRecuperacion(codigo)
+	}
+	return codigos, hashes, nil
+}
+
+func hashCodigoRecuperacion(codigo string) string {
+	suma := sha256.Sum256([]byte(codigo))
+	return hex.EncodeToString(suma[:])
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"managerfact/internal/domain/models"
+	"managerfact/pkg/utils"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pquerna/otp/totp"
+)
+
+// consumoEnMemoria reproduce los UPDATE condicionales de
+// UsuarioRepository.AvanzarPasoTotp y UsarCodigoRecuperacion.
+type consumoEnMemoria struct {
+	ultimoPaso int64
+	usados     map[string]bool
+	codigos    map[string]bool
+}
+
+func (c *consumoEnMemoria) AvanzarPasoTotp(id uint, paso int64) (bool, error) {
+	if c.ultimoPaso >= paso {
+		return false, nil
+	}
+	c.ultimoPaso = paso
+	return true, nil
+}
+
+func (c *consumoEnMemoria) UsarCodigoRecuperacion(usuarioID uint, hash string, ahora time.Time) (bool, error) {
+	if !c.codigos[hash] || c.usados[hash] {
+		return false, nil
+	}
+	c.usados[hash] = true
+	return true, nil
+}
+
+// usuarioConTotp devuelve un usuario con un secreto TOTP recién generado
+// (cifrado como en la base) y el secreto en claro.
+func usuarioConTotp(t *testing.T) (*models.Usuario, string) {
+	t.Helper()
+	t.Setenv("FACTURADOR_TOKEN_KEYS", "v1=clave de prueba")
+	key, err := totp.Generate(totp.GenerateOpts{Issuer: "test", AccountName: "jperez"})
+	if err != nil {
+		t.Fatalf("totp.Generate: %v", err)
+	}
+	cifrado, err := utils.Encrypt(key.Secret())
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	return &models.Usuario{ID: 1, TotpSecreto: cifrado, TotpActivo: true}, key.Secret()
+}
+
+func codigoTotp(t *testing.T, secreto string, momento time.Time) string {
+	t.Helper()
+	codigo, err := totp.GenerateCode(secreto, momento)
+	if err != nil {
+		t.Fatalf("totp.GenerateCode: %v", err)
+	}
+	return codigo
+}
+
+func TestVerificarTotpRechazaReuso(t *testing.T) {
+	usuario, secreto := usuarioConTotp(t)
+	consumo := &consumoEnMemoria{}
+	ahora := time.Unix(1_800_000_000, 0)
+
+	codigo := codigoTotp(t, secreto, ahora)
+	ok, err := verificarTotp(consumo, usuario, codigo, ahora)
+	if err != nil || !ok {
+		t.Fatalf("primer uso = (%v, %v), se esperaba aceptado", ok, err)
+	}
+	ok, err = verificarTotp(consumo, usuario, codigo, ahora.Add(5*time.Second))
+	if err != nil || ok {
+		t.Errorf("reuso del mismo código = (%v, %v), se esperaba rechazado", ok, err)
+	}
+
+	// el código del paso anterior sigue dentro de la tolerancia de reloj,
+	// pero ya se usó uno posterior
+	anterior := codigoTotp(t, secreto, ahora.Add(-periodoTotp*time.Second))
+	if ok, _ := verificarTotp(consumo, usuario, anterior, ahora); ok {
+		t.Error("se aceptó un código anterior al último usado")
+	}
+
+	siguiente := codigoTotp(t, secreto, ahora.Add(periodoTotp*time.Second))
+	if ok, err := verificarTotp(consumo, usuario, siguiente, ahora.Add(periodoTotp*time.Second)); err != nil || !ok {
+		t.Errorf("código del paso siguiente = (%v, %v), se esperaba aceptado", ok, err)
+	}
+}
+
+func TestPasoTotpTolerancia(t *testing.T) {
+	usuario, secreto := usuarioConTotp(t)
+	ahora := time.Unix(1_800_000_000, 0)
+	actual := ahora.Unix() / periodoTotp
+
+	validos := map[string]bool{}
+	for desfase := int64(-1); desfase <= 1; desfase++ {
+		codigo := codigoTotp(t, secreto, time.Unix((actual+desfase)*periodoTotp, 0))
+		validos[codigo] = true
+		paso, ok, err := pasoTotp(usuario.TotpSecreto, codigo, ahora)
+		if err != nil || !ok || paso != actual+desfase {
+			t.Errorf("desfase %d: pasoTotp = (%d, %v, %v), se esperaba (%d, true, nil)", desfase, paso, ok, err, actual+desfase)
+		}
+	}
+
+	viejo := codigoTotp(t, secreto, time.Unix((actual-3)*periodoTotp, 0))
+	// (salvo que coincida por azar con uno de los tres pasos válidos)
+	if ok, _ := verificarTotp(&consumoEnMemoria{}, usuario, viejo, ahora); ok && !validos[viejo] {
+		t.Error("se aceptó un código de hace tres pasos")
+	}
+}
+
+func TestCodigoRecuperacionUnSoloUso(t *testing.T) {
+	usuario, _ := usuarioConTotp(t)
+	codigos, hashes, err := nuevosCodigosRecuperacion()
+	if err != nil {
+		t.Fatalf("nuevosCodigosRecuperacion: %v", err)
+	}
+	if len(codigos) != cantidadCodigosRecuperacion {
+		t.Fatalf("se generaron %d códigos, se esperaban %d", len(codigos), cantidadCodigosRecuperacion)
+	}
+	consumo := &consumoEnMemoria{usados: map[string]bool{}, codigos: map[string]bool{}}
+	for _, hash := range hashes {
+		consumo.codigos[hash] = true
+	}
+	ahora := time.Now()
+
+	// se acepta como se muestra, en mayúsculas o sin el guión
+	ok, recuperacion, err := verificarCodigo2FA(consumo, usuario, " "+strings.ToUpper(codigos[0])+" ", ahora)
+	if err != nil || !ok || !recuperacion {
+		t.Fatalf("primer uso = (%v, %v, %v), se esperaba aceptado como recuperación", ok, recuperacion, err)
+	}
+	if ok, _, _ := verificarCodigo2FA(consumo, usuario, codigos[0], ahora); ok {
+		t.Error("se aceptó dos veces el mismo código de recuperación")
+	}
+	if ok, _, _ := verificarCodigo2FA(consumo, usuario, strings.ReplaceAll(codigos[1], "-", ""), ahora); !ok {
+		t.Error("no se aceptó otro código de recuperación sin usar")
+	}
+	if ok, _, _ := verificarCodigo2FA(consumo, usuario, "aaaaa-bbbbb", ahora); ok {
+		t.Error("se aceptó un código de recuperación inexistente")
+	}
+	if ok, _, _ := verificarCodigo2FA(consumo, usuario, "", ahora); ok {
+		t.Error("se aceptó un código vacío")
+	}
+}
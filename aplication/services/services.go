@@ -2,7 +2,6 @@ package services
 
 import (
 	"context"
-	"database/sql"
 	"fmt"
 	"log"
 	"managerfact/internal/domain/models"
@@ -31,6 +30,7 @@ type DbConnectionService interface {
 	TestConnectionByConfig(connection *models.DbConnection) (*ConnectionTestResult, error)
 	GetConnectionsPaginated(page, pageSize int) (*PaginatedResponse, error)
 	GetConnectionsCount() (int64, error)
+	PoolStats() []EstadisticasPool
 }
 
 // ConnectionTestResult representa el resultado de una prueba de conexión
@@ -42,7 +42,7 @@ type ConnectionTestResult struct {
 	Error        string        `json:"error,omitempty"`
 }
 
-// ServerInfo información del servidor SQL Server
+// ServerInfo información del servidor remoto (ver DriverBD.InfoServidor)
 type ServerInfo struct {
 	Version     string `json:"version"`
 	ProductName string `json:"product_name"`
@@ -62,13 +62,18 @@ type PaginatedResponse struct {
 type dbConnectionService struct {
 	repo      repositories.DbConnectionRepository
 	validator *validator.Validate
+	// conexiones es el pool compartido con ConsultasService: al actualizar
+	// o eliminar una conexión se invalida su pool para que la próxima
+	// consulta use la configuración nueva.
+	conexiones *ConexionesRemotas
 }
 
 // NewDbConnectionService crea una nueva instancia del servicio
-func NewDbConnectionService(repo repositories.DbConnectionRepository) DbConnectionService {
+func NewDbConnectionService(repo repositories.DbConnectionRepository, conexiones *ConexionesRemotas) DbConnectionService {
 	return &dbConnectionService{
-		repo:      repo,
-		validator: validator.New(),
+		repo:       repo,
+		validator:  validator.New(),
+		conexiones: conexiones,
 	}
 }
 
@@ -78,6 +83,10 @@ func (s *dbConnectionService) CreateConnection(connection *models.DbConnection)
 		return fmt.Errorf("la conexión no puede ser nula")
 	}
 
+	if _, err := completarDriver(connection); err != nil {
+		return err
+	}
+
 	// Validar la estructura
 	if err := s.validator.Struct(connection); err != nil {
 		return fmt.Errorf("datos de conexión inválidos: %v", err)
@@ -98,6 +107,10 @@ func (s *dbConnectionService) CreateConnection(connection *models.DbConnection)
 		return fmt.Errorf("no se pudo conectar a la base de datos: %s", testResult.Message)
 	}
 
+	if err := connection.CifrarPassword(); err != nil {
+		return err
+	}
+
 	// Guardar en el repositorio
 	if err := s.repo.Create(connection); err != nil {
 		return fmt.Errorf("error guardando conexión: %v", err)
@@ -107,6 +120,20 @@ func (s *dbConnectionService) CreateConnection(connection *models.DbConnection)
 	return nil
 }
 
+// completarDriver normaliza Driver (vacío = SQL Server) y, si no se indicó
+// puerto, usa el del motor.
+func completarDriver(connection *models.DbConnection) (DriverBD, error) {
+	connection.Driver = connection.DriverNormalizado()
+	driver, err := driverDe(connection)
+	if err != nil {
+		return nil, err
+	}
+	if connection.Port == 0 {
+		connection.Port = driver.PuertoPorDefecto()
+	}
+	return driver, nil
+}
+
 // GetConnection obtiene una conexión por ID
 func (s *dbConnectionService) GetConnection(id uint) (*models.DbConnection, error) {
 	if id == 0 {
@@ -148,17 +175,32 @@ func (s *dbConnectionService) UpdateConnection(connection *models.DbConnection)
 		return fmt.Errorf("ID de conexión requerido para actualización")
 	}
 
-	// Validar la estructura
-	if err := s.validator.Struct(connection); err != nil {
-		return fmt.Errorf("datos de conexión inválidos: %v", err)
-	}
-
 	// Verificar que la conexión existe
-	_, err := s.repo.GetByID(connection.ID)
+	existente, err := s.repo.GetByID(connection.ID)
 	if err != nil {
 		return err
 	}
 
+	// Contraseña vacía = conservar la guardada (el front nunca la recibe,
+	// así que no puede reenviarla).
+	if connection.Password == "" {
+		connection.Password = existente.Password
+		connection.PasswordCifrado = existente.PasswordCifrado
+	}
+	// Sin driver en el request se conserva el guardado.
+	if connection.Driver == "" {
+		connection.Driver = existente.Driver
+	}
+
+	if _, err := completarDriver(connection); err != nil {
+		return err
+	}
+
+	// Validar la estructura
+	if err := s.validator.Struct(connection); err != nil {
+		return fmt.Errorf("datos de conexión inválidos: %v", err)
+	}
+
 	// Si está activa, probar la conexión
 	if connection.IsActive {
 		testResult, err := s.TestConnectionByConfig(connection)
@@ -171,10 +213,15 @@ func (s *dbConnectionService) UpdateConnection(connection *models.DbConnection)
 		}
 	}
 
+	if err := connection.CifrarPassword(); err != nil {
+		return err
+	}
+
 	// Actualizar en el repositorio
 	if err := s.repo.Update(connection); err != nil {
 		return fmt.Errorf("error actualizando conexión: %v", err)
 	}
+	s.conexiones.Invalidar(connection.ID)
 
 	log.Printf("Conexión '%s' actualizada exitosamente", connection.ServerName)
 	return nil
@@ -196,6 +243,7 @@ func (s *dbConnectionService) DeleteConnection(id uint) error {
 	if err := s.repo.Delete(id); err != nil {
 		return fmt.Errorf("error eliminando conexión: %v", err)
 	}
+	s.conexiones.Invalidar(id)
 
 	log.Printf("Conexión '%s' eliminada permanentemente", connection.ServerName)
 	return nil
@@ -217,6 +265,7 @@ func (s *dbConnectionService) SoftDeleteConnection(id uint) error {
 	if err := s.repo.SoftDelete(id); err != nil {
 		return fmt.Errorf("error eliminando conexión: %v", err)
 	}
+	s.conexiones.Invalidar(id)
 
 	log.Printf("Conexión '%s' desactivada", connection.ServerName)
 	return nil
@@ -248,11 +297,14 @@ func (s *dbConnectionService) TestConnectionByConfig(connection *models.DbConnec
 	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 	defer cancel()
 
-	// Construir connection string
-	connString := connection.ConnectionString()
-
-	// Intentar conexión
-	db, err := sql.Open("mssql", connString)
+	// Abrir con el driver de la conexión (SQL Server, PostgreSQL o MySQL)
+	driver, err := completarDriver(connection)
+	if err != nil {
+		result.Message = "Driver de base de datos no soportado"
+		result.Error = err.Error()
+		return result, nil
+	}
+	db, err := abrirSQL(connection)
 	if err != nil {
 		result.Message = "Error abriendo conexión"
 		result.Error = err.Error()
@@ -273,7 +325,7 @@ func (s *dbConnectionService) TestConnectionByConfig(connection *models.DbConnec
 	}
 
 	// Query de prueba para obtener información del servidor
-	serverInfo, err := s.getServerInfo(ctx, db)
+	serverInfo, err := driver.InfoServidor(ctx, db)
 	if err != nil {
 		result.Message = "Conexión establecida pero error obteniendo información del servidor"
 		result.Error = err.Error()
@@ -288,27 +340,6 @@ func (s *dbConnectionService) TestConnectionByConfig(connection *models.DbConnec
 	return result, nil
 }
 
-// getServerInfo obtiene información del servidor SQL Server
-func (s *dbConnectionService) getServerInfo(ctx context.Context, db *sql.DB) (*ServerInfo, error) {
-	info := &ServerInfo{}
-
-	// Query para obtener versión y información del servidor
-	query := `
-		SELECT 
-			@@VERSION as version,
-			SERVERPROPERTY('ProductName') as product_name,
-			SERVERPROPERTY('Edition') as edition
-	`
-
-	row := db.QueryRowContext(ctx, query)
-	err := row.Scan(&info.Version, &info.ProductName, &info.Edition)
-	if err != nil {
-		return nil, fmt.Errorf("error obteniendo información del servidor: %v", err)
-	}
-
-	return info, nil
-}
-
 // GetConnectionsPaginated obtiene conexiones con paginación
 func (s *dbConnectionService) GetConnectionsPaginated(page, pageSize int) (*PaginatedResponse, error) {
 	if page < 1 {
@@ -346,3 +377,9 @@ func (s *dbConnectionService) GetConnectionsPaginated(page, pageSize int) (*Pagi
 func (s *dbConnectionService) GetConnectionsCount() (int64, error) {
 	return s.repo.Count()
 }
+
+// PoolStats devuelve el estado de los pools abiertos por ConsultasService
+// contra las conexiones remotas.
+func (s *dbConnectionService) PoolStats() []EstadisticasPool {
+	return s.conexiones.Estadisticas()
+}
@@ -0,0 +1,196 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"managerfact/internal/domain/models"
+	"managerfact/internal/domain/repositories"
+	"managerfact/pkg/utils"
+	"time"
+)
+
+// ErrSesionInvalida: refresh token desconocido, vencido, revocado o ya
+// rotado, o sesión que no es del usuario.
+var ErrSesionInvalida = errors.New("sesión inválida o expirada")
+
+// Las sesiones vencidas o revocadas se conservan este tiempo como historial
+// (GET /usuarios/:id/sesiones?todas=true) y después se borran.
+const retencionSesiones = 30 * 24 * time.Hour
+
+// SesionService maneja las sesiones del lado del servidor: el login crea
+// una con su refresh token, POST /auth/refresh la renueva rotando el
+// refresh token, y logout, un admin o los cambios del usuario (ver
+// UsuarioService) la revocan. REFRESH_TOKEN_DIAS es cuánto dura una sesión
+// sin renovarse.
+type SesionService struct {
+	repo            *repositories.SesionRepository
+	usuarios        *repositories.UsuarioRepository
+	duracionRefresh time.Duration
+}
+
+func NewSesionService(repo *repositories.SesionRepository, usuarios *repositories.UsuarioRepository) *SesionService {
+	return &SesionService{
+		repo:            repo,
+		usuarios:        usuarios,
+		duracionRefresh: time.Duration(enteroEnv("REFRESH_TOKEN_DIAS", 7)) * 24 * time.Hour,
+	}
+}
+
+// TokensSesion es lo que recibe el cliente al iniciar o renovar sesión.
+type TokensSesion struct {
+	Token           string    `json:"token"`
+	ExpiraEn        time.Time `json:"expira_en"`
+	RefreshToken    string    `json:"refresh_token"`
+	RefreshExpiraEn time.Time `json:"refresh_expira_en"`
+	SesionID        uint      `json:"sesion_id"`
+}
+
+// nuevoRefreshToken genera un refresh token aleatorio y su hash.
+func nuevoRefreshToken() (string, string, error) {
+	bytes := make([]byte, 32)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", "", fmt.Errorf("error generando refresh token: %w", err)
+	}
+	token := base64.RawURLEncoding.EncodeToString(bytes)
+	return token, hashRefreshToken(token), nil
+}
+
+func hashRefreshToken(token string) string {
+	suma := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(suma[:])
+}
+
+func (s *SesionService) tokens(sesion *models.Sesion, refreshToken string) (*TokensSesion, error) {
+	token, expira, err := utils.GenerarTokenJWT(sesion.UsuarioID, sesion.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &TokensSesion{
+		Token:           token,
+		ExpiraEn:        expira,
+		RefreshToken:    refreshToken,
+		RefreshExpiraEn: sesion.ExpiraEn,
+		SesionID:        sesion.ID,
+	}, nil
+}
+
+// Crear abre una sesión para el usuario que acaba de hacer login.
+func (s *SesionService) Crear(usuarioID uint, origen OrigenLogin) (*TokensSesion, error) {
+	refreshToken, hash, err := nuevoRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	ahora := time.Now()
+	sesion := &models.Sesion{
+		UsuarioID:   usuarioID,
+		RefreshHash: hash,
+		IP:          recortar(origen.IP, 64),
+		UserAgent:   recortar(origen.UserAgent, 255),
+		ExpiraEn:    ahora.Add(s.duracionRefresh),
+	}
+	if err := s.repo.Create(sesion); err != nil {
+		return nil, err
+	}
+	if err := s.repo.EliminarVencidas(usuarioID, ahora.Add(-retencionSesiones)); err != nil {
+		log.Printf("[Sesiones] %v", err)
+	}
+	return s.tokens(sesion, refreshToken)
+}
+
+// Renovar cambia un refresh token vigente por un par nuevo (el viejo deja
+// de servir). Presentar un refresh token ya rotado revoca la sesión: o lo
+// usó otro, o lo usa alguien que lo robó.
+func (s *SesionService) Renovar(refreshToken string) (*TokensSesion, error) {
+	hash := hashRefreshToken(refreshToken)
+	sesion, err := s.repo.PorRefreshHash(hash, false)
+	if err != nil {
+		return nil, err
+	}
+	ahora := time.Now()
+	if sesion == nil {
+		reusada, err := s.repo.PorRefreshHash(hash, true)
+		if err != nil {
+			return nil, err
+		}
+		if reusada != nil {
+			if _, err := s.repo.Revocar(reusada.ID, models.SesionReusoRefresh, ahora); err != nil {
+				return nil, err
+			}
+			log.Printf("[Sesiones] refresh token reusado en la sesión %d del usuario %d: sesión revocada", reusada.ID, reusada.UsuarioID)
+		}
+		return nil, ErrSesionInvalida
+	}
+	if !sesion.Activa(ahora) {
+		return nil, ErrSesionInvalida
+	}
+	usuario, err := s.usuarios.GetByID(sesion.UsuarioID)
+	if err != nil || !usuario.IsActive {
+		return nil, ErrSesionInvalida
+	}
+
+	nuevo, hashNuevo, err := nuevoRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	expira := ahora.Add(s.duracionRefresh)
+	rotada, err := s.repo.Rotar(sesion.ID, hash, hashNuevo, ahora, expira)
+	if err != nil {
+		return nil, err
+	}
+	if !rotada {
+		return nil, ErrSesionInvalida
+	}
+	sesion.ExpiraEn = expira
+	return s.tokens(sesion, nuevo)
+}
+
+// Vigente indica si la sesión del token existe, es del usuario y sigue
+// activa; la usa RequireAuth en cada request.
+func (s *SesionService) Vigente(sesionID, usuarioID uint) (bool, error) {
+	sesion, err := s.repo.GetByID(sesionID)
+	if err != nil {
+		return false, err
+	}
+	return sesion != nil && sesion.UsuarioID == usuarioID && sesion.Activa(time.Now()), nil
+}
+
+// Cerrar es el logout de la sesión actual.
+func (s *SesionService) Cerrar(sesionID uint) error {
+	_, err := s.repo.Revocar(sesionID, models.SesionCerrada, time.Now())
+	return err
+}
+
+// CerrarTodas es el logout de todas las sesiones del usuario.
+func (s *SesionService) CerrarTodas(usuarioID uint) (int64, error) {
+	return s.repo.RevocarDeUsuario(usuarioID, models.SesionCerrada, time.Now())
+}
+
+// ListarDeUsuario lista las sesiones activas del usuario (con todas,
+// también las vencidas y revocadas de los últimos 30 días).
+func (s *SesionService) ListarDeUsuario(usuarioID uint, todas bool) ([]models.Sesion, error) {
+	return s.repo.ListarDeUsuario(usuarioID, todas, time.Now())
+}
+
+// Revocar revoca una sesión del usuario (desde el admin).
+func (s *SesionService) Revocar(usuarioID, sesionID uint) error {
+	sesion, err := s.repo.GetByID(sesionID)
+	if err != nil {
+		return err
+	}
+	if sesion == nil || sesion.UsuarioID != usuarioID {
+		return fmt.Errorf("%w: la sesión %d no es del usuario %d", ErrSesionInvalida, sesionID, usuarioID)
+	}
+	_, err = s.repo.Revocar(sesionID, models.SesionRevocadaAdmin, time.Now())
+	return err
+}
+
+// RevocarTodas revoca todas las sesiones activas del usuario (desde el
+// admin) y devuelve cuántas eran.
+func (s *SesionService) RevocarTodas(usuarioID uint) (int64, error) {
+	return s.repo.RevocarDeUsuario(usuarioID, models.SesionRevocadaAdmin, time.Now())
+}
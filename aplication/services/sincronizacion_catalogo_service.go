@@ -0,0 +1,261 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"managerfact/internal/domain/models"
+	"managerfact/internal/domain/repositories"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrDiferenciaInvalida se devuelve al aplicar un código que no está entre
+// las diferencias de la sincronización o que ya se aplicó.
+var ErrDiferenciaInvalida = errors.New("diferencia inválida para esta sincronización")
+
+// SincronizacionCatalogoService compara sucursales_catalogo contra el
+// SFE_SUCURSAL de un facturador (la fuente real de los códigos SIN; el
+// catálogo inicial se transcribió a mano) y aplica las diferencias que
+// elija un admin. Cada comparación queda guardada con lo que se aplicó.
+type SincronizacionCatalogoService struct {
+	catalogo   *repositories.CatalogoRepository
+	consultas  *ConsultasService
+	conexiones repositories.DbConnectionRepository
+}
+
+func NewSincronizacionCatalogoService(catalogo *repositories.CatalogoRepository, consultas *ConsultasService, conexiones repositories.DbConnectionRepository) *SincronizacionCatalogoService {
+	return &SincronizacionCatalogoService{catalogo: catalogo, consultas: consultas, conexiones: conexiones}
+}
+
+// mismoNombre compara nombres sin distinguir mayúsculas ni espacios de más:
+// SFE_SUCURSAL suele tenerlos en mayúsculas y eso no es un renombre.
+func mismoNombre(a, b string) bool {
+	return strings.EqualFold(strings.Join(strings.Fields(a), " "), strings.Join(strings.Fields(b), " "))
+}
+
+// Comparar lee SFE_SUCURSAL de la conexión, lo compara con el catálogo y
+// guarda la sincronización con las diferencias (sin aplicar ninguna).
+func (s *SincronizacionCatalogoService) Comparar(ctx context.Context, dbConnectionID, usuarioID uint) (*models.SincronizacionCatalogo, error) {
+	conexion, err := s.conexiones.GetByID(dbConnectionID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: conexión %d", ErrCatalogoNoEncontrado, dbConnectionID)
+	}
+	filasSFE, err := s.consultas.Sucursales(ctx, strconv.FormatUint(uint64(dbConnectionID), 10))
+	if err != nil {
+		return nil, err
+	}
+
+	// Un código por sucursal; si SFE_SUCURSAL lo repite vale el primero.
+	sfe := map[int]string{}
+	for _, fila := range *filasSFE {
+		codigo, err := strconv.Atoi(strings.TrimSpace(fila.CodigoSucursal_sin))
+		if err != nil {
+			continue
+		}
+		if _, ok := sfe[codigo]; !ok {
+			sfe[codigo] = strings.TrimSpace(fila.Nombre)
+		}
+	}
+
+	catalogo, err := s.catalogo.SucursalesConEliminadas()
+	if err != nil {
+		return nil, err
+	}
+	porCodigo := make(map[int]models.SucursalCatalogo, len(catalogo))
+	for _, sucursal := range catalogo {
+		porCodigo[sucursal.CodigoSucursalSin] = sucursal
+	}
+
+	diferencias := []models.DiferenciaCatalogo{}
+	for codigo, nombreSFE := range sfe {
+		sucursal, ok := porCodigo[codigo]
+		switch {
+		case !ok:
+			diferencias = append(diferencias, models.DiferenciaCatalogo{Tipo: models.DiferenciaNueva, CodigoSucursalSin: codigo, NombreSFE: nombreSFE})
+		case sucursal.DeletedAt.Valid:
+			diferencias = append(diferencias, models.DiferenciaCatalogo{
+				Tipo:              models.DiferenciaNueva,
+				CodigoSucursalSin: codigo,
+				NombreCatalogo:    sucursal.Nombre,
+				NombreSFE:         nombreSFE,
+				SucursalID:        &sucursal.ID,
+				RegionalID:        &sucursal.RegionalID,
+			})
+		case !mismoNombre(sucursal.Nombre, nombreSFE):
+			diferencias = append(diferencias, models.DiferenciaCatalogo{
+				Tipo:              models.DiferenciaRenombrada,
+				CodigoSucursalSin: codigo,
+				NombreCatalogo:    sucursal.Nombre,
+				NombreSFE:         nombreSFE,
+				SucursalID:        &sucursal.ID,
+				RegionalID:        &sucursal.RegionalID,
+			})
+		}
+	}
+	for _, sucursal := range catalogo {
+		if _, ok := sfe[sucursal.CodigoSucursalSin]; ok || sucursal.DeletedAt.Valid {
+			continue
+		}
+		diferencias = append(diferencias, models.DiferenciaCatalogo{
+			Tipo:              models.DiferenciaFaltante,
+			CodigoSucursalSin: sucursal.CodigoSucursalSin,
+			NombreCatalogo:    sucursal.Nombre,
+			SucursalID:        &sucursal.ID,
+			RegionalID:        &sucursal.RegionalID,
+		})
+	}
+	sort.Slice(diferencias, func(i, j int) bool {
+		if diferencias[i].Tipo != diferencias[j].Tipo {
+			return diferencias[i].Tipo < diferencias[j].Tipo
+		}
+		return diferencias[i].CodigoSucursalSin < diferencias[j].CodigoSucursalSin
+	})
+
+	sincronizacion := &models.SincronizacionCatalogo{
+		DbConnectionID: dbConnectionID,
+		ServerName:     conexion.ServerName,
+		UsuarioID:      &usuarioID,
+		Estado:         models.SincronizacionPendiente,
+		TotalSFE:       len(sfe),
+		Diferencias:    diferencias,
+	}
+	if len(diferencias) == 0 {
+		sincronizacion.Estado = models.SincronizacionSinCambios
+	}
+	if err := s.catalogo.CrearSincronizacion(sincronizacion); err != nil {
+		return nil, err
+	}
+	return sincronizacion, nil
+}
+
+func (s *SincronizacionCatalogoService) Listar(limit int) ([]models.SincronizacionCatalogo, error) {
+	if limit <= 0 || limit > 200 {
+		limit = 50
+	}
+	return s.catalogo.ListarSincronizaciones(limit)
+}
+
+func (s *SincronizacionCatalogoService) Obtener(id uint) (*models.SincronizacionCatalogo, error) {
+	sincronizacion, err := s.catalogo.SincronizacionPorID(id, false)
+	if err != nil {
+		return nil, noEncontrado(err, fmt.Sprintf("sincronización %d", id))
+	}
+	return sincronizacion, nil
+}
+
+// CambioSincronizacion elige una diferencia (por código SIN) para aplicar.
+// RegionalID es obligatoria para una "nueva" sin fila previa en el
+// catálogo; Nombre reemplaza al de SFE_SUCURSAL (que suele venir en
+// mayúsculas) en una "nueva" o "renombrada".
+type CambioSincronizacion struct {
+	CodigoSucursalSin int
+	RegionalID        *uint
+	Nombre            string
+}
+
+// ResultadoAplicarSincronizacion es la sincronización actualizada y a
+// cuántos usuarios se les quitó el acceso a sucursales eliminadas.
+type ResultadoAplicarSincronizacion struct {
+	Sincronizacion       *models.SincronizacionCatalogo `json:"sincronizacion"`
+	Aplicadas            int                            `json:"aplicadas"`
+	UsuariosActualizados int                            `json:"usuarios_actualizados"`
+}
+
+// Aplicar aplica las diferencias elegidas en una sola transacción: si una
+// falla (por ejemplo porque el catálogo cambió desde la comparación) no se
+// aplica ninguna.
+func (s *SincronizacionCatalogoService) Aplicar(id, usuarioID uint, cambios []CambioSincronizacion) (*ResultadoAplicarSincronizacion, error) {
+	if len(cambios) == 0 {
+		return nil, fmt.Errorf("%w: no se eligió ningún cambio", ErrDiferenciaInvalida)
+	}
+
+	resultado := &ResultadoAplicarSincronizacion{}
+	err := s.catalogo.Transaccion(func(repo *repositories.CatalogoRepository) error {
+		sincronizacion, err := repo.SincronizacionPorID(id, true)
+		if err != nil {
+			return noEncontrado(err, fmt.Sprintf("sincronización %d", id))
+		}
+		indice := make(map[int]int, len(sincronizacion.Diferencias))
+		for i, diferencia := range sincronizacion.Diferencias {
+			indice[diferencia.CodigoSucursalSin] = i
+		}
+
+		ahora := time.Now()
+		for _, cambio := range cambios {
+			i, ok := indice[cambio.CodigoSucursalSin]
+			if !ok {
+				return fmt.Errorf("%w: el código %d no tiene diferencias", ErrDiferenciaInvalida, cambio.CodigoSucursalSin)
+			}
+			diferencia := &sincronizacion.Diferencias[i]
+			if diferencia.Aplicada {
+				return fmt.Errorf("%w: el código %d ya se aplicó", ErrDiferenciaInvalida, cambio.CodigoSucursalSin)
+			}
+			usuarios, err := aplicarDiferencia(repo, *diferencia, cambio)
+			if err != nil {
+				return fmt.Errorf("código %d: %w", cambio.CodigoSucursalSin, err)
+			}
+			diferencia.Aplicada = true
+			diferencia.AplicadaEn = &ahora
+			resultado.Aplicadas++
+			resultado.UsuariosActualizados += usuarios
+		}
+
+		sincronizacion.Estado = models.SincronizacionAplicada
+		for _, diferencia := range sincronizacion.Diferencias {
+			if !diferencia.Aplicada {
+				sincronizacion.Estado = models.SincronizacionParcial
+				break
+			}
+		}
+		sincronizacion.AplicadaPorID = &usuarioID
+		sincronizacion.AplicadaEn = &ahora
+		if err := repo.GuardarSincronizacion(sincronizacion); err != nil {
+			return err
+		}
+		resultado.Sincronizacion = sincronizacion
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resultado, nil
+}
+
+// aplicarDiferencia hace el cambio en el catálogo y devuelve cuántos
+// usuarios cambiaron sus accesos.
+func aplicarDiferencia(repo *repositories.CatalogoRepository, diferencia models.DiferenciaCatalogo, cambio CambioSincronizacion) (int, error) {
+	nombre := strings.TrimSpace(cambio.Nombre)
+	if nombre == "" {
+		nombre = diferencia.NombreSFE
+	}
+
+	switch diferencia.Tipo {
+	case models.DiferenciaNueva:
+		regionalID := cambio.RegionalID
+		if regionalID == nil {
+			regionalID = diferencia.RegionalID
+		}
+		if regionalID == nil {
+			return 0, fmt.Errorf("%w: falta regional_id para la sucursal nueva", ErrDiferenciaInvalida)
+		}
+		_, err := crearSucursal(repo, SucursalCatalogoInput{CodigoSucursalSin: diferencia.CodigoSucursalSin, Nombre: nombre, RegionalID: *regionalID})
+		return 0, err
+	case models.DiferenciaRenombrada:
+		regionalID := *diferencia.RegionalID
+		if cambio.RegionalID != nil {
+			regionalID = *cambio.RegionalID
+		}
+		_, err := actualizarSucursal(repo, *diferencia.SucursalID, SucursalCatalogoInput{CodigoSucursalSin: diferencia.CodigoSucursalSin, Nombre: nombre, RegionalID: regionalID})
+		return 0, err
+	case models.DiferenciaFaltante:
+		resultado, err := eliminarSucursal(repo, *diferencia.SucursalID)
+		if err != nil {
+			return 0, err
+		}
+		return resultado.UsuariosActualizados, nil
+	}
+	return 0, fmt.Errorf("%w: tipo %s", ErrDiferenciaInvalida, diferencia.Tipo)
+}
@@ -3,18 +3,36 @@ package services
 import (
 	"errors"
 	"fmt"
+	"log"
 	"managerfact/internal/domain/models"
 	"managerfact/internal/domain/repositories"
+	"strings"
+	"time"
 
 	"golang.org/x/crypto/bcrypt"
 )
 
 type UsuarioService struct {
-	repo *repositories.UsuarioRepository
+	repo     *repositories.UsuarioRepository
+	intentos *repositories.IntentoLoginRepository
+	sesiones *repositories.SesionRepository
+	roles    *repositories.RolRepository
+	politica PoliticaPassword
+	login    PoliticaLogin
+	// emisorTotp es el emisor de las cuentas TOTP (ver segundo_factor.go).
+	emisorTotp string
 }
 
-func NewUsuarioService(r *repositories.UsuarioRepository) *UsuarioService {
-	return &UsuarioService{repo: r}
+func NewUsuarioService(r *repositories.UsuarioRepository, intentos *repositories.IntentoLoginRepository, sesiones *repositories.SesionRepository, roles *repositories.RolRepository) *UsuarioService {
+	return &UsuarioService{
+		repo:       r,
+		intentos:   intentos,
+		sesiones:   sesiones,
+		roles:      roles,
+		politica:   PoliticaPasswordDesdeEnv(),
+		login:      PoliticaLoginDesdeEnv(),
+		emisorTotp: emisorTotpDesdeEnv(),
+	}
 }
 
 func hashPassword(password string) (string, error) {
@@ -25,6 +43,64 @@ func hashPassword(password string) (string, error) {
 	return string(hash), nil
 }
 
+// ErrCuentaServicio: las cuentas de servicio de las API keys no se
+// editan, eliminan ni cambian de contraseña desde /usuarios.
+var ErrCuentaServicio = errors.New("es la cuenta de servicio de una API key: se administra desde /api-keys")
+
+// editable devuelve el usuario si no es una cuenta de servicio.
+func (s *UsuarioService) editable(id uint) (*models.Usuario, error) {
+	usuario, err := s.repo.GetByID(id)
+	if err != nil {
+		return nil, err
+	}
+	if usuario.EsServicio {
+		return nil, ErrCuentaServicio
+	}
+	return usuario, nil
+}
+
+// administrable es editable más la regla de roles: actorID no administra a
+// un usuario cuyo rol no podría otorgar (por ejemplo, resetearle la
+// contraseña a un admin para entrar como él).
+func (s *UsuarioService) administrable(id, actorID uint) (*models.Usuario, error) {
+	usuario, err := s.editable(id)
+	if err != nil {
+		return nil, err
+	}
+	rol, err := s.roles.GetByNombre(usuario.Rol)
+	if err != nil {
+		return nil, err
+	}
+	if rol != nil {
+		if err := s.puedeOtorgar(actorID, rol); err != nil {
+			return nil, err
+		}
+	}
+	return usuario, nil
+}
+
+// validarRol verifica que el rol exista en la tabla roles y que actorID
+// pueda asignarlo.
+func (s *UsuarioService) validarRol(nombre string, actorID uint) error {
+	rol, err := s.roles.GetByNombre(nombre)
+	if err != nil {
+		return err
+	}
+	if rol == nil {
+		return fmt.Errorf("%w: %q", ErrRolNoEncontrado, nombre)
+	}
+	return s.puedeOtorgar(actorID, rol)
+}
+
+// puedeOtorgar aplica verificarOtorgable con el rol de actorID.
+func (s *UsuarioService) puedeOtorgar(actorID uint, rol *models.Rol) error {
+	actor, err := s.roles.DeUsuario(actorID)
+	if err != nil {
+		return err
+	}
+	return verificarOtorgable(actor, rol)
+}
+
 type CrearUsuarioInput struct {
 	Nombre        string
 	CI            string
@@ -36,23 +112,29 @@ type CrearUsuarioInput struct {
 }
 
 // Crear registra un usuario nuevo. La contraseña inicial es siempre su CI
-// (hasheada), tal como se pidió: "pass por defecto el CI".
-func (s *UsuarioService) Crear(input CrearUsuarioInput) (*models.Usuario, error) {
+// (hasheada), tal como se pidió: "pass por defecto el CI", y queda obligado
+// a cambiarla en el primer login (MustChangePassword). actorID tiene que
+// poder otorgar el rol elegido.
+func (s *UsuarioService) Crear(input CrearUsuarioInput, actorID uint) (*models.Usuario, error) {
+	if err := s.validarRol(input.Rol, actorID); err != nil {
+		return nil, err
+	}
 	passwordHash, err := hashPassword(input.CI)
 	if err != nil {
 		return nil, err
 	}
 
 	usuario := &models.Usuario{
-		Nombre:        input.Nombre,
-		CI:            input.CI,
-		Cargo:         input.Cargo,
-		CodigoUsuario: input.CodigoUsuario,
-		Rol:           input.Rol,
-		RegionalID:    input.RegionalID,
-		SucursalID:    input.SucursalID,
-		PasswordHash:  passwordHash,
-		IsActive:      true,
+		Nombre:             input.Nombre,
+		CI:                 input.CI,
+		Cargo:              input.Cargo,
+		CodigoUsuario:      input.CodigoUsuario,
+		Rol:                input.Rol,
+		RegionalID:         input.RegionalID,
+		SucursalID:         input.SucursalID,
+		PasswordHash:       passwordHash,
+		MustChangePassword: true,
+		IsActive:           true,
 	}
 	if err := s.repo.Create(usuario); err != nil {
 		return nil, err
@@ -72,11 +154,26 @@ type ActualizarUsuarioInput struct {
 	IsActive      bool
 }
 
-func (s *UsuarioService) Actualizar(input ActualizarUsuarioInput) (*models.Usuario, error) {
-	usuario, err := s.repo.GetByID(input.ID)
+// Actualizar guarda los datos del usuario. Desactivarlo o cambiarle el rol
+// revoca sus sesiones: tiene que volver a entrar (si puede) con el rol
+// nuevo. actorID tiene que poder otorgar tanto el rol actual como el nuevo.
+func (s *UsuarioService) Actualizar(input ActualizarUsuarioInput, actorID uint) (*models.Usuario, error) {
+	usuario, err := s.administrable(input.ID, actorID)
 	if err != nil {
 		return nil, err
 	}
+	if input.Rol != usuario.Rol {
+		if err := s.validarRol(input.Rol, actorID); err != nil {
+			return nil, err
+		}
+	}
+	motivoRevocacion := ""
+	switch {
+	case usuario.IsActive && !input.IsActive:
+		motivoRevocacion = models.SesionUsuarioInactivo
+	case usuario.Rol != input.Rol:
+		motivoRevocacion = models.SesionCambioRol
+	}
 
 	usuario.Nombre = input.Nombre
 	usuario.CI = input.CI
@@ -90,12 +187,18 @@ func (s *UsuarioService) Actualizar(input ActualizarUsuarioInput) (*models.Usuar
 	if err := s.repo.Update(usuario); err != nil {
 		return nil, err
 	}
+	if motivoRevocacion != "" {
+		if _, err := s.sesiones.RevocarDeUsuario(usuario.ID, motivoRevocacion, time.Now()); err != nil {
+			return nil, err
+		}
+	}
 	return usuario, nil
 }
 
-// ResetPassword restablece la contraseña del usuario a su CI actual.
-func (s *UsuarioService) ResetPassword(id uint) error {
-	usuario, err := s.repo.GetByID(id)
+// ResetPassword restablece la contraseña del usuario a su CI actual, lo
+// obliga a cambiarla en el próximo login y revoca sus sesiones.
+func (s *UsuarioService) ResetPassword(id, actorID uint) error {
+	usuario, err := s.administrable(id, actorID)
 	if err != nil {
 		return err
 	}
@@ -103,12 +206,63 @@ func (s *UsuarioService) ResetPassword(id uint) error {
 	if err != nil {
 		return err
 	}
-	usuario.PasswordHash = passwordHash
-	return s.repo.Update(usuario)
+	if err := s.repo.ActualizarPassword(usuario, passwordHash, true, nil, s.politica.Historial); err != nil {
+		return err
+	}
+	_, err = s.sesiones.RevocarDeUsuario(id, models.SesionPasswordReseteada, time.Now())
+	return err
+}
+
+// CambiarPassword es el cambio de contraseña del propio usuario: verifica
+// la actual, aplica la política (largo, distinta del CI y del código de
+// usuario, distinta de la actual y de las últimas PASSWORD_HISTORIAL) y
+// levanta MustChangePassword.
+func (s *UsuarioService) CambiarPassword(usuarioID uint, actual, nueva string) error {
+	usuario, err := s.editable(usuarioID)
+	if err != nil {
+		return err
+	}
+	if bcrypt.CompareHashAndPassword([]byte(usuario.PasswordHash), []byte(actual)) != nil {
+		return ErrPasswordActualIncorrecta
+	}
+	if err := s.politica.Validar(nueva, usuario.CI, usuario.CodigoUsuario); err != nil {
+		return err
+	}
+	anteriores, err := s.repo.HashesPasswordsAnteriores(usuario.ID, s.politica.Historial)
+	if err != nil {
+		return err
+	}
+	if err := validarHistorial(nueva, append([]string{usuario.PasswordHash}, anteriores...)); err != nil {
+		return err
+	}
+
+	passwordHash, err := hashPassword(nueva)
+	if err != nil {
+		return err
+	}
+	ahora := time.Now()
+	return s.repo.ActualizarPassword(usuario, passwordHash, false, &ahora, s.politica.Historial)
 }
 
-func (s *UsuarioService) Eliminar(id uint) error {
-	return s.repo.SoftDelete(id)
+// DebeCambiarPassword indica si el usuario tiene pendiente el cambio de
+// contraseña obligatorio (ver middleware.RequirePasswordVigente).
+func (s *UsuarioService) DebeCambiarPassword(usuarioID uint) (bool, error) {
+	usuario, err := s.repo.GetByID(usuarioID)
+	if err != nil {
+		return false, err
+	}
+	return usuario.MustChangePassword, nil
+}
+
+func (s *UsuarioService) Eliminar(id, actorID uint) error {
+	if _, err := s.administrable(id, actorID); err != nil {
+		return err
+	}
+	if err := s.repo.SoftDelete(id); err != nil {
+		return err
+	}
+	_, err := s.sesiones.RevocarDeUsuario(id, models.SesionUsuarioEliminado, time.Now())
+	return err
 }
 
 func (s *UsuarioService) ObtenerPorID(id uint) (*models.Usuario, error) {
@@ -127,14 +281,68 @@ func (s *UsuarioService) ListarSucursalesCatalogo() ([]models.SucursalCatalogo,
 	return s.repo.GetSucursalesCatalogo()
 }
 
+// AccesosInput es la configuración completa de accesos de un usuario.
+// VigenteDesde/VigenteHasta (opcionales) se aplican a todas las sucursales
+// elegidas.
 type AccesosInput struct {
 	AccesoTotal   bool
 	RegionalesIDs []uint
 	SucursalesIDs []uint
+	VigenteDesde  *time.Time
+	VigenteHasta  *time.Time
 }
 
-func (s *UsuarioService) ConfigurarAccesos(usuarioID uint, input AccesosInput) error {
-	return s.repo.SetAccesos(usuarioID, input.AccesoTotal, input.RegionalesIDs, input.SucursalesIDs)
+// ErrVigenciaInvalida: vigente_hasta tiene que ser posterior a
+// vigente_desde.
+var ErrVigenciaInvalida = errors.New("vigente_hasta debe ser posterior a vigente_desde")
+
+// ErrAccesosNoOtorgables: un usuario no otorga acceso_total ni sucursales
+// fuera de su propio alcance (tampoco a sí mismo).
+var ErrAccesosNoOtorgables = errors.New("no puede otorgar accesos que no tiene")
+
+// ConfigurarAccesos reemplaza los accesos de usuarioID. actorID tiene que
+// poder administrarlo y tener él mismo los accesos que otorga.
+func (s *UsuarioService) ConfigurarAccesos(usuarioID uint, input AccesosInput, actorID uint) error {
+	if input.VigenteDesde != nil && input.VigenteHasta != nil && !input.VigenteHasta.After(*input.VigenteDesde) {
+		return ErrVigenciaInvalida
+	}
+	if _, err := s.administrable(usuarioID, actorID); err != nil {
+		return err
+	}
+	alcance, err := s.repo.AlcanceSucursales(actorID)
+	if err != nil {
+		return err
+	}
+	catalogo, err := s.repo.GetSucursalesCatalogo()
+	if err != nil {
+		return err
+	}
+	if err := verificarAccesosOtorgables(alcance, catalogo, input); err != nil {
+		return err
+	}
+	return s.repo.SetAccesos(usuarioID, input.AccesoTotal, input.RegionalesIDs, input.SucursalesIDs, input.VigenteDesde, input.VigenteHasta)
+}
+
+// verificarAccesosOtorgables compara accesos con el alcance del actor: con
+// acceso total puede otorgar cualquier cosa; si no, ni acceso_total ni
+// sucursales (sueltas o por regional) cuyo código SIN no tenga.
+func verificarAccesosOtorgables(alcance *repositories.AlcanceSucursales, catalogo []models.SucursalCatalogo, accesos AccesosInput) error {
+	if alcance.Total {
+		return nil
+	}
+	if accesos.AccesoTotal {
+		return fmt.Errorf("%w: acceso_total", ErrAccesosNoOtorgables)
+	}
+	fuera := []uint{}
+	for _, sucursal := range sucursalesPedidas(catalogo, accesos) {
+		if !alcance.Incluye(sucursal.CodigoSucursalSin) {
+			fuera = append(fuera, sucursal.ID)
+		}
+	}
+	if len(fuera) > 0 {
+		return fmt.Errorf("%w: sucursales %v", ErrAccesosNoOtorgables, fuera)
+	}
+	return nil
 }
 
 func (s *UsuarioService) ObtenerAccesos(usuarioID uint) (*repositories.AccesosResueltos, error) {
@@ -154,15 +362,16 @@ func (s *UsuarioService) TieneAccesoSucursal(usuarioID uint, codigoSucursalSin i
 	return s.repo.TieneAccesoSucursal(usuarioID, codigoSucursalSin)
 }
 
-// TieneAccesoTotal indica si el usuario tiene acceso nacional (bypass de
-// sucursales_permitidas_codigos).
-func (s *UsuarioService) TieneAccesoTotal(usuarioID uint) (bool, error) {
-	return s.repo.TieneAccesoTotal(usuarioID)
+// AlcanceSucursales resuelve de una vez qué códigos SIN puede ver el
+// usuario, para chequear varios sin una consulta por código.
+func (s *UsuarioService) AlcanceSucursales(usuarioID uint) (*repositories.AlcanceSucursales, error) {
+	return s.repo.AlcanceSucursales(usuarioID)
 }
 
-// EsAdmin indica si el usuario tiene rol "admin".
-func (s *UsuarioService) EsAdmin(usuarioID uint) (bool, error) {
-	return s.repo.EsAdmin(usuarioID)
+// TieneAccesoTotal indica si el usuario tiene acceso nacional (sin importar
+// sus accesos por sucursal).
+func (s *UsuarioService) TieneAccesoTotal(usuarioID uint) (bool, error) {
+	return s.repo.TieneAccesoTotal(usuarioID)
 }
 
 // ErrCredencialesInvalidas se devuelve cuando el código de usuario no existe,
@@ -170,17 +379,144 @@ func (s *UsuarioService) EsAdmin(usuarioID uint) (bool, error) {
 // genérico en los 3 casos para no filtrar cuáles códigos de usuario existen.
 var ErrCredencialesInvalidas = errors.New("usuario o contraseña incorrectos")
 
-// Login verifica codigo_usuario + password contra el hash guardado.
-func (s *UsuarioService) Login(codigoUsuario, password string) (*models.Usuario, error) {
+// OrigenLogin es de dónde viene un intento de login (para el límite por IP
+// y el historial).
+type OrigenLogin struct {
+	IP        string
+	UserAgent string
+}
+
+// Login verifica codigo_usuario + password contra el hash guardado, con
+// límite de intentos por usuario y por IP (PoliticaLogin). Cada intento
+// queda en intentos_login. Un intento rechazado por el límite devuelve
+// *EsperaLoginError sin verificar la contraseña. Si el usuario tiene TOTP
+// activo la contraseña sola no alcanza: el login sigue con
+// VerificarSegundoFactor.
+func (s *UsuarioService) Login(codigoUsuario, password string, origen OrigenLogin) (*models.Usuario, error) {
+	ahora := time.Now()
+	intento := &models.IntentoLogin{
+		CodigoUsuario: recortar(codigoUsuario, 50),
+		IP:            recortar(origen.IP, 64),
+		UserAgent:     recortar(origen.UserAgent, 255),
+	}
+
+	if err := s.verificarIP(intento, ahora); err != nil {
+		return nil, err
+	}
+
 	usuario, err := s.repo.GetByCodigoUsuario(codigoUsuario)
 	if err != nil {
-		return nil, ErrCredencialesInvalidas
+		return nil, s.loginFallido(intento, nil, "usuario inexistente", ahora)
+	}
+	intento.UsuarioID = &usuario.ID
+	if hasta, motivo := s.login.esperaUsuario(usuario, ahora); hasta.After(ahora) {
+		return nil, s.rechazarLogin(intento, motivo, hasta)
 	}
 	if !usuario.IsActive {
-		return nil, ErrCredencialesInvalidas
+		return nil, s.loginFallido(intento, usuario, "usuario inactivo", ahora)
+	}
+	if usuario.EsServicio {
+		return nil, s.loginFallido(intento, usuario, "cuenta de servicio", ahora)
 	}
 	if err := bcrypt.CompareHashAndPassword([]byte(usuario.PasswordHash), []byte(password)); err != nil {
-		return nil, ErrCredencialesInvalidas
+		return nil, s.loginFallido(intento, usuario, "contraseña incorrecta", ahora)
+	}
+
+	if usuario.TotpActivo {
+		// los intentos fallidos se reinician recién con el segundo factor:
+		// si no, sabiendo la contraseña se podrían probar códigos sin límite
+		intento.Resultado = models.LoginSegundoFactor
+		s.registrarIntento(intento)
+		return usuario, nil
+	}
+	if err := s.loginExitoso(intento, usuario); err != nil {
+		return nil, err
 	}
 	return usuario, nil
 }
+
+// verificarIP rechaza el intento si la IP superó su límite de fallos.
+func (s *UsuarioService) verificarIP(intento *models.IntentoLogin, ahora time.Time) error {
+	fallosIP, ultimoFalloIP, err := s.intentos.FallosDesdeIP(intento.IP, ahora.Add(-s.login.VentanaIP))
+	if err != nil {
+		return err
+	}
+	if hasta, motivo := s.login.esperaIP(int(fallosIP), ultimoFalloIP); hasta.After(ahora) {
+		return s.rechazarLogin(intento, motivo, hasta)
+	}
+	return nil
+}
+
+// loginExitoso reinicia los intentos fallidos del usuario y registra el
+// intento.
+func (s *UsuarioService) loginExitoso(intento *models.IntentoLogin, usuario *models.Usuario) error {
+	if usuario.IntentosFallidos > 0 || usuario.BloqueadoHasta != nil {
+		if err := s.repo.ReiniciarIntentosLogin(usuario.ID); err != nil {
+			return err
+		}
+		usuario.IntentosFallidos = 0
+		usuario.UltimoIntentoFallido = nil
+		usuario.BloqueadoHasta = nil
+	}
+	intento.Resultado = models.LoginExitoso
+	s.registrarIntento(intento)
+	return nil
+}
+
+// loginFallido registra el fallo (en el usuario, si existe, y en el
+// historial) y devuelve el error genérico.
+func (s *UsuarioService) loginFallido(intento *models.IntentoLogin, usuario *models.Usuario, motivo string, ahora time.Time) error {
+	if usuario != nil {
+		if err := s.repo.RegistrarLoginFallido(usuario.ID, ahora, s.login.MaxIntentos, s.login.Bloqueo); err != nil {
+			log.Printf("[Login] %v", err)
+		}
+	}
+	intento.Resultado = models.LoginFallido
+	intento.Motivo = motivo
+	s.registrarIntento(intento)
+	return ErrCredencialesInvalidas
+}
+
+func (s *UsuarioService) rechazarLogin(intento *models.IntentoLogin, motivo string, hasta time.Time) error {
+	intento.Resultado = models.LoginBloqueado
+	intento.Motivo = motivo
+	s.registrarIntento(intento)
+	return &EsperaLoginError{Hasta: hasta}
+}
+
+// registrarIntento no corta el login si falla el historial: solo lo loguea.
+func (s *UsuarioService) registrarIntento(intento *models.IntentoLogin) {
+	if err := s.intentos.Create(intento); err != nil {
+		log.Printf("[Login] %v", err)
+	}
+}
+
+// recortar limita texto que viene del cliente al largo de su columna.
+func recortar(texto string, largo int) string {
+	if len(texto) <= largo {
+		return texto
+	}
+	return strings.ToValidUTF8(texto[:largo], "")
+}
+
+// Desbloquear quita el bloqueo de login del usuario y reinicia su contador
+// de intentos fallidos (no toca el límite por IP).
+func (s *UsuarioService) Desbloquear(id, actorID uint) error {
+	if _, err := s.administrable(id, actorID); err != nil {
+		return err
+	}
+	return s.repo.ReiniciarIntentosLogin(id)
+}
+
+// VerificarAdministrable devuelve error si actorID no puede administrar al
+// usuario id (ver administrable); lo usan las acciones sobre el usuario que
+// no pasan por este servicio, como revocar sus sesiones.
+func (s *UsuarioService) VerificarAdministrable(id, actorID uint) error {
+	_, err := s.administrable(id, actorID)
+	return err
+}
+
+// ListarIntentosLogin es el historial de logins (ver GET /intentos-login).
+func (s *UsuarioService) ListarIntentosLogin(filtro repositories.IntentoLoginFiltro) ([]models.IntentoLogin, error) {
+	return s.intentos.GetAll(filtro)
+}
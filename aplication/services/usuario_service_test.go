@@ -0,0 +1,53 @@
+package services
+
+import (
+	"errors"
+	"managerfact/internal/domain/models"
+	"managerfact/internal/domain/repositories"
+	"strings"
+	"testing"
+)
+
+func TestVerificarAccesosOtorgables(t *testing.T) {
+	catalogo := []models.SucursalCatalogo{
+		{ID: 1, RegionalID: 10, CodigoSucursalSin: 0},
+		{ID: 2, RegionalID: 10, CodigoSucursalSin: 1},
+		{ID: 3, RegionalID: 20, CodigoSucursalSin: 2},
+	}
+	parcial := &repositories.AlcanceSucursales{Codigos: map[int]bool{0: true, 1: true}}
+	total := &repositories.AlcanceSucursales{Total: true}
+
+	casos := []struct {
+		nombre    string
+		alcance   *repositories.AlcanceSucursales
+		accesos   AccesosInput
+		rechazado string
+	}{
+		// el caso del review: PUT /usuarios/<propio id>/accesos con
+		// acceso_total sin tenerlo
+		{"acceso total sin tenerlo", parcial, AccesosInput{AccesoTotal: true}, "acceso_total"},
+		{"acceso total teniéndolo", total, AccesosInput{AccesoTotal: true}, ""},
+		{"sucursales propias", parcial, AccesosInput{SucursalesIDs: []uint{1, 2}}, ""},
+		{"regional propia", parcial, AccesosInput{RegionalesIDs: []uint{10}}, ""},
+		{"sucursal ajena", parcial, AccesosInput{SucursalesIDs: []uint{1, 3}}, "[3]"},
+		{"regional ajena", parcial, AccesosInput{RegionalesIDs: []uint{20}}, "[3]"},
+		{"con acceso total otorga cualquier sucursal", total, AccesosInput{RegionalesIDs: []uint{20}}, ""},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			err := verificarAccesosOtorgables(c.alcance, catalogo, c.accesos)
+			if c.rechazado == "" {
+				if err != nil {
+					t.Errorf("err = %v, se esperaba nil", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrAccesosNoOtorgables) {
+				t.Fatalf("err = %v, se esperaba ErrAccesosNoOtorgables", err)
+			}
+			if !strings.Contains(err.Error(), c.rechazado) {
+				t.Errorf("err = %q, se esperaba que nombre %s", err, c.rechazado)
+			}
+		})
+	}
+}
@@ -0,0 +1,213 @@
+// Command managerfact es la CLI de administración: aplica las migraciones
+// y carga los datos iniciales (bootstrap) contra la misma base que usa el
+// servidor (.env / variables DB_*). Ver doc/Migraciones.md y
+// doc/Bootstrap.md.
+//
+//	managerfact migrate up|down [n]|status
+//	managerfact bootstrap catalogo <archivo.yaml|.json>
+//	managerfact bootstrap admin <archivo.yaml|.json>
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"managerfact/aplication/services"
+	"managerfact/infraestructura/database"
+	"managerfact/internal/domain/repositories"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+	"gorm.io/gorm"
+	gormLogger "gorm.io/gorm/logger"
+)
+
+const uso = `uso:
+  managerfact migrate up                                aplica las migraciones pendientes
+  managerfact migrate down [n]                          revierte las últimas n migraciones (1 por defecto)
+  managerfact migrate status                            lista las migraciones y si están aplicadas
+  managerfact bootstrap catalogo <archivo.yaml|.json>   regionales y sucursales_catalogo
+  managerfact bootstrap admin <archivo.yaml|.json>      usuario administrador inicial
+`
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, uso)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "migrate":
+		err = migrar(os.Args[2:])
+	case "bootstrap":
+		err = bootstrap(os.Args[2:])
+	case "-h", "--help", "help":
+		fmt.Print(uso)
+		return
+	default:
+		err = fmt.Errorf("comando desconocido %q\n%s", os.Args[1], uso)
+	}
+	if err != nil {
+		log.Fatalf("error: %v", err)
+	}
+}
+
+// conectar abre la base principal con el log de gorm en advertencias (el
+// del servidor loguea cada query).
+func conectar() *gorm.DB {
+	db := database.InitDatabase(database.LoadConfig())
+	return db.Session(&gorm.Session{Logger: db.Logger.LogMode(gormLogger.Warn)})
+}
+
+// abrirBase conecta y exige el esquema al día, igual que el servidor: el
+// bootstrap no migra por su cuenta.
+func abrirBase() (*gorm.DB, error) {
+	db := conectar()
+	if err := database.VerificarEsquema(db); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+func migrar(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("falta el subcomando de migrate\n%s", uso)
+	}
+
+	switch args[0] {
+	case "up":
+		aplicadas, err := database.Subir(conectar())
+		if err != nil {
+			return err
+		}
+		for _, migracion := range aplicadas {
+			fmt.Printf("  aplicada: %04d_%s\n", migracion.Version, migracion.Nombre)
+		}
+		fmt.Printf("migrate up: %d migraciones aplicadas\n", len(aplicadas))
+	case "down":
+		pasos := 1
+		if len(args) > 1 {
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("cantidad de migraciones inválida: %s", args[1])
+			}
+			pasos = n
+		}
+		revertidas, err := database.Bajar(conectar(), pasos)
+		if err != nil {
+			return err
+		}
+		for _, migracion := range revertidas {
+			fmt.Printf("  revertida: %04d_%s\n", migracion.Version, migracion.Nombre)
+		}
+		fmt.Printf("migrate down: %d migraciones revertidas\n", len(revertidas))
+	case "status":
+		estados, err := database.Estado(conectar())
+		if err != nil {
+			return err
+		}
+		for _, estado := range estados {
+			situacion := "pendiente"
+			switch {
+			case estado.Desconocida:
+				situacion = "aplicada, desconocida para este binario"
+			case estado.Modificada:
+				situacion = "aplicada, modificada después"
+			case estado.Aplicada:
+				situacion = "aplicada " + estado.AplicadaEn.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("  %04d_%s: %s\n", estado.Version, estado.Nombre, situacion)
+		}
+	default:
+		return fmt.Errorf("subcomando de migrate desconocido %q\n%s", args[0], uso)
+	}
+	return nil
+}
+
+func bootstrap(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("faltan argumentos\n%s", uso)
+	}
+	subcomando, archivo := args[0], args[1]
+
+	var resultado *services.ResultadoBootstrap
+	switch subcomando {
+	case "catalogo":
+		var catalogo services.CatalogoBootstrap
+		if err := leerArchivo(archivo, &catalogo); err != nil {
+			return err
+		}
+		db, err := abrirBase()
+		if err != nil {
+			return err
+		}
+		resultado, err = nuevoBootstrapService(db).Catalogo(catalogo)
+		if err != nil {
+			return err
+		}
+	case "admin":
+		var admin services.AdminBootstrap
+		if err := leerArchivo(archivo, &admin); err != nil {
+			return err
+		}
+		// La contraseña puede quedar fuera del archivo (que suele terminar
+		// versionado) y pasarse por entorno.
+		if admin.Password == "" {
+			admin.Password = os.Getenv("BOOTSTRAP_ADMIN_PASSWORD")
+		}
+		db, err := abrirBase()
+		if err != nil {
+			return err
+		}
+		resultado, err = nuevoBootstrapService(db).Admin(admin)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("subcomando de bootstrap desconocido %q\n%s", subcomando, uso)
+	}
+
+	for _, linea := range resultado.Detalle {
+		fmt.Println("  " + linea)
+	}
+	fmt.Printf("bootstrap %s: %d creados, %d actualizados, %d sin cambios\n",
+		subcomando, resultado.Creados, resultado.Actualizados, resultado.SinCambios)
+	return nil
+}
+
+func nuevoBootstrapService(db *gorm.DB) *services.BootstrapService {
+	return services.NewBootstrapService(repositories.NewCatalogoRepository(db), repositories.NewUsuarioRepository(db))
+}
+
+// leerArchivo decodifica un archivo YAML (.yaml/.yml) o JSON (.json) en
+// destino, rechazando campos desconocidos para que un typo en una clave no
+// se ignore en silencio.
+func leerArchivo(ruta string, destino any) error {
+	contenido, err := os.ReadFile(ruta)
+	if err != nil {
+		return fmt.Errorf("error leyendo %s: %w", ruta, err)
+	}
+
+	switch strings.ToLower(filepath.Ext(ruta)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(contenido))
+		decoder.KnownFields(true)
+		err = decoder.Decode(destino)
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(contenido))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(destino)
+	default:
+		return fmt.Errorf("%s: formato no soportado (se espera .yaml, .yml o .json)", ruta)
+	}
+	if err != nil {
+		return fmt.Errorf("error interpretando %s: %w", ruta, err)
+	}
+	return nil
+}
@@ -1,275 +1,29 @@
 package main
 
 import (
-	"fmt"
 	"log"
 	"managerfact/aplication/services"
+	"managerfact/infraestructura/database"
 	"managerfact/infraestructura/handlers"
 	"managerfact/infraestructura/middleware"
-	"managerfact/internal/domain/models"
 	"managerfact/internal/domain/repositories"
 	"os"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/logger"
 	"github.com/gofiber/fiber/v2/middleware/recover"
-	"github.com/joho/godotenv"
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
-	gormLogger "gorm.io/gorm/logger"
 )
 
-// Config estructura de configuración
-type Config struct {
-	DBHost     string
-	DBUser     string
-	DBPassword string
-	DBName     string
-	DBPort     string
-	DBSSLMode  string
-	ServerPort string
-}
-
-// LoadConfig carga la configuración desde variables de entorno
-func LoadConfig() *Config {
-	// Cargar archivo .env si existe
-	if err := godotenv.Load(); err != nil {
-		log.Println("No se encontró archivo .env, usando variables de entorno del sistema")
-	}
-
-	config := &Config{
-		DBHost:     getEnv("DB_HOST", "localhost"),
-		DBUser:     getEnv("DB_USER", "postgres"),
-		DBPassword: getEnv("DB_PASSWORD", "password"),
-		DBName:     getEnv("DB_NAME", "invoices_system"),
-		DBPort:     getEnv("DB_PORT", "5432"),
-		DBSSLMode:  getEnv("DB_SSL_MODE", "disable"),
-		ServerPort: getEnv("SERVER_PORT", "8080"),
-	}
-
-	return config
-}
-
-// getEnv obtiene una variable de entorno o retorna un valor por defecto
-func getEnv(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
-}
-
-// InitDatabase inicializa la conexión a PostgreSQL
-func InitDatabase(config *Config) *gorm.DB {
-	dsn := fmt.Sprintf(
-		"host=%s user=%s password=%s dbname=%s port=%s sslmode=%s TimeZone=America/La_Paz",
-		config.DBHost, config.DBUser, config.DBPassword, config.DBName, config.DBPort, config.DBSSLMode,
-	)
-
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
-		Logger: gormLogger.Default.LogMode(gormLogger.Info),
-	})
-	if err != nil {
-		log.Fatalf("Error conectando a la base de datos: %v", err)
-	}
-
-	log.Println("Conexión a PostgreSQL establecida exitosamente")
-	return db
-}
-
-// MigrarFechasPrevaloradaADate convierte fecha_emision/fecha_compra_boleto
-// de facturas_prevaloradas de timestamptz (el default que le daba GORM a
-// time.Time) a date: son fechas de calendario puras que vienen del Excel,
-// sin hora. Con timestamptz y la sesión en America/La_Paz (UTC-4, ver
-// InitDatabase), una fecha guardada como medianoche se leía un día para
-// atrás. Corre antes de AutoMigrate y solo si la columna todavía es
-// timestamptz (no-op en instalaciones nuevas, donde AutoMigrate crea la
-// tabla directo con date).
-//
-// El cast usa "AT TIME ZONE 'UTC'", no la zona de la sesión: las fechas ya
-// guardadas se parsearon siempre como medianoche UTC (ver parsearFecha en
-// aplication/services/factura_prevalorada_service.go), así que extraer la
-// fecha en UTC recupera el valor original tal cual se importó. Un
-// "ALTER COLUMN TYPE date" sin USING dejaría que Postgres use su cast
-// implícito timestamptz->date, que sí usa la zona de la sesión — y
-// corrompería en la migración misma los datos ya importados con el mismo
-// corrimiento que se está arreglando.
-func MigrarFechasPrevaloradaADate(db *gorm.DB) error {
-	var tipoActual string
-	err := db.Raw(`
-		SELECT data_type FROM information_schema.columns
-		WHERE table_name = 'facturas_prevaloradas' AND column_name = 'fecha_emision'
-	`).Scan(&tipoActual).Error
-	if err != nil {
-		return fmt.Errorf("error verificando tipo de fecha_emision: %v", err)
-	}
-	if tipoActual != "timestamp with time zone" {
-		return nil
-	}
-
-	log.Println("Migrando fecha_emision/fecha_compra_boleto de facturas_prevaloradas a date (evitando el corrimiento de un día)...")
-	err = db.Exec(`
-		ALTER TABLE facturas_prevaloradas
-			ALTER COLUMN fecha_emision TYPE date USING (fecha_emision AT TIME ZONE 'UTC')::date,
-			ALTER COLUMN fecha_compra_boleto TYPE date USING (fecha_compra_boleto AT TIME ZONE 'UTC')::date
-	`).Error
-	if err != nil {
-		return fmt.Errorf("error migrando fechas de facturas_prevaloradas a date: %v", err)
-	}
-	log.Println("Migración de fechas a date completada")
-	return nil
-}
-
-// AutoMigrate ejecuta las migraciones automáticas
-func AutoMigrate(db *gorm.DB) error {
-	if err := MigrarFechasPrevaloradaADate(db); err != nil {
-		return err
-	}
-
-	log.Println("Ejecutando migraciones automáticas...")
-
-	err := db.AutoMigrate(
-		&models.DbConnection{},
-		&models.Codigo_producto{},
-		&models.Regional{},
-		&models.SucursalCatalogo{},
-		&models.Usuario{},
-		&models.SucursalFacturador{},
-		&models.FacturaPrevalorada{},
-		&models.FacturaAnulacion{},
-		&models.LogEnvio{},
-	)
-
-	if err != nil {
-		return fmt.Errorf("error en migración automática: %v", err)
-	}
-
-	log.Println("Migraciones completadas exitosamente")
-	return nil
-}
-
-// SeedDatabase agrega datos iniciales si es necesario
-func SeedDatabase(db *gorm.DB) error {
-	log.Println("Verificando datos iniciales...")
-
-	// Verificar si ya existen conexiones
-	var count int64
-	if err := db.Model(&models.DbConnection{}).Count(&count).Error; err != nil {
-		return fmt.Errorf("error verificando datos existentes: %v", err)
-	}
-
-	// Si no hay datos, agregar conexiones de ejemplo (opcional)
-	if count == 0 {
-		log.Println("No se encontraron conexiones, agregando datos de ejemplo...")
-
-		sampleConnections := []models.DbConnection{
-			{
-				ServerName:   "Servidor Principal",
-				Host:         "localhost",
-				Port:         1433,
-				DatabaseName: "FacturasDB",
-				Username:     "sa",
-				Password:     "your_password_here",
-				IsActive:     true,
-				Description:  "Servidor principal de facturas",
-			},
-			{
-				ServerName:   "Servidor Backup",
-				Host:         "backup.example.com",
-				Port:         1433,
-				DatabaseName: "FacturasDB_Backup",
-				Username:     "backup_user",
-				Password:     "backup_password_here",
-				IsActive:     false,
-				Description:  "Servidor de respaldo",
-			},
-		}
-
-		for _, conn := range sampleConnections {
-			if err := db.Create(&conn).Error; err != nil {
-				log.Printf("Error creando conexión de ejemplo %s: %v", conn.ServerName, err)
-			} else {
-				log.Printf("Conexión de ejemplo '%s' creada", conn.ServerName)
-			}
-		}
-	}
-
-	return nil
-}
-
-// SeedRegionalesYSucursales siembra el catálogo de regionales y sucursales
-// (transcrito de doc/sucursales.md). Corre en cada arranque y usa
-// FirstOrCreate por cada regional (por nombre, único) y cada sucursal (por
-// codigo_sucursal_sin, único) en vez de saltarse todo si ya hay datos: así,
-// si se agrega una sucursal nueva a este catálogo más adelante (como pasó
-// con el código 0 "Oficina Central"), el próximo reinicio la crea sola sin
-// duplicar ni tocar las que ya existen. Pendiente de validar contra
-// SFE_SUCURSAL en producción, tal como advierte el propio documento de
-// origen.
-func SeedRegionalesYSucursales(db *gorm.DB) error {
-	type sucursalSeed struct {
-		Codigo int
-		Nombre string
-	}
-
-	sucursalesPorRegional := map[string][]sucursalSeed{
-
-		"La Paz": {
-			{4, "El Alto"}, {5, "Oruro"}, {25, "Cobija"}, {28, "Uyuni"},
-			{35, "Rurrenabaque"}, {36, "Reyes"}, {24, "San Borja"},
-			{6, "Copacabana"}, {38, "Apolo"}, {0, "Oficina Central"},
-		},
-		"Cochabamba": {
-			{3, "Cochabamba"}, {31, "Chimoré"}, {33, "Tarija"}, {26, "Potosí"},
-			{37, "Alcantarí"}, {30, "Yacuiba"}, {8, "Monteagudo"},
-			{27, "Villamontes"}, {7, "Bermejo"},
-		},
-		"Santa Cruz": {
-			{29, "Viru Viru"}, {2, "Trompillo"}, {17, "San Javier"}, {11, "Concepción"},
-			{14, "San Ignacio de Velasco"}, {19, "Camiri"}, {10, "Roboré"},
-			{13, "Puerto Suárez"}, {12, "Vallegrande"}, {18, "Ascensión de Guarayos"},
-			{16, "San José Chiquitos"}, {9, "San Matías"},
-		},
-		// San Ramón (Beni) no tiene código SIN visible en la tarjeta fuente,
-		// así que queda fuera del catálogo hasta confirmarlo.
-		"Beni": {
-			{1, "Trinidad"}, {22, "Santa Ana de Yacuma"}, {23, "San Ignacio de Moxos"},
-			{21, "Magdalena"}, {34, "Riberalta"}, {32, "Santa Rosa"}, {20, "Guarayamerín"},
-		},
-	}
-
-	ordenRegionales := []string{"La Paz", "Cochabamba", "Santa Cruz", "Beni"}
-
-	for _, nombreRegional := range ordenRegionales {
-		regional := models.Regional{Nombre: nombreRegional}
-		if err := db.Where(models.Regional{Nombre: nombreRegional}).FirstOrCreate(&regional).Error; err != nil {
-			return fmt.Errorf("error creando regional %s: %v", nombreRegional, err)
-		}
-		for _, s := range sucursalesPorRegional[nombreRegional] {
-			sucursal := models.SucursalCatalogo{
-				CodigoSucursalSin: s.Codigo,
-				Nombre:            s.Nombre,
-				RegionalID:        regional.ID,
-			}
-			// Condición como string+args (no struct): un Where con struct
-			// omite los campos en su valor cero, y codigo_sucursal_sin=0
-			// ("Oficina Central") es justamente ese caso — con struct nunca
-			// se filtraría por código y quedaría sin sembrar.
-			if err := db.Where("codigo_sucursal_sin = ?", s.Codigo).FirstOrCreate(&sucursal).Error; err != nil {
-				return fmt.Errorf("error creando sucursal %s: %v", s.Nombre, err)
-			}
-		}
-	}
-
-	log.Println("Catálogo de regionales y sucursales verificado/completado")
-	return nil
-}
-
 // SetupRoutes configura todas las rutas de la API
 func SetupRoutes(
 	app *fiber.App,
 	authHandler *handlers.AuthHandler,
 	usuarioService *services.UsuarioService,
+	sesionService *services.SesionService,
+	rolService *services.RolService,
+	apiKeyService *services.ApiKeyService,
 	dbConnectionHandler *handlers.DbConnectionHandler,
 	consultasHandler *handlers.ConsultasHandler,
 	codigoProductoHandler *handlers.CodigoProductoHandler,
@@ -278,10 +32,19 @@ func SetupRoutes(
 	facturaPrevaloradaHandler *handlers.FacturaPrevaloradaHandler,
 	facturaAnulacionHandler *handlers.FacturaAnulacionHandler,
 	logEnvioHandler *handlers.LogEnvioHandler,
+	exportacionesHandler *handlers.ExportacionesHandler,
+	cifradoHandler *handlers.CifradoHandler,
+	saludHandler *handlers.SaludHandler,
+	catalogoHandler *handlers.CatalogoHandler,
+	sincronizacionCatalogoHandler *handlers.SincronizacionCatalogoHandler,
+	rolHandler *handlers.RolHandler,
+	apiKeyHandler *handlers.ApiKeyHandler,
+	auditoriaHandler *handlers.AuditoriaHandler,
 ) {
-	// Middleware global
+	// Middleware global. autor es quién hizo la request (usuario o API
+	// key), lo pone RequireAuth.
 	app.Use(logger.New(logger.Config{
-		Format: "[${ip}]:${port} ${status} - ${method} ${path} - ${latency}\n",
+		Format: "[${ip}]:${port} ${status} - ${method} ${path} - ${latency} ${locals:autor}\n",
 	}))
 	app.Use(recover.New())
 
@@ -289,7 +52,7 @@ func SetupRoutes(
 	app.Use(cors.New(cors.Config{
 		AllowOrigins: "*",
 		AllowMethods: "GET,POST,HEAD,PUT,DELETE,PATCH,OPTIONS",
-		AllowHeaders: "Origin,Content-Type,Accept,Authorization",
+		AllowHeaders: "Origin,Content-Type,Accept,Authorization,X-API-Key",
 	}))
 
 	// Ruta raíz
@@ -298,8 +61,9 @@ func SetupRoutes(
 			"message": "Invoice System API",
 			"version": "1.0.0",
 			"endpoints": fiber.Map{
-				"health":      "/api/v1/health",
-				"connections": "/api/v1/connections",
+				"health":       "/api/v1/health",
+				"dependencies": "/api/v1/health/dependencies",
+				"connections":  "/api/v1/connections",
 			},
 		})
 	})
@@ -315,80 +79,143 @@ func SetupRoutes(
 		})
 	})
 
-	// Login (público)
-	authHandler.RegisterRoutes(api)
+	// Login (público), y cambio de contraseña y segundo factor (con sesión,
+	// pero sin exigir que la contraseña ya esté cambiada ni el segundo
+	// factor enrolado). requireAuth acepta también API keys de
+	// integraciones.
+	requireAuth := middleware.RequireAuth(sesionService, apiKeyService)
+	authHandler.RegisterRoutes(api, requireAuth)
 
-	// Todo lo demás requiere sesión (JWT) — ver
+	// Todo lo demás requiere sesión (JWT de una sesión activa), que el usuario no tenga
+	// pendiente el cambio de contraseña obligatorio y que haya enrolado el
+	// segundo factor si su rol lo exige — ver
 	// infraestructura/middleware/auth_middleware.go
-	protegido := api.Group("/", middleware.RequireAuth())
+	protegido := api.Group("/", requireAuth, middleware.RequirePasswordVigente(usuarioService), middleware.Require2FAConfigurado(usuarioService))
 
-	// Usuarios y Sucursales Facturador además requieren rol "admin": los
-	// operadores no pueden ver ni operar estos dos módulos. El middleware se
-	// pasa directo a cada RegisterRoutes para que quede scopeado a sus
-	// propios prefijos (/usuarios, /sucursales-facturador, etc.) — un grupo
-	// con prefijo "/" aplicaría el middleware a TODO el resto de rutas
-	// protegidas, no solo a estas dos.
-	requireAdmin := middleware.RequireAdmin(usuarioService)
+	// Cada ruta exige además un permiso del rol del usuario
+	// (models.Permisos). Los middlewares se pasan a cada RegisterRoutes para
+	// que queden scopeados a sus propios prefijos (/usuarios,
+	// /sucursales-facturador, etc.) — un grupo con prefijo "/" aplicaría el
+	// middleware a TODO el resto de rutas protegidas.
+	requiere := middleware.RequirePermiso(rolService)
 
 	// Registrar rutas de conexiones de BD
-	dbConnectionHandler.RegisterRoutes(protegido)
+	dbConnectionHandler.RegisterRoutes(protegido, requiere)
 	// Registrar rutas de consultas
-	consultasHandler.RegisterRoutes(protegido)
+	consultasHandler.RegisterRoutes(protegido, requiere)
 	// Registrar rutas de codigo producto
-	codigoProductoHandler.RegisterRoutes(protegido)
-	// Registrar rutas de usuarios/regionales/catálogo de sucursales (solo admin)
-	usuarioHandler.RegisterRoutes(protegido, requireAdmin)
-	// Registrar rutas de sucursales facturador (FacturaClic) (solo admin)
-	sucursalFacturadorHandler.RegisterRoutes(protegido, requireAdmin)
+	codigoProductoHandler.RegisterRoutes(protegido, requiere)
+	// Registrar rutas de usuarios/regionales/catálogo de sucursales
+	usuarioHandler.RegisterRoutes(protegido, requiere)
+	// Registrar ABM de roles y catálogo de permisos
+	rolHandler.RegisterRoutes(protegido, requiere)
+	// Registrar ABM de API keys de integraciones
+	apiKeyHandler.RegisterRoutes(protegido, requiere)
+	// Registrar rutas de sucursales facturador (FacturaClic)
+	sucursalFacturadorHandler.RegisterRoutes(protegido, requiere)
 	// Registrar rutas de facturas prevaloradas (boletos)
-	facturaPrevaloradaHandler.RegisterRoutes(protegido)
+	facturaPrevaloradaHandler.RegisterRoutes(protegido, requiere)
 	// Registrar rutas de facturas de anulación
-	facturaAnulacionHandler.RegisterRoutes(protegido)
+	facturaAnulacionHandler.RegisterRoutes(protegido, requiere)
 	// Registrar rutas de logs de envío
-	logEnvioHandler.RegisterRoutes(protegido)
+	logEnvioHandler.RegisterRoutes(protegido, requiere)
+	// Registrar rutas de exportaciones en segundo plano (estado/descarga)
+	exportacionesHandler.RegisterRoutes(protegido, requiere)
+	// Registrar rutas de rotación de la clave de cifrado de secretos
+	cifradoHandler.RegisterRoutes(protegido, requiere)
+	// Registrar rutas de salud de dependencias (conexiones y facturadores)
+	saludHandler.RegisterRoutes(protegido, requiere)
+	// Registrar ABM de regionales y catálogo de sucursales
+	catalogoHandler.RegisterRoutes(protegido, requiere)
+	// Registrar sincronización del catálogo contra SFE_SUCURSAL
+	sincronizacionCatalogoHandler.RegisterRoutes(protegido, requiere)
+	// Registrar consulta/exportación de la auditoría de acciones
+	auditoriaHandler.RegisterRoutes(protegido, requiere)
 }
 
 func main() {
 	log.Println("Iniciando Invoice System API...")
 
 	// Cargar configuración
-	config := LoadConfig()
+	config := database.LoadConfig()
 
 	// Inicializar base de datos
-	db := InitDatabase(config)
-
-	// Ejecutar migraciones
-	if err := AutoMigrate(db); err != nil {
-		log.Fatalf("Error en migraciones: %v", err)
+	db := database.InitDatabase(config)
+
+	// Las migraciones se aplican con "managerfact migrate up" (ver
+	// doc/Migraciones.md); el servidor las aplica únicamente si se le pide
+	// con MIGRAR_AL_INICIAR, y no arranca contra un esquema inesperado.
+	if os.Getenv("MIGRAR_AL_INICIAR") == "true" {
+		if _, err := database.Subir(db); err != nil {
+			log.Fatalf("Error en migraciones: %v", err)
+		}
 	}
-
-	// Agregar datos iniciales (opcional)
-	if err := SeedDatabase(db); err != nil {
-		log.Printf("Advertencia en seed de datos: %v", err)
+	if err := database.VerificarEsquema(db); err != nil {
+		log.Fatalf("Esquema de base de datos inesperado: %v", err)
+	}
+	if err := database.MigrarPasswordsConexiones(db); err != nil {
+		log.Printf("Advertencia cifrando contraseñas de conexiones: %v", err)
+	}
+	if err := database.MarcarPasswordsIgualesAlCI(db); err != nil {
+		log.Printf("Advertencia revisando contraseñas iguales al CI: %v", err)
 	}
-	if err := SeedRegionalesYSucursales(db); err != nil {
-		log.Printf("Advertencia en seed de regionales/sucursales: %v", err)
+
+	// El servidor no siembra datos: el catálogo y el admin inicial se
+	// cargan con "managerfact bootstrap" (ver doc/Bootstrap.md).
+	if total, err := repositories.NewCatalogoRepository(db).ContarSucursales(); err == nil && total == 0 {
+		log.Println("Advertencia: el catálogo de sucursales está vacío, cargarlo con \"managerfact bootstrap catalogo\"")
 	}
 
 	// Inicializar dependencias (Dependency Injection)
-	dbConnectionRepo := repositories.NewDbConnectionRepository(db)
-	dbConnectionService := services.NewDbConnectionService(dbConnectionRepo)
-	dbConnectionHandler := handlers.NewDbConnectionHandler(dbConnectionService)
+	// exportaciones (xlsx/csv/pdf) de consultas y auditoría; las grandes corren en
+	// segundo plano y se descargan desde /exportaciones/:id/descargar
+	exportacionesService := services.NewExportacionesService()
+	exportacionesHandler := handlers.NewExportacionesHandler(exportacionesService)
 
+	dbConnectionRepo := repositories.NewDbConnectionRepository(db)
+	// pools de las conexiones remotas (SQL Server de facturadores/DUAS),
+	// compartidos entre consultas y el CRUD de conexiones
+	conexionesRemotas := services.NewConexionesRemotas(dbConnectionRepo)
+	dbConnectionService := services.NewDbConnectionService(dbConnectionRepo, conexionesRemotas)
 	// usuarios (antes de consultas: ConsultasHandler necesita usuarioService
 	// para verificar accesos por sucursal)
 	usuarioRepo := repositories.NewUsuarioRepository(db)
-	usuarioService := services.NewUsuarioService(usuarioRepo)
-	usuarioHandler := handlers.NewUsuarioHandler(usuarioService)
+	sesionRepo := repositories.NewSesionRepository(db)
+	rolRepo := repositories.NewRolRepository(db)
+	usuarioService := services.NewUsuarioService(usuarioRepo, repositories.NewIntentoLoginRepository(db), sesionRepo, rolRepo)
+	sesionService := services.NewSesionService(sesionRepo, usuarioRepo)
+
+	// auditoría de acciones administrativas y fiscales (solo inserción)
+	auditoriaService := services.NewAuditoriaService(repositories.NewAuditoriaRepository(db), usuarioRepo, exportacionesService)
+	auditoriaHandler := handlers.NewAuditoriaHandler(auditoriaService, usuarioService)
+
+	usuarioHandler := handlers.NewUsuarioHandler(usuarioService, sesionService, auditoriaService)
+	dbConnectionHandler := handlers.NewDbConnectionHandler(dbConnectionService, auditoriaService)
 
-	// login / sesión
-	authHandler := handlers.NewAuthHandler(usuarioService)
+	// roles y permisos
+	rolService := services.NewRolService(rolRepo)
+	rolHandler := handlers.NewRolHandler(rolService, auditoriaService)
+
+	// API keys de integraciones (cada una con su cuenta de servicio)
+	apiKeyService := services.NewApiKeyService(repositories.NewApiKeyRepository(db), usuarioRepo, rolRepo)
+	apiKeyHandler := handlers.NewApiKeyHandler(apiKeyService, auditoriaService)
+
+	// ABM de regionales y sucursales_catalogo
+	catalogoRepo := repositories.NewCatalogoRepository(db)
+	catalogoHandler := handlers.NewCatalogoHandler(services.NewCatalogoService(catalogoRepo), auditoriaService)
+
+	// login / sesiones (refresh, logout)
+	authHandler := handlers.NewAuthHandler(usuarioService, sesionService, rolService, auditoriaService)
 
 	// Iniciar consultas
 	consultasRepositori := repositories.NewConsutasRepository(db)
-	consultaHandler := services.NewConsultasService(consultasRepositori)
+	consultaHandler := services.NewConsultasService(consultasRepositori, conexionesRemotas, exportacionesService)
 	consultasHandler := handlers.NewConsultasHandler(consultaHandler, usuarioService)
 
+	// sincronización del catálogo de sucursales contra SFE_SUCURSAL
+	sincronizacionCatalogoService := services.NewSincronizacionCatalogoService(catalogoRepo, consultaHandler, dbConnectionRepo)
+	sincronizacionCatalogoHandler := handlers.NewSincronizacionCatalogoHandler(sincronizacionCatalogoService, auditoriaService)
+
 	// codigo producto
 	codigoProductoRepo := repositories.NewCodigoProductoRepoRepo(db)
 	codigoProductoService := services.NewCodigoProductoService(codigoProductoRepo)
@@ -397,7 +224,12 @@ func main() {
 	// sucursales facturador (FacturaClic)
 	sucursalFacturadorRepo := repositories.NewSucursalFacturadorRepository(db)
 	sucursalFacturadorService := services.NewSucursalFacturadorService(sucursalFacturadorRepo)
-	sucursalFacturadorHandler := handlers.NewSucursalFacturadorHandler(sucursalFacturadorService)
+	sucursalFacturadorHandler := handlers.NewSucursalFacturadorHandler(sucursalFacturadorService, auditoriaService)
+
+	// rotación de la clave de cifrado (tokens de sucursales facturador y
+	// contraseñas de conexiones)
+	cifradoService := services.NewCifradoService(sucursalFacturadorRepo, dbConnectionRepo, usuarioRepo)
+	cifradoHandler := handlers.NewCifradoHandler(cifradoService, auditoriaService)
 
 	// logs de envío (registro de intentos, manuales y automáticos)
 	logEnvioRepo := repositories.NewLogEnvioRepository(db)
@@ -406,21 +238,49 @@ func main() {
 	// facturas prevaloradas (boletos)
 	facturaPrevaloradaRepo := repositories.NewFacturaPrevaloradaRepository(db)
 	facturaPrevaloradaService := services.NewFacturaPrevaloradaService(facturaPrevaloradaRepo, sucursalFacturadorRepo, logEnvioRepo, usuarioService)
-	facturaPrevaloradaHandler := handlers.NewFacturaPrevaloradaHandler(facturaPrevaloradaService)
+	facturaPrevaloradaHandler := handlers.NewFacturaPrevaloradaHandler(facturaPrevaloradaService, auditoriaService)
 
 	// facturas de anulación
 	facturaAnulacionRepo := repositories.NewFacturaAnulacionRepository(db)
 	facturaAnulacionService := services.NewFacturaAnulacionService(facturaAnulacionRepo, sucursalFacturadorRepo, logEnvioRepo, usuarioService)
-	facturaAnulacionHandler := handlers.NewFacturaAnulacionHandler(facturaAnulacionService)
+	facturaAnulacionHandler := handlers.NewFacturaAnulacionHandler(facturaAnulacionService, auditoriaService)
 
 	// envío automático de pendientes (prevaloradas + anulación) en background
 	envioWorker := services.NewEnvioWorker(facturaPrevaloradaService, facturaAnulacionService)
 	go envioWorker.Iniciar()
 
+	// chequeo periódico de conexiones remotas y facturadores, con historial
+	// en chequeos_salud y reporte en /health/dependencies
+	chequeoSaludRepo := repositories.NewChequeoSaludRepository(db)
+	monitorSalud := services.NewMonitorSalud(dbConnectionRepo, sucursalFacturadorRepo, chequeoSaludRepo)
+	saludHandler := handlers.NewSaludHandler(monitorSalud)
+	go monitorSalud.Iniciar()
+
+	// proxies inversos de los que se acepta PROXY_HEADER (IPs o CIDR)
+	var proxiesConfiables []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxiesConfiables = append(proxiesConfiables, proxy)
+		}
+	}
+	if os.Getenv("PROXY_HEADER") != "" && len(proxiesConfiables) == 0 {
+		log.Println("PROXY_HEADER está definido pero TRUSTED_PROXIES no: se ignora el header y se usa la IP de la conexión")
+	}
+
 	// Configurar Fiber
 	app := fiber.New(fiber.Config{
 		AppName:      "Invoice System API v1.0.0",
 		ServerHeader: "Invoice System",
+		// Detrás de un proxy inverso c.IP() sería siempre la del proxy: el
+		// límite de intentos de login por IP necesita la del cliente
+		// (PROXY_HEADER=X-Forwarded-For o X-Real-Ip). El header solo se lee
+		// si la conexión viene de TRUSTED_PROXIES; si no, cualquier cliente
+		// podría inventarse la IP para saltear el límite o falsear la
+		// auditoría.
+		ProxyHeader:             os.Getenv("PROXY_HEADER"),
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          proxiesConfiables,
+		EnableIPValidation:      true,
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
 			code := fiber.StatusInternalServerError
 			if e, ok := err.(*fiber.Error); ok {
@@ -436,7 +296,7 @@ func main() {
 	})
 
 	// Configurar rutas
-	SetupRoutes(app, authHandler, usuarioService, dbConnectionHandler, consultasHandler, codigoProductoHandler, usuarioHandler, sucursalFacturadorHandler, facturaPrevaloradaHandler, facturaAnulacionHandler, logEnvioHandler)
+	SetupRoutes(app, authHandler, usuarioService, sesionService, rolService, apiKeyService, dbConnectionHandler, consultasHandler, codigoProductoHandler, usuarioHandler, sucursalFacturadorHandler, facturaPrevaloradaHandler, facturaAnulacionHandler, logEnvioHandler, exportacionesHandler, cifradoHandler, saludHandler, catalogoHandler, sincronizacionCatalogoHandler, rolHandler, apiKeyHandler, auditoriaHandler)
 
 	// Iniciar servidor
 	port := ":" + config.ServerPort
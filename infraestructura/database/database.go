@@ -0,0 +1,268 @@
+// Package database abre la base principal (PostgreSQL) y maneja sus
+// migraciones versionadas (migraciones.go); lo usan el servidor (cmd/server) y la CLI (cmd/managerfact).
+package database
+
+import (
+	"fmt"
+	"log"
+	"managerfact/internal/domain/models"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	gormLogger "gorm.io/gorm/logger"
+)
+
+// Config estructura de configuración
+type Config struct {
+	DBHost     string
+	DBUser     string
+	DBPassword string
+	DBName     string
+	DBPort     string
+	DBSSLMode  string
+	ServerPort string
+}
+
+// LoadConfig carga la configuración desde variables de entorno
+func LoadConfig() *Config {
+	// Cargar archivo .env si existe
+	if err := godotenv.Load(); err != nil {
+		log.Println("No se encontró archivo .env, usando variables de entorno del sistema")
+	}
+
+	config := &Config{
+		DBHost:     getEnv("DB_HOST", "localhost"),
+		DBUser:     getEnv("DB_USER", "postgres"),
+		DBPassword: getEnv("DB_PASSWORD", "password"),
+		DBName:     getEnv("DB_NAME", "invoices_system"),
+		DBPort:     getEnv("DB_PORT", "5432"),
+		DBSSLMode:  getEnv("DB_SSL_MODE", "disable"),
+		ServerPort: getEnv("SERVER_PORT", "8080"),
+	}
+
+	return config
+}
+
+// getEnv obtiene una variable de entorno o retorna un valor por defecto
+func getEnv(key, defaultValue string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return defaultValue
+}
+
+// InitDatabase inicializa la conexión a PostgreSQL
+func InitDatabase(config *Config) *gorm.DB {
+	dsn := fmt.Sprintf(
+		"host=%s user=%s password=%s dbname=%s port=%s sslmode=%s TimeZone=America/La_Paz",
+		config.DBHost, config.DBUser, config.DBPassword, config.DBName, config.DBPort, config.DBSSLMode,
+	)
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{
+		Logger: gormLogger.Default.LogMode(gormLogger.Info),
+	})
+	if err != nil {
+		log.Fatalf("Error conectando a la base de datos: %v", err)
+	}
+
+	log.Println("Conexión a PostgreSQL establecida exitosamente")
+	return db
+}
+
+// MigrarFechasPrevaloradaADate convierte fecha_emision/fecha_compra_boleto
+// de facturas_prevaloradas de timestamptz (el default que le daba GORM a
+// time.Time) a date: son fechas de calendario puras que vienen del Excel,
+// sin hora. Con timestamptz y la sesión en America/La_Paz (UTC-4, ver
+// InitDatabase), una fecha guardada como medianoche se leía un día para
+// atrás. Solo corre en el baseline de una instalación legada y solo si la
+// columna todavía es timestamptz (la migración 0001 ya crea la tabla con
+// date).
+//
+// El cast usa "AT TIME ZONE 'UTC'", no la zona de la sesión: las fechas ya
+// guardadas se parsearon siempre como medianoche UTC (ver parsearFecha en
+// aplication/services/factura_prevalorada_service.go), así que extraer la
+// fecha en UTC recupera el valor original tal cual se importó. Un
+// "ALTER COLUMN TYPE date" sin USING dejaría que Postgres use su cast
+// implícito timestamptz->date, que sí usa la zona de la sesión — y
+// corrompería en la migración misma los datos ya importados con el mismo
+// corrimiento que se está arreglando.
+func MigrarFechasPrevaloradaADate(db *gorm.DB) error {
+	var tipoActual string
+	err := db.Raw(`
+		SELECT data_type FROM information_schema.columns
+		WHERE table_name = 'facturas_prevaloradas' AND column_name = 'fecha_emision'
+	`).Scan(&tipoActual).Error
+	if err != nil {
+		return fmt.Errorf("error verificando tipo de fecha_emision: %v", err)
+	}
+	if tipoActual != "timestamp with time zone" {
+		return nil
+	}
+
+	log.Println("Migrando fecha_emision/fecha_compra_boleto de facturas_prevaloradas a date (evitando el corrimiento de un día)...")
+	err = db.Exec(`
+		ALTER TABLE facturas_prevaloradas
+			ALTER COLUMN fecha_emision TYPE date USING (fecha_emision AT TIME ZONE 'UTC')::date,
+			ALTER COLUMN fecha_compra_boleto TYPE date USING (fecha_compra_boleto AT TIME ZONE 'UTC')::date
+	`).Error
+	if err != nil {
+		return fmt.Errorf("error migrando fechas de facturas_prevaloradas a date: %v", err)
+	}
+	log.Println("Migración de fechas a date completada")
+	return nil
+}
+
+// baselineEsquemaLegado lleva una instalación anterior a las migraciones
+// versionadas al esquema de la migración 0001: corre el arreglo de fechas
+// de antes y después el DDL de la propia 0001 (inicial) con guardas por
+// objeto (ver esquemaBaseline). No depende de los modelos actuales, así que
+// el resultado es el mismo que una instalación nueva con la 0001 y las
+// migraciones siguientes corren igual en las dos. Solo lo llama Subir.
+func baselineEsquemaLegado(db *gorm.DB, inicial Migracion) error {
+	if err := MigrarFechasPrevaloradaADate(db); err != nil {
+		return err
+	}
+
+	esquema, err := esquemaBaseline(inicial.Up)
+	if err != nil {
+		return err
+	}
+	log.Println("Completando el esquema legado hasta la migración 0001...")
+	if err := db.Exec(esquema).Error; err != nil {
+		return fmt.Errorf("error en el baseline del esquema: %w", err)
+	}
+	return nil
+}
+
+var (
+	patronCrearTabla = regexp.MustCompile(`^CREATE TABLE "(\w+)" \($`)
+	patronColumna    = regexp.MustCompile(`^\s+"(\w+)" (.+?),?$`)
+	patronFK         = regexp.MustCompile(`^\s+CONSTRAINT "(\w+)" (FOREIGN KEY .+?),?$`)
+	patronClave      = regexp.MustCompile(`^\s+PRIMARY KEY \(.+\),?$`)
+	patronIndice     = regexp.MustCompile(`^CREATE (UNIQUE )?INDEX IF NOT EXISTS `)
+)
+
+// esquemaBaseline convierte el DDL de la 0001 en uno que se puede correr
+// sobre las tablas que dejó AutoMigrate: cada CREATE TABLE pasa a IF NOT
+// EXISTS y se completa con un ADD COLUMN IF NOT EXISTS por columna y las
+// foreign keys que falten (por nombre, en pg_constraint); los índices ya
+// son IF NOT EXISTS. Cualquier otra sentencia es un error: la 0001 no
+// cambia (su checksum lo impide), así que esto solo falla si alguien la
+// edita.
+func esquemaBaseline(up string) (string, error) {
+	var salida strings.Builder
+	var tabla string
+	var columnas, fks []string
+
+	for _, linea := range strings.Split(up, "\n") {
+		switch {
+		case tabla != "":
+			if linea == ");" {
+				salida.WriteString(linea + "\n")
+				for _, columna := range columnas {
+					fmt.Fprintf(&salida, "ALTER TABLE %q ADD COLUMN IF NOT EXISTS %s;\n", tabla, columna)
+				}
+				for _, fk := range fks {
+					salida.WriteString(fk)
+				}
+				tabla, columnas, fks = "", nil, nil
+				continue
+			}
+			salida.WriteString(linea + "\n")
+			if partes := patronFK.FindStringSubmatch(linea); partes != nil {
+				fks = append(fks, fmt.Sprintf(`DO $$ BEGIN
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = '%s') THEN
+        ALTER TABLE %q ADD CONSTRAINT %q %s;
+    END IF;
+END $$;
+`, partes[1], tabla, partes[1], partes[2]))
+			} else if partes := patronColumna.FindStringSubmatch(linea); partes != nil {
+				// el id (bigserial) existe si existe la tabla
+				if partes[1] != "id" {
+					columnas = append(columnas, fmt.Sprintf("%q %s", partes[1], partes[2]))
+				}
+			} else if !patronClave.MatchString(linea) {
+				return "", fmt.Errorf("baseline: línea inesperada en la tabla %s: %q", tabla, linea)
+			}
+		case strings.TrimSpace(linea) == "" || strings.HasPrefix(linea, "--"):
+			continue
+		case patronCrearTabla.MatchString(linea):
+			tabla = patronCrearTabla.FindStringSubmatch(linea)[1]
+			salida.WriteString(strings.Replace(linea, "CREATE TABLE", "CREATE TABLE IF NOT EXISTS", 1) + "\n")
+		case patronIndice.MatchString(linea):
+			salida.WriteString(linea + "\n")
+		default:
+			return "", fmt.Errorf("baseline: sentencia inesperada en la migración inicial: %q", linea)
+		}
+	}
+	if tabla != "" {
+		return "", fmt.Errorf("baseline: la tabla %s no cierra", tabla)
+	}
+	return salida.String(), nil
+}
+
+// MigrarPasswordsConexiones cifra las contraseñas de db_connections que
+// todavía están en claro (password_cifrado = false: filas creadas antes de
+// que se cifraran). Es idempotente: una fila ya cifrada no se vuelve a
+// tocar.
+func MigrarPasswordsConexiones(db *gorm.DB) error {
+	var pendientes []models.DbConnection
+	if err := db.Where("password_cifrado = ?", false).Find(&pendientes).Error; err != nil {
+		return fmt.Errorf("error buscando contraseñas sin cifrar: %v", err)
+	}
+	if len(pendientes) == 0 {
+		return nil
+	}
+
+	log.Printf("Cifrando contraseñas de %d conexión(es)...", len(pendientes))
+	for _, conexion := range pendientes {
+		if err := conexion.CifrarPassword(); err != nil {
+			return err
+		}
+		err := db.Model(&models.DbConnection{}).Where("id = ?", conexion.ID).UpdateColumns(map[string]any{
+			"password":         conexion.Password,
+			"password_cifrado": true,
+		}).Error
+		if err != nil {
+			return fmt.Errorf("error guardando contraseña cifrada de '%s': %v", conexion.ServerName, err)
+		}
+	}
+	return nil
+}
+
+// MarcarPasswordsIgualesAlCI fuerza el cambio de contraseña
+// (must_change_password) a los usuarios que todavía tienen su CI como
+// contraseña: las instalaciones anteriores a la política creaban y
+// reseteaban usuarios así sin pedir nunca el cambio. Solo revisa a los que
+// nunca cambiaron su contraseña, así que deja de costar en cuanto cada uno
+// la cambia.
+func MarcarPasswordsIgualesAlCI(db *gorm.DB) error {
+	var usuarios []models.Usuario
+	err := db.Select("id", "ci", "password_hash").
+		Where("must_change_password = ? AND password_cambiado_en IS NULL", false).
+		Find(&usuarios).Error
+	if err != nil {
+		return fmt.Errorf("error buscando usuarios sin cambio de contraseña: %w", err)
+	}
+
+	var ids []uint
+	for _, usuario := range usuarios {
+		if bcrypt.CompareHashAndPassword([]byte(usuario.PasswordHash), []byte(usuario.CI)) == nil {
+			ids = append(ids, usuario.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	log.Printf("%d usuario(s) todavía tienen el CI como contraseña: se les exige cambiarla", len(ids))
+	if err := db.Model(&models.Usuario{}).Where("id IN ?", ids).UpdateColumn("must_change_password", true).Error; err != nil {
+		return fmt.Errorf("error marcando usuarios con contraseña igual al CI: %w", err)
+	}
+	return nil
+}
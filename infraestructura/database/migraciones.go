@@ -0,0 +1,355 @@
+package database
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Las migraciones son pares NNNN_nombre.up.sql / NNNN_nombre.down.sql en
+// migraciones/, embebidos en el binario. Las pendientes corren en una sola
+// transacción junto con su registro en schema_migrations (Postgres tiene
+// DDL transaccional): si una falla no queda ninguna aplicada a medias. Por
+// eso una migración no puede usar CREATE INDEX CONCURRENTLY. Ver
+// doc/Migraciones.md.
+//
+//go:embed migraciones/*.sql
+var archivosMigraciones embed.FS
+
+var patronMigracion = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// lockMigraciones es la clave del advisory lock de Postgres que serializa
+// dos "migrate" corriendo a la vez (o un servidor con MIGRAR_AL_INICIAR).
+const lockMigraciones = 73702024
+
+// Migracion es un par up/down leído de migraciones/.
+type Migracion struct {
+	Version  int
+	Nombre   string
+	Up       string
+	Down     string
+	Checksum string
+}
+
+// EstadoMigracion es una migración conocida por el binario o registrada en
+// schema_migrations (o ambas).
+type EstadoMigracion struct {
+	Version    int        `json:"version"`
+	Nombre     string     `json:"nombre"`
+	Aplicada   bool       `json:"aplicada"`
+	AplicadaEn *time.Time `json:"aplicada_en,omitempty"`
+	// Modificada: el .up.sql embebido no es el que se aplicó.
+	Modificada bool `json:"modificada"`
+	// Desconocida: está aplicada pero este binario no la tiene (la aplicó
+	// una versión más nueva).
+	Desconocida bool `json:"desconocida"`
+}
+
+// migracionAplicada es una fila de schema_migrations.
+type migracionAplicada struct {
+	Version    int
+	Nombre     string
+	Checksum   string
+	AplicadaEn time.Time
+}
+
+func (migracionAplicada) TableName() string { return "schema_migrations" }
+
+// CargarMigraciones lee las migraciones embebidas, ordenadas por versión.
+func CargarMigraciones() ([]Migracion, error) {
+	entradas, err := fs.ReadDir(archivosMigraciones, "migraciones")
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo migraciones embebidas: %w", err)
+	}
+
+	porVersion := map[int]*Migracion{}
+	for _, entrada := range entradas {
+		partes := patronMigracion.FindStringSubmatch(entrada.Name())
+		if partes == nil {
+			return nil, fmt.Errorf("nombre de migración inválido: %s (se espera NNNN_nombre.up.sql o .down.sql)", entrada.Name())
+		}
+		version, _ := strconv.Atoi(partes[1])
+		contenido, err := fs.ReadFile(archivosMigraciones, "migraciones/"+entrada.Name())
+		if err != nil {
+			return nil, fmt.Errorf("error leyendo %s: %w", entrada.Name(), err)
+		}
+
+		migracion, ok := porVersion[version]
+		if !ok {
+			migracion = &Migracion{Version: version, Nombre: partes[2]}
+			porVersion[version] = migracion
+		} else if migracion.Nombre != partes[2] {
+			return nil, fmt.Errorf("la versión %d está repetida (%s y %s)", version, migracion.Nombre, partes[2])
+		}
+		if partes[3] == "up" {
+			migracion.Up = string(contenido)
+			suma := sha256.Sum256(contenido)
+			migracion.Checksum = hex.EncodeToString(suma[:])
+		} else {
+			migracion.Down = string(contenido)
+		}
+	}
+
+	migraciones := make([]Migracion, 0, len(porVersion))
+	for _, migracion := range porVersion {
+		if migracion.Up == "" || migracion.Down == "" {
+			return nil, fmt.Errorf("la migración %04d_%s no tiene su .up.sql y su .down.sql", migracion.Version, migracion.Nombre)
+		}
+		migraciones = append(migraciones, *migracion)
+	}
+	sort.Slice(migraciones, func(i, j int) bool { return migraciones[i].Version < migraciones[j].Version })
+	return migraciones, nil
+}
+
+// crearTablaMigraciones crea schema_migrations si no existe.
+func crearTablaMigraciones(db *gorm.DB) error {
+	err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version bigint PRIMARY KEY,
+			nombre varchar(150) NOT NULL,
+			checksum varchar(64) NOT NULL,
+			aplicada_en timestamptz NOT NULL DEFAULT now()
+		)
+	`).Error
+	if err != nil {
+		return fmt.Errorf("error creando schema_migrations: %w", err)
+	}
+	return nil
+}
+
+func migracionesAplicadas(db *gorm.DB) (map[int]migracionAplicada, error) {
+	var filas []migracionAplicada
+	if err := db.Order("version").Find(&filas).Error; err != nil {
+		return nil, fmt.Errorf("error leyendo schema_migrations: %w", err)
+	}
+	aplicadas := make(map[int]migracionAplicada, len(filas))
+	for _, fila := range filas {
+		aplicadas[fila.Version] = fila
+	}
+	return aplicadas, nil
+}
+
+// esInstalacionLegada indica si la base tiene el esquema creado por
+// AutoMigrate (antes de las migraciones versionadas) pero ninguna
+// migración registrada.
+func esInstalacionLegada(db *gorm.DB, aplicadas map[int]migracionAplicada) bool {
+	return len(aplicadas) == 0 && db.Migrator().HasTable("usuarios")
+}
+
+// Estado lista todas las migraciones, aplicadas o no.
+func Estado(db *gorm.DB) ([]EstadoMigracion, error) {
+	migraciones, err := CargarMigraciones()
+	if err != nil {
+		return nil, err
+	}
+	if err := crearTablaMigraciones(db); err != nil {
+		return nil, err
+	}
+	aplicadas, err := migracionesAplicadas(db)
+	if err != nil {
+		return nil, err
+	}
+
+	estados := make([]EstadoMigracion, 0, len(migraciones))
+	for _, migracion := range migraciones {
+		estado := EstadoMigracion{Version: migracion.Version, Nombre: migracion.Nombre}
+		if aplicada, ok := aplicadas[migracion.Version]; ok {
+			estado.Aplicada = true
+			estado.AplicadaEn = &aplicada.AplicadaEn
+			estado.Modificada = aplicada.Checksum != migracion.Checksum
+			delete(aplicadas, migracion.Version)
+		}
+		estados = append(estados, estado)
+	}
+	for _, aplicada := range aplicadas {
+		estados = append(estados, EstadoMigracion{
+			Version:     aplicada.Version,
+			Nombre:      aplicada.Nombre,
+			Aplicada:    true,
+			AplicadaEn:  &aplicada.AplicadaEn,
+			Desconocida: true,
+		})
+	}
+	sort.Slice(estados, func(i, j int) bool { return estados[i].Version < estados[j].Version })
+	return estados, nil
+}
+
+// VerificarEsquema es el chequeo de arranque: la base tiene que tener
+// aplicadas exactamente las migraciones que trae este binario. Si faltan,
+// sobran (la migró un binario más nuevo) o alguna cambió después de
+// aplicada, devuelve un error que dice qué hacer en vez de arrancar contra
+// un esquema que no es el que esperan los modelos.
+func VerificarEsquema(db *gorm.DB) error {
+	if !db.Migrator().HasTable(migracionAplicada{}) {
+		if db.Migrator().HasTable("usuarios") {
+			return fmt.Errorf("la base no tiene versión de esquema (instalación anterior a las migraciones): correr \"managerfact migrate up\" para hacer el baseline")
+		}
+		return fmt.Errorf("la base está vacía: correr \"managerfact migrate up\"")
+	}
+
+	estados, err := Estado(db)
+	if err != nil {
+		return err
+	}
+	var pendientes, desconocidas, modificadas []string
+	for _, estado := range estados {
+		nombre := fmt.Sprintf("%04d_%s", estado.Version, estado.Nombre)
+		switch {
+		case estado.Desconocida:
+			desconocidas = append(desconocidas, nombre)
+		case !estado.Aplicada:
+			pendientes = append(pendientes, nombre)
+		case estado.Modificada:
+			modificadas = append(modificadas, nombre)
+		}
+	}
+
+	if len(desconocidas) > 0 {
+		return fmt.Errorf("la base tiene migraciones que este binario no conoce (%s): usar un binario más nuevo o revertirlas con él", strings.Join(desconocidas, ", "))
+	}
+	if len(pendientes) > 0 {
+		return fmt.Errorf("hay migraciones pendientes (%s): correr \"managerfact migrate up\"", strings.Join(pendientes, ", "))
+	}
+	if len(modificadas) > 0 {
+		return fmt.Errorf("migraciones modificadas después de aplicadas (%s): una migración aplicada no se edita, se agrega otra", strings.Join(modificadas, ", "))
+	}
+	return nil
+}
+
+// conLock corre fn con el advisory lock de migraciones tomado, dentro de
+// una transacción (el lock se suelta solo al terminar).
+func conLock(db *gorm.DB, fn func(tx *gorm.DB) error) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", lockMigraciones).Error; err != nil {
+			return fmt.Errorf("error tomando el lock de migraciones: %w", err)
+		}
+		return fn(tx)
+	})
+}
+
+// Subir aplica las migraciones pendientes en orden y devuelve las que
+// aplicó. En una instalación legada (esquema de AutoMigrate sin
+// schema_migrations) primero hace el baseline: completa el esquema hasta el
+// de la migración 1 (baselineEsquemaLegado) y la registra como aplicada.
+func Subir(db *gorm.DB) ([]Migracion, error) {
+	migraciones, err := CargarMigraciones()
+	if err != nil {
+		return nil, err
+	}
+	if err := crearTablaMigraciones(db); err != nil {
+		return nil, err
+	}
+
+	var aplicadasAhora []Migracion
+	err = conLock(db, func(tx *gorm.DB) error {
+		aplicadas, err := migracionesAplicadas(tx)
+		if err != nil {
+			return err
+		}
+
+		if esInstalacionLegada(tx, aplicadas) {
+			log.Println("Instalación anterior a las migraciones versionadas: haciendo baseline del esquema")
+			if err := baselineEsquemaLegado(tx, migraciones[0]); err != nil {
+				return err
+			}
+			if err := registrarMigracion(tx, migraciones[0]); err != nil {
+				return err
+			}
+			aplicadas[migraciones[0].Version] = migracionAplicada{Version: migraciones[0].Version}
+			aplicadasAhora = append(aplicadasAhora, migraciones[0])
+		}
+
+		for _, migracion := range migraciones {
+			if _, ok := aplicadas[migracion.Version]; ok {
+				continue
+			}
+			log.Printf("Aplicando migración %04d_%s", migracion.Version, migracion.Nombre)
+			if err := tx.Exec(migracion.Up).Error; err != nil {
+				return fmt.Errorf("error aplicando migración %04d_%s: %w", migracion.Version, migracion.Nombre, err)
+			}
+			if err := registrarMigracion(tx, migracion); err != nil {
+				return err
+			}
+			aplicadasAhora = append(aplicadasAhora, migracion)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return aplicadasAhora, nil
+}
+
+func registrarMigracion(tx *gorm.DB, migracion Migracion) error {
+	err := tx.Create(&migracionAplicada{
+		Version:    migracion.Version,
+		Nombre:     migracion.Nombre,
+		Checksum:   migracion.Checksum,
+		AplicadaEn: time.Now(),
+	}).Error
+	if err != nil {
+		return fmt.Errorf("error registrando migración %04d_%s: %w", migracion.Version, migracion.Nombre, err)
+	}
+	return nil
+}
+
+// Bajar revierte las últimas pasos migraciones aplicadas, de la más nueva a
+// la más vieja, y devuelve las que revirtió. Una migración aplicada que el
+// binario no conoce no se puede revertir (no tiene su .down.sql).
+func Bajar(db *gorm.DB, pasos int) ([]Migracion, error) {
+	if pasos < 1 {
+		return nil, fmt.Errorf("la cantidad de migraciones a revertir debe ser al menos 1")
+	}
+	migraciones, err := CargarMigraciones()
+	if err != nil {
+		return nil, err
+	}
+	porVersion := make(map[int]Migracion, len(migraciones))
+	for _, migracion := range migraciones {
+		porVersion[migracion.Version] = migracion
+	}
+	if err := crearTablaMigraciones(db); err != nil {
+		return nil, err
+	}
+
+	var revertidas []Migracion
+	err = conLock(db, func(tx *gorm.DB) error {
+		var versiones []int
+		if err := tx.Model(&migracionAplicada{}).Order("version DESC").Limit(pasos).Pluck("version", &versiones).Error; err != nil {
+			return fmt.Errorf("error leyendo schema_migrations: %w", err)
+		}
+		if len(versiones) == 0 {
+			return fmt.Errorf("no hay migraciones aplicadas")
+		}
+
+		for _, version := range versiones {
+			migracion, ok := porVersion[version]
+			if !ok {
+				return fmt.Errorf("la migración %d está aplicada pero este binario no la conoce: revertirla con el binario que la aplicó", version)
+			}
+			log.Printf("Revirtiendo migración %04d_%s", migracion.Version, migracion.Nombre)
+			if err := tx.Exec(migracion.Down).Error; err != nil {
+				return fmt.Errorf("error revirtiendo migración %04d_%s: %w", migracion.Version, migracion.Nombre, err)
+			}
+			if err := tx.Delete(&migracionAplicada{}, "version = ?", version).Error; err != nil {
+				return fmt.Errorf("error desregistrando migración %04d_%s: %w", migracion.Version, migracion.Nombre, err)
+			}
+			revertidas = append(revertidas, migracion)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return revertidas, nil
+}
@@ -0,0 +1,11 @@
+-- Borra todo el esquema, con sus datos.
+DROP TABLE IF EXISTS "chequeos_salud";
+DROP TABLE IF EXISTS "logs_envio";
+DROP TABLE IF EXISTS "facturas_anulacion";
+DROP TABLE IF EXISTS "facturas_prevaloradas";
+DROP TABLE IF EXISTS "sucursales_facturador";
+DROP TABLE IF EXISTS "usuarios";
+DROP TABLE IF EXISTS "sucursales_catalogo";
+DROP TABLE IF EXISTS "regionales";
+DROP TABLE IF EXISTS "db_codigo_producto";
+DROP TABLE IF EXISTS "db_connections";
@@ -0,0 +1,199 @@
+-- Esquema inicial: el mismo que dejaba AutoMigrate de GORM con los modelos
+-- al momento de pasar a migraciones versionadas. En una instalación
+-- existente no se ejecuta: "managerfact migrate up" la marca como aplicada
+-- (baseline, ver infraestructura/database/migraciones.go).
+
+CREATE TABLE "db_connections" (
+    "id" bigserial,
+    "server_name" varchar(100) NOT NULL,
+    "host" varchar(255) NOT NULL,
+    "port" bigint NOT NULL DEFAULT 1433,
+    "database_name" varchar(100) NOT NULL,
+    "username" varchar(100) NOT NULL,
+    "password" varchar(500) NOT NULL,
+    "password_cifrado" boolean NOT NULL DEFAULT false,
+    "is_active" boolean DEFAULT true,
+    "description" text,
+    "type" varchar(50) NOT NULL DEFAULT 'general',
+    "driver" varchar(20) NOT NULL DEFAULT 'sqlserver',
+    "query_timeout_seconds" bigint NOT NULL DEFAULT 0,
+    "codigo_sucursal_sin" bigint,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_db_connections_deleted_at" ON "db_connections" ("deleted_at");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_db_connections_server_name" ON "db_connections" ("server_name");
+
+CREATE TABLE "db_codigo_producto" (
+    "id" bigserial,
+    "codigo" text,
+    "descripcion" text,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_db_codigo_producto_deleted_at" ON "db_codigo_producto" ("deleted_at");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_db_codigo_producto_codigo" ON "db_codigo_producto" ("codigo");
+
+CREATE TABLE "regionales" (
+    "id" bigserial,
+    "nombre" varchar(100) NOT NULL,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_regionales_deleted_at" ON "regionales" ("deleted_at");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_regionales_nombre" ON "regionales" ("nombre");
+
+CREATE TABLE "sucursales_catalogo" (
+    "id" bigserial,
+    "codigo_sucursal_sin" bigint NOT NULL,
+    "nombre" varchar(150) NOT NULL,
+    "regional_id" bigint NOT NULL,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_sucursales_catalogo_regional" FOREIGN KEY ("regional_id") REFERENCES "regionales"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_sucursales_catalogo_deleted_at" ON "sucursales_catalogo" ("deleted_at");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_sucursales_catalogo_codigo_sucursal_sin" ON "sucursales_catalogo" ("codigo_sucursal_sin");
+
+CREATE TABLE "usuarios" (
+    "id" bigserial,
+    "nombre" varchar(150) NOT NULL,
+    "ci" varchar(20) NOT NULL,
+    "cargo" varchar(100),
+    "codigo_usuario" varchar(50) NOT NULL,
+    "password_hash" varchar(255) NOT NULL,
+    "regional_id" bigint,
+    "sucursal_id" bigint,
+    "is_active" boolean DEFAULT true,
+    "rol" varchar(20) NOT NULL DEFAULT 'operador',
+    "acceso_total" boolean DEFAULT false,
+    "sucursales_permitidas_codigos" text,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_usuarios_regional" FOREIGN KEY ("regional_id") REFERENCES "regionales"("id"),
+    CONSTRAINT "fk_usuarios_sucursal" FOREIGN KEY ("sucursal_id") REFERENCES "sucursales_catalogo"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_usuarios_deleted_at" ON "usuarios" ("deleted_at");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_usuarios_codigo_usuario" ON "usuarios" ("codigo_usuario");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_usuarios_ci" ON "usuarios" ("ci");
+
+CREATE TABLE "sucursales_facturador" (
+    "id" bigserial,
+    "nombre" varchar(150) NOT NULL,
+    "codigo_sucursal_sin" bigint NOT NULL,
+    "punto_venta_emisor" varchar(20),
+    "url_link_facturador" varchar(255) NOT NULL,
+    "token_acceso" varchar(500),
+    "codigo_moneda_bob" varchar(10),
+    "codigo_ci" varchar(20),
+    "codigo_nit" varchar(20) NOT NULL,
+    "activo" boolean DEFAULT true,
+    "estado_conexion" varchar(20) NOT NULL DEFAULT 'activo',
+    "ultimo_error_conexion" timestamptz,
+    "ultimo_error_mensaje" text,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_sucursales_facturador_deleted_at" ON "sucursales_facturador" ("deleted_at");
+
+CREATE TABLE "facturas_prevaloradas" (
+    "id" bigserial,
+    "sucursal_facturador_id" bigint NOT NULL,
+    "lote_id" varchar(36) NOT NULL,
+    "codigo_integracion" varchar(64) NOT NULL,
+    "tipo" varchar(30) NOT NULL DEFAULT 'FACTURA_PREVALORADA',
+    "observacion" varchar(255) NOT NULL,
+    "detalle" varchar(255) NOT NULL,
+    "codigo_producto" varchar(30) NOT NULL,
+    "costo_dua_dolares" decimal NOT NULL,
+    "fecha_compra_boleto" date NOT NULL,
+    "tipo_cambio" decimal NOT NULL,
+    "total_bob" decimal NOT NULL DEFAULT 0,
+    "fecha_emision" date NOT NULL,
+    "estado" varchar(20) NOT NULL DEFAULT 'pendiente',
+    "codigo_respuesta" varchar(50),
+    "mensaje_respuesta" text,
+    "fecha_envio" timestamptz,
+    "fecha_respuesta" timestamptz,
+    "intentos_consulta" bigint DEFAULT 0,
+    "cuf" varchar(100),
+    "numero_factura" varchar(50),
+    "url_documento" text,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_facturas_prevaloradas_sucursal_facturador" FOREIGN KEY ("sucursal_facturador_id") REFERENCES "sucursales_facturador"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_facturas_prevaloradas_deleted_at" ON "facturas_prevaloradas" ("deleted_at");
+CREATE INDEX IF NOT EXISTS "idx_facturas_prevaloradas_estado" ON "facturas_prevaloradas" ("estado");
+CREATE INDEX IF NOT EXISTS "idx_facturas_prevaloradas_codigo_integracion" ON "facturas_prevaloradas" ("codigo_integracion");
+CREATE INDEX IF NOT EXISTS "idx_facturas_prevaloradas_lote_id" ON "facturas_prevaloradas" ("lote_id");
+
+CREATE TABLE "facturas_anulacion" (
+    "id" bigserial,
+    "sucursal_facturador_id" bigint NOT NULL,
+    "lote_id" varchar(36) NOT NULL,
+    "observacion" varchar(255) NOT NULL,
+    "codigo_integracion" varchar(64) NOT NULL,
+    "cuf" varchar(250) NOT NULL,
+    "codigo_motivo" varchar(10) NOT NULL,
+    "estado" varchar(20) NOT NULL DEFAULT 'pendiente',
+    "codigo_respuesta" varchar(50),
+    "mensaje_respuesta" text,
+    "fecha_envio" timestamptz,
+    "fecha_respuesta" timestamptz,
+    "intentos_consulta" bigint DEFAULT 0,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_facturas_anulacion_sucursal_facturador" FOREIGN KEY ("sucursal_facturador_id") REFERENCES "sucursales_facturador"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_facturas_anulacion_deleted_at" ON "facturas_anulacion" ("deleted_at");
+CREATE INDEX IF NOT EXISTS "idx_facturas_anulacion_estado" ON "facturas_anulacion" ("estado");
+CREATE INDEX IF NOT EXISTS "idx_facturas_anulacion_codigo_integracion" ON "facturas_anulacion" ("codigo_integracion");
+CREATE INDEX IF NOT EXISTS "idx_facturas_anulacion_lote_id" ON "facturas_anulacion" ("lote_id");
+
+CREATE TABLE "logs_envio" (
+    "id" bigserial,
+    "tipo" varchar(20) NOT NULL,
+    "factura_id" bigint NOT NULL,
+    "codigo_integracion" varchar(64),
+    "sucursal_facturador_id" bigint NOT NULL,
+    "origen" varchar(20) NOT NULL,
+    "resultado" varchar(20) NOT NULL,
+    "mensaje" text,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_logs_envio_sucursal_facturador" FOREIGN KEY ("sucursal_facturador_id") REFERENCES "sucursales_facturador"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_logs_envio_resultado" ON "logs_envio" ("resultado");
+CREATE INDEX IF NOT EXISTS "idx_logs_envio_sucursal_facturador_id" ON "logs_envio" ("sucursal_facturador_id");
+CREATE INDEX IF NOT EXISTS "idx_logs_envio_factura_id" ON "logs_envio" ("factura_id");
+CREATE INDEX IF NOT EXISTS "idx_logs_envio_tipo" ON "logs_envio" ("tipo");
+
+CREATE TABLE "chequeos_salud" (
+    "id" bigserial,
+    "tipo" varchar(20) NOT NULL,
+    "recurso_id" bigint NOT NULL,
+    "nombre" varchar(150),
+    "ok" boolean NOT NULL,
+    "latencia_ms" bigint,
+    "mensaje" text,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_chequeo_dependencia" ON "chequeos_salud" ("tipo","recurso_id","created_at");
@@ -0,0 +1,17 @@
+-- Historial de sincronizaciones del catálogo de sucursales contra el
+-- SFE_SUCURSAL de un facturador (models.SincronizacionCatalogo).
+CREATE TABLE IF NOT EXISTS "sincronizaciones_catalogo" (
+    "id" bigserial,
+    "db_connection_id" bigint NOT NULL,
+    "server_name" varchar(100),
+    "usuario_id" bigint,
+    "estado" varchar(20) NOT NULL DEFAULT 'pendiente',
+    "total_sfe" bigint,
+    "diferencias" jsonb,
+    "aplicada_por_id" bigint,
+    "aplicada_en" timestamptz,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_sincronizaciones_catalogo_db_connection_id" ON "sincronizaciones_catalogo" ("db_connection_id");
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS "historial_passwords";
+ALTER TABLE "usuarios" DROP COLUMN IF EXISTS "password_cambiado_en";
+ALTER TABLE "usuarios" DROP COLUMN IF EXISTS "must_change_password";
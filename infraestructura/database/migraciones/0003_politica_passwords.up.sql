@@ -0,0 +1,16 @@
+-- Cambio de contraseña obligatorio e historial de contraseñas
+-- (models.Usuario.MustChangePassword, models.HistorialPassword). Los
+-- usuarios existentes que todavía tienen el CI como contraseña se marcan
+-- al arrancar el servidor (database.MarcarPasswordsIgualesAlCI): bcrypt no
+-- se puede comparar desde SQL.
+ALTER TABLE "usuarios" ADD COLUMN IF NOT EXISTS "must_change_password" boolean NOT NULL DEFAULT false;
+ALTER TABLE "usuarios" ADD COLUMN IF NOT EXISTS "password_cambiado_en" timestamptz;
+
+CREATE TABLE IF NOT EXISTS "historial_passwords" (
+    "id" bigserial,
+    "usuario_id" bigint NOT NULL,
+    "password_hash" varchar(255) NOT NULL,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_historial_passwords_usuario_id" ON "historial_passwords" ("usuario_id");
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS "intentos_login";
+ALTER TABLE "usuarios" DROP COLUMN IF EXISTS "bloqueado_hasta";
+ALTER TABLE "usuarios" DROP COLUMN IF EXISTS "ultimo_intento_fallido";
+ALTER TABLE "usuarios" DROP COLUMN IF EXISTS "intentos_fallidos";
@@ -0,0 +1,24 @@
+-- Límite de intentos de login: contadores y bloqueo temporal por usuario
+-- (models.Usuario.IntentosFallidos/UltimoIntentoFallido/BloqueadoHasta) e
+-- historial de intentos (models.IntentoLogin), que también limita los
+-- intentos por IP.
+ALTER TABLE "usuarios" ADD COLUMN IF NOT EXISTS "intentos_fallidos" bigint NOT NULL DEFAULT 0;
+ALTER TABLE "usuarios" ADD COLUMN IF NOT EXISTS "ultimo_intento_fallido" timestamptz;
+ALTER TABLE "usuarios" ADD COLUMN IF NOT EXISTS "bloqueado_hasta" timestamptz;
+
+CREATE TABLE IF NOT EXISTS "intentos_login" (
+    "id" bigserial,
+    "usuario_id" bigint,
+    "codigo_usuario" varchar(50) NOT NULL,
+    "ip" varchar(64) NOT NULL,
+    "user_agent" varchar(255),
+    "resultado" varchar(20) NOT NULL,
+    "motivo" varchar(100),
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_intentos_login_usuario_id" ON "intentos_login" ("usuario_id");
+CREATE INDEX IF NOT EXISTS "idx_intentos_login_codigo_usuario" ON "intentos_login" ("codigo_usuario");
+CREATE INDEX IF NOT EXISTS "idx_intentos_login_ip_fecha" ON "intentos_login" ("ip","created_at");
+CREATE INDEX IF NOT EXISTS "idx_intentos_login_resultado" ON "intentos_login" ("resultado");
+CREATE INDEX IF NOT EXISTS "idx_intentos_login_created_at" ON "intentos_login" ("created_at");
@@ -0,0 +1,20 @@
+-- Sesiones del lado del servidor (models.Sesion): el JWT de acceso lleva el
+-- ID de la sesión y el refresh token rota en cada renovación. Los JWT
+-- emitidos antes de esta versión no tienen sesión y dejan de ser válidos.
+CREATE TABLE IF NOT EXISTS "sesiones" (
+    "id" bigserial,
+    "usuario_id" bigint NOT NULL,
+    "refresh_hash" char(64) NOT NULL,
+    "refresh_hash_anterior" char(64),
+    "ip" varchar(64),
+    "user_agent" varchar(255),
+    "created_at" timestamptz,
+    "renovada_en" timestamptz,
+    "expira_en" timestamptz NOT NULL,
+    "revocada_en" timestamptz,
+    "motivo_revocacion" varchar(50),
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_sesiones_usuario_id" ON "sesiones" ("usuario_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_sesiones_refresh_hash" ON "sesiones" ("refresh_hash");
+CREATE INDEX IF NOT EXISTS "idx_sesiones_refresh_hash_anterior" ON "sesiones" ("refresh_hash_anterior");
@@ -0,0 +1,21 @@
+-- Roles configurables con permisos (models.Rol). usuarios.rol sigue siendo
+-- el nombre del rol. El operador conserva lo que podía hacer antes (todo
+-- menos los módulos de admin, incluidas las conexiones); el auditor es
+-- solo lectura.
+CREATE TABLE IF NOT EXISTS "roles" (
+    "id" bigserial,
+    "nombre" varchar(20) NOT NULL,
+    "descripcion" varchar(255),
+    "permisos" jsonb NOT NULL,
+    "sistema" boolean NOT NULL DEFAULT false,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_roles_nombre" ON "roles" ("nombre");
+
+INSERT INTO "roles" ("nombre", "descripcion", "permisos", "sistema", "created_at", "updated_at") VALUES
+    ('admin', 'Acceso completo', '[]', true, now(), now()),
+    ('operador', 'Importa, envía y anula facturas; consulta', '["consultas.ver", "facturas.ver", "lotes.importar", "facturas.enviar", "facturas.anular", "conexiones.ver", "conexiones.gestionar"]', true, now(), now()),
+    ('auditor', 'Solo lectura', '["consultas.ver", "facturas.ver", "conexiones.ver"]', true, now(), now())
+ON CONFLICT ("nombre") DO NOTHING;
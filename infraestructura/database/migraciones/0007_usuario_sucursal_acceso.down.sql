@@ -0,0 +1,14 @@
+-- Vuelve a la columna de texto con los códigos de los accesos vigentes
+-- (la vigencia se pierde).
+ALTER TABLE "usuarios" ADD COLUMN IF NOT EXISTS "sucursales_permitidas_codigos" text;
+
+UPDATE "usuarios" u SET "sucursales_permitidas_codigos" = COALESCE((
+    SELECT string_agg(sc.codigo_sucursal_sin::text, ',' ORDER BY sc.codigo_sucursal_sin)
+    FROM usuario_sucursal_acceso a
+    JOIN sucursales_catalogo sc ON sc.id = a.sucursal_catalogo_id AND sc.deleted_at IS NULL
+    WHERE a.usuario_id = u.id
+        AND (a.vigente_desde IS NULL OR a.vigente_desde <= now())
+        AND (a.vigente_hasta IS NULL OR a.vigente_hasta > now())
+), '');
+
+DROP TABLE IF EXISTS "usuario_sucursal_acceso";
@@ -0,0 +1,37 @@
+-- Accesos por sucursal normalizados (models.UsuarioSucursalAcceso): una
+-- fila por usuario y sucursal del catálogo, con vigencia opcional. Pasa
+-- los códigos de usuarios.sucursales_permitidas_codigos ("1,6,7") a filas y
+-- borra esa columna. Un código que ya no está en el catálogo (o está
+-- eliminado) no tiene a qué sucursal apuntar y se descarta.
+CREATE TABLE IF NOT EXISTS "usuario_sucursal_acceso" (
+    "id" bigserial,
+    "usuario_id" bigint NOT NULL,
+    "sucursal_catalogo_id" bigint NOT NULL,
+    "vigente_desde" timestamptz,
+    "vigente_hasta" timestamptz,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_usuario_sucursal_acceso_usuario" FOREIGN KEY ("usuario_id") REFERENCES "usuarios"("id") ON DELETE CASCADE,
+    CONSTRAINT "fk_usuario_sucursal_acceso_sucursal_catalogo" FOREIGN KEY ("sucursal_catalogo_id") REFERENCES "sucursales_catalogo"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_usuario_sucursal_acceso_sucursal_catalogo_id" ON "usuario_sucursal_acceso" ("sucursal_catalogo_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_usuario_sucursal_acceso_par" ON "usuario_sucursal_acceso" ("usuario_id","sucursal_catalogo_id");
+
+DO $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_name = 'usuarios' AND column_name = 'sucursales_permitidas_codigos'
+    ) THEN
+        INSERT INTO "usuario_sucursal_acceso" ("usuario_id", "sucursal_catalogo_id", "created_at")
+        SELECT DISTINCT u.id, sc.id, now()
+        FROM usuarios u
+        CROSS JOIN LATERAL regexp_split_to_table(u.sucursales_permitidas_codigos, ',') AS codigo(texto)
+        JOIN sucursales_catalogo sc
+            ON sc.codigo_sucursal_sin::text = btrim(codigo.texto) AND sc.deleted_at IS NULL
+        WHERE btrim(COALESCE(u.sucursales_permitidas_codigos, '')) <> ''
+        ON CONFLICT DO NOTHING;
+
+        ALTER TABLE "usuarios" DROP COLUMN "sucursales_permitidas_codigos";
+    END IF;
+END $$;
@@ -0,0 +1,5 @@
+-- Las cuentas de servicio quedan eliminadas (soft delete): sin la columna
+-- es_servicio pasarían por usuarios comunes.
+DROP TABLE IF EXISTS "api_keys";
+UPDATE "usuarios" SET "is_active" = false, "deleted_at" = now() WHERE "es_servicio" AND "deleted_at" IS NULL;
+ALTER TABLE "usuarios" DROP COLUMN IF EXISTS "es_servicio";
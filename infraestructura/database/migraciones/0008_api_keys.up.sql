@@ -0,0 +1,24 @@
+-- API keys de integraciones (models.ApiKey). Cada key tiene su cuenta de
+-- servicio en usuarios (es_servicio), que es la que ve las sucursales y
+-- figura como autora de lo que hace la key.
+ALTER TABLE "usuarios" ADD COLUMN IF NOT EXISTS "es_servicio" boolean NOT NULL DEFAULT false;
+
+CREATE TABLE IF NOT EXISTS "api_keys" (
+    "id" bigserial,
+    "nombre" varchar(100) NOT NULL,
+    "prefijo" varchar(16) NOT NULL,
+    "hash" char(64) NOT NULL,
+    "usuario_id" bigint NOT NULL,
+    "permisos" jsonb NOT NULL,
+    "expira_en" timestamptz,
+    "ultimo_uso" timestamptz,
+    "ultima_ip" varchar(64),
+    "creada_por_id" bigint,
+    "revocada_en" timestamptz,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_api_keys_usuario" FOREIGN KEY ("usuario_id") REFERENCES "usuarios"("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_api_keys_usuario_id" ON "api_keys" ("usuario_id");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_api_keys_prefijo" ON "api_keys" ("prefijo");
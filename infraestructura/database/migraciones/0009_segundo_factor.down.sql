@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS "codigos_recuperacion";
+ALTER TABLE "roles" DROP COLUMN IF EXISTS "requiere_2fa";
+ALTER TABLE "usuarios" DROP COLUMN IF EXISTS "totp_ultimo_paso";
+ALTER TABLE "usuarios" DROP COLUMN IF EXISTS "totp_activado_en";
+ALTER TABLE "usuarios" DROP COLUMN IF EXISTS "totp_activo";
+ALTER TABLE "usuarios" DROP COLUMN IF EXISTS "totp_secreto";
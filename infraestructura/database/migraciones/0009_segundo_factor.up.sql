@@ -0,0 +1,20 @@
+-- Segundo factor TOTP: secreto cifrado y estado en usuarios, códigos de
+-- recuperación de un solo uso (models.CodigoRecuperacion) y la marca de
+-- roles que lo exigen.
+ALTER TABLE "usuarios" ADD COLUMN IF NOT EXISTS "totp_secreto" text;
+ALTER TABLE "usuarios" ADD COLUMN IF NOT EXISTS "totp_activo" boolean NOT NULL DEFAULT false;
+ALTER TABLE "usuarios" ADD COLUMN IF NOT EXISTS "totp_activado_en" timestamptz;
+ALTER TABLE "usuarios" ADD COLUMN IF NOT EXISTS "totp_ultimo_paso" bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE "roles" ADD COLUMN IF NOT EXISTS "requiere_2fa" boolean NOT NULL DEFAULT false;
+
+CREATE TABLE IF NOT EXISTS "codigos_recuperacion" (
+    "id" bigserial,
+    "usuario_id" bigint NOT NULL,
+    "hash" char(64) NOT NULL,
+    "usado_en" timestamptz,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_codigos_recuperacion_usuario" FOREIGN KEY ("usuario_id") REFERENCES "usuarios"("id") ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS "idx_codigos_recuperacion_usuario_id" ON "codigos_recuperacion" ("usuario_id");
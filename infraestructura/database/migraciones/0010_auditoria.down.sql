@@ -0,0 +1,5 @@
+-- Borra el historial de auditoría completo.
+UPDATE "roles" SET "permisos" = "permisos" - 'auditoria.ver', "updated_at" = now()
+WHERE "permisos" ? 'auditoria.ver';
+DROP TABLE IF EXISTS "auditoria";
+DROP FUNCTION IF EXISTS "auditoria_solo_insercion"();
@@ -0,0 +1,38 @@
+-- Auditoría de acciones administrativas y operativas (models.Auditoria).
+-- Es de solo inserción: el trigger rechaza cualquier UPDATE, DELETE o
+-- TRUNCATE, también desde fuera de la aplicación.
+CREATE TABLE IF NOT EXISTS "auditoria" (
+    "id" bigserial,
+    "usuario_id" bigint,
+    "codigo_usuario" varchar(50),
+    "autor" varchar(100) NOT NULL,
+    "accion" varchar(50) NOT NULL,
+    "entidad" varchar(50) NOT NULL,
+    "entidad_id" varchar(50),
+    "antes" jsonb,
+    "despues" jsonb,
+    "ip" varchar(64),
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_auditoria_created_at" ON "auditoria" ("created_at");
+CREATE INDEX IF NOT EXISTS "idx_auditoria_entidad" ON "auditoria" ("entidad","entidad_id");
+CREATE INDEX IF NOT EXISTS "idx_auditoria_accion" ON "auditoria" ("accion");
+CREATE INDEX IF NOT EXISTS "idx_auditoria_usuario_id" ON "auditoria" ("usuario_id");
+
+CREATE OR REPLACE FUNCTION "auditoria_solo_insercion"() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'la tabla auditoria es de solo inserción';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS "auditoria_solo_insercion" ON "auditoria";
+CREATE TRIGGER "auditoria_solo_insercion" BEFORE UPDATE OR DELETE ON "auditoria"
+    FOR EACH ROW EXECUTE FUNCTION "auditoria_solo_insercion"();
+DROP TRIGGER IF EXISTS "auditoria_sin_truncate" ON "auditoria";
+CREATE TRIGGER "auditoria_sin_truncate" BEFORE TRUNCATE ON "auditoria"
+    FOR EACH STATEMENT EXECUTE FUNCTION "auditoria_solo_insercion"();
+
+-- el rol de solo lectura también consulta la auditoría
+UPDATE "roles" SET "permisos" = "permisos" || '["auditoria.ver"]'::jsonb, "updated_at" = now()
+WHERE "nombre" = 'auditor' AND NOT "permisos" ? 'auditoria.ver';
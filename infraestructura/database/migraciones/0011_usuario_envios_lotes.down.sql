@@ -0,0 +1,3 @@
+ALTER TABLE "logs_envio" DROP COLUMN IF EXISTS "usuario_id";
+ALTER TABLE "facturas_anulacion" DROP COLUMN IF EXISTS "importado_por";
+ALTER TABLE "facturas_prevaloradas" DROP COLUMN IF EXISTS "importado_por";
@@ -0,0 +1,25 @@
+-- Quién importó cada lote (facturas_*.importado_por) y quién disparó cada
+-- envío manual (logs_envio.usuario_id; NULL en los del EnvioWorker).
+ALTER TABLE "facturas_prevaloradas" ADD COLUMN IF NOT EXISTS "importado_por" bigint
+    CONSTRAINT "fk_facturas_prevaloradas_importado_por" REFERENCES "usuarios"("id");
+CREATE INDEX IF NOT EXISTS "idx_facturas_prevaloradas_importado_por" ON "facturas_prevaloradas" ("importado_por");
+
+ALTER TABLE "facturas_anulacion" ADD COLUMN IF NOT EXISTS "importado_por" bigint
+    CONSTRAINT "fk_facturas_anulacion_importado_por" REFERENCES "usuarios"("id");
+CREATE INDEX IF NOT EXISTS "idx_facturas_anulacion_importado_por" ON "facturas_anulacion" ("importado_por");
+
+ALTER TABLE "logs_envio" ADD COLUMN IF NOT EXISTS "usuario_id" bigint
+    CONSTRAINT "fk_logs_envio_usuario" REFERENCES "usuarios"("id");
+CREATE INDEX IF NOT EXISTS "idx_logs_envio_usuario_id" ON "logs_envio" ("usuario_id");
+
+-- Los lotes importados desde la migración 0010 ya tienen su importación en
+-- la auditoría: se completa importado_por con ella. Los anteriores quedan
+-- en NULL.
+UPDATE "facturas_prevaloradas" AS fp SET "importado_por" = a."usuario_id"
+FROM "auditoria" AS a
+WHERE a."entidad" = 'lote_prevalorada' AND a."accion" = 'importar'
+    AND a."entidad_id" = fp."lote_id" AND fp."importado_por" IS NULL;
+UPDATE "facturas_anulacion" AS fa SET "importado_por" = a."usuario_id"
+FROM "auditoria" AS a
+WHERE a."entidad" = 'lote_anulacion' AND a."accion" = 'importar'
+    AND a."entidad_id" = fa."lote_id" AND fa."importado_por" IS NULL;
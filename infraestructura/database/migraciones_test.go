@@ -0,0 +1,54 @@
+package database
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// El baseline sale del DDL de la 0001: mismas tablas, cada columna y foreign
+// key con su guarda, y nada de los modelos actuales.
+func TestEsquemaBaseline(t *testing.T) {
+	migraciones, err := CargarMigraciones()
+	if err != nil {
+		t.Fatalf("CargarMigraciones: %v", err)
+	}
+	inicial := migraciones[0]
+	esquema, err := esquemaBaseline(inicial.Up)
+	if err != nil {
+		t.Fatalf("esquemaBaseline: %v", err)
+	}
+
+	tablas := regexp.MustCompile(`(?m)^CREATE TABLE "\w+"`).FindAllString(inicial.Up, -1)
+	if len(tablas) == 0 {
+		t.Fatal("la migración inicial no tiene tablas")
+	}
+	if n := strings.Count(esquema, "CREATE TABLE IF NOT EXISTS"); n != len(tablas) {
+		t.Errorf("%d CREATE TABLE IF NOT EXISTS, se esperaban %d", n, len(tablas))
+	}
+	if regexp.MustCompile(`(?m)^CREATE TABLE "`).MatchString(esquema) {
+		t.Error("quedó un CREATE TABLE sin IF NOT EXISTS")
+	}
+
+	columnas := regexp.MustCompile(`(?m)^\s+"(\w+)" `).FindAllStringSubmatch(inicial.Up, -1)
+	agregadas := strings.Count(esquema, "ADD COLUMN IF NOT EXISTS")
+	if agregadas != len(columnas)-len(tablas) {
+		t.Errorf("%d ADD COLUMN, se esperaba uno por columna salvo los id (%d)", agregadas, len(columnas)-len(tablas))
+	}
+
+	for _, fk := range regexp.MustCompile(`CONSTRAINT "(\w+)"`).FindAllStringSubmatch(inicial.Up, -1) {
+		if !strings.Contains(esquema, "WHERE conname = '"+fk[1]+"'") {
+			t.Errorf("la foreign key %s no se agrega con guarda", fk[1])
+		}
+	}
+	if strings.Count(esquema, "CREATE INDEX")+strings.Count(esquema, "CREATE UNIQUE INDEX") !=
+		strings.Count(inicial.Up, "CREATE INDEX")+strings.Count(inicial.Up, "CREATE UNIQUE INDEX") {
+		t.Error("el baseline no tiene los mismos índices que la migración inicial")
+	}
+}
+
+func TestEsquemaBaselineSentenciaInesperada(t *testing.T) {
+	if _, err := esquemaBaseline("ALTER TABLE \"usuarios\" ADD COLUMN \"x\" text;\n"); err == nil {
+		t.Error("una sentencia que no es CREATE TABLE ni índice debería fallar")
+	}
+}
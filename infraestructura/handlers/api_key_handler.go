@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"errors"
+	"managerfact/aplication/services"
+	"managerfact/internal/domain/models"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ApiKeyHandler es el ABM de API keys de integraciones, con
+// api_keys.gestionar.
+type ApiKeyHandler struct {
+	service   *services.ApiKeyService
+	auditoria *services.AuditoriaService
+}
+
+func NewApiKeyHandler(service *services.ApiKeyService, auditoria *services.AuditoriaService) *ApiKeyHandler {
+	return &ApiKeyHandler{service: service, auditoria: auditoria}
+}
+
+// auditar registra una acción sobre la key id. La key serializada no lleva
+// el hash y el token en claro nunca se audita.
+func (h *ApiKeyHandler) auditar(c *fiber.Ctx, accion string, id uint, antes, despues *models.ApiKey) {
+	evento := services.EventoAuditoria{Accion: accion, Entidad: models.EntidadApiKey, EntidadID: id}
+	if antes != nil {
+		evento.Antes = antes
+	}
+	if despues != nil {
+		evento.Despues = despues
+	}
+	h.auditoria.Registrar(actorDesdeContexto(c), evento)
+}
+
+// errorApiKey responde 400/403/404 para los errores conocidos de API keys y
+// 500 para el resto.
+func errorApiKey(c *fiber.Ctx, err error, mensaje string) error {
+	status := fiber.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrApiKeyNoEncontrada):
+		status = fiber.StatusNotFound
+	case errors.Is(err, services.ErrApiKeyDatosInvalidos):
+		status = fiber.StatusBadRequest
+	case errors.Is(err, services.ErrApiKeyExcedeCreador):
+		status = fiber.StatusForbidden
+	}
+	return c.Status(status).JSON(fiber.Map{"message": mensaje, "error": err.Error()})
+}
+
+// apiKeyRequest: los accesos son los mismos campos que PUT
+// /usuarios/:id/accesos; expira_en es opcional (RFC 3339, nil = no vence).
+type apiKeyRequest struct {
+	Nombre        string     `json:"nombre"`
+	Permisos      []string   `json:"permisos"`
+	ExpiraEn      *time.Time `json:"expira_en"`
+	AccesoTotal   bool       `json:"acceso_total"`
+	RegionalesIDs []uint     `json:"regionales_ids"`
+	SucursalesIDs []uint     `json:"sucursales_ids"`
+	VigenteDesde  *time.Time `json:"vigente_desde"`
+	VigenteHasta  *time.Time `json:"vigente_hasta"`
+}
+
+func (r apiKeyRequest) input() services.ApiKeyInput {
+	return services.ApiKeyInput{
+		Nombre:   r.Nombre,
+		Permisos: r.Permisos,
+		ExpiraEn: r.ExpiraEn,
+		Accesos: services.AccesosInput{
+			AccesoTotal:   r.AccesoTotal,
+			RegionalesIDs: r.RegionalesIDs,
+			SucursalesIDs: r.SucursalesIDs,
+			VigenteDesde:  r.VigenteDesde,
+			VigenteHasta:  r.VigenteHasta,
+		},
+	}
+}
+
+func (h *ApiKeyHandler) GetAll(c *fiber.Ctx) error {
+	keys, err := h.service.Listar()
+	if err != nil {
+		return errorApiKey(c, err, "Error obteniendo API keys")
+	}
+	return c.JSON(fiber.Map{"message": "API keys obtenidas exitosamente", "data": keys})
+}
+
+// GetByID devuelve la key con sus accesos por sucursal.
+func (h *ApiKeyHandler) GetByID(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID inválido"})
+	}
+	key, accesos, err := h.service.Obtener(uint(id))
+	if err != nil {
+		return errorApiKey(c, err, "Error obteniendo la API key")
+	}
+	return c.JSON(fiber.Map{
+		"message": "API key encontrada",
+		"data": fiber.Map{
+			"api_key":        key,
+			"acceso_total":   key.Usuario.AccesoTotal,
+			"regionales_ids": accesos.RegionalesIDs,
+			"sucursales_ids": accesos.SucursalesIDs,
+			"accesos":        accesos.Accesos,
+		},
+	})
+}
+
+// Create responde el token en claro una única vez; después solo se ve su
+// prefijo.
+func (h *ApiKeyHandler) Create(c *fiber.Ctx) error {
+	usuarioID, ok := usuarioIDDesdeContexto(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Sesión inválida"})
+	}
+	var req apiKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Datos inválidos", "error": err.Error()})
+	}
+	key, token, err := h.service.Crear(req.input(), usuarioID)
+	if err != nil {
+		return errorApiKey(c, err, "Error creando la API key")
+	}
+	h.auditar(c, models.AccionCrear, key.ID, nil, key)
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "API key creada exitosamente (guarda el token: no se vuelve a mostrar)",
+		"data":    fiber.Map{"api_key": key, "token": token},
+	})
+}
+
+func (h *ApiKeyHandler) Update(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID inválido"})
+	}
+	var req apiKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Datos inválidos", "error": err.Error()})
+	}
+	usuarioID, ok := usuarioIDDesdeContexto(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Sesión inválida"})
+	}
+	antes, _, _ := h.service.Obtener(uint(id))
+	key, err := h.service.Actualizar(uint(id), req.input(), usuarioID)
+	if err != nil {
+		return errorApiKey(c, err, "Error actualizando la API key")
+	}
+	h.auditar(c, models.AccionActualizar, key.ID, antes, key)
+	return c.JSON(fiber.Map{"message": "API key actualizada exitosamente", "data": key})
+}
+
+// Revoke revoca la key; deja de servir en la próxima request.
+func (h *ApiKeyHandler) Revoke(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID inválido"})
+	}
+	antes, _, _ := h.service.Obtener(uint(id))
+	if err := h.service.Revocar(uint(id)); err != nil {
+		return errorApiKey(c, err, "Error revocando la API key")
+	}
+	h.auditar(c, models.AccionRevocar, uint(id), antes, nil)
+	return c.JSON(fiber.Map{"message": "API key revocada"})
+}
+
+func (h *ApiKeyHandler) RegisterRoutes(router fiber.Router, requiere func(...string) fiber.Handler) {
+	keys := router.Group("/api-keys", requiere(models.PermisoApiKeysEditar))
+	keys.Get("/", h.GetAll)
+	keys.Get("/:id", h.GetByID)
+	keys.Post("/", h.Create)
+	keys.Put("/:id", h.Update)
+	keys.Delete("/:id", h.Revoke)
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"errors"
+	"managerfact/aplication/services"
+	"managerfact/infraestructura/middleware"
+	"managerfact/internal/domain/models"
+	"managerfact/internal/domain/repositories"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// actorDesdeContexto arma el services.Actor de la request con lo que dejó
+// RequireAuth en Locals.
+func actorDesdeContexto(c *fiber.Ctx) services.Actor {
+	usuarioID, _ := usuarioIDDesdeContexto(c)
+	autor, _ := c.Locals(middleware.AutorLocal).(string)
+	return services.Actor{UsuarioID: usuarioID, Autor: autor, IP: c.IP()}
+}
+
+// AuditoriaHandler consulta y exporta la auditoría, con auditoria.ver.
+type AuditoriaHandler struct {
+	service        *services.AuditoriaService
+	usuarioService *services.UsuarioService
+}
+
+func NewAuditoriaHandler(service *services.AuditoriaService, usuarioService *services.UsuarioService) *AuditoriaHandler {
+	return &AuditoriaHandler{service: service, usuarioService: usuarioService}
+}
+
+// leerFiltroAuditoria lee usuario_id, entidad, entidad_id, accion y
+// fecha_desde/fecha_hasta (YYYY-MM-DD, ambas inclusive).
+func leerFiltroAuditoria(c *fiber.Ctx) repositories.AuditoriaFiltro {
+	filtro := repositories.AuditoriaFiltro{
+		Accion:    c.Query("accion"),
+		Entidad:   c.Query("entidad"),
+		EntidadID: c.Query("entidad_id"),
+	}
+	if usuarioID, err := strconv.ParseUint(c.Query("usuario_id"), 10, 32); err == nil {
+		filtro.UsuarioID = uint(usuarioID)
+	}
+	if desde, err := time.ParseInLocation("2006-01-02", c.Query("fecha_desde"), time.Local); err == nil {
+		filtro.Desde = &desde
+	}
+	if hasta, err := time.ParseInLocation("2006-01-02", c.Query("fecha_hasta"), time.Local); err == nil {
+		hasta = hasta.AddDate(0, 0, 1)
+		filtro.Hasta = &hasta
+	}
+	return filtro
+}
+
+// generadoPor arma "Nombre (codigo_usuario)" para el encabezado de la
+// exportación.
+func (h *AuditoriaHandler) generadoPor(usuarioID uint) string {
+	usuario, err := h.usuarioService.ObtenerPorID(usuarioID)
+	if err != nil {
+		return "usuario " + strconv.FormatUint(uint64(usuarioID), 10)
+	}
+	return usuario.Nombre + " (" + usuario.CodigoUsuario + ")"
+}
+
+// GetAll lista la auditoría paginada (page, page_size hasta 200), lo más
+// reciente primero. Con ?format=xlsx|csv|pdf exporta todo lo filtrado (sin
+// paginar).
+func (h *AuditoriaHandler) GetAll(c *fiber.Ctx) error {
+	usuarioID, ok := usuarioIDDesdeContexto(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Sesión inválida"})
+	}
+	formato, err := services.ParseFormatoExportacion(c.Query("format"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	}
+	filtro := leerFiltroAuditoria(c)
+
+	if formato != "" {
+		archivo, trabajo, err := h.service.Exportar(filtro, formato, usuarioID, h.generadoPor(usuarioID))
+		if errors.Is(err, services.ErrPDFDemasiadasFilas) {
+			return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"message": err.Error()})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Error exportando la auditoría", "error": err.Error()})
+		}
+		return exportar(c, archivo, trabajo)
+	}
+
+	page := c.QueryInt("page", 1)
+	if page < 1 {
+		page = 1
+	}
+	pageSize := c.QueryInt("page_size", 50)
+	if pageSize < 1 || pageSize > 200 {
+		pageSize = 50
+	}
+	pagina, err := h.service.Listar(filtro, page, pageSize)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Error obteniendo la auditoría", "error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "Auditoría obtenida exitosamente", "data": pagina})
+}
+
+func (h *AuditoriaHandler) RegisterRoutes(router fiber.Router, requiere func(...string) fiber.Handler) {
+	router.Get("/auditoria", requiere(models.PermisoAuditoriaVer), h.GetAll)
+}
@@ -3,17 +3,35 @@ package handlers
 import (
 	"errors"
 	"managerfact/aplication/services"
+	"managerfact/infraestructura/middleware"
+	"managerfact/internal/domain/models"
 	"managerfact/pkg/utils"
+	"math"
+	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 type AuthHandler struct {
-	service *services.UsuarioService
+	service   *services.UsuarioService
+	sesiones  *services.SesionService
+	roles     *services.RolService
+	auditoria *services.AuditoriaService
 }
 
-func NewAuthHandler(s *services.UsuarioService) *AuthHandler {
-	return &AuthHandler{service: s}
+func NewAuthHandler(s *services.UsuarioService, sesiones *services.SesionService, roles *services.RolService, auditoria *services.AuditoriaService) *AuthHandler {
+	return &AuthHandler{service: s, sesiones: sesiones, roles: roles, auditoria: auditoria}
+}
+
+// auditarSegundoFactor registra un cambio del usuario sobre su propio
+// segundo factor. No guarda secretos ni códigos.
+func (h *AuthHandler) auditarSegundoFactor(c *fiber.Ctx, accion string, usuarioID uint) {
+	h.auditoria.Registrar(actorDesdeContexto(c), services.EventoAuditoria{
+		Accion:    accion,
+		Entidad:   models.EntidadUsuario,
+		EntidadID: usuarioID,
+	})
 }
 
 type loginRequest struct {
@@ -21,7 +39,12 @@ type loginRequest struct {
 	Password      string `json:"password"`
 }
 
-// Login valida codigo_usuario + password y devuelve un JWT de sesión.
+// Login valida codigo_usuario + password, abre una sesión y devuelve el JWT
+// de acceso (corto) y el refresh token para renovarlo. Si el
+// usuario o la IP superaron el límite de intentos responde 429 con
+// Retry-After (en segundos). Si el usuario tiene segundo factor activo no
+// abre la sesión: responde requiere_2fa con un desafío para POST
+// /auth/login/2fa.
 func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	var req loginRequest
 	if err := c.BodyParser(&req); err != nil {
@@ -31,15 +54,83 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "codigo_usuario y password son requeridos"})
 	}
 
-	usuario, err := h.service.Login(req.CodigoUsuario, req.Password)
+	origen := services.OrigenLogin{IP: c.IP(), UserAgent: c.Get(fiber.HeaderUserAgent)}
+	usuario, err := h.service.Login(req.CodigoUsuario, req.Password, origen)
 	if err != nil {
-		if errors.Is(err, services.ErrCredencialesInvalidas) {
-			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": err.Error()})
+		return errorLogin(c, err)
+	}
+
+	if usuario.TotpActivo {
+		desafio, expira, err := utils.GenerarTokenDesafio2FA(usuario.ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Error iniciando sesión", "error": err.Error()})
 		}
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Error iniciando sesión", "error": err.Error()})
+		return c.JSON(fiber.Map{
+			"message": "Ingresa el código de tu app autenticadora",
+			"data": fiber.Map{
+				"requiere_2fa":      true,
+				"desafio":           desafio,
+				"desafio_expira_en": expira,
+			},
+		})
+	}
+	return h.abrirSesion(c, usuario, origen)
+}
+
+type loginSegundoFactorRequest struct {
+	Desafio string `json:"desafio"`
+	Codigo  string `json:"codigo"`
+}
+
+// LoginSegundoFactor es el segundo paso del login con TOTP: el desafío que
+// devolvió /auth/login más un código de la app o uno de recuperación.
+// Responde lo mismo que /auth/login sin segundo factor.
+func (h *AuthHandler) LoginSegundoFactor(c *fiber.Ctx) error {
+	var req loginSegundoFactorRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Datos inválidos", "error": err.Error()})
+	}
+	if req.Desafio == "" || req.Codigo == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "desafio y codigo son requeridos"})
 	}
+	usuarioID, err := utils.ValidarTokenDesafio2FA(req.Desafio)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Desafío inválido o expirado: vuelve a iniciar sesión", "error": err.Error()})
+	}
+
+	origen := services.OrigenLogin{IP: c.IP(), UserAgent: c.Get(fiber.HeaderUserAgent)}
+	usuario, err := h.service.VerificarSegundoFactor(usuarioID, req.Codigo, origen)
+	if err != nil {
+		return errorLogin(c, err)
+	}
+	return h.abrirSesion(c, usuario, origen)
+}
+
+// errorLogin responde 429 (con Retry-After) si hay que esperar, 401 si las
+// credenciales o el código no corresponden, y 500 para el resto.
+func errorLogin(c *fiber.Ctx, err error) error {
+	var espera *services.EsperaLoginError
+	if errors.As(err, &espera) {
+		segundos := int(math.Ceil(time.Until(espera.Hasta).Seconds()))
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(max(segundos, 1)))
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"message": err.Error(), "reintentar_en": espera.Hasta})
+	}
+	if errors.Is(err, services.ErrCredencialesInvalidas) || errors.Is(err, services.ErrCodigo2FAInvalido) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": err.Error()})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Error iniciando sesión", "error": err.Error()})
+}
 
-	token, err := utils.GenerarTokenJWT(usuario.ID)
+// abrirSesion crea la sesión del usuario ya autenticado y responde los
+// tokens.
+func (h *AuthHandler) abrirSesion(c *fiber.Ctx, usuario *models.Usuario, origen services.OrigenLogin) error {
+	// los permisos van en la respuesta para que el front arme el menú; el
+	// backend igual los verifica en cada ruta
+	permisos, err := h.roles.PermisosDeUsuario(usuario.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Error obteniendo permisos", "error": err.Error()})
+	}
+	tokens, err := h.sesiones.Crear(usuario.ID, origen)
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Error generando la sesión", "error": err.Error()})
 	}
@@ -47,12 +138,248 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{
 		"message": "Login exitoso",
 		"data": fiber.Map{
-			"token":   token,
-			"usuario": usuario,
+			"token":             tokens.Token,
+			"expira_en":         tokens.ExpiraEn,
+			"refresh_token":     tokens.RefreshToken,
+			"refresh_expira_en": tokens.RefreshExpiraEn,
+			"usuario":           usuario,
+			"permisos":          permisos,
 		},
 	})
 }
 
-func (h *AuthHandler) RegisterRoutes(router fiber.Router) {
+type refreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Refresh cambia el refresh token por un JWT de acceso nuevo y otro refresh
+// token (el anterior deja de servir).
+func (h *AuthHandler) Refresh(c *fiber.Ctx) error {
+	var req refreshRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Datos inválidos", "error": err.Error()})
+	}
+	if req.RefreshToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "refresh_token es requerido"})
+	}
+
+	tokens, err := h.sesiones.Renovar(req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, services.ErrSesionInvalida) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Error renovando la sesión", "error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "Sesión renovada", "data": tokens})
+}
+
+type logoutRequest struct {
+	Todas bool `json:"todas"`
+}
+
+// Logout revoca la sesión actual, o todas las del usuario con
+// {"todas": true}.
+func (h *AuthHandler) Logout(c *fiber.Ctx) error {
+	usuarioID, ok := usuarioIDDesdeContexto(c)
+	sesionID, okSesion := c.Locals(middleware.SesionIDLocal).(uint)
+	if !ok || !okSesion {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Sesión inválida"})
+	}
+	var req logoutRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&req); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Datos inválidos", "error": err.Error()})
+		}
+	}
+
+	if req.Todas {
+		cerradas, err := h.sesiones.CerrarTodas(usuarioID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Error cerrando sesiones", "error": err.Error()})
+		}
+		return c.JSON(fiber.Map{"message": "Sesiones cerradas", "data": fiber.Map{"cerradas": cerradas}})
+	}
+	if err := h.sesiones.Cerrar(sesionID); err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Error cerrando sesión", "error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "Sesión cerrada"})
+}
+
+type cambiarPasswordRequest struct {
+	PasswordActual string `json:"password_actual"`
+	PasswordNueva  string `json:"password_nueva"`
+}
+
+// CambiarPassword cambia la contraseña del usuario de la sesión. Es la
+// única ruta con sesión disponible mientras must_change_password está en
+// true.
+func (h *AuthHandler) CambiarPassword(c *fiber.Ctx) error {
+	usuarioID, ok := usuarioIDDesdeContexto(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Sesión inválida"})
+	}
+	var req cambiarPasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Datos inválidos", "error": err.Error()})
+	}
+	if req.PasswordActual == "" || req.PasswordNueva == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "password_actual y password_nueva son requeridos"})
+	}
+
+	err := h.service.CambiarPassword(usuarioID, req.PasswordActual, req.PasswordNueva)
+	switch {
+	case errors.Is(err, services.ErrPasswordActualIncorrecta):
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": err.Error()})
+	case errors.Is(err, services.ErrCuentaServicio):
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": err.Error()})
+	case errors.Is(err, services.ErrPasswordInvalida):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "La contraseña nueva no cumple la política", "error": err.Error()})
+	case err != nil:
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Error cambiando la contraseña", "error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "Contraseña actualizada exitosamente"})
+}
+
+// errorSegundoFactor responde el error de las rutas /auth/2fa: 401 por
+// código o contraseña incorrectos, 403 para cuentas de servicio o si el rol
+// exige el segundo factor, 409 si el estado no permite la operación.
+func errorSegundoFactor(c *fiber.Ctx, err error, mensaje string) error {
+	status := fiber.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrCodigo2FAInvalido), errors.Is(err, services.ErrPasswordActualIncorrecta):
+		status = fiber.StatusUnauthorized
+	case errors.Is(err, services.ErrCuentaServicio), errors.Is(err, services.Err2FAObligatorio):
+		status = fiber.StatusForbidden
+	case errors.Is(err, services.Err2FAYaActivo), errors.Is(err, services.Err2FANoActivo), errors.Is(err, services.Err2FASinIniciar):
+		status = fiber.StatusConflict
+	}
+	return c.Status(status).JSON(fiber.Map{"message": mensaje, "error": err.Error()})
+}
+
+// EstadoSegundoFactor dice si el usuario tiene el segundo factor activo,
+// si su rol lo exige y cuántos códigos de recuperación le quedan.
+func (h *AuthHandler) EstadoSegundoFactor(c *fiber.Ctx) error {
+	usuarioID, ok := usuarioIDDesdeContexto(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Sesión inválida"})
+	}
+	estado, err := h.service.EstadoSegundoFactor(usuarioID)
+	if err != nil {
+		return errorSegundoFactor(c, err, "Error obteniendo el segundo factor")
+	}
+	return c.JSON(fiber.Map{"message": "Estado del segundo factor", "data": estado})
+}
+
+// IniciarSegundoFactor genera el secreto TOTP y devuelve el QR para la app
+// autenticadora. No queda activo hasta confirmarlo con un código.
+func (h *AuthHandler) IniciarSegundoFactor(c *fiber.Ctx) error {
+	usuarioID, ok := usuarioIDDesdeContexto(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Sesión inválida"})
+	}
+	enrolamiento, err := h.service.IniciarSegundoFactor(usuarioID)
+	if err != nil {
+		return errorSegundoFactor(c, err, "Error iniciando el segundo factor")
+	}
+	return c.JSON(fiber.Map{
+		"message": "Escanea el QR con tu app autenticadora y confirma con un código (POST /api/v1/auth/2fa/confirmar)",
+		"data":    enrolamiento,
+	})
+}
+
+type codigoSegundoFactorRequest struct {
+	Codigo string `json:"codigo"`
+}
+
+// ConfirmarSegundoFactor activa el segundo factor y responde los códigos
+// de recuperación, que no se vuelven a mostrar.
+func (h *AuthHandler) ConfirmarSegundoFactor(c *fiber.Ctx) error {
+	usuarioID, ok := usuarioIDDesdeContexto(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Sesión inválida"})
+	}
+	var req codigoSegundoFactorRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Datos inválidos", "error": err.Error()})
+	}
+	if req.Codigo == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "codigo es requerido"})
+	}
+	codigos, err := h.service.ConfirmarSegundoFactor(usuarioID, req.Codigo)
+	if err != nil {
+		return errorSegundoFactor(c, err, "Error confirmando el segundo factor")
+	}
+	h.auditarSegundoFactor(c, models.AccionActivar2FA, usuarioID)
+	return c.JSON(fiber.Map{
+		"message": "Segundo factor activado (guarda los códigos de recuperación: no se vuelven a mostrar)",
+		"data":    fiber.Map{"codigos_recuperacion": codigos},
+	})
+}
+
+// RegenerarCodigosRecuperacion reemplaza los códigos de recuperación; pide
+// un código TOTP vigente.
+func (h *AuthHandler) RegenerarCodigosRecuperacion(c *fiber.Ctx) error {
+	usuarioID, ok := usuarioIDDesdeContexto(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Sesión inválida"})
+	}
+	var req codigoSegundoFactorRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Datos inválidos", "error": err.Error()})
+	}
+	if req.Codigo == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "codigo es requerido"})
+	}
+	codigos, err := h.service.RegenerarCodigosRecuperacion(usuarioID, req.Codigo)
+	if err != nil {
+		return errorSegundoFactor(c, err, "Error regenerando los códigos de recuperación")
+	}
+	h.auditarSegundoFactor(c, models.AccionRegenerarCodigos, usuarioID)
+	return c.JSON(fiber.Map{
+		"message": "Códigos de recuperación regenerados (los anteriores ya no sirven)",
+		"data":    fiber.Map{"codigos_recuperacion": codigos},
+	})
+}
+
+type desactivarSegundoFactorRequest struct {
+	Password string `json:"password"`
+	Codigo   string `json:"codigo"`
+}
+
+// DesactivarSegundoFactor lo quita con la contraseña y un código; no se
+// puede si el rol lo exige.
+func (h *AuthHandler) DesactivarSegundoFactor(c *fiber.Ctx) error {
+	usuarioID, ok := usuarioIDDesdeContexto(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Sesión inválida"})
+	}
+	var req desactivarSegundoFactorRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Datos inválidos", "error": err.Error()})
+	}
+	if req.Password == "" || req.Codigo == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "password y codigo son requeridos"})
+	}
+	if err := h.service.DesactivarSegundoFactor(usuarioID, req.Password, req.Codigo); err != nil {
+		return errorSegundoFactor(c, err, "Error desactivando el segundo factor")
+	}
+	h.auditarSegundoFactor(c, models.AccionDesactivar2FA, usuarioID)
+	return c.JSON(fiber.Map{"message": "Segundo factor desactivado"})
+}
+
+// RegisterRoutes registra login, su segundo paso y refresh (públicos), y
+// logout, cambio de contraseña y segundo factor, que llevan requireAuth
+// propio: se registran antes del grupo protegido para quedar fuera de
+// RequirePasswordVigente y Require2FAConfigurado.
+func (h *AuthHandler) RegisterRoutes(router fiber.Router, requireAuth fiber.Handler) {
 	router.Post("/auth/login", h.Login)
+	router.Post("/auth/login/2fa", h.LoginSegundoFactor)
+	router.Post("/auth/refresh", h.Refresh)
+	router.Post("/auth/logout", requireAuth, h.Logout)
+	router.Post("/auth/change-password", requireAuth, h.CambiarPassword)
+	router.Get("/auth/2fa", requireAuth, h.EstadoSegundoFactor)
+	router.Post("/auth/2fa/iniciar", requireAuth, h.IniciarSegundoFactor)
+	router.Post("/auth/2fa/confirmar", requireAuth, h.ConfirmarSegundoFactor)
+	router.Post("/auth/2fa/codigos-recuperacion", requireAuth, h.RegenerarCodigosRecuperacion)
+	router.Post("/auth/2fa/desactivar", requireAuth, h.DesactivarSegundoFactor)
 }
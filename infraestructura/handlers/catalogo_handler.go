@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"errors"
+	"managerfact/aplication/services"
+	"managerfact/internal/domain/models"
+	"managerfact/pkg/utils"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// CatalogoHandler es el ABM (catalogo.gestionar) de regionales y del
+// catálogo maestro de sucursales. Los listados siguen en UsuarioHandler
+// (GET /regionales, GET /sucursales-catalogo).
+type CatalogoHandler struct {
+	service   *services.CatalogoService
+	auditoria *services.AuditoriaService
+}
+
+func NewCatalogoHandler(service *services.CatalogoService, auditoria *services.AuditoriaService) *CatalogoHandler {
+	return &CatalogoHandler{service: service, auditoria: auditoria}
+}
+
+// auditar registra una acción sobre una regional o sucursal del catálogo.
+// antes y despues llegan ya como any para no guardar un puntero nil con
+// tipo.
+func (h *CatalogoHandler) auditar(c *fiber.Ctx, entidad, accion string, id uint, antes, despues any) {
+	h.auditoria.Registrar(actorDesdeContexto(c), services.EventoAuditoria{
+		Accion:    accion,
+		Entidad:   entidad,
+		EntidadID: id,
+		Antes:     antes,
+		Despues:   despues,
+	})
+}
+
+// regionalAuditada y sucursalAuditada devuelven nil (sin tipo) si no se
+// pudo leer el estado anterior.
+func (h *CatalogoHandler) regionalAuditada(id uint) any {
+	regional, err := h.service.Regional(id)
+	if err != nil {
+		return nil
+	}
+	return regional
+}
+
+func (h *CatalogoHandler) sucursalAuditada(id uint) any {
+	sucursal, err := h.service.Sucursal(id)
+	if err != nil {
+		return nil
+	}
+	return sucursal
+}
+
+// errorCatalogo responde 400/404/409 para los errores conocidos del
+// catálogo y 500 para el resto.
+func errorCatalogo(c *fiber.Ctx, err error, mensaje string) error {
+	status := fiber.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrCatalogoNoEncontrado):
+		status = fiber.StatusNotFound
+	case errors.Is(err, services.ErrCatalogoDuplicado), errors.Is(err, services.ErrRegionalConSucursales):
+		status = fiber.StatusConflict
+	case errors.Is(err, services.ErrDiferenciaInvalida):
+		status = fiber.StatusBadRequest
+	}
+	return c.Status(status).JSON(fiber.Map{"message": mensaje, "error": err.Error()})
+}
+
+type regionalRequest struct {
+	Nombre string `json:"nombre"`
+}
+
+func (h *CatalogoHandler) parsearRegional(c *fiber.Ctx) (*regionalRequest, []string, error) {
+	var req regionalRequest
+	if err := c.BodyParser(&req); err != nil {
+		return nil, nil, err
+	}
+	var errValidacion []string
+	req.Nombre = utils.ValidarCampoRequerido(&errValidacion, req.Nombre, "El campo nombre es requerido")
+	return &req, errValidacion, nil
+}
+
+func (h *CatalogoHandler) CrearRegional(c *fiber.Ctx) error {
+	req, errValidacion, err := h.parsearRegional(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Datos inválidos", "error": err.Error()})
+	}
+	if len(errValidacion) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Datos inválidos", "errors": errValidacion})
+	}
+
+	regional, err := h.service.CrearRegional(req.Nombre)
+	if err != nil {
+		return errorCatalogo(c, err, "Error creando regional")
+	}
+	h.auditar(c, models.EntidadRegional, models.AccionCrear, regional.ID, nil, regional)
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"message": "Regional creada exitosamente", "data": regional})
+}
+
+func (h *CatalogoHandler) RenombrarRegional(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID inválido"})
+	}
+	req, errValidacion, err := h.parsearRegional(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Datos inválidos", "error": err.Error()})
+	}
+	if len(errValidacion) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Datos inválidos", "errors": errValidacion})
+	}
+
+	antes := h.regionalAuditada(uint(id))
+	regional, err := h.service.RenombrarRegional(uint(id), req.Nombre)
+	if err != nil {
+		return errorCatalogo(c, err, "Error actualizando regional")
+	}
+	h.auditar(c, models.EntidadRegional, models.AccionActualizar, regional.ID, antes, regional)
+	return c.JSON(fiber.Map{"message": "Regional actualizada exitosamente", "data": regional})
+}
+
+func (h *CatalogoHandler) EliminarRegional(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID inválido"})
+	}
+	antes := h.regionalAuditada(uint(id))
+	if err := h.service.EliminarRegional(uint(id)); err != nil {
+		return errorCatalogo(c, err, "Error eliminando regional")
+	}
+	h.auditar(c, models.EntidadRegional, models.AccionEliminar, uint(id), antes, nil)
+	return c.JSON(fiber.Map{"message": "Regional eliminada exitosamente"})
+}
+
+type sucursalCatalogoRequest struct {
+	CodigoSucursalSin *int   `json:"codigo_sucursal_sin"`
+	Nombre            string `json:"nombre"`
+	RegionalID        uint   `json:"regional_id"`
+}
+
+func (h *CatalogoHandler) parsearSucursal(c *fiber.Ctx) (*services.SucursalCatalogoInput, []string, error) {
+	var req sucursalCatalogoRequest
+	if err := c.BodyParser(&req); err != nil {
+		return nil, nil, err
+	}
+	var errValidacion []string
+	req.Nombre = utils.ValidarCampoRequerido(&errValidacion, req.Nombre, "El campo nombre es requerido")
+	if req.CodigoSucursalSin == nil || *req.CodigoSucursalSin < 0 {
+		errValidacion = append(errValidacion, "El campo codigo_sucursal_sin es requerido y no puede ser negativo")
+	}
+	if req.RegionalID == 0 {
+		errValidacion = append(errValidacion, "El campo regional_id es requerido")
+	}
+	if len(errValidacion) > 0 {
+		return nil, errValidacion, nil
+	}
+	return &services.SucursalCatalogoInput{
+		CodigoSucursalSin: *req.CodigoSucursalSin,
+		Nombre:            req.Nombre,
+		RegionalID:        req.RegionalID,
+	}, nil, nil
+}
+
+func (h *CatalogoHandler) CrearSucursal(c *fiber.Ctx) error {
+	input, errValidacion, err := h.parsearSucursal(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Datos inválidos", "error": err.Error()})
+	}
+	if len(errValidacion) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Datos inválidos", "errors": errValidacion})
+	}
+
+	resultado, err := h.service.CrearSucursal(*input)
+	if err != nil {
+		return errorCatalogo(c, err, "Error creando sucursal")
+	}
+	h.auditar(c, models.EntidadSucursalCatalogo, models.AccionCrear, resultado.Sucursal.ID, nil, resultado.Sucursal)
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"message": "Sucursal creada exitosamente", "data": resultado.Sucursal})
+}
+
+// ActualizarSucursal renombra, mueve de regional o cambia el código SIN;
+// usuarios_actualizados dice a cuántos usuarios se les corrigió el acceso
+// por el cambio de código.
+func (h *CatalogoHandler) ActualizarSucursal(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID inválido"})
+	}
+	input, errValidacion, err := h.parsearSucursal(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Datos inválidos", "error": err.Error()})
+	}
+	if len(errValidacion) > 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Datos inválidos", "errors": errValidacion})
+	}
+
+	antes := h.sucursalAuditada(uint(id))
+	resultado, err := h.service.ActualizarSucursal(uint(id), *input)
+	if err != nil {
+		return errorCatalogo(c, err, "Error actualizando sucursal")
+	}
+	h.auditar(c, models.EntidadSucursalCatalogo, models.AccionActualizar, uint(id), antes, resultado)
+	return c.JSON(fiber.Map{"message": "Sucursal actualizada exitosamente", "data": resultado})
+}
+
+func (h *CatalogoHandler) EliminarSucursal(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID inválido"})
+	}
+	antes := h.sucursalAuditada(uint(id))
+	resultado, err := h.service.EliminarSucursal(uint(id))
+	if err != nil {
+		return errorCatalogo(c, err, "Error eliminando sucursal")
+	}
+	h.auditar(c, models.EntidadSucursalCatalogo, models.AccionEliminar, uint(id), antes, resultado)
+	return c.JSON(fiber.Map{"message": "Sucursal eliminada exitosamente", "data": resultado})
+}
+
+// RegisterRoutes registra el ABM sobre los mismos prefijos que los
+// listados, todo con catalogo.gestionar.
+func (h *CatalogoHandler) RegisterRoutes(router fiber.Router, requiere func(...string) fiber.Handler) {
+	gestionar := requiere(models.PermisoCatalogoEditar)
+	router.Post("/regionales", gestionar, h.CrearRegional)
+	router.Put("/regionales/:id", gestionar, h.RenombrarRegional)
+	router.Delete("/regionales/:id", gestionar, h.EliminarRegional)
+
+	router.Post("/sucursales-catalogo", gestionar, h.CrearSucursal)
+	router.Put("/sucursales-catalogo/:id", gestionar, h.ActualizarSucursal)
+	router.Delete("/sucursales-catalogo/:id", gestionar, h.EliminarSucursal)
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"errors"
+	"managerfact/aplication/services"
+	"managerfact/internal/domain/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// CifradoHandler expone la rotación de la clave de cifrado de secretos
+// (tokens de sucursales facturador y contraseñas de conexiones). Exige
+// sistema.administrar.
+type CifradoHandler struct {
+	service   *services.CifradoService
+	auditoria *services.AuditoriaService
+}
+
+func NewCifradoHandler(service *services.CifradoService, auditoria *services.AuditoriaService) *CifradoHandler {
+	return &CifradoHandler{service: service, auditoria: auditoria}
+}
+
+// Inventario responde las claves cargadas, cuántos secretos hay cifrados
+// con cada una y el estado del último recifrado.
+func (h *CifradoHandler) Inventario(c *fiber.Ctx) error {
+	inventario, err := h.service.Inventario()
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Error leyendo claves de cifrado", "error": err.Error()})
+	}
+	return c.JSON(fiber.Map{
+		"data": fiber.Map{
+			"inventario": inventario,
+			"recifrado":  h.service.Estado(),
+		},
+	})
+}
+
+// Recifrar arranca el recifrado con la clave actual; el progreso se
+// consulta con GET /admin/cifrado/recifrar.
+func (h *CifradoHandler) Recifrar(c *fiber.Ctx) error {
+	estado, err := h.service.Recifrar()
+	if errors.Is(err, services.ErrRecifradoEnCurso) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": err.Error(), "data": h.service.Estado()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Error iniciando el recifrado", "error": err.Error()})
+	}
+	// se audita el inicio: el resultado queda en GET /admin/cifrado/recifrar
+	h.auditoria.Registrar(actorDesdeContexto(c), services.EventoAuditoria{
+		Accion:    models.AccionRecifrar,
+		Entidad:   models.EntidadClaveCifrado,
+		EntidadID: estado.ClaveActual,
+		Despues:   fiber.Map{"clave_actual": estado.ClaveActual, "total": estado.Total},
+	})
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "Recifrado iniciado",
+		"data":    estado,
+	})
+}
+
+func (h *CifradoHandler) EstadoRecifrado(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"data": h.service.Estado()})
+}
+
+func (h *CifradoHandler) RegisterRoutes(router fiber.Router, requiere func(...string) fiber.Handler) {
+	g := router.Group("/admin/cifrado", requiere(models.PermisoSistemaAdmin))
+	g.Get("/", h.Inventario)
+	g.Post("/recifrar", h.Recifrar)
+	g.Get("/recifrar", h.EstadoRecifrado)
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"managerfact/aplication/services"
+	"managerfact/internal/domain/models"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -28,7 +29,7 @@ func (h *CodigoProductoHandler) GetAll(c *fiber.Ctx) error {
 		"data":    data,
 	})
 }
-func (h *CodigoProductoHandler) RegisterRoutes(router fiber.Router) {
-	connections := router.Group("/codigoproducto")
+func (h *CodigoProductoHandler) RegisterRoutes(router fiber.Router, requiere func(...string) fiber.Handler) {
+	connections := router.Group("/codigoproducto", requiere(models.PermisoConsultasVer))
 	connections.Get("/", h.GetAll)
 }
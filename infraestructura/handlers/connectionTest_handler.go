@@ -9,6 +9,7 @@ import (
 
 // TestConnectionConfig request para probar configuración
 type TestConnectionConfig struct {
+	Driver       string `json:"driver"`
 	Host         string `json:"host"`
 	Port         int    `json:"port"`
 	DatabaseName string `json:"database_name"`
@@ -27,6 +28,7 @@ func TestConnectionByConfig(c *fiber.Ctx) error {
 	}
 
 	config := &models.DbConnection{
+		Driver:       req.Driver,
 		Host:         req.Host,
 		Port:         req.Port,
 		DatabaseName: req.DatabaseName,
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"errors"
+	"managerfact/aplication/services"
+	"managerfact/infraestructura/middleware"
+	"managerfact/internal/domain/models"
+	"managerfact/internal/domain/repositories"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// accesosFijos responde siempre lo mismo a las verificaciones de acceso.
+type accesosFijos struct {
+	total    bool
+	sucursal bool
+}
+
+func (a accesosFijos) TieneAccesoTotal(uint) (bool, error) { return a.total, nil }
+
+func (a accesosFijos) TieneAccesoSucursal(uint, int) (bool, error) { return a.sucursal, nil }
+
+// conexionesContadas cuenta las búsquedas de conexión: es lo primero que
+// hace ConsultasService antes de consultar SQL Server. Los demás métodos
+// del repositorio no se usan y entran en pánico si se llaman.
+type conexionesContadas struct {
+	repositories.DbConnectionRepository
+	busquedas int
+}
+
+func (r *conexionesContadas) GetByID(uint) (*models.DbConnection, error) {
+	r.busquedas++
+	return nil, errors.New("conexión no disponible en el test")
+}
+
+const cuerpoConsulta = `{"idServer": "1", "fechaDesde": "2026-01-01", "fechaHasta": "2026-01-31", "codigoSucursalSin": "5"}`
+
+func consultar(t *testing.T, app *fiber.App) int {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/consultar", strings.NewReader(cuerpoConsulta))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("app.Test: %v", err)
+	}
+	return resp.StatusCode
+}
+
+// Sin usuario en Locals verificarAccesoSucursal responde 401, y el handler
+// tiene que cortar ahí: antes c.JSON devolvía nil al escribir el error y
+// DataFacturas seguía de largo con la consulta.
+func TestDataFacturasCortaSiNoHayAcceso(t *testing.T) {
+	h := &ConsultasHandler{}
+	app := fiber.New()
+	app.Post("/consultar", h.DataFacturas)
+
+	if status := consultar(t, app); status != fiber.StatusUnauthorized {
+		t.Errorf("status = %d, se esperaba 401", status)
+	}
+}
+
+// Un usuario autenticado sin acceso a la sucursal recibe 403 y la consulta
+// no llega a correr.
+func TestDataFacturasSucursalSinAcceso(t *testing.T) {
+	repo := &conexionesContadas{}
+	consultas := services.NewConsultasService(&repositories.ConsutasRepository{}, services.NewConexionesRemotas(repo), nil)
+	h := NewConsultasHandler(consultas, nil)
+	h.accesos = accesosFijos{sucursal: false}
+
+	app := fiber.New()
+	app.Post("/consultar", func(c *fiber.Ctx) error {
+		c.Locals(middleware.UsuarioIDLocal, uint(7))
+		return c.Next()
+	}, h.DataFacturas)
+
+	if status := consultar(t, app); status != fiber.StatusForbidden {
+		t.Errorf("status = %d, se esperaba 403", status)
+	}
+	if repo.busquedas != 0 {
+		t.Errorf("se buscó la conexión %d veces: la consulta corrió sin acceso", repo.busquedas)
+	}
+
+	// control: con acceso sí se llega a buscar la conexión
+	h.accesos = accesosFijos{sucursal: true}
+	consultar(t, app)
+	if repo.busquedas == 0 {
+		t.Error("con acceso no se buscó la conexión: el test no detectaría una consulta sin acceso")
+	}
+}
@@ -1,11 +1,16 @@
 package handlers
 
 import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
 	"managerfact/aplication/services"
 	"managerfact/infraestructura/middleware"
 	"managerfact/internal/domain/models"
 	"managerfact/pkg/utils"
 	"strconv"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
 )
@@ -13,12 +18,20 @@ import (
 type ConsultasHandler struct {
 	services.ConsultasService
 	usuarioService *services.UsuarioService
+	accesos        accesosSucursal
+}
+
+// accesosSucursal es lo que verificarAccesoSucursal usa de UsuarioService.
+type accesosSucursal interface {
+	TieneAccesoTotal(usuarioID uint) (bool, error)
+	TieneAccesoSucursal(usuarioID uint, codigoSucursalSin int) (bool, error)
 }
 
 func NewConsultasHandler(s *services.ConsultasService, usuarioService *services.UsuarioService) *ConsultasHandler {
 	return &ConsultasHandler{
 		ConsultasService: *s,
 		usuarioService:   usuarioService,
+		accesos:          usuarioService,
 	}
 }
 
@@ -26,43 +39,106 @@ func NewConsultasHandler(s *services.ConsultasService, usuarioService *services.
 // puesto en Locals por middleware.RequireAuth) tenga permiso sobre el
 // codigoSucursalSin solicitado. Si viene vacío, solo se permite a usuarios
 // con acceso total — no se puede pedir "todas las sucursales" sin tenerlo.
-// Devuelve nil si el acceso es válido, o la respuesta de error ya escrita.
-func (h *ConsultasHandler) verificarAccesoSucursal(c *fiber.Ctx, codigoSucursalSin string) error {
+// Devuelve true si el acceso es válido; si no, false y la respuesta de error
+// ya escrita (c.JSON devuelve nil al escribir bien, por eso el bool: con
+// solo el error el handler seguía de largo y respondía los datos igual).
+func (h *ConsultasHandler) verificarAccesoSucursal(c *fiber.Ctx, codigoSucursalSin string) (bool, error) {
 	usuarioID, ok := c.Locals(middleware.UsuarioIDLocal).(uint)
 	if !ok {
-		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Sesión inválida"})
+		return false, c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Sesión inválida"})
 	}
 
 	if codigoSucursalSin == "" {
-		tieneAccesoTotal, err := h.usuarioService.TieneAccesoTotal(usuarioID)
+		tieneAccesoTotal, err := h.accesos.TieneAccesoTotal(usuarioID)
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Error verificando accesos", "error": err.Error()})
+			return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Error verificando accesos", "error": err.Error()})
 		}
 		if !tieneAccesoTotal {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Debes indicar una sucursal a la que tengas acceso"})
+			return false, c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Debes indicar una sucursal a la que tengas acceso"})
 		}
-		return nil
+		return true, nil
 	}
 
 	codigo, err := strconv.Atoi(codigoSucursalSin)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "codigoSucursalSin inválido"})
+		return false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "codigoSucursalSin inválido"})
 	}
-	permitido, err := h.usuarioService.TieneAccesoSucursal(usuarioID, codigo)
+	permitido, err := h.accesos.TieneAccesoSucursal(usuarioID, codigo)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Error verificando accesos", "error": err.Error()})
+		return false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Error verificando accesos", "error": err.Error()})
 	}
 	if !permitido {
-		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "No tiene acceso a la sucursal " + codigoSucursalSin})
+		return false, c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "No tiene acceso a la sucursal " + codigoSucursalSin})
 	}
-	return nil
+	return true, nil
 }
 
-func (h *ConsultasHandler) DataFacturas(c *fiber.Ctx) error {
+// exportar responde una exportación de ConsultasService: el archivo como
+// adjunto si se generó en el request, o 202 con el trabajo encolado (y su
+// url de descarga) si era grande.
+func exportar(c *fiber.Ctx, archivo *services.ArchivoExportado, trabajo *services.TrabajoExportacion) error {
+	if trabajo != nil {
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"message": "La exportación es grande y se está generando en segundo plano",
+			"data":    trabajo,
+		})
+	}
+	c.Set(fiber.HeaderContentType, archivo.ContentType)
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+archivo.NombreArchivo+`"`)
+	return c.Send(archivo.Contenido)
+}
+
+// generadoPor arma "Nombre (codigo_usuario)" del usuario autenticado para el
+// encabezado de las exportaciones.
+func (h *ConsultasHandler) generadoPor(usuarioID uint) string {
+	usuario, err := h.usuarioService.ObtenerPorID(usuarioID)
+	if err != nil {
+		return "usuario " + strconv.FormatUint(uint64(usuarioID), 10)
+	}
+	return usuario.Nombre + " (" + usuario.CodigoUsuario + ")"
+}
+
+// errorConsulta responde el error de una consulta remota: 504 si venció el
+// tiempo máximo de la conexión (ver services.ErrConsultaTimeout), 422 si la
+// consulta no corre en el motor de esa conexión, 500 para cualquier otro
+// error.
+func errorConsulta(c *fiber.Ctx, mensaje string, err error) error {
+	if errors.Is(err, services.ErrConsultaTimeout) {
+		return c.Status(fiber.StatusGatewayTimeout).JSON(fiber.Map{
+			"message": "La consulta al servidor remoto tardó demasiado y fue cancelada",
+			"error":   err.Error(),
+		})
+	}
+	if errors.Is(err, services.ErrPDFDemasiadasFilas) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{"message": err.Error()})
+	}
+	if errors.Is(err, services.ErrSinFacturas) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": mensaje,
+			"error":   err.Error(),
+		})
+	}
+	if errors.Is(err, services.ErrConsultaSoloSQLServer) {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"message": mensaje,
+			"error":   err.Error(),
+		})
+	}
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"message": mensaje,
+		"error":   err.Error(),
+	})
+}
+
+// leerConsultaFacturas parsea y valida los filtros (Json_consulta_data) del
+// body y verifica el acceso a la sucursal pedida. Usado por el reporte y por
+// los resúmenes, que aceptan los mismos filtros. Devuelve false con la
+// respuesta de error ya escrita.
+func (h *ConsultasHandler) leerConsultaFacturas(c *fiber.Ctx) (models.Json_consulta_data, bool, error) {
 	var dataIn models.Json_consulta_data
 
 	if err := c.BodyParser(&dataIn); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		return dataIn, false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"message": "Datos inválidos",
 			"error":   err.Error(),
 		})
@@ -92,38 +168,143 @@ func (h *ConsultasHandler) DataFacturas(c *fiber.Ctx) error {
 	}
 
 	if len(errValidacion) > 0 {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+		return dataIn, false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 			"message": "Datos inválidos",
 			"errors":  errValidacion,
 		})
 	}
 
-	if err := h.verificarAccesoSucursal(c, dataIn.CodigoSucursalSin); err != nil {
+	if ok, err := h.verificarAccesoSucursal(c, dataIn.CodigoSucursalSin); !ok {
+		return dataIn, false, err
+	}
+	return dataIn, true, nil
+}
+
+func (h *ConsultasHandler) DataFacturas(c *fiber.Ctx) error {
+	dataIn, ok, err := h.leerConsultaFacturas(c)
+	if !ok {
 		return err
 	}
 
-	data, errDaS := h.ConsultasService.DataFacturas(dataIn)
+	if c.Query("format") == "ndjson" || strings.Contains(c.Get(fiber.HeaderAccept), "application/x-ndjson") {
+		return h.streamFacturas(c, dataIn)
+	}
+	formato, err := services.ParseFormatoExportacion(c.Query("format"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	}
+	if formato != "" {
+		usuarioID, _ := c.Locals(middleware.UsuarioIDLocal).(uint)
+		archivo, trabajo, err := h.ConsultasService.ExportarFacturas(c.Context(), dataIn, formato, usuarioID, h.generadoPor(usuarioID))
+		if err != nil {
+			return errorConsulta(c, "Error de consulta", err)
+		}
+		return exportar(c, archivo, trabajo)
+	}
+
+	limite := 0
+	if limitStr := c.Query("limit"); limitStr != "" {
+		l, err := strconv.Atoi(limitStr)
+		if err != nil || l <= 0 {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "El parámetro limit debe ser un entero positivo"})
+		}
+		limite = l
+	}
+	if _, err := services.DecodificarCursorFacturas(c.Query("cursor")); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Cursor inválido", "error": err.Error()})
+	}
+
+	pagina, errDaS := h.ConsultasService.DataFacturas(c.Context(), dataIn, c.Query("cursor"), limite)
 	if errDaS != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Error de consulta",
-			"error":   errDaS.Error(),
-		})
+		return errorConsulta(c, "Error de consulta", errDaS)
 	}
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"message": "Informacion de factura",
-		"data":    data,
+		"message":    "Informacion de factura",
+		"data":       pagina.Data,
+		"pagination": pagina.PaginacionFacturas,
+	})
+}
+
+// streamFacturas responde el reporte completo como NDJSON (una fila JSON por
+// línea), escribiendo cada fila apenas llega de SQL Server. Los errores de
+// conexión o de la consulta inicial se responden como JSON normal; si la
+// lectura falla a mitad del stream (el status ya se envió), la última línea
+// es {"error": "..."}.
+func (h *ConsultasHandler) streamFacturas(c *fiber.Ctx, dataIn models.Json_consulta_data) error {
+	// El stream se escribe después de que el handler retorna, cuando el
+	// contexto de fasthttp ya no debe usarse: la consulta corre con su propio
+	// contexto (acotado por el QueryTimeout de la conexión) y se cancela en
+	// Cerrar si el cliente corta la descarga (falla la escritura).
+	filas, err := h.ConsultasService.StreamFacturas(context.Background(), dataIn)
+	if err != nil {
+		return errorConsulta(c, "Error de consulta", err)
+	}
+
+	c.Set(fiber.HeaderContentType, "application/x-ndjson")
+	c.Status(fiber.StatusOK).Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer filas.Cerrar()
+
+		encoder := json.NewEncoder(w)
+		var fila models.SFEReporteFacturador
+		for n := 1; ; n++ {
+			ok, err := filas.Siguiente(&fila)
+			if err != nil {
+				encoder.Encode(fiber.Map{"error": err.Error()})
+				w.Flush()
+				return
+			}
+			if !ok {
+				w.Flush()
+				return
+			}
+			if err := encoder.Encode(fila); err != nil {
+				return
+			}
+			// Flush periódico: el cliente va recibiendo filas y, si se
+			// desconectó, el error corta la lectura.
+			if n%200 == 0 {
+				if err := w.Flush(); err != nil {
+					return
+				}
+			}
+		}
+	})
+	return nil
+}
+
+// Resumen devuelve los agregados de facturación (ver
+// ConsultasService.ResumenFacturas). Recibe los mismos filtros que
+// DataFacturas en el body y la agrupación en ?agrupar= (por defecto "mes",
+// el cierre mensual).
+func (h *ConsultasHandler) Resumen(c *fiber.Ctx) error {
+	agrupar := c.Query("agrupar", "mes")
+	if !services.AgrupacionResumenValida(agrupar) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "El parámetro agrupar debe ser dia, mes, sucursal, codigo_producto, tipo_emision o estado",
+		})
+	}
+
+	dataIn, ok, err := h.leerConsultaFacturas(c)
+	if !ok {
+		return err
+	}
+
+	resumen, err := h.ConsultasService.ResumenFacturas(c.Context(), dataIn, agrupar)
+	if err != nil {
+		return errorConsulta(c, "Error de consulta", err)
+	}
+	return c.JSON(fiber.Map{
+		"message": "Resumen de facturación",
+		"data":    resumen,
 	})
 }
 
 func (h *ConsultasHandler) Sucursales(c *fiber.Ctx) error {
 	var idServer = c.Query("idServer")
-	data, err := h.ConsultasService.Sucursales(idServer)
+	data, err := h.ConsultasService.Sucursales(c.Context(), idServer)
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Error de consulta",
-			"error":   err.Error(),
-		})
+		return errorConsulta(c, "Error de consulta", err)
 	}
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"message": "Sucursales registradas",
@@ -132,7 +313,131 @@ func (h *ConsultasHandler) Sucursales(c *fiber.Ctx) error {
 	// return nil
 }
 
+// leerParamsDuas lee y valida los criterios de búsqueda DUAS del query
+// string. Todos son opcionales pero tiene que venir al menos uno (sin
+// ninguno la consulta recorrería TES_FACTURAITINERARIO completa). Devuelve
+// false con la respuesta 400 ya escrita si algo no es válido.
+func leerParamsDuas(c *fiber.Ctx) (models.DuasBusquedaParams, bool, error) {
+	var errValidacion []string
+	params := models.DuasBusquedaParams{
+		Nombre:      utils.ValidarCampoOpcional(&errValidacion, c.Query("nombre")),
+		Apellido:    utils.ValidarCampoOpcional(&errValidacion, c.Query("apellido")),
+		NumeroVuelo: utils.ValidarCampoOpcional(&errValidacion, c.Query("numero_vuelo")),
+		Asiento:     utils.ValidarCodigoOpcional(&errValidacion, c.Query("asiento"), "El campo asiento debe tener hasta 4 caracteres alfanuméricos", 1, 4, false),
+		Ticket:      utils.ValidarCampoOpcional(&errValidacion, c.Query("ticket")),
+		Origen:      utils.ValidarCodigoOpcional(&errValidacion, c.Query("origen"), "El campo origen debe ser un código IATA de 3 letras", 3, 3, true),
+		Destino:     utils.ValidarCodigoOpcional(&errValidacion, c.Query("destino"), "El campo destino debe ser un código IATA de 3 letras", 3, 3, true),
+		PNR:         utils.ValidarCodigoOpcional(&errValidacion, c.Query("pnr"), "El campo pnr debe tener entre 5 y 7 caracteres alfanuméricos", 5, 7, false),
+	}
+	if params.Ticket != "" {
+		if _, err := strconv.ParseUint(params.Ticket, 10, 64); err != nil || len(params.Ticket) > 13 {
+			errValidacion = append(errValidacion, "El campo ticket debe tener hasta 13 dígitos")
+		}
+	}
+
+	desde := utils.ValidarFechaOpcional(&errValidacion, c.Query("fecha_desde"), "El campo fecha_desde debe tener formato AAAA-MM-DD")
+	hasta := utils.ValidarFechaOpcional(&errValidacion, c.Query("fecha_hasta"), "El campo fecha_hasta debe tener formato AAAA-MM-DD")
+	if !desde.IsZero() {
+		params.FechaDesde = desde.Format("2006-01-02")
+	}
+	if !hasta.IsZero() {
+		params.FechaHasta = hasta.Format("2006-01-02")
+	}
+	if !desde.IsZero() && !hasta.IsZero() && hasta.Before(desde) {
+		errValidacion = append(errValidacion, "El campo fecha_hasta no puede ser anterior a fecha_desde")
+	}
+
+	if len(errValidacion) == 0 && params == (models.DuasBusquedaParams{}) {
+		errValidacion = append(errValidacion, "Debe indicar al menos un criterio de búsqueda")
+	}
+	if len(errValidacion) > 0 {
+		return params, false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Datos inválidos",
+			"errors":  errValidacion,
+		})
+	}
+	return params, true, nil
+}
+
+// servidoresPermitidos arma el filtro de conexiones DUAS según los accesos
+// del usuario: todas con acceso total; si no, solo las que tienen
+// codigo_sucursal_sin dentro de sus sucursales permitidas.
+func (h *ConsultasHandler) servidoresPermitidos(usuarioID uint) (func(*models.DbConnection) bool, error) {
+	alcance, err := h.usuarioService.AlcanceSucursales(usuarioID)
+	if err != nil {
+		return nil, err
+	}
+	return func(servidor *models.DbConnection) bool {
+		return alcance.Total || (servidor.CodigoSucursalSin != nil && alcance.Incluye(*servidor.CodigoSucursalSin))
+	}, nil
+}
+
+// BuscarDuasTodos busca en todos los servidores DUAS a los que el usuario
+// tiene acceso. Responde 200 aunque algunos servidores fallen (el detalle va
+// en data.servidores); 502 solo si fallaron todos.
+func (h *ConsultasHandler) BuscarDuasTodos(c *fiber.Ctx) error {
+	usuarioID, ok := c.Locals(middleware.UsuarioIDLocal).(uint)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Sesión inválida"})
+	}
+	permitido, err := h.servidoresPermitidos(usuarioID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Error verificando accesos", "error": err.Error()})
+	}
+
+	params, ok, err := leerParamsDuas(c)
+	if !ok {
+		return err
+	}
+
+	formato, err := services.ParseFormatoExportacion(c.Query("format"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	}
+	if formato != "" {
+		archivo, trabajo, err := h.ConsultasService.ExportarDuasTodos(c.Context(), params, permitido, formato, usuarioID, h.generadoPor(usuarioID))
+		if errors.Is(err, services.ErrSinServidoresDuas) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": err.Error()})
+		}
+		if err != nil {
+			return errorConsulta(c, "Error en consulta DUAS", err)
+		}
+		return exportar(c, archivo, trabajo)
+	}
+
+	data, err := h.ConsultasService.BuscarDuasTodos(c.Context(), params, permitido)
+	if errors.Is(err, services.ErrSinServidoresDuas) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": err.Error()})
+	}
+	if err != nil {
+		return errorConsulta(c, "Error en consulta DUAS", err)
+	}
+
+	fallidos := services.ServidoresConError(data)
+	if fallidos == len(data.Servidores) {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"message": "Ningún servidor DUAS respondió",
+			"data":    data,
+		})
+	}
+	mensaje := "Resultados DUAS obtenidos"
+	if fallidos > 0 {
+		mensaje = "Resultados DUAS parciales: " + strconv.Itoa(fallidos) + " servidor(es) con error"
+	}
+	return c.JSON(fiber.Map{
+		"message": mensaje,
+		"data":    data,
+	})
+}
+
+// BuscarDuas busca en un solo servidor DUAS (idServer), con el mismo
+// control de accesos que BuscarDuasTodos: 403 si el servidor no está entre
+// los permitidos del usuario.
 func (h *ConsultasHandler) BuscarDuas(c *fiber.Ctx) error {
+	usuarioID, ok := c.Locals(middleware.UsuarioIDLocal).(uint)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Sesión inválida"})
+	}
 	idServer := c.Query("idServer")
 	if idServer == "" {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -140,22 +445,38 @@ func (h *ConsultasHandler) BuscarDuas(c *fiber.Ctx) error {
 		})
 	}
 
-	params := models.DuasBusquedaParams{
-		Nombre:      c.Query("nombre"),
-		Apellido:    c.Query("apellido"),
-		NumeroVuelo: c.Query("numero_vuelo"),
-		FechaDesde:  c.Query("fecha_desde"),
-		FechaHasta:  c.Query("fecha_hasta"),
-		Asiento:     c.Query("asiento"),
-		Ticket:      c.Query("ticket"),
+	servidor, err := h.ConsultasService.Servidor(idServer)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Servidor no encontrado", "error": err.Error()})
+	}
+	permitido, err := h.servidoresPermitidos(usuarioID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Error verificando accesos", "error": err.Error()})
+	}
+	if !permitido(servidor) {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "No tiene acceso al servidor " + idServer})
+	}
+
+	params, ok, err := leerParamsDuas(c)
+	if !ok {
+		return err
 	}
 
-	data, err := h.ConsultasService.BuscarDuas(idServer, params)
+	formato, err := services.ParseFormatoExportacion(c.Query("format"))
 	if err != nil {
-		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Error en consulta DUAS",
-			"error":   err.Error(),
-		})
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	}
+	if formato != "" {
+		archivo, trabajo, err := h.ConsultasService.ExportarDuas(c.Context(), idServer, params, formato, usuarioID, h.generadoPor(usuarioID))
+		if err != nil {
+			return errorConsulta(c, "Error en consulta DUAS", err)
+		}
+		return exportar(c, archivo, trabajo)
+	}
+
+	data, err := h.ConsultasService.BuscarDuas(c.Context(), idServer, params)
+	if err != nil {
+		return errorConsulta(c, "Error en consulta DUAS", err)
 	}
 
 	return c.JSON(fiber.Map{
@@ -164,10 +485,12 @@ func (h *ConsultasHandler) BuscarDuas(c *fiber.Ctx) error {
 	})
 }
 
-func (h *ConsultasHandler) RegisterRoutes(router fiber.Router) {
-	connections := router.Group("/consultar")
+func (h *ConsultasHandler) RegisterRoutes(router fiber.Router, requiere func(...string) fiber.Handler) {
+	connections := router.Group("/consultar", requiere(models.PermisoConsultasVer))
 
 	connections.Post("/", h.DataFacturas)
+	connections.Post("/resumen", h.Resumen)
 	connections.Get("/sucursales", h.Sucursales)
 	connections.Get("/duas", h.BuscarDuas)
+	connections.Get("/duas/todos", h.BuscarDuasTodos)
 }
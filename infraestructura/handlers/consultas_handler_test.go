@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"managerfact/aplication/services"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestErrorConsultaStatus(t *testing.T) {
+	casos := []struct {
+		nombre string
+		err    error
+		status int
+	}{
+		{"timeout", fmt.Errorf("%w (context deadline exceeded)", services.ErrConsultaTimeout), fiber.StatusGatewayTimeout},
+		{"motor no soportado", fmt.Errorf("%w (la conexión 'x' usa postgres)", services.ErrConsultaSoloSQLServer), fiber.StatusUnprocessableEntity},
+		{"sin facturas", services.ErrSinFacturas, fiber.StatusNotFound},
+		{"pdf demasiado grande", services.ErrPDFDemasiadasFilas, fiber.StatusUnprocessableEntity},
+		{"otro", errors.New("sintaxis inválida"), fiber.StatusInternalServerError},
+	}
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			app := fiber.New()
+			app.Get("/", func(c *fiber.Ctx) error {
+				return errorConsulta(c, "Error de consulta", caso.err)
+			})
+			resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+			if err != nil {
+				t.Fatalf("app.Test: %v", err)
+			}
+			if resp.StatusCode != caso.status {
+				t.Errorf("status = %d, se esperaba %d", resp.StatusCode, caso.status)
+			}
+		})
+	}
+}
@@ -11,27 +11,49 @@ import (
 
 // DbConnectionHandler maneja las peticiones relacionadas con conexiones de BD
 type DbConnectionHandler struct {
-	service services.DbConnectionService
+	service   services.DbConnectionService
+	auditoria *services.AuditoriaService
 }
 
 // NewDbConnectionHandler crea una nueva instancia del handler
-func NewDbConnectionHandler(service services.DbConnectionService) *DbConnectionHandler {
+func NewDbConnectionHandler(service services.DbConnectionService, auditoria *services.AuditoriaService) *DbConnectionHandler {
 	return &DbConnectionHandler{
-		service: service,
+		service:   service,
+		auditoria: auditoria,
 	}
 }
 
+// auditar registra una acción sobre la conexión id. Antes/después van como
+// dbConnectionResponse: sin la contraseña.
+func (h *DbConnectionHandler) auditar(c *fiber.Ctx, accion string, id uint, antes, despues *models.DbConnection) {
+	evento := services.EventoAuditoria{Accion: accion, Entidad: models.EntidadDbConnection, EntidadID: id}
+	if antes != nil {
+		evento.Antes = nuevaDbConnectionResponse(antes)
+	}
+	if despues != nil {
+		evento.Despues = nuevaDbConnectionResponse(despues)
+	}
+	h.auditoria.Registrar(actorDesdeContexto(c), evento)
+}
+
 // CreateConnectionRequest estructura para crear conexión
 type CreateConnectionRequest struct {
 	ServerName   string `json:"server_name" validate:"required,min=3,max=100"`
 	Host         string `json:"host" validate:"required"`
-	Port         int    `json:"port" validate:"required,min=1,max=65535"`
+	Port         int    `json:"port" validate:"omitempty,min=1,max=65535"`
 	DatabaseName string `json:"database_name" validate:"required,min=1,max=100"`
 	Username     string `json:"username" validate:"required,min=1,max=100"`
 	Password     string `json:"password" validate:"required,min=1"`
 	IsActive     *bool  `json:"is_active,omitempty"`
 	Description  string `json:"description,omitempty"`
 	Type         string `json:"type" validate:"required,min=1,max=50"`
+	// QueryTimeoutSeconds es opcional: 0 usa models.DefaultQueryTimeout.
+	QueryTimeoutSeconds int `json:"query_timeout_seconds,omitempty" validate:"min=0,max=3600"`
+	// CodigoSucursalSin es opcional: sin valor la conexión es nacional.
+	CodigoSucursalSin *int `json:"codigo_sucursal_sin,omitempty"`
+	// Driver es opcional: sqlserver (por defecto), postgres o mysql. Sin
+	// puerto se usa el del motor.
+	Driver string `json:"driver,omitempty" validate:"omitempty,oneof=sqlserver postgres mysql"`
 }
 
 // UpdateConnectionRequest estructura para actualizar conexión
@@ -39,13 +61,54 @@ type UpdateConnectionRequest struct {
 	ID           uint   `json:"id" validate:"required"`
 	ServerName   string `json:"server_name" validate:"required,min=3,max=100"`
 	Host         string `json:"host" validate:"required"`
-	Port         int    `json:"port" validate:"required,min=1,max=65535"`
+	Port         int    `json:"port" validate:"omitempty,min=1,max=65535"`
 	DatabaseName string `json:"database_name" validate:"required,min=1,max=100"`
 	Username     string `json:"username" validate:"required,min=1,max=100"`
-	Password     string `json:"password" validate:"required,min=1"`
-	IsActive     *bool  `json:"is_active,omitempty"`
-	Description  string `json:"description,omitempty"`
-	Type         string `json:"type" validate:"required,min=1,max=50"`
+	// Password vacío significa "no cambiar la contraseña guardada" (el GET
+	// nunca la devuelve, así que el front no puede reenviarla).
+	Password    string `json:"password,omitempty"`
+	IsActive    *bool  `json:"is_active,omitempty"`
+	Description string `json:"description,omitempty"`
+	Type        string `json:"type" validate:"required,min=1,max=50"`
+	// QueryTimeoutSeconds es opcional: 0 usa models.DefaultQueryTimeout.
+	QueryTimeoutSeconds int `json:"query_timeout_seconds,omitempty" validate:"min=0,max=3600"`
+	// CodigoSucursalSin es opcional: sin valor la conexión es nacional.
+	CodigoSucursalSin *int `json:"codigo_sucursal_sin,omitempty"`
+	// Driver es opcional: sqlserver (por defecto), postgres o mysql. Sin
+	// puerto se usa el del motor.
+	Driver string `json:"driver,omitempty" validate:"omitempty,oneof=sqlserver postgres mysql"`
+}
+
+// dbConnectionResponse envuelve el modelo sin exponer nunca la contraseña
+// (ni cifrada ni en claro), indicando solo si ya hay una configurada.
+type dbConnectionResponse struct {
+	models.DbConnection
+	PasswordConfigurado bool `json:"password_configurado"`
+}
+
+func nuevaDbConnectionResponse(connection *models.DbConnection) dbConnectionResponse {
+	return dbConnectionResponse{
+		DbConnection:        *connection,
+		PasswordConfigurado: connection.Password != "",
+	}
+}
+
+func nuevasDbConnectionResponse(connections []models.DbConnection) []dbConnectionResponse {
+	respuestas := make([]dbConnectionResponse, 0, len(connections))
+	for i := range connections {
+		respuestas = append(respuestas, nuevaDbConnectionResponse(&connections[i]))
+	}
+	return respuestas
+}
+
+// dbConnectionsPaginadasResponse es services.PaginatedResponse con las
+// conexiones envueltas en dbConnectionResponse.
+type dbConnectionsPaginadasResponse struct {
+	Data       []dbConnectionResponse `json:"data"`
+	Total      int64                  `json:"total"`
+	Page       int                    `json:"page"`
+	PageSize   int                    `json:"page_size"`
+	TotalPages int                    `json:"total_pages"`
 }
 
 // APIResponse estructura estándar de respuesta
@@ -69,15 +132,18 @@ func (h *DbConnectionHandler) CreateConnection(c *fiber.Ctx) error {
 
 	// Convertir request a modelo
 	connection := &models.DbConnection{
-		ServerName:   req.ServerName,
-		Host:         req.Host,
-		Port:         req.Port,
-		DatabaseName: req.DatabaseName,
-		Username:     req.Username,
-		Password:     req.Password,
-		IsActive:     true, // Por defecto activa
-		Description:  req.Description,
-		Type:         req.Type,
+		ServerName:          req.ServerName,
+		Host:                req.Host,
+		Port:                req.Port,
+		DatabaseName:        req.DatabaseName,
+		Username:            req.Username,
+		Password:            req.Password,
+		IsActive:            true, // Por defecto activa
+		Description:         req.Description,
+		Type:                req.Type,
+		Driver:              req.Driver,
+		QueryTimeoutSeconds: req.QueryTimeoutSeconds,
+		CodigoSucursalSin:   req.CodigoSucursalSin,
 	}
 
 	// Si se especifica is_active, usar ese valor
@@ -93,11 +159,12 @@ func (h *DbConnectionHandler) CreateConnection(c *fiber.Ctx) error {
 			Error:   err.Error(),
 		})
 	}
+	h.auditar(c, models.AccionCrear, connection.ID, nil, connection)
 
 	return c.Status(fiber.StatusCreated).JSON(APIResponse{
 		Success: true,
 		Message: "Conexión creada exitosamente",
-		Data:    connection,
+		Data:    nuevaDbConnectionResponse(connection),
 	})
 }
 
@@ -125,7 +192,7 @@ func (h *DbConnectionHandler) GetConnection(c *fiber.Ctx) error {
 	return c.JSON(APIResponse{
 		Success: true,
 		Message: "Conexión encontrada",
-		Data:    connection,
+		Data:    nuevaDbConnectionResponse(connection),
 	})
 }
 
@@ -157,7 +224,7 @@ func (h *DbConnectionHandler) GetAllConnections(c *fiber.Ctx) error {
 	return c.JSON(APIResponse{
 		Success: true,
 		Message: "Conexiones obtenidas exitosamente",
-		Data:    connections,
+		Data:    nuevasDbConnectionResponse(connections),
 	})
 }
 
@@ -190,7 +257,13 @@ func (h *DbConnectionHandler) GetConnectionsPaginated(c *fiber.Ctx) error {
 	return c.JSON(APIResponse{
 		Success: true,
 		Message: "Conexiones obtenidas exitosamente",
-		Data:    result,
+		Data: dbConnectionsPaginadasResponse{
+			Data:       nuevasDbConnectionResponse(result.Data),
+			Total:      result.Total,
+			Page:       result.Page,
+			PageSize:   result.PageSize,
+			TotalPages: result.TotalPages,
+		},
 	})
 }
 
@@ -225,16 +298,19 @@ func (h *DbConnectionHandler) UpdateConnection(c *fiber.Ctx) error {
 
 	// Convertir request a modelo
 	connection := &models.DbConnection{
-		ID:           req.ID,
-		ServerName:   req.ServerName,
-		Host:         req.Host,
-		Port:         req.Port,
-		DatabaseName: req.DatabaseName,
-		Username:     req.Username,
-		Password:     req.Password,
-		IsActive:     true, // Por defecto activa
-		Description:  req.Description,
-		Type:         req.Type,
+		ID:                  req.ID,
+		ServerName:          req.ServerName,
+		Host:                req.Host,
+		Port:                req.Port,
+		DatabaseName:        req.DatabaseName,
+		Username:            req.Username,
+		Password:            req.Password,
+		IsActive:            true, // Por defecto activa
+		Description:         req.Description,
+		Type:                req.Type,
+		Driver:              req.Driver,
+		QueryTimeoutSeconds: req.QueryTimeoutSeconds,
+		CodigoSucursalSin:   req.CodigoSucursalSin,
 	}
 
 	// Si se especifica is_active, usar ese valor
@@ -243,6 +319,7 @@ func (h *DbConnectionHandler) UpdateConnection(c *fiber.Ctx) error {
 	}
 
 	// Actualizar conexión usando el servicio
+	antes, _ := h.service.GetConnection(uint(id))
 	if err := h.service.UpdateConnection(connection); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(APIResponse{
 			Success: false,
@@ -250,11 +327,12 @@ func (h *DbConnectionHandler) UpdateConnection(c *fiber.Ctx) error {
 			Error:   err.Error(),
 		})
 	}
+	h.auditar(c, models.AccionActualizar, connection.ID, antes, connection)
 
 	return c.JSON(APIResponse{
 		Success: true,
 		Message: "Conexión actualizada exitosamente",
-		Data:    connection,
+		Data:    nuevaDbConnectionResponse(connection),
 	})
 }
 
@@ -270,6 +348,7 @@ func (h *DbConnectionHandler) DeleteConnection(c *fiber.Ctx) error {
 		})
 	}
 
+	antes, _ := h.service.GetConnection(uint(id))
 	if err := h.service.DeleteConnection(uint(id)); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(APIResponse{
 			Success: false,
@@ -277,6 +356,7 @@ func (h *DbConnectionHandler) DeleteConnection(c *fiber.Ctx) error {
 			Error:   err.Error(),
 		})
 	}
+	h.auditar(c, models.AccionEliminar, uint(id), antes, nil)
 
 	return c.JSON(APIResponse{
 		Success: true,
@@ -296,6 +376,7 @@ func (h *DbConnectionHandler) SoftDeleteConnection(c *fiber.Ctx) error {
 		})
 	}
 
+	antes, _ := h.service.GetConnection(uint(id))
 	if err := h.service.SoftDeleteConnection(uint(id)); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(APIResponse{
 			Success: false,
@@ -303,6 +384,8 @@ func (h *DbConnectionHandler) SoftDeleteConnection(c *fiber.Ctx) error {
 			Error:   err.Error(),
 		})
 	}
+	despues, _ := h.service.GetConnection(uint(id))
+	h.auditar(c, models.AccionDesactivar, uint(id), antes, despues)
 
 	return c.JSON(APIResponse{
 		Success: true,
@@ -364,6 +447,7 @@ func (h *DbConnectionHandler) TestConnectionByConfig(c *fiber.Ctx) error {
 		Password:     req.Password,
 		IsActive:     true,
 		Description:  req.Description,
+		Driver:       req.Driver,
 	}
 
 	result, err := h.service.TestConnectionByConfig(connection)
@@ -411,6 +495,7 @@ func (h *DbConnectionHandler) GetConnectionsStats(c *fiber.Ctx) error {
 		"total_connections":    total,
 		"active_connections":   len(activeConnections),
 		"inactive_connections": total - int64(len(activeConnections)),
+		"pools":                h.service.PoolStats(),
 	}
 
 	return c.JSON(APIResponse{
@@ -420,18 +505,22 @@ func (h *DbConnectionHandler) GetConnectionsStats(c *fiber.Ctx) error {
 	})
 }
 
-// RegisterRoutes registra todas las rutas del handler
-func (h *DbConnectionHandler) RegisterRoutes(router fiber.Router) {
+// RegisterRoutes registra todas las rutas del handler: las de lectura con
+// conexiones.ver y las que crean, modifican o prueban con
+// conexiones.gestionar.
+func (h *DbConnectionHandler) RegisterRoutes(router fiber.Router, requiere func(...string) fiber.Handler) {
 	connections := router.Group("/connections")
-
-	connections.Post("/", h.CreateConnection)
-	connections.Get("/", h.GetAllConnections)
-	connections.Get("/paginated", h.GetConnectionsPaginated)
-	connections.Get("/stats", h.GetConnectionsStats)
-	connections.Get("/:id", h.GetConnection)
-	connections.Put("/:id", h.UpdateConnection)
-	connections.Delete("/:id", h.DeleteConnection)
-	connections.Patch("/:id/soft-delete", h.SoftDeleteConnection)
-	connections.Post("/:id/test", h.TestConnection)
-	connections.Post("/test", h.TestConnectionByConfig)
+	ver := requiere(models.PermisoConexionesVer, models.PermisoConexionesEditar)
+	gestionar := requiere(models.PermisoConexionesEditar)
+
+	connections.Post("/", gestionar, h.CreateConnection)
+	connections.Get("/", ver, h.GetAllConnections)
+	connections.Get("/paginated", ver, h.GetConnectionsPaginated)
+	connections.Get("/stats", ver, h.GetConnectionsStats)
+	connections.Get("/:id", ver, h.GetConnection)
+	connections.Put("/:id", gestionar, h.UpdateConnection)
+	connections.Delete("/:id", gestionar, h.DeleteConnection)
+	connections.Patch("/:id/soft-delete", gestionar, h.SoftDeleteConnection)
+	connections.Post("/:id/test", gestionar, h.TestConnection)
+	connections.Post("/test", gestionar, h.TestConnectionByConfig)
 }
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"errors"
+	"managerfact/aplication/services"
+	"managerfact/infraestructura/middleware"
+	"managerfact/internal/domain/models"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// ExportacionesHandler expone el estado y la descarga de las exportaciones
+// grandes que ConsultasService encola en segundo plano. Cada usuario solo ve
+// sus propios trabajos.
+type ExportacionesHandler struct {
+	service *services.ExportacionesService
+}
+
+func NewExportacionesHandler(service *services.ExportacionesService) *ExportacionesHandler {
+	return &ExportacionesHandler{service: service}
+}
+
+func (h *ExportacionesHandler) Estado(c *fiber.Ctx) error {
+	usuarioID, _ := c.Locals(middleware.UsuarioIDLocal).(uint)
+	trabajo, err := h.service.Obtener(c.Params("id"), usuarioID)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": err.Error()})
+	}
+	return c.JSON(fiber.Map{"data": trabajo})
+}
+
+func (h *ExportacionesHandler) Descargar(c *fiber.Ctx) error {
+	usuarioID, _ := c.Locals(middleware.UsuarioIDLocal).(uint)
+	ruta, trabajo, err := h.service.RutaArchivo(c.Params("id"), usuarioID)
+	if errors.Is(err, services.ErrExportacionNoEncontrada) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": err.Error(), "data": trabajo})
+	}
+	c.Set(fiber.HeaderContentType, trabajo.Formato.ContentType())
+	return c.Download(ruta, trabajo.NombreArchivo)
+}
+
+func (h *ExportacionesHandler) RegisterRoutes(router fiber.Router, requiere func(...string) fiber.Handler) {
+	g := router.Group("/exportaciones", requiere(models.PermisoConsultasVer))
+	g.Get("/:id", h.Estado)
+	g.Get("/:id/descargar", h.Descargar)
+}
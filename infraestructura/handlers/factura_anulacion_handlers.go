@@ -3,6 +3,7 @@ package handlers
 import (
 	"errors"
 	"managerfact/aplication/services"
+	"managerfact/internal/domain/models"
 	"strconv"
 	"strings"
 
@@ -10,11 +11,12 @@ import (
 )
 
 type FacturaAnulacionHandler struct {
-	service *services.FacturaAnulacionService
+	service   *services.FacturaAnulacionService
+	auditoria *services.AuditoriaService
 }
 
-func NewFacturaAnulacionHandler(s *services.FacturaAnulacionService) *FacturaAnulacionHandler {
-	return &FacturaAnulacionHandler{service: s}
+func NewFacturaAnulacionHandler(s *services.FacturaAnulacionService, auditoria *services.AuditoriaService) *FacturaAnulacionHandler {
+	return &FacturaAnulacionHandler{service: s, auditoria: auditoria}
 }
 
 // ImportarExcel recibe el archivo .xlsx de anulaciones (multipart, campo
@@ -54,6 +56,9 @@ func (h *FacturaAnulacionHandler) ImportarExcel(c *fiber.Ctx) error {
 		}
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Error importando el Excel", "error": err.Error()})
 	}
+	h.auditoria.Registrar(actorDesdeContexto(c), services.EventoAuditoria{
+		Accion: models.AccionImportar, Entidad: models.EntidadLoteAnulacion, EntidadID: resultado.LoteID, Despues: resultado,
+	})
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"message": "Importación procesada",
@@ -78,16 +83,18 @@ func (h *FacturaAnulacionHandler) GetAll(c *fiber.Ctx) error {
 }
 
 // GetLotes lista el registro de lotes de importación de anulaciones: con qué
-// sucursal facturador y observación se cargó cada uno, y el desglose de
-// estados de envío. Solo incluye lotes de sucursales permitidas para el
-// usuario autenticado.
+// sucursal facturador y observación se cargó cada uno, quién lo importó y
+// el desglose de estados de envío. Solo incluye lotes de sucursales
+// permitidas para el usuario autenticado; ?importado_por=<usuario_id> deja
+// los de ese usuario.
 func (h *FacturaAnulacionHandler) GetLotes(c *fiber.Ctx) error {
 	usuarioID, ok := usuarioIDDesdeContexto(c)
 	if !ok {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Sesión inválida"})
 	}
 
-	lotes, err := h.service.ListarLotes(usuarioID)
+	importadoPor, _ := strconv.ParseUint(c.Query("importado_por"), 10, 32)
+	lotes, err := h.service.ListarLotes(usuarioID, uint(importadoPor))
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Error obteniendo lotes", "error": err.Error()})
 	}
@@ -149,7 +156,13 @@ func (h *FacturaAnulacionHandler) Anular(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Factura de anulación no encontrada", "error": err.Error()})
 	}
 
-	factura, err := h.service.Anular(uint(id), "manual")
+	factura, err := h.service.Anular(uint(id), "manual", usuarioID)
+	if factura != nil {
+		// se audita también el intento fallido: quedó guardado igual
+		h.auditoria.Registrar(actorDesdeContexto(c), services.EventoAuditoria{
+			Accion: models.AccionAnular, Entidad: models.EntidadFacturaAnulacion, EntidadID: factura.ID, Despues: factura,
+		})
+	}
 	if err != nil {
 		if errors.Is(err, services.ErrAnulacionYaAceptada) {
 			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": err.Error()})
@@ -164,12 +177,13 @@ func (h *FacturaAnulacionHandler) Anular(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"message": "Anulación enviada al facturador", "data": factura})
 }
 
-func (h *FacturaAnulacionHandler) RegisterRoutes(router fiber.Router) {
+func (h *FacturaAnulacionHandler) RegisterRoutes(router fiber.Router, requiere func(...string) fiber.Handler) {
 	facturas := router.Group("/facturas-anulacion")
-	facturas.Post("/importar-excel", h.ImportarExcel)
-	facturas.Post("/:id/anular", h.Anular)
-	facturas.Get("/plantilla", h.DescargarPlantilla)
-	facturas.Get("/lotes", h.GetLotes)
-	facturas.Get("/", h.GetAll)
-	facturas.Get("/:id", h.GetByID)
+	ver := requiere(models.PermisoFacturasVer)
+	facturas.Post("/importar-excel", requiere(models.PermisoLotesImportar), h.ImportarExcel)
+	facturas.Post("/:id/anular", requiere(models.PermisoFacturasAnular), h.Anular)
+	facturas.Get("/plantilla", requiere(models.PermisoLotesImportar), h.DescargarPlantilla)
+	facturas.Get("/lotes", ver, h.GetLotes)
+	facturas.Get("/", ver, h.GetAll)
+	facturas.Get("/:id", ver, h.GetByID)
 }
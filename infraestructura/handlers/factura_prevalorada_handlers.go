@@ -4,6 +4,7 @@ import (
 	"errors"
 	"managerfact/aplication/services"
 	"managerfact/infraestructura/middleware"
+	"managerfact/internal/domain/models"
 	"strconv"
 	"strings"
 
@@ -11,11 +12,12 @@ import (
 )
 
 type FacturaPrevaloradaHandler struct {
-	service *services.FacturaPrevaloradaService
+	service   *services.FacturaPrevaloradaService
+	auditoria *services.AuditoriaService
 }
 
-func NewFacturaPrevaloradaHandler(s *services.FacturaPrevaloradaService) *FacturaPrevaloradaHandler {
-	return &FacturaPrevaloradaHandler{service: s}
+func NewFacturaPrevaloradaHandler(s *services.FacturaPrevaloradaService, auditoria *services.AuditoriaService) *FacturaPrevaloradaHandler {
+	return &FacturaPrevaloradaHandler{service: s, auditoria: auditoria}
 }
 
 // usuarioIDDesdeContexto obtiene el usuario_id puesto en Locals por
@@ -62,6 +64,9 @@ func (h *FacturaPrevaloradaHandler) ImportarExcel(c *fiber.Ctx) error {
 		}
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Error importando el Excel", "error": err.Error()})
 	}
+	h.auditoria.Registrar(actorDesdeContexto(c), services.EventoAuditoria{
+		Accion: models.AccionImportar, Entidad: models.EntidadLotePrevalorada, EntidadID: resultado.LoteID, Despues: resultado,
+	})
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"message": "Importación procesada",
@@ -86,15 +91,17 @@ func (h *FacturaPrevaloradaHandler) GetAll(c *fiber.Ctx) error {
 }
 
 // GetLotes lista el registro de lotes de importación: con qué sucursal
-// facturador y tipo se cargó cada uno, y el desglose de estados de envío.
-// Solo incluye lotes de sucursales permitidas para el usuario autenticado.
+// facturador y tipo se cargó cada uno, quién lo importó y el desglose de
+// estados de envío. Solo incluye lotes de sucursales permitidas para el
+// usuario autenticado; ?importado_por=<usuario_id> deja los de ese usuario.
 func (h *FacturaPrevaloradaHandler) GetLotes(c *fiber.Ctx) error {
 	usuarioID, ok := usuarioIDDesdeContexto(c)
 	if !ok {
 		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Sesión inválida"})
 	}
 
-	lotes, err := h.service.ListarLotes(usuarioID)
+	importadoPor, _ := strconv.ParseUint(c.Query("importado_por"), 10, 32)
+	lotes, err := h.service.ListarLotes(usuarioID, uint(importadoPor))
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Error obteniendo lotes", "error": err.Error()})
 	}
@@ -156,7 +163,13 @@ func (h *FacturaPrevaloradaHandler) Facturar(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Factura prevalorada no encontrada", "error": err.Error()})
 	}
 
-	factura, err := h.service.Facturar(uint(id), "manual")
+	factura, err := h.service.Facturar(uint(id), "manual", usuarioID)
+	if factura != nil {
+		// se audita también el intento fallido: quedó guardado igual
+		h.auditoria.Registrar(actorDesdeContexto(c), services.EventoAuditoria{
+			Accion: models.AccionFacturar, Entidad: models.EntidadFacturaPrevalorada, EntidadID: factura.ID, Despues: factura,
+		})
+	}
 	if err != nil {
 		if errors.Is(err, services.ErrFacturaYaAceptada) {
 			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": err.Error()})
@@ -171,12 +184,13 @@ func (h *FacturaPrevaloradaHandler) Facturar(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"message": "Factura enviada al facturador", "data": factura})
 }
 
-func (h *FacturaPrevaloradaHandler) RegisterRoutes(router fiber.Router) {
+func (h *FacturaPrevaloradaHandler) RegisterRoutes(router fiber.Router, requiere func(...string) fiber.Handler) {
 	facturas := router.Group("/facturas-prevaloradas")
-	facturas.Post("/importar-excel", h.ImportarExcel)
-	facturas.Post("/:id/facturar", h.Facturar)
-	facturas.Get("/plantilla", h.DescargarPlantilla)
-	facturas.Get("/lotes", h.GetLotes)
-	facturas.Get("/", h.GetAll)
-	facturas.Get("/:id", h.GetByID)
+	ver := requiere(models.PermisoFacturasVer)
+	facturas.Post("/importar-excel", requiere(models.PermisoLotesImportar), h.ImportarExcel)
+	facturas.Post("/:id/facturar", requiere(models.PermisoFacturasEnviar), h.Facturar)
+	facturas.Get("/plantilla", requiere(models.PermisoLotesImportar), h.DescargarPlantilla)
+	facturas.Get("/lotes", ver, h.GetLotes)
+	facturas.Get("/", ver, h.GetAll)
+	facturas.Get("/:id", ver, h.GetByID)
 }
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"managerfact/internal/domain/models"
 	"managerfact/internal/domain/repositories"
 	"strconv"
 
@@ -27,6 +28,9 @@ func (h *LogEnvioHandler) GetAll(c *fiber.Ctx) error {
 	if sucursalID, err := strconv.ParseUint(c.Query("sucursal_facturador_id"), 10, 32); err == nil {
 		filtro.SucursalFacturadorID = uint(sucursalID)
 	}
+	if usuarioID, err := strconv.ParseUint(c.Query("usuario_id"), 10, 32); err == nil {
+		filtro.UsuarioID = uint(usuarioID)
+	}
 	if limit, err := strconv.Atoi(c.Query("limit")); err == nil {
 		filtro.Limit = limit
 	}
@@ -38,6 +42,6 @@ func (h *LogEnvioHandler) GetAll(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"message": "Logs de envío obtenidos exitosamente", "data": logs})
 }
 
-func (h *LogEnvioHandler) RegisterRoutes(router fiber.Router) {
-	router.Get("/logs-envio", h.GetAll)
+func (h *LogEnvioHandler) RegisterRoutes(router fiber.Router, requiere func(...string) fiber.Handler) {
+	router.Get("/logs-envio", requiere(models.PermisoFacturasVer), h.GetAll)
 }
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"errors"
+	"managerfact/aplication/services"
+	"managerfact/internal/domain/models"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// RolHandler es el ABM de roles y el catálogo de permisos, con
+// usuarios.gestionar.
+type RolHandler struct {
+	service   *services.RolService
+	auditoria *services.AuditoriaService
+}
+
+func NewRolHandler(service *services.RolService, auditoria *services.AuditoriaService) *RolHandler {
+	return &RolHandler{service: service, auditoria: auditoria}
+}
+
+func (h *RolHandler) auditar(c *fiber.Ctx, accion string, id uint, antes, despues *models.Rol) {
+	evento := services.EventoAuditoria{Accion: accion, Entidad: models.EntidadRol, EntidadID: id}
+	if antes != nil {
+		evento.Antes = antes
+	}
+	if despues != nil {
+		evento.Despues = despues
+	}
+	h.auditoria.Registrar(actorDesdeContexto(c), evento)
+}
+
+// errorRol responde 400/403/404/409 para los errores conocidos de roles y
+// 500 para el resto.
+func errorRol(c *fiber.Ctx, err error, mensaje string) error {
+	status := fiber.StatusInternalServerError
+	switch {
+	case errors.Is(err, services.ErrRolNoEncontrado):
+		status = fiber.StatusNotFound
+	case errors.Is(err, services.ErrRolDuplicado), errors.Is(err, services.ErrRolEnUso), errors.Is(err, services.ErrRolSistema):
+		status = fiber.StatusConflict
+	case errors.Is(err, services.ErrRolInvalido):
+		status = fiber.StatusBadRequest
+	case errors.Is(err, services.ErrRolNoOtorgable):
+		status = fiber.StatusForbidden
+	}
+	return c.Status(status).JSON(fiber.Map{"message": mensaje, "error": err.Error()})
+}
+
+type rolRequest struct {
+	Nombre      string   `json:"nombre"`
+	Descripcion string   `json:"descripcion"`
+	Permisos    []string `json:"permisos"`
+	Requiere2FA bool     `json:"requiere_2fa"`
+}
+
+func (r rolRequest) input() services.RolInput {
+	return services.RolInput{Nombre: r.Nombre, Descripcion: r.Descripcion, Permisos: r.Permisos, Requiere2FA: r.Requiere2FA}
+}
+
+func (h *RolHandler) GetPermisos(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"message": "Permisos obtenidos exitosamente", "data": models.Permisos})
+}
+
+func (h *RolHandler) GetAll(c *fiber.Ctx) error {
+	roles, err := h.service.Listar()
+	if err != nil {
+		return errorRol(c, err, "Error obteniendo roles")
+	}
+	return c.JSON(fiber.Map{"message": "Roles obtenidos exitosamente", "data": roles})
+}
+
+func (h *RolHandler) Create(c *fiber.Ctx) error {
+	var req rolRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Datos inválidos", "error": err.Error()})
+	}
+	usuarioID, ok := usuarioIDDesdeContexto(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Sesión inválida"})
+	}
+	rol, err := h.service.Crear(req.input(), usuarioID)
+	if err != nil {
+		return errorRol(c, err, "Error creando rol")
+	}
+	h.auditar(c, models.AccionCrear, rol.ID, nil, rol)
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"message": "Rol creado exitosamente", "data": rol})
+}
+
+func (h *RolHandler) Update(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID inválido"})
+	}
+	var req rolRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Datos inválidos", "error": err.Error()})
+	}
+	usuarioID, ok := usuarioIDDesdeContexto(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Sesión inválida"})
+	}
+	antes, _ := h.service.Obtener(uint(id))
+	rol, err := h.service.Actualizar(uint(id), req.input(), usuarioID)
+	if err != nil {
+		return errorRol(c, err, "Error actualizando rol")
+	}
+	h.auditar(c, models.AccionActualizar, rol.ID, antes, rol)
+	return c.JSON(fiber.Map{"message": "Rol actualizado exitosamente", "data": rol})
+}
+
+func (h *RolHandler) Delete(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID inválido"})
+	}
+	antes, _ := h.service.Obtener(uint(id))
+	if err := h.service.Eliminar(uint(id)); err != nil {
+		return errorRol(c, err, "Error eliminando rol")
+	}
+	h.auditar(c, models.AccionEliminar, uint(id), antes, nil)
+	return c.JSON(fiber.Map{"message": "Rol eliminado exitosamente"})
+}
+
+func (h *RolHandler) RegisterRoutes(router fiber.Router, requiere func(...string) fiber.Handler) {
+	gestionar := requiere(models.PermisoUsuariosEditar)
+	router.Get("/permisos", gestionar, h.GetPermisos)
+
+	roles := router.Group("/roles", gestionar)
+	roles.Get("/", h.GetAll)
+	roles.Post("/", h.Create)
+	roles.Put("/:id", h.Update)
+	roles.Delete("/:id", h.Delete)
+}
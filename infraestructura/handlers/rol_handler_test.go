@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"managerfact/aplication/services"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+func TestErrorRolStatus(t *testing.T) {
+	casos := []struct {
+		nombre string
+		err    error
+		status int
+	}{
+		{"no otorgable", fmt.Errorf("%w: sistema.administrar", services.ErrRolNoOtorgable), fiber.StatusForbidden},
+		{"no encontrado", fmt.Errorf("%w: 7", services.ErrRolNoEncontrado), fiber.StatusNotFound},
+		{"duplicado", fmt.Errorf("%w: gestor", services.ErrRolDuplicado), fiber.StatusConflict},
+		{"inválido", fmt.Errorf("%w: permiso desconocido", services.ErrRolInvalido), fiber.StatusBadRequest},
+		{"otro", errors.New("conexión cerrada"), fiber.StatusInternalServerError},
+	}
+	for _, caso := range casos {
+		t.Run(caso.nombre, func(t *testing.T) {
+			app := fiber.New()
+			app.Get("/", func(c *fiber.Ctx) error {
+				return errorRol(c, caso.err, "Error de rol")
+			})
+			resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+			if err != nil {
+				t.Fatalf("app.Test: %v", err)
+			}
+			if resp.StatusCode != caso.status {
+				t.Errorf("status = %d, se esperaba %d", resp.StatusCode, caso.status)
+			}
+		})
+	}
+}
+
+func TestStatusUsuario(t *testing.T) {
+	if status := statusUsuario(fmt.Errorf("%w: admin", services.ErrRolNoOtorgable)); status != fiber.StatusForbidden {
+		t.Errorf("status = %d, se esperaba %d", status, fiber.StatusForbidden)
+	}
+	if status := statusUsuario(fmt.Errorf("%w: acceso_total", services.ErrAccesosNoOtorgables)); status != fiber.StatusForbidden {
+		t.Errorf("status = %d, se esperaba %d", status, fiber.StatusForbidden)
+	}
+	if status := statusUsuario(errors.New("CI duplicado")); status != fiber.StatusBadRequest {
+		t.Errorf("status = %d, se esperaba %d", status, fiber.StatusBadRequest)
+	}
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"managerfact/aplication/services"
+	"managerfact/internal/domain/models"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SaludHandler expone el estado de las dependencias externas (DbConnection
+// y facturadores) que revisa el MonitorSalud en background.
+type SaludHandler struct {
+	monitor *services.MonitorSalud
+}
+
+func NewSaludHandler(monitor *services.MonitorSalud) *SaludHandler {
+	return &SaludHandler{monitor: monitor}
+}
+
+func (h *SaludHandler) Dependencias(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{"data": h.monitor.Reporte()})
+}
+
+// Verificar corre un ciclo de chequeos en el momento (por ejemplo después
+// de arreglar una conexión) en vez de esperar al próximo intervalo.
+func (h *SaludHandler) Verificar(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"message": "Chequeo de dependencias ejecutado",
+		"data":    h.monitor.VerificarAhora(),
+	})
+}
+
+func (h *SaludHandler) Historial(c *fiber.Ctx) error {
+	tipo := c.Params("tipo")
+	if tipo != models.DependenciaDbConnection && tipo != models.DependenciaFacturador {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Tipo inválido, debe ser db_connection o facturador"})
+	}
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID inválido"})
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	chequeos, err := h.monitor.Historial(tipo, uint(id), limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Error obteniendo historial", "error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"data": chequeos})
+}
+
+func (h *SaludHandler) RegisterRoutes(router fiber.Router, requiere func(...string) fiber.Handler) {
+	// el reporte expone host:puerto/base de cada conexión y la URL de cada
+	// facturador: solo para quien ya puede ver las conexiones.
+	ver := requiere(models.PermisoConexionesVer, models.PermisoConexionesEditar, models.PermisoSistemaAdmin)
+	router.Get("/health/dependencies", ver, h.Dependencias)
+	router.Post("/health/dependencies/verificar", requiere(models.PermisoSistemaAdmin), h.Verificar)
+	router.Get("/health/dependencies/:tipo/:id/historial", ver, h.Historial)
+}
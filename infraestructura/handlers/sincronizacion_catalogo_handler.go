@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"errors"
+	"managerfact/aplication/services"
+	"managerfact/internal/domain/models"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// SincronizacionCatalogoHandler compara el catálogo de sucursales contra
+// el SFE_SUCURSAL de un facturador y aplica las diferencias elegidas. Solo
+// admin.
+type SincronizacionCatalogoHandler struct {
+	service   *services.SincronizacionCatalogoService
+	auditoria *services.AuditoriaService
+}
+
+func NewSincronizacionCatalogoHandler(service *services.SincronizacionCatalogoService, auditoria *services.AuditoriaService) *SincronizacionCatalogoHandler {
+	return &SincronizacionCatalogoHandler{service: service, auditoria: auditoria}
+}
+
+type compararCatalogoRequest struct {
+	DbConnectionID uint `json:"db_connection_id"`
+}
+
+// Comparar lee SFE_SUCURSAL de la conexión elegida y guarda la
+// sincronización con sus diferencias, sin aplicar nada.
+func (h *SincronizacionCatalogoHandler) Comparar(c *fiber.Ctx) error {
+	usuarioID, ok := usuarioIDDesdeContexto(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Sesión inválida"})
+	}
+	var req compararCatalogoRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Datos inválidos", "error": err.Error()})
+	}
+	if req.DbConnectionID == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Datos inválidos", "errors": []string{"El campo db_connection_id es requerido"}})
+	}
+
+	sincronizacion, err := h.service.Comparar(c.Context(), req.DbConnectionID, usuarioID)
+	if errors.Is(err, services.ErrCatalogoNoEncontrado) {
+		return errorCatalogo(c, err, "Error comparando el catálogo")
+	}
+	if err != nil {
+		return errorConsulta(c, "Error leyendo SFE_SUCURSAL", err)
+	}
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"message": "Comparación guardada, " + strconv.Itoa(len(sincronizacion.Diferencias)) + " diferencias",
+		"data":    sincronizacion,
+	})
+}
+
+func (h *SincronizacionCatalogoHandler) Listar(c *fiber.Ctx) error {
+	limit, _ := strconv.Atoi(c.Query("limit"))
+	sincronizaciones, err := h.service.Listar(limit)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Error obteniendo sincronizaciones", "error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"data": sincronizaciones})
+}
+
+func (h *SincronizacionCatalogoHandler) Obtener(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID inválido"})
+	}
+	sincronizacion, err := h.service.Obtener(uint(id))
+	if err != nil {
+		return errorCatalogo(c, err, "Error obteniendo sincronización")
+	}
+	return c.JSON(fiber.Map{"data": sincronizacion})
+}
+
+type cambioSincronizacionRequest struct {
+	CodigoSucursalSin int    `json:"codigo_sucursal_sin"`
+	RegionalID        *uint  `json:"regional_id"`
+	Nombre            string `json:"nombre"`
+}
+
+type aplicarSincronizacionRequest struct {
+	Cambios []cambioSincronizacionRequest `json:"cambios"`
+}
+
+// Aplicar aplica las diferencias elegidas por código SIN (todas o
+// ninguna); se puede llamar varias veces hasta aplicar las que hagan falta.
+func (h *SincronizacionCatalogoHandler) Aplicar(c *fiber.Ctx) error {
+	usuarioID, ok := usuarioIDDesdeContexto(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Sesión inválida"})
+	}
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID inválido"})
+	}
+	var req aplicarSincronizacionRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Datos inválidos", "error": err.Error()})
+	}
+
+	cambios := make([]services.CambioSincronizacion, len(req.Cambios))
+	for i, cambio := range req.Cambios {
+		cambios[i] = services.CambioSincronizacion{
+			CodigoSucursalSin: cambio.CodigoSucursalSin,
+			RegionalID:        cambio.RegionalID,
+			Nombre:            cambio.Nombre,
+		}
+	}
+	resultado, err := h.service.Aplicar(uint(id), usuarioID, cambios)
+	if err != nil {
+		return errorCatalogo(c, err, "Error aplicando la sincronización")
+	}
+	h.auditoria.Registrar(actorDesdeContexto(c), services.EventoAuditoria{
+		Accion:    models.AccionAplicar,
+		Entidad:   models.EntidadSincronizacion,
+		EntidadID: uint(id),
+		Despues: fiber.Map{
+			"cambios":               req.Cambios,
+			"aplicadas":             resultado.Aplicadas,
+			"usuarios_actualizados": resultado.UsuariosActualizados,
+		},
+	})
+	return c.JSON(fiber.Map{"message": "Cambios aplicados exitosamente", "data": resultado})
+}
+
+func (h *SincronizacionCatalogoHandler) RegisterRoutes(router fiber.Router, requiere func(...string) fiber.Handler) {
+	g := router.Group("/sucursales-catalogo/sincronizaciones", requiere(models.PermisoCatalogoEditar))
+	g.Post("/", h.Comparar)
+	g.Get("/", h.Listar)
+	g.Get("/:id", h.Obtener)
+	g.Post("/:id/aplicar", h.Aplicar)
+}
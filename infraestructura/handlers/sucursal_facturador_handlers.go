@@ -10,11 +10,25 @@ import (
 )
 
 type SucursalFacturadorHandler struct {
-	service *services.SucursalFacturadorService
+	service   *services.SucursalFacturadorService
+	auditoria *services.AuditoriaService
 }
 
-func NewSucursalFacturadorHandler(s *services.SucursalFacturadorService) *SucursalFacturadorHandler {
-	return &SucursalFacturadorHandler{service: s}
+func NewSucursalFacturadorHandler(s *services.SucursalFacturadorService, auditoria *services.AuditoriaService) *SucursalFacturadorHandler {
+	return &SucursalFacturadorHandler{service: s, auditoria: auditoria}
+}
+
+// auditar registra una acción sobre la sucursal id. Antes/después van
+// como sucursalFacturadorResponse: sin el token.
+func (h *SucursalFacturadorHandler) auditar(c *fiber.Ctx, accion string, id uint, antes, despues *models.SucursalFacturador) {
+	evento := services.EventoAuditoria{Accion: accion, Entidad: models.EntidadSucursalFacturador, EntidadID: id}
+	if antes != nil {
+		evento.Antes = nuevaSucursalFacturadorResponse(antes)
+	}
+	if despues != nil {
+		evento.Despues = nuevaSucursalFacturadorResponse(despues)
+	}
+	h.auditoria.Registrar(actorDesdeContexto(c), evento)
 }
 
 type sucursalFacturadorRequest struct {
@@ -109,6 +123,7 @@ func (h *SucursalFacturadorHandler) Create(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Error creando sucursal facturador", "error": err.Error()})
 	}
+	h.auditar(c, models.AccionCrear, sucursal.ID, nil, sucursal)
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 		"message": "Sucursal facturador creada exitosamente",
@@ -136,6 +151,7 @@ func (h *SucursalFacturadorHandler) Update(c *fiber.Ctx) error {
 		activo = *req.Activo
 	}
 
+	antes, _ := h.service.ObtenerPorID(uint(id))
 	sucursal, err := h.service.Actualizar(services.ActualizarSucursalFacturadorInput{
 		ID:                uint(id),
 		Nombre:            req.Nombre,
@@ -151,6 +167,11 @@ func (h *SucursalFacturadorHandler) Update(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Error actualizando sucursal facturador", "error": err.Error()})
 	}
+	h.auditar(c, models.AccionActualizar, sucursal.ID, antes, sucursal)
+	if req.TokenAcceso != "" {
+		// el token no se guarda ni cifrado: solo que se cambió
+		h.auditar(c, models.AccionCambiarToken, sucursal.ID, nil, nil)
+	}
 
 	return c.JSON(fiber.Map{"message": "Sucursal facturador actualizada exitosamente", "data": nuevaSucursalFacturadorResponse(sucursal)})
 }
@@ -180,22 +201,24 @@ func (h *SucursalFacturadorHandler) Delete(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID inválido"})
 	}
+	antes, _ := h.service.ObtenerPorID(uint(id))
 	if err := h.service.Eliminar(uint(id)); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Error eliminando sucursal facturador", "error": err.Error()})
 	}
+	h.auditar(c, models.AccionEliminar, uint(id), antes, nil)
 	return c.JSON(fiber.Map{"message": "Sucursal facturador eliminada exitosamente"})
 }
 
 // RegisterRoutes registra las rutas bajo /sucursales-facturador. Listar
 // (GetAll) es visible para cualquier usuario autenticado (lo necesitan al
 // elegir la sucursal antes de importar un Excel); crear/editar/eliminar y
-// GetByID siguen detrás de requireAdmin — los operadores no pueden operar
-// este módulo, solo consultar el listado.
-func (h *SucursalFacturadorHandler) RegisterRoutes(router fiber.Router, requireAdmin fiber.Handler) {
+// GetByID exigen sucursales_facturador.gestionar — los demás no pueden
+// operar este módulo, solo consultar el listado.
+func (h *SucursalFacturadorHandler) RegisterRoutes(router fiber.Router, requiere func(...string) fiber.Handler) {
 	sucursales := router.Group("/sucursales-facturador")
 	sucursales.Get("/", h.GetAll)
 
-	admin := sucursales.Group("/", requireAdmin)
+	admin := sucursales.Group("/", requiere(models.PermisoFacturadorEditar))
 	admin.Post("/", h.Create)
 	admin.Get("/:id", h.GetByID)
 	admin.Put("/:id", h.Update)
@@ -1,20 +1,71 @@
 package handlers
 
 import (
+	"errors"
 	"managerfact/aplication/services"
 	"managerfact/internal/domain/models"
+	"managerfact/internal/domain/repositories"
 	"managerfact/pkg/utils"
 	"strconv"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 type UsuarioHandler struct {
-	service *services.UsuarioService
+	service   *services.UsuarioService
+	sesiones  *services.SesionService
+	auditoria *services.AuditoriaService
 }
 
-func NewUsuarioHandler(s *services.UsuarioService) *UsuarioHandler {
-	return &UsuarioHandler{service: s}
+func NewUsuarioHandler(s *services.UsuarioService, sesiones *services.SesionService, auditoria *services.AuditoriaService) *UsuarioHandler {
+	return &UsuarioHandler{service: s, sesiones: sesiones, auditoria: auditoria}
+}
+
+// auditar registra una acción sobre el usuario id.
+func (h *UsuarioHandler) auditar(c *fiber.Ctx, accion string, id uint, antes, despues any) {
+	h.auditoria.Registrar(actorDesdeContexto(c), services.EventoAuditoria{
+		Accion:    accion,
+		Entidad:   models.EntidadUsuario,
+		EntidadID: id,
+		Antes:     antes,
+		Despues:   despues,
+	})
+}
+
+// accesosAuditados es el estado de accesos del usuario que se guarda en la
+// auditoría (nil si no se pudo leer).
+func (h *UsuarioHandler) accesosAuditados(id uint) any {
+	usuario, err := h.service.ObtenerPorID(id)
+	if err != nil {
+		return nil
+	}
+	accesos, err := h.service.ObtenerAccesos(id)
+	if err != nil {
+		return nil
+	}
+	sucursales := make([]fiber.Map, len(accesos.Accesos))
+	for i, acceso := range accesos.Accesos {
+		sucursales[i] = fiber.Map{
+			"sucursal_id":   acceso.SucursalCatalogoID,
+			"vigente_desde": acceso.VigenteDesde,
+			"vigente_hasta": acceso.VigenteHasta,
+		}
+	}
+	return fiber.Map{
+		"acceso_total":   usuario.AccesoTotal,
+		"regionales_ids": accesos.RegionalesIDs,
+		"sucursales":     sucursales,
+	}
+}
+
+// statusUsuario es 403 cuando el actor no puede dar el rol o administrar a
+// ese usuario (services.ErrRolNoOtorgable) y 400 para el resto.
+func statusUsuario(err error) int {
+	if errors.Is(err, services.ErrRolNoOtorgable) || errors.Is(err, services.ErrAccesosNoOtorgables) {
+		return fiber.StatusForbidden
+	}
+	return fiber.StatusBadRequest
 }
 
 type usuarioRequest struct {
@@ -34,9 +85,7 @@ func (h *UsuarioHandler) validar(req *usuarioRequest) []string {
 	req.CI = utils.ValidarCampoRequerido(&errValidacion, req.CI, "El campo ci es requerido")
 	req.CodigoUsuario = utils.ValidarCampoRequerido(&errValidacion, req.CodigoUsuario, "El campo codigo_usuario es requerido")
 	req.Cargo = utils.ValidarCampoOpcional(&errValidacion, req.Cargo)
-	if req.Rol != models.RolAdmin && req.Rol != models.RolOperador {
-		errValidacion = append(errValidacion, "El campo rol debe ser 'admin' u 'operador'")
-	}
+	req.Rol = utils.ValidarCampoRequerido(&errValidacion, req.Rol, "El campo rol es requerido")
 	return errValidacion
 }
 
@@ -50,6 +99,11 @@ func (h *UsuarioHandler) Create(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Datos inválidos", "errors": errValidacion})
 	}
 
+	actorID, ok := usuarioIDDesdeContexto(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Sesión inválida"})
+	}
+
 	usuario, err := h.service.Crear(services.CrearUsuarioInput{
 		Nombre:        req.Nombre,
 		CI:            req.CI,
@@ -58,13 +112,14 @@ func (h *UsuarioHandler) Create(c *fiber.Ctx) error {
 		Rol:           req.Rol,
 		RegionalID:    req.RegionalID,
 		SucursalID:    req.SucursalID,
-	})
+	}, actorID)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Error creando usuario", "error": err.Error()})
+		return c.Status(statusUsuario(err)).JSON(fiber.Map{"message": "Error creando usuario", "error": err.Error()})
 	}
+	h.auditar(c, models.AccionCrear, usuario.ID, nil, usuario)
 
 	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
-		"message": "Usuario creado exitosamente (contraseña inicial = CI)",
+		"message": "Usuario creado exitosamente (contraseña inicial = CI, debe cambiarla al ingresar)",
 		"data":    usuario,
 	})
 }
@@ -89,6 +144,12 @@ func (h *UsuarioHandler) Update(c *fiber.Ctx) error {
 		isActive = *req.IsActive
 	}
 
+	actorID, ok := usuarioIDDesdeContexto(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Sesión inválida"})
+	}
+
+	antes, _ := h.service.ObtenerPorID(uint(id))
 	usuario, err := h.service.Actualizar(services.ActualizarUsuarioInput{
 		ID:            uint(id),
 		Nombre:        req.Nombre,
@@ -99,10 +160,11 @@ func (h *UsuarioHandler) Update(c *fiber.Ctx) error {
 		RegionalID:    req.RegionalID,
 		SucursalID:    req.SucursalID,
 		IsActive:      isActive,
-	})
+	}, actorID)
 	if err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Error actualizando usuario", "error": err.Error()})
+		return c.Status(statusUsuario(err)).JSON(fiber.Map{"message": "Error actualizando usuario", "error": err.Error()})
 	}
+	h.auditar(c, models.AccionActualizar, usuario.ID, antes, usuario)
 
 	return c.JSON(fiber.Map{"message": "Usuario actualizado exitosamente", "data": usuario})
 }
@@ -132,9 +194,15 @@ func (h *UsuarioHandler) Delete(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID inválido"})
 	}
-	if err := h.service.Eliminar(uint(id)); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Error eliminando usuario", "error": err.Error()})
+	actorID, ok := usuarioIDDesdeContexto(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Sesión inválida"})
 	}
+	antes, _ := h.service.ObtenerPorID(uint(id))
+	if err := h.service.Eliminar(uint(id), actorID); err != nil {
+		return c.Status(statusUsuario(err)).JSON(fiber.Map{"message": "Error eliminando usuario", "error": err.Error()})
+	}
+	h.auditar(c, models.AccionEliminar, uint(id), antes, nil)
 	return c.JSON(fiber.Map{"message": "Usuario eliminado exitosamente"})
 }
 
@@ -143,16 +211,43 @@ func (h *UsuarioHandler) ResetPassword(c *fiber.Ctx) error {
 	if err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID inválido"})
 	}
-	if err := h.service.ResetPassword(uint(id)); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Error reseteando contraseña", "error": err.Error()})
+	actorID, ok := usuarioIDDesdeContexto(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Sesión inválida"})
+	}
+	if err := h.service.ResetPassword(uint(id), actorID); err != nil {
+		return c.Status(statusUsuario(err)).JSON(fiber.Map{"message": "Error reseteando contraseña", "error": err.Error()})
 	}
-	return c.JSON(fiber.Map{"message": "Contraseña restablecida al CI del usuario"})
+	h.auditar(c, models.AccionResetPassword, uint(id), nil, nil)
+	return c.JSON(fiber.Map{"message": "Contraseña restablecida al CI del usuario (debe cambiarla al ingresar)"})
 }
 
+// ResetSegundoFactor le quita el TOTP al usuario (perdió el teléfono y los
+// códigos de recuperación) y revoca sus sesiones.
+func (h *UsuarioHandler) ResetSegundoFactor(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID inválido"})
+	}
+	actorID, ok := usuarioIDDesdeContexto(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Sesión inválida"})
+	}
+	if err := h.service.ResetearSegundoFactor(uint(id), actorID); err != nil {
+		return c.Status(statusUsuario(err)).JSON(fiber.Map{"message": "Error reseteando el segundo factor", "error": err.Error()})
+	}
+	h.auditar(c, models.AccionReset2FA, uint(id), nil, nil)
+	return c.JSON(fiber.Map{"message": "Segundo factor reseteado (si su rol lo exige, debe enrolarlo de nuevo al ingresar)"})
+}
+
+// accesosRequest: vigente_desde/vigente_hasta son opcionales (RFC 3339) y
+// valen para todas las sucursales elegidas.
 type accesosRequest struct {
-	AccesoTotal   bool   `json:"acceso_total"`
-	RegionalesIDs []uint `json:"regionales_ids"`
-	SucursalesIDs []uint `json:"sucursales_ids"`
+	AccesoTotal   bool       `json:"acceso_total"`
+	RegionalesIDs []uint     `json:"regionales_ids"`
+	SucursalesIDs []uint     `json:"sucursales_ids"`
+	VigenteDesde  *time.Time `json:"vigente_desde"`
+	VigenteHasta  *time.Time `json:"vigente_hasta"`
 }
 
 func (h *UsuarioHandler) SetAccesos(c *fiber.Ctx) error {
@@ -161,18 +256,27 @@ func (h *UsuarioHandler) SetAccesos(c *fiber.Ctx) error {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID inválido"})
 	}
 
+	actorID, ok := usuarioIDDesdeContexto(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Sesión inválida"})
+	}
+
 	var req accesosRequest
 	if err := c.BodyParser(&req); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Datos inválidos", "error": err.Error()})
 	}
 
+	antes := h.accesosAuditados(uint(id))
 	if err := h.service.ConfigurarAccesos(uint(id), services.AccesosInput{
 		AccesoTotal:   req.AccesoTotal,
 		RegionalesIDs: req.RegionalesIDs,
 		SucursalesIDs: req.SucursalesIDs,
-	}); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Error configurando accesos", "error": err.Error()})
+		VigenteDesde:  req.VigenteDesde,
+		VigenteHasta:  req.VigenteHasta,
+	}, actorID); err != nil {
+		return c.Status(statusUsuario(err)).JSON(fiber.Map{"message": "Error configurando accesos", "error": err.Error()})
 	}
+	h.auditar(c, models.AccionAccesos, uint(id), antes, h.accesosAuditados(uint(id)))
 
 	return c.JSON(fiber.Map{"message": "Accesos actualizados exitosamente"})
 }
@@ -197,12 +301,25 @@ func (h *UsuarioHandler) GetAccesos(c *fiber.Ctx) error {
 	for i, id := range accesos.SucursalesIDs {
 		sucursales[i] = fiber.Map{"sucursal_id": id}
 	}
+	// detalle por sucursal con la vigencia de cada acceso
+	ahora := time.Now()
+	detalle := make([]fiber.Map, len(accesos.Accesos))
+	for i, acceso := range accesos.Accesos {
+		detalle[i] = fiber.Map{
+			"sucursal_id":   acceso.SucursalCatalogoID,
+			"sucursal":      acceso.SucursalCatalogo,
+			"vigente_desde": acceso.VigenteDesde,
+			"vigente_hasta": acceso.VigenteHasta,
+			"vigente":       acceso.Vigente(ahora),
+		}
+	}
 
 	return c.JSON(fiber.Map{
 		"message": "Accesos obtenidos exitosamente",
 		"data": fiber.Map{
 			"regionales": regionales,
 			"sucursales": sucursales,
+			"accesos":    detalle,
 		},
 	})
 }
@@ -238,23 +355,151 @@ func (h *UsuarioHandler) GetSucursalesCatalogo(c *fiber.Ctx) error {
 	return c.JSON(fiber.Map{"message": "Sucursales obtenidas exitosamente", "data": sucursales})
 }
 
-// RegisterRoutes registra las rutas de usuarios y los catálogos de
-// regionales/sucursales que usa el formulario de accesos, todas detrás de
-// requireAdmin (los operadores no pueden ver ni operar este módulo). Los
-// prefijos "/usuarios", "/regionales" y "/sucursales-catalogo" scopean el
-// middleware solo a estas rutas, no a las demás del grupo protegido.
-func (h *UsuarioHandler) RegisterRoutes(router fiber.Router, requireAdmin fiber.Handler) {
-	usuarios := router.Group("/usuarios", requireAdmin)
+// Desbloquear quita el bloqueo por intentos de login fallidos.
+func (h *UsuarioHandler) Desbloquear(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID inválido"})
+	}
+	actorID, ok := usuarioIDDesdeContexto(c)
+	if !ok {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Sesión inválida"})
+	}
+	if err := h.service.Desbloquear(uint(id), actorID); err != nil {
+		status := fiber.StatusNotFound
+		if errors.Is(err, services.ErrRolNoOtorgable) || errors.Is(err, services.ErrCuentaServicio) {
+			status = statusUsuario(err)
+		}
+		return c.Status(status).JSON(fiber.Map{"message": "Error desbloqueando usuario", "error": err.Error()})
+	}
+	h.auditar(c, models.AccionDesbloquear, uint(id), nil, nil)
+	return c.JSON(fiber.Map{"message": "Usuario desbloqueado exitosamente"})
+}
+
+// GetIntentosLogin lista el historial de logins, filtrable por usuario_id,
+// codigo_usuario, ip, resultado (exitoso|fallido|bloqueado|
+// segundo_factor) y fecha_desde/fecha_hasta (YYYY-MM-DD, ambas inclusive).
+func (h *UsuarioHandler) GetIntentosLogin(c *fiber.Ctx) error {
+	filtro := repositories.IntentoLoginFiltro{
+		CodigoUsuario: c.Query("codigo_usuario"),
+		IP:            c.Query("ip"),
+		Resultado:     c.Query("resultado"),
+	}
+	if usuarioID, err := strconv.ParseUint(c.Query("usuario_id"), 10, 32); err == nil {
+		filtro.UsuarioID = uint(usuarioID)
+	}
+	if desde, err := time.ParseInLocation("2006-01-02", c.Query("fecha_desde"), time.Local); err == nil {
+		filtro.Desde = &desde
+	}
+	if hasta, err := time.ParseInLocation("2006-01-02", c.Query("fecha_hasta"), time.Local); err == nil {
+		hasta = hasta.AddDate(0, 0, 1)
+		filtro.Hasta = &hasta
+	}
+	if limit, err := strconv.Atoi(c.Query("limit")); err == nil {
+		filtro.Limit = limit
+	}
+
+	intentos, err := h.service.ListarIntentosLogin(filtro)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Error obteniendo intentos de login", "error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "Intentos de login obtenidos exitosamente", "data": intentos})
+}
+
+// GetSesiones lista las sesiones activas del usuario (?todas=true incluye
+// las vencidas y revocadas).
+func (h *UsuarioHandler) GetSesiones(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID inválido"})
+	}
+	sesiones, err := h.sesiones.ListarDeUsuario(uint(id), c.QueryBool("todas"))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Error obteniendo sesiones", "error": err.Error()})
+	}
+	return c.JSON(fiber.Map{"message": "Sesiones obtenidas exitosamente", "data": sesiones})
+}
+
+// verificarAdministrable exige que el actor pueda administrar al usuario id
+// (UsuarioService.VerificarAdministrable). Devuelve false con la respuesta
+// de error ya escrita si no.
+func (h *UsuarioHandler) verificarAdministrable(c *fiber.Ctx, id uint) (bool, error) {
+	actorID, ok := usuarioIDDesdeContexto(c)
+	if !ok {
+		return false, c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Sesión inválida"})
+	}
+	if err := h.service.VerificarAdministrable(id, actorID); err != nil {
+		return false, c.Status(statusUsuario(err)).JSON(fiber.Map{"message": "No puede administrar a este usuario", "error": err.Error()})
+	}
+	return true, nil
+}
+
+// RevocarSesion revoca una sesión del usuario: su JWT deja de servir en el
+// próximo request.
+func (h *UsuarioHandler) RevocarSesion(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID inválido"})
+	}
+	sesionID, err := strconv.ParseUint(c.Params("sesionId"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID de sesión inválido"})
+	}
+	if ok, err := h.verificarAdministrable(c, uint(id)); !ok {
+		return err
+	}
+	if err := h.sesiones.Revocar(uint(id), uint(sesionID)); err != nil {
+		if errors.Is(err, services.ErrSesionInvalida) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Sesión no encontrada", "error": err.Error()})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Error revocando sesión", "error": err.Error()})
+	}
+	h.auditar(c, models.AccionRevocarSesion, uint(id), nil, fiber.Map{"sesion_id": sesionID})
+	return c.JSON(fiber.Map{"message": "Sesión revocada exitosamente"})
+}
+
+// RevocarSesiones revoca todas las sesiones activas del usuario.
+func (h *UsuarioHandler) RevocarSesiones(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 32)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "ID inválido"})
+	}
+	if ok, err := h.verificarAdministrable(c, uint(id)); !ok {
+		return err
+	}
+	revocadas, err := h.sesiones.RevocarTodas(uint(id))
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Error revocando sesiones", "error": err.Error()})
+	}
+	h.auditar(c, models.AccionRevocarSesiones, uint(id), nil, fiber.Map{"revocadas": revocadas})
+	return c.JSON(fiber.Map{"message": "Sesiones revocadas exitosamente", "data": fiber.Map{"revocadas": revocadas}})
+}
+
+// RegisterRoutes registra las rutas de usuarios (usuarios.gestionar) y los
+// catálogos de regionales/sucursales que usa el formulario de accesos
+// (usuarios.gestionar o catalogo.gestionar). Los prefijos "/usuarios",
+// "/regionales" y "/sucursales-catalogo" scopean el middleware solo a estas
+// rutas, no a las demás del grupo protegido.
+func (h *UsuarioHandler) RegisterRoutes(router fiber.Router, requiere func(...string) fiber.Handler) {
+	gestionar := requiere(models.PermisoUsuariosEditar)
+	usuarios := router.Group("/usuarios", gestionar)
 	usuarios.Post("/", h.Create)
 	usuarios.Get("/", h.GetAll)
 	usuarios.Get("/:id", h.GetByID)
 	usuarios.Put("/:id", h.Update)
 	usuarios.Delete("/:id", h.Delete)
 	usuarios.Post("/:id/reset-password", h.ResetPassword)
+	usuarios.Post("/:id/desbloquear", h.Desbloquear)
+	usuarios.Post("/:id/2fa/reset", h.ResetSegundoFactor)
+	usuarios.Get("/:id/sesiones", h.GetSesiones)
+	usuarios.Delete("/:id/sesiones", h.RevocarSesiones)
+	usuarios.Delete("/:id/sesiones/:sesionId", h.RevocarSesion)
 	usuarios.Get("/:id/accesos", h.GetAccesos)
 	usuarios.Put("/:id/accesos", h.SetAccesos)
 	usuarios.Get("/:id/sucursales-permitidas", h.GetSucursalesPermitidas)
 
-	router.Get("/regionales", requireAdmin, h.GetRegionales)
-	router.Get("/sucursales-catalogo", requireAdmin, h.GetSucursalesCatalogo)
+	catalogo := requiere(models.PermisoUsuariosEditar, models.PermisoCatalogoEditar)
+	router.Get("/regionales", catalogo, h.GetRegionales)
+	router.Get("/sucursales-catalogo", catalogo, h.GetSucursalesCatalogo)
+	router.Get("/intentos-login", gestionar, h.GetIntentosLogin)
 }
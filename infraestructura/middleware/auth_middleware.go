@@ -1,7 +1,10 @@
 package middleware
 
 import (
+	"errors"
+	"fmt"
 	"managerfact/aplication/services"
+	"managerfact/internal/domain/models"
 	"managerfact/pkg/utils"
 	"strings"
 
@@ -12,44 +15,159 @@ import (
 // c.Locals una vez validado por RequireAuth.
 const UsuarioIDLocal = "usuario_id"
 
+// SesionIDLocal es la key del ID de la sesión (models.Sesion) del token.
+const SesionIDLocal = "sesion_id"
+
+// ApiKeyLocal es la key de la *models.ApiKey cuando la request se
+// autenticó con una API key en vez de un JWT.
+const ApiKeyLocal = "api_key"
+
+// AutorLocal es la key del texto que identifica quién hace la request
+// ("usuario:12" o "api_key:3:<prefijo>"); lo usa el log de requests.
+const AutorLocal = "autor"
+
+// HeaderApiKey es el header alternativo para mandar una API key.
+const HeaderApiKey = "X-API-Key"
+
 // RequireAuth exige un JWT válido en el header Authorization ("Bearer
-// <token>") y deja el usuario_id disponible en c.Locals para los handlers
-// siguientes.
-func RequireAuth() fiber.Handler {
+// <token>") cuya sesión siga activa en la BD (no revocada por logout, un
+// admin o un cambio del usuario), y deja usuario_id y sesion_id
+// disponibles en c.Locals para los handlers siguientes. También acepta una
+// API key ("Bearer mfk_..." o en X-API-Key): en ese caso usuario_id es su
+// cuenta de servicio, no hay sesion_id y la key queda en api_key.
+func RequireAuth(sesiones *services.SesionService, apiKeys *services.ApiKeyService) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		header := c.Get("Authorization")
-		if !strings.HasPrefix(header, "Bearer ") {
+		tokenString, esBearer := strings.CutPrefix(header, "Bearer ")
+		if apiKey := c.Get(HeaderApiKey); apiKey != "" || strings.HasPrefix(tokenString, models.PrefijoApiKey) {
+			if apiKey == "" {
+				apiKey = tokenString
+			}
+			return autenticarApiKey(c, apiKeys, apiKey)
+		}
+		if !esBearer {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Token no proporcionado"})
 		}
-		tokenString := strings.TrimPrefix(header, "Bearer ")
 
 		claims, err := utils.ValidarTokenJWT(tokenString)
 		if err != nil {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Sesión inválida o expirada", "error": err.Error()})
 		}
 
+		vigente, err := sesiones.Vigente(claims.SesionID, claims.UsuarioID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Error verificando la sesión", "error": err.Error()})
+		}
+		if !vigente {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Sesión inválida o expirada", "error": "sesión revocada"})
+		}
+
 		c.Locals(UsuarioIDLocal, claims.UsuarioID)
+		c.Locals(SesionIDLocal, claims.SesionID)
+		c.Locals(AutorLocal, fmt.Sprintf("usuario:%d", claims.UsuarioID))
 		return c.Next()
 	}
 }
 
-// RequireAdmin exige que el usuario autenticado (usuario_id ya puesto en
-// Locals por RequireAuth, que debe ir encadenado antes) tenga rol "admin".
-// Usado para bloquear los módulos de Usuarios y Sucursales Facturador a los
-// operadores.
-func RequireAdmin(usuarioService *services.UsuarioService) fiber.Handler {
+func autenticarApiKey(c *fiber.Ctx, apiKeys *services.ApiKeyService, token string) error {
+	key, err := apiKeys.Autenticar(token, c.IP())
+	if errors.Is(err, services.ErrApiKeyInvalida) {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": err.Error()})
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Error verificando la API key", "error": err.Error()})
+	}
+
+	c.Locals(UsuarioIDLocal, key.UsuarioID)
+	c.Locals(ApiKeyLocal, key)
+	c.Locals(AutorLocal, fmt.Sprintf("api_key:%d:%s", key.ID, key.Prefijo))
+	return c.Next()
+}
+
+// RequirePermiso arma los middlewares que exigen permisos: cada
+// requiere(permisos...) deja pasar al usuario autenticado (usuario_id ya
+// puesto en Locals por RequireAuth, que debe ir encadenado antes) cuyo rol
+// tenga alguno de los permisos dados; con una API key cuentan los permisos
+// de la key. Solo decide qué puede hacer; sobre qué sucursales lo siguen
+// filtrando los handlers y servicios con TieneAccesoSucursal.
+func RequirePermiso(roles *services.RolService) func(permisos ...string) fiber.Handler {
+	return func(permisos ...string) fiber.Handler {
+		return func(c *fiber.Ctx) error {
+			usuarioID, ok := c.Locals(UsuarioIDLocal).(uint)
+			if !ok {
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Sesión inválida"})
+			}
+
+			var permitido bool
+			var err error
+			if key, esApiKey := c.Locals(ApiKeyLocal).(*models.ApiKey); esApiKey {
+				permitido = key.Tiene(permisos...)
+			} else {
+				permitido, err = roles.TienePermiso(usuarioID, permisos...)
+			}
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Error verificando permisos", "error": err.Error()})
+			}
+			if !permitido {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+					"message":  "No tienes permiso para esta acción",
+					"permisos": permisos,
+				})
+			}
+			return c.Next()
+		}
+	}
+}
+
+// RequirePasswordVigente bloquea al usuario que tiene pendiente el cambio
+// de contraseña obligatorio (recién creado o reseteado: su contraseña es el
+// CI). Va después de RequireAuth en el grupo protegido; POST
+// /auth/change-password se registra antes del grupo para no pasar por acá.
+func RequirePasswordVigente(usuarioService *services.UsuarioService) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		usuarioID, ok := c.Locals(UsuarioIDLocal).(uint)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Sesión inválida"})
+		}
+
+		debeCambiar, err := usuarioService.DebeCambiarPassword(usuarioID)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Sesión inválida", "error": err.Error()})
+		}
+		if debeCambiar {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"message": "Debes cambiar tu contraseña antes de continuar (POST /api/v1/auth/change-password)",
+				"code":    "password_change_required",
+			})
+		}
+		return c.Next()
+	}
+}
+
+// Require2FAConfigurado bloquea al usuario cuyo rol exige segundo factor
+// y todavía no lo enroló. Va después de RequirePasswordVigente en el grupo
+// protegido; las rutas /auth/2fa se registran antes del grupo para que
+// pueda enrolarse. Con API key no aplica (la cuenta de servicio no inicia
+// sesión).
+func Require2FAConfigurado(usuarioService *services.UsuarioService) fiber.Handler {
 	return func(c *fiber.Ctx) error {
+		if _, esApiKey := c.Locals(ApiKeyLocal).(*models.ApiKey); esApiKey {
+			return c.Next()
+		}
 		usuarioID, ok := c.Locals(UsuarioIDLocal).(uint)
 		if !ok {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Sesión inválida"})
 		}
 
-		esAdmin, err := usuarioService.EsAdmin(usuarioID)
+		debeEnrolar, err := usuarioService.RequiereEnrolar2FA(usuarioID)
 		if err != nil {
-			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Error verificando permisos", "error": err.Error()})
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Sesión inválida", "error": err.Error()})
 		}
-		if !esAdmin {
-			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "No tienes permiso para acceder a este módulo"})
+		if debeEnrolar {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"message": "Tu rol exige segundo factor: configúralo antes de continuar (POST /api/v1/auth/2fa/iniciar)",
+				"code":    "totp_enrollment_required",
+			})
 		}
 		return c.Next()
 	}
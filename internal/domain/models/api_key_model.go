@@ -0,0 +1,52 @@
+package models
+
+import "time"
+
+// PrefijoApiKey encabeza toda API key ("mfk_<prefijo>_<secreto>"), para
+// distinguirla de un JWT en el header Authorization.
+const PrefijoApiKey = "mfk_"
+
+// ApiKey es una credencial de integración máquina a máquina (ej. el
+// sistema de tickets que carga lotes y consulta su estado). Cada key actúa
+// como su propia cuenta de servicio (Usuario con EsServicio): las
+// sucursales que ve son los accesos de esa cuenta, y lo que hace queda a
+// su nombre. Qué puede hacer lo dicen sus Permisos, no un rol. Del token
+// solo se guarda su SHA-256; se muestra una única vez al crearla.
+type ApiKey struct {
+	ID     uint   `json:"id" gorm:"primaryKey"`
+	Nombre string `json:"nombre" gorm:"type:varchar(100);not null"`
+	// Prefijo es la parte pública del token, para buscar la key sin
+	// recorrer los hashes y reconocerla en listados y logs.
+	Prefijo   string   `json:"prefijo" gorm:"type:varchar(16);not null;uniqueIndex"`
+	Hash      string   `json:"-" gorm:"type:char(64);not null"`
+	UsuarioID uint     `json:"usuario_id" gorm:"not null;uniqueIndex"`
+	Usuario   *Usuario `json:"usuario,omitempty" gorm:"foreignKey:UsuarioID"`
+	Permisos  []string `json:"permisos" gorm:"type:jsonb;serializer:json;not null"`
+	// ExpiraEn nil = no vence.
+	ExpiraEn    *time.Time `json:"expira_en"`
+	UltimoUso   *time.Time `json:"ultimo_uso"`
+	UltimaIP    string     `json:"ultima_ip" gorm:"type:varchar(64)"`
+	CreadaPorID *uint      `json:"creada_por_id"`
+	RevocadaEn  *time.Time `json:"revocada_en"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+func (ApiKey) TableName() string { return "api_keys" }
+
+// Activa indica si la key no está revocada ni vencida.
+func (k *ApiKey) Activa(ahora time.Time) bool {
+	return k.RevocadaEn == nil && (k.ExpiraEn == nil || k.ExpiraEn.After(ahora))
+}
+
+// Tiene indica si la key tiene alguno de los permisos dados.
+func (k *ApiKey) Tiene(permisos ...string) bool {
+	for _, propio := range k.Permisos {
+		for _, permiso := range permisos {
+			if propio == permiso {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,80 @@
+package models
+
+import "time"
+
+// Entidades auditadas (Auditoria.Entidad).
+const (
+	EntidadUsuario            = "usuario"
+	EntidadSucursalFacturador = "sucursal_facturador"
+	EntidadDbConnection       = "db_connection"
+	EntidadLotePrevalorada    = "lote_prevalorada"
+	EntidadLoteAnulacion      = "lote_anulacion"
+	EntidadFacturaPrevalorada = "factura_prevalorada"
+	EntidadFacturaAnulacion   = "factura_anulacion"
+	EntidadRol                = "rol"
+	EntidadApiKey             = "api_key"
+	EntidadRegional           = "regional"
+	EntidadSucursalCatalogo   = "sucursal_catalogo"
+	// EntidadSincronizacion es una comparación con SFE_SUCURSAL
+	// (models.SincronizacionCatalogo).
+	EntidadSincronizacion = "sincronizacion_catalogo"
+	// EntidadClaveCifrado: la rotación de la clave de secretos; EntidadID
+	// es el id de la clave actual.
+	EntidadClaveCifrado = "clave_cifrado"
+)
+
+// Acciones auditadas (Auditoria.Accion).
+const (
+	AccionCrear         = "crear"
+	AccionActualizar    = "actualizar"
+	AccionEliminar      = "eliminar"
+	AccionDesactivar    = "desactivar"
+	AccionResetPassword = "reset_password"
+	AccionReset2FA      = "reset_2fa"
+	AccionAccesos       = "cambiar_accesos"
+	// AccionCambiarToken: se cargó un token de acceso nuevo en una
+	// sucursal facturador. El token nunca va en Antes/Despues.
+	AccionCambiarToken = "cambiar_token"
+	AccionImportar     = "importar"
+	AccionFacturar     = "facturar"
+	AccionAnular       = "anular"
+	AccionRevocar      = "revocar"
+	AccionDesbloquear  = "desbloquear"
+	// AccionRevocarSesion / AccionRevocarSesiones: revocación de sesiones
+	// de un usuario (una o todas), sobre la entidad usuario.
+	AccionRevocarSesion   = "revocar_sesion"
+	AccionRevocarSesiones = "revocar_sesiones"
+	// AccionActivar2FA, AccionDesactivar2FA y AccionRegenerarCodigos: el
+	// propio usuario sobre su segundo factor (el reset de un admin es
+	// AccionReset2FA).
+	AccionActivar2FA       = "activar_2fa"
+	AccionDesactivar2FA    = "desactivar_2fa"
+	AccionRegenerarCodigos = "regenerar_codigos_2fa"
+	AccionAplicar          = "aplicar"
+	AccionRecifrar         = "recifrar"
+)
+
+// Auditoria es el registro de quién hizo qué sobre qué entidad, con el
+// estado antes y después (JSON, sin secretos). La tabla es de solo
+// inserción: un trigger rechaza UPDATE, DELETE y TRUNCATE (ver migración
+// 0010).
+type Auditoria struct {
+	ID uint `json:"id" gorm:"primaryKey"`
+	// UsuarioID es quien hizo la acción (la cuenta de servicio, si fue una
+	// API key). Sin FK: el registro sobrevive al usuario.
+	UsuarioID *uint `json:"usuario_id" gorm:"index"`
+	// CodigoUsuario es el del usuario al momento de la acción.
+	CodigoUsuario string `json:"codigo_usuario" gorm:"type:varchar(50)"`
+	// Autor es "usuario:<id>" o "api_key:<id>:<prefijo>" (el mismo del log
+	// de requests).
+	Autor     string    `json:"autor" gorm:"type:varchar(100);not null"`
+	Accion    string    `json:"accion" gorm:"type:varchar(50);not null;index"`
+	Entidad   string    `json:"entidad" gorm:"type:varchar(50);not null;index:idx_auditoria_entidad,priority:1"`
+	EntidadID string    `json:"entidad_id" gorm:"type:varchar(50);index:idx_auditoria_entidad,priority:2"`
+	Antes     any       `json:"antes" gorm:"type:jsonb;serializer:json"`
+	Despues   any       `json:"despues" gorm:"type:jsonb;serializer:json"`
+	IP        string    `json:"ip" gorm:"type:varchar(64)"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+func (Auditoria) TableName() string { return "auditoria" }
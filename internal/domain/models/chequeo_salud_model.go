@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// Tipos de dependencia que revisa el MonitorSalud.
+const (
+	DependenciaDbConnection = "db_connection"
+	DependenciaFacturador   = "facturador"
+)
+
+// ChequeoSalud es el resultado de un chequeo periódico del MonitorSalud
+// contra una dependencia externa: un ping a una DbConnection activa o un
+// GET a la URL base del facturador de una sucursal facturador activa. Se
+// guarda uno por dependencia y ciclo para tener historial de latencia y de
+// caídas, y se purgan los más viejos que SALUD_RETENCION_DIAS.
+type ChequeoSalud struct {
+	ID        uint   `json:"id" gorm:"primaryKey"`
+	Tipo      string `json:"tipo" gorm:"type:varchar(20);not null;index:idx_chequeo_dependencia,priority:1"` // "db_connection" | "facturador"
+	RecursoID uint   `json:"recurso_id" gorm:"not null;index:idx_chequeo_dependencia,priority:2"`
+	Nombre    string `json:"nombre" gorm:"type:varchar(150)"`
+	// Ok es true si la dependencia respondió: el ping a la base, o cualquier
+	// respuesta HTTP del facturador (incluso 401/404: lo que interesa es que
+	// el servidor está arriba, no el resultado de negocio).
+	Ok         bool      `json:"ok" gorm:"not null"`
+	LatenciaMs int64     `json:"latencia_ms"`
+	Mensaje    string    `json:"mensaje" gorm:"type:text"`
+	CreatedAt  time.Time `json:"created_at" gorm:"index:idx_chequeo_dependencia,priority:3"`
+}
+
+func (ChequeoSalud) TableName() string { return "chequeos_salud" }
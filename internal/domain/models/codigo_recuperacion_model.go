@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// CodigoRecuperacion es un código de un solo uso que reemplaza al TOTP en
+// el segundo paso del login (por si el usuario pierde el teléfono). Se
+// generan de a tandas al activar el segundo factor y solo se guarda su
+// SHA-256.
+type CodigoRecuperacion struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	UsuarioID uint       `json:"usuario_id" gorm:"not null;index"`
+	Hash      string     `json:"-" gorm:"type:char(64);not null"`
+	UsadoEn   *time.Time `json:"usado_en"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+func (CodigoRecuperacion) TableName() string { return "codigos_recuperacion" }
@@ -4,27 +4,77 @@ package models
 
 import (
 	"fmt"
+	"managerfact/pkg/utils"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
 	// "gorm.io/gorm"
 )
 
-// DbConnection representa la configuración de conexión a bases de datos SQL Server
+// DbConnection representa la configuración de conexión a una base de datos
+// remota (SQL Server, PostgreSQL o MySQL según Driver)
 type DbConnection struct {
-	ID           uint           `json:"id" gorm:"primaryKey"`
-	ServerName   string         `json:"server_name" gorm:"type:varchar(100);not null;uniqueIndex" validate:"required,min=3,max=100"`
-	Host         string         `json:"host" gorm:"type:varchar(255);not null" validate:"required,hostname_rfc1123"`
-	Port         int            `json:"port" gorm:"not null;default:1433" validate:"required,min=1,max=65535"`
-	DatabaseName string         `json:"database_name" gorm:"type:varchar(100);not null" validate:"required,min=1,max=100"`
-	Username     string         `json:"username" gorm:"type:varchar(100);not null" validate:"required,min=1,max=100"`
-	Password     string         `json:"password" gorm:"type:varchar(255);not null" validate:"required,min=1"`
-	IsActive     bool           `json:"is_active" gorm:"default:true"`
-	Description  string         `json:"description" gorm:"type:text"`
-	Type         string         `json:"type" gorm:"column:type;type:varchar(50);not null;default:'general'" validate:"required,min=1,max=50"`
-	CreatedAt    time.Time      `json:"created_at"`
-	UpdatedAt    time.Time      `json:"updated_at"`
-	DeletedAt    gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
+	ID           uint   `json:"id" gorm:"primaryKey"`
+	ServerName   string `json:"server_name" gorm:"type:varchar(100);not null;uniqueIndex" validate:"required,min=3,max=100"`
+	Host         string `json:"host" gorm:"type:varchar(255);not null" validate:"required,hostname_rfc1123"`
+	Port         int    `json:"port" gorm:"not null;default:1433" validate:"required,min=1,max=65535"`
+	DatabaseName string `json:"database_name" gorm:"type:varchar(100);not null" validate:"required,min=1,max=100"`
+	Username     string `json:"username" gorm:"type:varchar(100);not null" validate:"required,min=1,max=100"`
+	// Password se guarda cifrado (AES-256-GCM, utils.Encrypt) y nunca se
+	// serializa en JSON: el handler expone únicamente un booleano
+	// "password_configurado". Solo se descifra al armar la conexión (ver
+	// PasswordPlano).
+	Password string `json:"-" gorm:"type:varchar(500);not null" validate:"required,min=1"`
+	// PasswordCifrado indica si Password ya está cifrado. Es false en las
+	// filas anteriores al cifrado (MigrarPasswordsConexiones las cifra al
+	// arrancar) y en las conexiones armadas desde un request que todavía no
+	// se guardaron.
+	PasswordCifrado bool   `json:"-" gorm:"not null;default:false"`
+	IsActive        bool   `json:"is_active" gorm:"default:true"`
+	Description     string `json:"description" gorm:"type:text"`
+	Type            string `json:"type" gorm:"column:type;type:varchar(50);not null;default:'general'" validate:"required,min=1,max=50"`
+	// Driver es el motor de la base remota (DriverSQLServer, DriverPostgres
+	// o DriverMySQL); vacío equivale a SQL Server, el de todas las filas
+	// anteriores a este campo. Ver services.DriverBD.
+	Driver              string `json:"driver" gorm:"type:varchar(20);not null;default:'sqlserver'" validate:"omitempty,oneof=sqlserver postgres mysql"`
+	QueryTimeoutSeconds int    `json:"query_timeout_seconds" gorm:"not null;default:0" validate:"min=0,max=3600"`
+	// CodigoSucursalSin es la sucursal (aeropuerto) que atiende la conexión,
+	// usada para filtrar por accesos de usuario en búsquedas sobre varios
+	// servidores (ver ConsultasService.BuscarDuasTodos). nil = nacional:
+	// solo la ven usuarios con acceso total.
+	CodigoSucursalSin *int           `json:"codigo_sucursal_sin"`
+	CreatedAt         time.Time      `json:"created_at"`
+	UpdatedAt         time.Time      `json:"updated_at"`
+	DeletedAt         gorm.DeletedAt `json:"deleted_at,omitempty" gorm:"index"`
+}
+
+// Tipos de conexión (DbConnection.Type) con las tablas de DUAS
+// (TES_FACTURAITINERARIO).
+const (
+	TipoConexionDuas        = "duas"
+	TipoConexionDuasCentral = "duas_central"
+	TipoConexionDuasLocal   = "duas_local"
+)
+
+// TiposConexionDuas son los tipos sobre los que corre la búsqueda DUAS.
+var TiposConexionDuas = []string{TipoConexionDuas, TipoConexionDuasCentral, TipoConexionDuasLocal}
+
+// Motores soportados en DbConnection.Driver.
+const (
+	DriverSQLServer = "sqlserver"
+	DriverPostgres  = "postgres"
+	DriverMySQL     = "mysql"
+)
+
+// DriverNormalizado devuelve Driver en minúsculas, o DriverSQLServer si
+// está vacío.
+func (dc *DbConnection) DriverNormalizado() string {
+	driver := strings.ToLower(strings.TrimSpace(dc.Driver))
+	if driver == "" {
+		return DriverSQLServer
+	}
+	return driver
 }
 
 // TableName especifica el nombre de la tabla
@@ -34,16 +84,51 @@ func (DbConnection) TableName() string {
 
 // BeforeCreate se ejecuta antes de crear un registro
 func (dc *DbConnection) BeforeCreate(tx *gorm.DB) error {
-	// Aquí se podría encriptar la contraseña si es necesario
+	// La contraseña la cifra el service (CifrarPassword) antes de guardar:
+	// acá no se puede saber si el valor ya viene cifrado.
 	return nil
 }
 
-// ConnectionString construye la cadena de conexión para SQL Server
-func (dc *DbConnection) ConnectionString() string {
-	return fmt.Sprintf(
-		"server=%s;port=%d;database=%s;user id=%s;password=%s;encrypt=false;connection timeout=30",
-		dc.Host, dc.Port, dc.DatabaseName, dc.Username, dc.Password,
-	)
+// CifrarPassword cifra Password si todavía está en claro. Se llama justo
+// antes de guardar la conexión.
+func (dc *DbConnection) CifrarPassword() error {
+	if dc.PasswordCifrado {
+		return nil
+	}
+	cifrado, err := utils.Encrypt(dc.Password)
+	if err != nil {
+		return fmt.Errorf("error cifrando contraseña de la conexión: %w", err)
+	}
+	dc.Password = cifrado
+	dc.PasswordCifrado = true
+	return nil
+}
+
+// PasswordPlano devuelve la contraseña en claro, descifrándola si está
+// cifrada.
+func (dc *DbConnection) PasswordPlano() (string, error) {
+	if !dc.PasswordCifrado {
+		return dc.Password, nil
+	}
+	plano, err := utils.Decrypt(dc.Password)
+	if err != nil {
+		return "", fmt.Errorf("error descifrando contraseña de la conexión '%s': %w", dc.ServerName, err)
+	}
+	return plano, nil
+}
+
+// DefaultQueryTimeout es el tope de duración de una consulta remota cuando
+// la conexión no define QueryTimeoutSeconds.
+const DefaultQueryTimeout = 60 * time.Second
+
+// QueryTimeout devuelve el tope de duración de cada consulta remota
+// (reportes de ConsultasService) contra este servidor: QueryTimeoutSeconds,
+// o DefaultQueryTimeout si vale 0.
+func (dc *DbConnection) QueryTimeout() time.Duration {
+	if dc.QueryTimeoutSeconds <= 0 {
+		return DefaultQueryTimeout
+	}
+	return time.Duration(dc.QueryTimeoutSeconds) * time.Second
 }
 
 // IsValid verifica si la configuración tiene los campos requeridos
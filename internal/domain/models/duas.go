@@ -2,7 +2,11 @@ package models
 
 import "time"
 
-// DuasBusquedaParams representa los parámetros de búsqueda para DUAS
+// DuasBusquedaParams representa los parámetros de búsqueda para DUAS. Todos
+// son opcionales (vacío = sin filtro) pero tiene que venir al menos uno; el
+// handler los valida y normaliza (códigos en mayúsculas, fechas
+// "2006-01-02"). El rango de fechas puede ser abierto en cualquiera de sus
+// extremos.
 type DuasBusquedaParams struct {
 	Nombre      string `json:"nombre"`
 	Apellido    string `json:"apellido"`
@@ -11,6 +15,47 @@ type DuasBusquedaParams struct {
 	FechaHasta  string `json:"fecha_hasta"`
 	Asiento     string `json:"asiento"`
 	Ticket      string `json:"ticket"`
+	// Origen y Destino son códigos IATA de aeropuerto (3 letras) de un
+	// mismo tramo del boarding pass.
+	Origen  string `json:"origen"`
+	Destino string `json:"destino"`
+	// PNR es el código de reserva (hasta 7 caracteres alfanuméricos).
+	PNR string `json:"pnr"`
+}
+
+// DatosBCBP son los datos del pasajero decodificados del boarding pass
+// (BCBP) guardado en FAC_DETALLEFACTURA (ver pkg/bcbp). Los campos de primer
+// nivel son del primer tramo; Tramos trae todos si el pase es multi-tramo.
+// ErrorBCBP explica por qué quedaron vacíos si el detalle no se pudo
+// decodificar.
+type DatosBCBP struct {
+	Pasajero      string      `json:"pasajero,omitempty" gorm:"-"`
+	Apellido      string      `json:"apellido,omitempty" gorm:"-"`
+	Nombre        string      `json:"nombre,omitempty" gorm:"-"`
+	PNR           string      `json:"pnr,omitempty" gorm:"-"`
+	Origen        string      `json:"origen,omitempty" gorm:"-"`
+	Destino       string      `json:"destino,omitempty" gorm:"-"`
+	Transportista string      `json:"transportista,omitempty" gorm:"-"`
+	Vuelo         string      `json:"vuelo,omitempty" gorm:"-"`
+	FechaJuliana  int         `json:"fecha_juliana,omitempty" gorm:"-"`
+	FechaVuelo    *time.Time  `json:"fecha_vuelo,omitempty" gorm:"-"`
+	Asiento       string      `json:"asiento,omitempty" gorm:"-"`
+	NumeroTicket  string      `json:"numero_ticket,omitempty" gorm:"-"`
+	Tramos        []TramoBCBP `json:"tramos,omitempty" gorm:"-"`
+	ErrorBCBP     string      `json:"error_bcbp,omitempty" gorm:"-"`
+}
+
+// TramoBCBP es un tramo del boarding pass (ver DatosBCBP).
+type TramoBCBP struct {
+	PNR           string     `json:"pnr"`
+	Origen        string     `json:"origen"`
+	Destino       string     `json:"destino"`
+	Transportista string     `json:"transportista"`
+	Vuelo         string     `json:"vuelo"`
+	FechaJuliana  int        `json:"fecha_juliana"`
+	FechaVuelo    *time.Time `json:"fecha_vuelo,omitempty"`
+	Asiento       string     `json:"asiento"`
+	NumeroTicket  string     `json:"numero_ticket,omitempty"`
 }
 
 // DuasResultado representa un registro de la búsqueda DUAS
@@ -27,6 +72,13 @@ type DuasResultadoCentral struct {
 	FACDetalleFactura      string    `json:"fac_detallefactura" gorm:"column:FAC_DETALLEFACTURA"`
 	//FAC_FECHAEMISION_FACTURA
 	FacFechaEmisionFactura time.Time `json:"fac_fechaemision_factura" gorm:"column:FAC_FECHAEMISION_FACTURA"`
+
+	DatosBCBP `gorm:"-"`
+
+	// IDServidor y Servidor identifican la DbConnection de la que salió la
+	// fila (relevante al combinar varios servidores, ver DuasResultadoGlobal).
+	IDServidor uint   `json:"id_servidor" gorm:"-"`
+	Servidor   string `json:"servidor" gorm:"-"`
 }
 
 // DuasResultadoLocal representa un registro de la búsqueda DUAS para facturas locales
@@ -48,9 +100,36 @@ type DuasResultadoLocal struct {
 	EstadoDocumentoFiscal  string    `json:"estado_documento_fiscal" gorm:"column:ESTADO_DOCUMENTO_FISCAL"`
 	CodigoIntegracion      string    `json:"codigo_integracion" gorm:"column:CODIGO_INTEGRACION"`
 	URLSin                 string    `json:"url_sin" gorm:"column:URL_SIN"`
+
+	DatosBCBP `gorm:"-"`
+
+	// IDServidor y Servidor identifican la DbConnection de la que salió la
+	// fila (relevante al combinar varios servidores, ver DuasResultadoGlobal).
+	IDServidor uint   `json:"id_servidor" gorm:"-"`
+	Servidor   string `json:"servidor" gorm:"-"`
 }
 
 type DuasResultado struct {
 	ResultadosLocal   []DuasResultadoLocal
 	ResultadosCentral []DuasResultadoCentral
 }
+
+// DuasEstadoServidor es lo que aportó cada servidor a una búsqueda sobre
+// todos los servidores DUAS: cantidad de filas, o el error si falló (las
+// demás conexiones siguen y sus resultados se devuelven igual).
+type DuasEstadoServidor struct {
+	IDServidor uint   `json:"id_servidor"`
+	Servidor   string `json:"servidor"`
+	Tipo       string `json:"tipo"`
+	Resultados int    `json:"resultados"`
+	DuracionMs int64  `json:"duracion_ms"`
+	Error      string `json:"error,omitempty"`
+	Timeout    bool   `json:"timeout,omitempty"`
+}
+
+// DuasResultadoGlobal combina los resultados de varios servidores DUAS, con
+// el estado de cada uno en Servidores.
+type DuasResultadoGlobal struct {
+	DuasResultado
+	Servidores []DuasEstadoServidor `json:"servidores"`
+}
@@ -21,6 +21,10 @@ type FacturaAnulacion struct {
 	// archivo), ingresado una sola vez antes de importar y fijo para todas
 	// las filas del lote — mismo patrón que en FacturaPrevalorada.
 	Observacion string `json:"observacion" gorm:"type:varchar(255);not null"`
+	// ImportadoPor es el usuario que importó el lote (el de la sesión, o la
+	// cuenta de servicio si fue una API key). nil en lotes importados antes
+	// de la migración 0011.
+	ImportadoPor *uint `json:"importado_por" gorm:"index"`
 
 	// Etapa 1: datos importados del Excel. A diferencia de
 	// FacturaPrevalorada, CodigoIntegracion NO se genera acá: es el de la
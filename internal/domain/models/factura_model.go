@@ -120,6 +120,7 @@ type SFEReporteFacturador struct {
 	EventoFechaFin    time.Time `json:"evento_fecha_fin" gorm:"column:evento_fecha_fin"`
 
 	// Detalle de productos/items
+	IDDetalle         uint    `json:"id_detalle" gorm:"column:id_detalle"`
 	Cantidad          float64 `json:"cantidad" gorm:"column:cantidad"`
 	CodigoProductoSfe string  `json:"codigo_producto_sfe" gorm:"column:codigo_producto_sfe"`
 	Descripcion       string  `json:"descripcion" gorm:"column:descripcion"`
@@ -129,6 +130,23 @@ type SFEReporteFacturador struct {
 	UsuarioCreador string `json:"usuario_creador" gorm:"column:usuario_creador"`
 }
 
+// ResumenFacturacion es una fila de los agregados de facturación (ver
+// ConsultasService.ResumenFacturas): totales por la clave de agrupación
+// elegida (día, mes, sucursal, código de producto, tipo de emisión o
+// estado). MontoTotalDocumentos suma monto_total una vez por documento; es
+// nil al agrupar por código de producto, donde un documento cae en varios
+// grupos.
+type ResumenFacturacion struct {
+	Clave                string   `json:"clave" gorm:"column:clave"`
+	Descripcion          string   `json:"descripcion,omitempty" gorm:"column:descripcion"`
+	CantidadDocumentos   int      `json:"cantidad_documentos" gorm:"column:cantidad_documentos"`
+	CantidadItems        int      `json:"cantidad_items" gorm:"column:cantidad_items"`
+	Cantidad             float64  `json:"cantidad" gorm:"column:cantidad"`
+	TotalDetalle         float64  `json:"total_detalle" gorm:"column:total_detalle"`
+	MontoTotalDocumentos *float64 `json:"monto_total_documentos" gorm:"column:monto_total_documentos"`
+	EsTotal              bool     `json:"-" gorm:"column:es_total"`
+}
+
 type SFE_factura struct {
 	NumeroFactura         string `gorm:"column:numero_factura" json:"numero_factura"`
 	NombreRazonSolcial    string `gorm:"column:nombre_razon_social" json:"nombre_razon_social"`
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+// Resultados de IntentoLogin.
+const (
+	LoginExitoso = "exitoso"
+	// LoginFallido: usuario inexistente o inactivo, o contraseña incorrecta
+	// (el motivo queda en Motivo; al cliente siempre se le responde lo
+	// mismo).
+	LoginFallido = "fallido"
+	// LoginBloqueado: el intento se rechazó sin verificar la contraseña,
+	// por el bloqueo del usuario o por demasiados fallos desde la IP.
+	LoginBloqueado = "bloqueado"
+	// LoginSegundoFactor: contraseña correcta de un usuario con TOTP
+	// activo; el resultado final queda en el intento del segundo paso.
+	LoginSegundoFactor = "segundo_factor"
+)
+
+// IntentoLogin registra cada intento de POST /auth/login y de POST
+// /auth/login/2fa. Además de historial consultable (GET /intentos-login),
+// los fallidos por IP de los últimos minutos son los que limitan los
+// intentos desde esa IP (ver services.PoliticaLogin).
+type IntentoLogin struct {
+	ID uint `json:"id" gorm:"primaryKey"`
+	// UsuarioID es nil si el codigo_usuario no existe.
+	UsuarioID     *uint     `json:"usuario_id" gorm:"index"`
+	CodigoUsuario string    `json:"codigo_usuario" gorm:"type:varchar(50);not null;index"`
+	IP            string    `json:"ip" gorm:"type:varchar(64);not null;index:idx_intentos_login_ip_fecha,priority:1"`
+	UserAgent     string    `json:"user_agent" gorm:"type:varchar(255)"`
+	Resultado     string    `json:"resultado" gorm:"type:varchar(20);not null;index"`
+	Motivo        string    `json:"motivo" gorm:"type:varchar(100)"`
+	CreatedAt     time.Time `json:"created_at" gorm:"index;index:idx_intentos_login_ip_fecha,priority:2"`
+}
+
+func (IntentoLogin) TableName() string { return "intentos_login" }
@@ -17,6 +17,13 @@ type LogEnvio struct {
 	// Origen distingue si el envío lo disparó el usuario (botón "Facturar"/
 	// "Anular") o el EnvioWorker en background.
 	Origen string `json:"origen" gorm:"type:varchar(20);not null"` // "manual" | "automatico"
+	// UsuarioID es quien apretó el botón en un envío manual; nil en los del
+	// EnvioWorker. UsuarioCodigo y UsuarioNombre no son columnas: los llena
+	// LogEnvioRepository.GetAll con un join, para no exponer el resto del
+	// usuario (rol, bloqueo, 2FA) a quien solo puede ver facturas.
+	UsuarioID     *uint  `json:"usuario_id" gorm:"index"`
+	UsuarioCodigo string `json:"usuario_codigo" gorm:"->;-:migration"`
+	UsuarioNombre string `json:"usuario_nombre" gorm:"->;-:migration"`
 	// Resultado es el desenlace del intento: "aceptado"/"rechazado" (el
 	// facturador respondió) o "error" (fallo de transporte).
 	Resultado string    `json:"resultado" gorm:"type:varchar(20);not null;index"`
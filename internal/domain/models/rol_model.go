@@ -0,0 +1,105 @@
+package models
+
+import "time"
+
+// Permisos: cada ruta protegida exige uno (ver middleware.RequirePermiso).
+// Los permisos dicen qué puede hacer el usuario; sobre qué sucursales lo
+// sigue diciendo su acceso por sucursal (UsuarioService.TieneAccesoSucursal).
+const (
+	PermisoConsultasVer     = "consultas.ver"
+	PermisoFacturasVer      = "facturas.ver"
+	PermisoLotesImportar    = "lotes.importar"
+	PermisoLotesAprobar     = "lotes.aprobar"
+	PermisoFacturasEnviar   = "facturas.enviar"
+	PermisoFacturasAnular   = "facturas.anular"
+	PermisoConexionesVer    = "conexiones.ver"
+	PermisoConexionesEditar = "conexiones.gestionar"
+	PermisoUsuariosEditar   = "usuarios.gestionar"
+	PermisoCatalogoEditar   = "catalogo.gestionar"
+	PermisoFacturadorEditar = "sucursales_facturador.gestionar"
+	PermisoApiKeysEditar    = "api_keys.gestionar"
+	PermisoAuditoriaVer     = "auditoria.ver"
+	PermisoSistemaAdmin     = "sistema.administrar"
+)
+
+// PermisoInfo describe un permiso para el formulario de roles.
+type PermisoInfo struct {
+	Nombre      string `json:"nombre"`
+	Descripcion string `json:"descripcion"`
+}
+
+// Permisos es el catálogo completo, en el orden en que se muestra.
+var Permisos = []PermisoInfo{
+	{PermisoConsultasVer, "Consultar facturas y DUAS de los facturadores, y exportar"},
+	{PermisoFacturasVer, "Ver facturas prevaloradas y de anulación, sus lotes y los logs de envío"},
+	{PermisoLotesImportar, "Importar lotes desde Excel"},
+	// todavía no hay flujo de aprobación de lotes: el permiso queda
+	// reservado para poder asignarlo en los roles desde ya
+	{PermisoLotesAprobar, "Aprobar lotes importados"},
+	{PermisoFacturasEnviar, "Enviar manualmente facturas prevaloradas al facturador"},
+	{PermisoFacturasAnular, "Anular facturas"},
+	{PermisoConexionesVer, "Ver las conexiones a bases de datos"},
+	{PermisoConexionesEditar, "Crear, editar, probar y eliminar conexiones a bases de datos"},
+	{PermisoUsuariosEditar, "Administrar usuarios, sus accesos, sesiones y roles"},
+	{PermisoCatalogoEditar, "Administrar regionales y el catálogo de sucursales"},
+	{PermisoFacturadorEditar, "Administrar las sucursales facturador (FacturaClic)"},
+	{PermisoApiKeysEditar, "Administrar las API keys de integraciones"},
+	{PermisoAuditoriaVer, "Consultar y exportar la auditoría de acciones"},
+	{PermisoSistemaAdmin, "Rotar la clave de cifrado y forzar chequeos de salud"},
+}
+
+// EsPermiso indica si el nombre está en el catálogo.
+func EsPermiso(nombre string) bool {
+	for _, permiso := range Permisos {
+		if permiso.Nombre == nombre {
+			return true
+		}
+	}
+	return false
+}
+
+// Rol agrupa permisos; Usuario.Rol guarda el nombre. Los roles de sistema
+// (admin, operador, auditor) se crean en la migración y no se pueden
+// eliminar ni renombrar; admin además tiene siempre todos los permisos,
+// incluidos los que se agreguen más adelante.
+type Rol struct {
+	ID          uint     `json:"id" gorm:"primaryKey"`
+	Nombre      string   `json:"nombre" gorm:"type:varchar(20);not null;uniqueIndex"`
+	Descripcion string   `json:"descripcion" gorm:"type:varchar(255)"`
+	Permisos    []string `json:"permisos" gorm:"type:jsonb;serializer:json;not null"`
+	Sistema     bool     `json:"sistema" gorm:"not null;default:false"`
+	// Requiere2FA obliga a los usuarios del rol a enrolar TOTP: hasta que
+	// lo hagan solo pueden usar /auth (ver middleware.Require2FAConfigurado).
+	Requiere2FA bool      `json:"requiere_2fa" gorm:"column:requiere_2fa;not null;default:false"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (Rol) TableName() string { return "roles" }
+
+// PermisosEfectivos son los permisos del rol (todos, para admin).
+func (r *Rol) PermisosEfectivos() []string {
+	if r.Nombre == RolAdmin {
+		permisos := make([]string, len(Permisos))
+		for i, permiso := range Permisos {
+			permisos[i] = permiso.Nombre
+		}
+		return permisos
+	}
+	return r.Permisos
+}
+
+// Tiene indica si el rol tiene alguno de los permisos dados.
+func (r *Rol) Tiene(permisos ...string) bool {
+	if r.Nombre == RolAdmin {
+		return true
+	}
+	for _, propio := range r.Permisos {
+		for _, permiso := range permisos {
+			if propio == permiso {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package models
+
+import "time"
+
+// Motivos de revocación de una Sesion.
+const (
+	SesionCerrada           = "logout"
+	SesionRevocadaAdmin     = "revocada_por_admin"
+	SesionUsuarioInactivo   = "usuario_inactivo"
+	SesionCambioRol         = "cambio_de_rol"
+	SesionPasswordReseteada = "password_reseteada"
+	SesionUsuarioEliminado  = "usuario_eliminado"
+	// SesionSegundoFactorReseteado: un admin le reseteó el TOTP.
+	SesionSegundoFactorReseteado = "segundo_factor_reseteado"
+	// SesionReusoRefresh: se presentó un refresh token ya rotado, señal de
+	// que alguien más lo tiene; se revoca la sesión entera.
+	SesionReusoRefresh = "reuso_refresh_token"
+)
+
+// Sesion es una sesión de login del lado del servidor. El JWT de acceso
+// (corto, ver pkg/utils/jwt.go) lleva el ID de la sesión y RequireAuth la
+// verifica en cada request, así revocarla corta el acceso de inmediato. El
+// refresh token rota en cada POST /auth/refresh; de la sesión solo se
+// guarda su SHA-256.
+type Sesion struct {
+	ID          uint   `json:"id" gorm:"primaryKey"`
+	UsuarioID   uint   `json:"usuario_id" gorm:"not null;index"`
+	RefreshHash string `json:"-" gorm:"type:char(64);not null;uniqueIndex"`
+	// RefreshHashAnterior es el refresh token previo a la última rotación,
+	// para detectar su reuso.
+	RefreshHashAnterior string     `json:"-" gorm:"type:char(64);index"`
+	IP                  string     `json:"ip" gorm:"type:varchar(64)"`
+	UserAgent           string     `json:"user_agent" gorm:"type:varchar(255)"`
+	CreatedAt           time.Time  `json:"created_at"`
+	RenovadaEn          *time.Time `json:"renovada_en"`
+	// ExpiraEn vence el refresh token: cada renovación la corre
+	// REFRESH_TOKEN_DIAS hacia adelante.
+	ExpiraEn         time.Time  `json:"expira_en" gorm:"not null"`
+	RevocadaEn       *time.Time `json:"revocada_en"`
+	MotivoRevocacion string     `json:"motivo_revocacion,omitempty" gorm:"type:varchar(50)"`
+}
+
+func (Sesion) TableName() string { return "sesiones" }
+
+// Activa indica si la sesión no está revocada ni vencida.
+func (s *Sesion) Activa(ahora time.Time) bool {
+	return s.RevocadaEn == nil && s.ExpiraEn.After(ahora)
+}
@@ -0,0 +1,60 @@
+package models
+
+import "time"
+
+// Tipos de DiferenciaCatalogo.
+const (
+	// DiferenciaNueva: el código está en SFE_SUCURSAL y no en el catálogo
+	// (o está eliminado ahí: aplicarla lo restaura).
+	DiferenciaNueva = "nueva"
+	// DiferenciaRenombrada: el código está en los dos con otro nombre.
+	DiferenciaRenombrada = "renombrada"
+	// DiferenciaFaltante: el código está en el catálogo y no en
+	// SFE_SUCURSAL; aplicarla lo elimina del catálogo.
+	DiferenciaFaltante = "faltante"
+)
+
+// Estados de SincronizacionCatalogo.
+const (
+	SincronizacionSinCambios = "sin_cambios"
+	SincronizacionPendiente  = "pendiente"
+	SincronizacionParcial    = "parcial"
+	SincronizacionAplicada   = "aplicada"
+)
+
+// DiferenciaCatalogo es una diferencia entre sucursales_catalogo y el
+// SFE_SUCURSAL de un facturador, por código SIN.
+type DiferenciaCatalogo struct {
+	Tipo              string `json:"tipo"`
+	CodigoSucursalSin int    `json:"codigo_sucursal_sin"`
+	NombreCatalogo    string `json:"nombre_catalogo,omitempty"`
+	NombreSFE         string `json:"nombre_sfe,omitempty"`
+	// SucursalID y RegionalID son la fila del catálogo (la eliminada, en
+	// una "nueva" que se restaura); en una "nueva" sin fila previa la
+	// regional se elige al aplicar.
+	SucursalID *uint      `json:"sucursal_id,omitempty"`
+	RegionalID *uint      `json:"regional_id,omitempty"`
+	Aplicada   bool       `json:"aplicada"`
+	AplicadaEn *time.Time `json:"aplicada_en,omitempty"`
+}
+
+// SincronizacionCatalogo es una comparación del catálogo contra el
+// SFE_SUCURSAL de una DbConnection, con las diferencias que encontró y
+// cuáles se aplicaron (historial de sincronizaciones).
+type SincronizacionCatalogo struct {
+	ID             uint                 `json:"id" gorm:"primaryKey"`
+	DbConnectionID uint                 `json:"db_connection_id" gorm:"not null;index"`
+	ServerName     string               `json:"server_name" gorm:"type:varchar(100)"`
+	UsuarioID      *uint                `json:"usuario_id"`
+	Estado         string               `json:"estado" gorm:"type:varchar(20);not null;default:'pendiente'"`
+	TotalSFE       int                  `json:"total_sfe"`
+	Diferencias    []DiferenciaCatalogo `json:"diferencias" gorm:"type:jsonb;serializer:json"`
+	// AplicadaPorID/AplicadaEn son del último aplicar (puede haber varios
+	// si se aplica de a partes).
+	AplicadaPorID *uint      `json:"aplicada_por_id"`
+	AplicadaEn    *time.Time `json:"aplicada_en"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+func (SincronizacionCatalogo) TableName() string { return "sincronizaciones_catalogo" }
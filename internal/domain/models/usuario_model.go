@@ -36,7 +36,8 @@ type SucursalCatalogo struct {
 func (SucursalCatalogo) TableName() string { return "sucursales_catalogo" }
 
 // Usuario representa a un operador del sistema, autenticado con
-// codigo_usuario + password (login vía JWT, ver pkg/utils/jwt.go).
+// codigo_usuario + password (login vía JWT, ver pkg/utils/jwt.go) y, si lo
+// tiene activo, un código TOTP.
 type Usuario struct {
 	ID            uint              `json:"id" gorm:"primaryKey"`
 	Nombre        string            `json:"nombre" gorm:"type:varchar(150);not null"`
@@ -49,31 +50,60 @@ type Usuario struct {
 	SucursalID    *uint             `json:"sucursal_id"`
 	Sucursal      *SucursalCatalogo `json:"sucursal,omitempty" gorm:"foreignKey:SucursalID"`
 	IsActive      bool              `json:"is_active" gorm:"default:true"`
-	// Rol controla qué módulos puede usar: "admin" ve y opera todo; "operador"
-	// no puede ver ni operar los módulos de Usuarios ni Sucursales Facturador
-	// (ver middleware.RequireAdmin y RequireAdmin.tsx en el front).
+	// MustChangePassword queda en true al crear el usuario y al resetearle
+	// la contraseña (las dos la dejan igual al CI): hasta que la cambie con
+	// POST /auth/change-password no puede usar ninguna otra ruta protegida
+	// (ver middleware.RequirePasswordVigente).
+	MustChangePassword bool `json:"must_change_password" gorm:"not null;default:false"`
+	// PasswordCambiadoEn es la última vez que el propio usuario cambió su
+	// contraseña; nil si nunca lo hizo.
+	PasswordCambiadoEn *time.Time `json:"password_cambiado_en"`
+	// IntentosFallidos cuenta los logins fallidos seguidos (vuelve a 0 con
+	// un login exitoso o al desbloquearlo un admin). Desde el tercero cada
+	// intento tiene que esperar más desde UltimoIntentoFallido, y al llegar
+	// a LOGIN_MAX_INTENTOS queda bloqueado hasta BloqueadoHasta.
+	IntentosFallidos     int        `json:"intentos_fallidos" gorm:"not null;default:0"`
+	UltimoIntentoFallido *time.Time `json:"ultimo_intento_fallido"`
+	BloqueadoHasta       *time.Time `json:"bloqueado_hasta"`
+	// Rol es el nombre del Rol del usuario, que define sus permisos (ver
+	// middleware.RequirePermiso); "admin" tiene todos.
 	Rol string `json:"rol" gorm:"type:varchar(20);not null;default:'operador'"`
-	// AccesoTotal otorga acceso a todas las sucursales sin importar
-	// SucursalesPermitidasCodigos.
+	// AccesoTotal otorga acceso a todas las sucursales; si es false, las
+	// sucursales permitidas son sus filas vigentes de UsuarioSucursalAcceso.
 	AccesoTotal bool `json:"acceso_total" gorm:"default:false"`
-	// SucursalesPermitidasCodigos es la colección de códigos SIN de sucursal
-	// a los que puede acceder este usuario, como texto separado por comas
-	// (ej. "1,6,7") — reemplaza las antiguas tablas de acceso por
-	// regional/sucursal (usuario_accesos_regional/usuario_accesos_sucursal).
-	// Verificar acceso a una sucursal es una simple búsqueda del código SIN
-	// dentro de este texto (ver UsuarioService.TieneAccesoSucursal). El
-	// front sigue armando la selección por regional/sucursal vía IDs (más
-	// cómodo de mostrar agrupado); el backend resuelve esos IDs a códigos
-	// SIN al guardar.
-	SucursalesPermitidasCodigos string         `json:"sucursales_permitidas_codigos" gorm:"type:text"`
-	CreatedAt                   time.Time      `json:"created_at"`
-	UpdatedAt                   time.Time      `json:"updated_at"`
-	DeletedAt                   gorm.DeletedAt `json:"-" gorm:"index"`
+	// EsServicio marca la cuenta de servicio de una ApiKey: no inicia
+	// sesión, no aparece en /usuarios y se administra desde /api-keys.
+	EsServicio bool `json:"es_servicio" gorm:"not null;default:false"`
+	// TotpSecreto es el secreto del segundo factor, cifrado con
+	// utils.Encrypt. Se guarda al iniciar el enrolamiento, pero el login
+	// recién lo pide cuando TotpActivo (después de confirmar un código).
+	TotpSecreto    string     `json:"-" gorm:"type:text"`
+	TotpActivo     bool       `json:"totp_activo" gorm:"not null;default:false"`
+	TotpActivadoEn *time.Time `json:"totp_activado_en"`
+	// TotpUltimoPaso es el paso de 30 s del último código aceptado: un
+	// código no se puede usar dos veces.
+	TotpUltimoPaso int64          `json:"-" gorm:"not null;default:0"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+	DeletedAt      gorm.DeletedAt `json:"-" gorm:"index"`
 }
 
 func (Usuario) TableName() string { return "usuarios" }
 
+// HistorialPassword guarda los hashes de contraseñas anteriores de un
+// usuario para no dejarlo reutilizar las últimas (PASSWORD_HISTORIAL).
+type HistorialPassword struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	UsuarioID    uint      `json:"usuario_id" gorm:"not null;index"`
+	PasswordHash string    `json:"-" gorm:"type:varchar(255);not null"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func (HistorialPassword) TableName() string { return "historial_passwords" }
+
+// Roles de sistema (ver Rol).
 const (
 	RolAdmin    = "admin"
 	RolOperador = "operador"
+	RolAuditor  = "auditor"
 )
@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+// UsuarioSucursalAcceso es el acceso de un usuario a una sucursal del
+// catálogo. Va por el ID de la sucursal (no por el código SIN), así que
+// cambiarle el código en el catálogo no toca los accesos; eliminarla los
+// borra. Los usuarios con AccesoTotal no necesitan filas.
+type UsuarioSucursalAcceso struct {
+	ID                 uint              `json:"id" gorm:"primaryKey"`
+	UsuarioID          uint              `json:"usuario_id" gorm:"not null;uniqueIndex:idx_usuario_sucursal_acceso_par,priority:1"`
+	SucursalCatalogoID uint              `json:"sucursal_catalogo_id" gorm:"not null;uniqueIndex:idx_usuario_sucursal_acceso_par,priority:2;index"`
+	SucursalCatalogo   *SucursalCatalogo `json:"sucursal,omitempty" gorm:"foreignKey:SucursalCatalogoID"`
+	// VigenteDesde/VigenteHasta acotan el acceso en el tiempo (ej. un
+	// reemplazo temporal en otra sucursal); nil = sin límite de ese lado.
+	// Fuera de ese rango la fila existe pero no da acceso.
+	VigenteDesde *time.Time `json:"vigente_desde"`
+	VigenteHasta *time.Time `json:"vigente_hasta"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+func (UsuarioSucursalAcceso) TableName() string { return "usuario_sucursal_acceso" }
+
+// Vigente indica si el acceso vale en el momento dado.
+func (a *UsuarioSucursalAcceso) Vigente(ahora time.Time) bool {
+	return (a.VigenteDesde == nil || !a.VigenteDesde.After(ahora)) &&
+		(a.VigenteHasta == nil || a.VigenteHasta.After(ahora))
+}
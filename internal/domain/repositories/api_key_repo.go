@@ -0,0 +1,90 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"managerfact/internal/domain/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ApiKeyRepository struct {
+	db *gorm.DB
+}
+
+func NewApiKeyRepository(db *gorm.DB) *ApiKeyRepository {
+	return &ApiKeyRepository{db: db}
+}
+
+// Transaccion corre fn con los repositorios de keys y de usuarios dentro de
+// una misma transacción (la key y su cuenta de servicio se crean y
+// modifican juntas).
+func (r *ApiKeyRepository) Transaccion(fn func(keys *ApiKeyRepository, usuarios *UsuarioRepository) error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&ApiKeyRepository{db: tx}, &UsuarioRepository{db: tx})
+	})
+}
+
+func (r *ApiKeyRepository) Create(key *models.ApiKey) error {
+	if err := r.db.Create(key).Error; err != nil {
+		return fmt.Errorf("error creando API key: %w", err)
+	}
+	return nil
+}
+
+// GetByID devuelve la key con su cuenta de servicio, o nil si no existe.
+func (r *ApiKeyRepository) GetByID(id uint) (*models.ApiKey, error) {
+	var key models.ApiKey
+	err := r.db.Preload("Usuario").First(&key, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error obteniendo API key: %w", err)
+	}
+	return &key, nil
+}
+
+// PorPrefijo busca la key por la parte pública del token, con su cuenta de
+// servicio; nil si no hay.
+func (r *ApiKeyRepository) PorPrefijo(prefijo string) (*models.ApiKey, error) {
+	var key models.ApiKey
+	err := r.db.Preload("Usuario").Where("prefijo = ?", prefijo).First(&key).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error obteniendo API key: %w", err)
+	}
+	return &key, nil
+}
+
+// GetAll lista las keys, las más nuevas primero (incluye revocadas y
+// vencidas).
+func (r *ApiKeyRepository) GetAll() ([]models.ApiKey, error) {
+	keys := []models.ApiKey{}
+	if err := r.db.Order("created_at DESC").Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("error obteniendo API keys: %w", err)
+	}
+	return keys, nil
+}
+
+func (r *ApiKeyRepository) Guardar(key *models.ApiKey) error {
+	if err := r.db.Omit("Usuario").Save(key).Error; err != nil {
+		return fmt.Errorf("error guardando API key: %w", err)
+	}
+	return nil
+}
+
+// RegistrarUso anota el último uso de la key. Solo escribe si el anterior
+// es más viejo que intervalo, para no hacer un UPDATE por request.
+func (r *ApiKeyRepository) RegistrarUso(id uint, ahora time.Time, ip string, intervalo time.Duration) error {
+	err := r.db.Model(&models.ApiKey{}).
+		Where("id = ? AND (ultimo_uso IS NULL OR ultimo_uso < ?)", id, ahora.Add(-intervalo)).
+		UpdateColumns(map[string]any{"ultimo_uso": ahora, "ultima_ip": ip}).Error
+	if err != nil {
+		return fmt.Errorf("error registrando uso de la API key %d: %w", id, err)
+	}
+	return nil
+}
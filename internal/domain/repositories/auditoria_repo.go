@@ -0,0 +1,102 @@
+package repositories
+
+import (
+	"fmt"
+	"managerfact/internal/domain/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type AuditoriaRepository struct {
+	db *gorm.DB
+}
+
+func NewAuditoriaRepository(db *gorm.DB) *AuditoriaRepository {
+	return &AuditoriaRepository{db: db}
+}
+
+// Create agrega un registro. No hay Update ni Delete: la tabla es de solo
+// inserción.
+func (r *AuditoriaRepository) Create(registro *models.Auditoria) error {
+	if err := r.db.Create(registro).Error; err != nil {
+		return fmt.Errorf("error registrando auditoría: %w", err)
+	}
+	return nil
+}
+
+// AuditoriaFiltro filtra la auditoría; los campos vacíos/nil se ignoran.
+type AuditoriaFiltro struct {
+	UsuarioID uint
+	Accion    string
+	Entidad   string
+	EntidadID string
+	Desde     *time.Time
+	Hasta     *time.Time
+}
+
+func (r *AuditoriaRepository) filtrar(filtro AuditoriaFiltro) *gorm.DB {
+	query := r.db.Model(&models.Auditoria{})
+	if filtro.UsuarioID != 0 {
+		query = query.Where("usuario_id = ?", filtro.UsuarioID)
+	}
+	if filtro.Accion != "" {
+		query = query.Where("accion = ?", filtro.Accion)
+	}
+	if filtro.Entidad != "" {
+		query = query.Where("entidad = ?", filtro.Entidad)
+	}
+	if filtro.EntidadID != "" {
+		query = query.Where("entidad_id = ?", filtro.EntidadID)
+	}
+	if filtro.Desde != nil {
+		query = query.Where("created_at >= ?", *filtro.Desde)
+	}
+	if filtro.Hasta != nil {
+		query = query.Where("created_at < ?", *filtro.Hasta)
+	}
+	return query
+}
+
+// Contar cuenta los registros que cumplen el filtro.
+func (r *AuditoriaRepository) Contar(filtro AuditoriaFiltro) (int64, error) {
+	var total int64
+	if err := r.filtrar(filtro).Count(&total).Error; err != nil {
+		return 0, fmt.Errorf("error contando auditoría: %w", err)
+	}
+	return total, nil
+}
+
+// GetPagina devuelve una página (desde 1) de registros, los más recientes
+// primero.
+func (r *AuditoriaRepository) GetPagina(filtro AuditoriaFiltro, page, pageSize int) ([]models.Auditoria, error) {
+	registros := []models.Auditoria{}
+	err := r.filtrar(filtro).
+		Order("created_at DESC, id DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&registros).Error
+	if err != nil {
+		return nil, fmt.Errorf("error obteniendo auditoría: %w", err)
+	}
+	return registros, nil
+}
+
+// Recorrer llama a fn con cada registro que cumple el filtro, en orden
+// cronológico y de a tandas, sin cargarlos todos en memoria (exportaciones
+// grandes).
+func (r *AuditoriaRepository) Recorrer(filtro AuditoriaFiltro, fn func(registro *models.Auditoria) error) error {
+	var tanda []models.Auditoria
+	err := r.filtrar(filtro).FindInBatches(&tanda, 500, func(tx *gorm.DB, _ int) error {
+		for i := range tanda {
+			if err := fn(&tanda[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}).Error
+	if err != nil {
+		return fmt.Errorf("error recorriendo auditoría: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"managerfact/internal/domain/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Resultados de CatalogoRepository.AsegurarRegional/AsegurarSucursal.
+const (
+	CatalogoCreado      = "creado"
+	CatalogoActualizado = "actualizado"
+	CatalogoSinCambios  = "sin_cambios"
+)
+
+// CatalogoRepository escribe el catálogo maestro de regionales y sucursales
+// (sucursales_catalogo). La lectura para accesos de usuario sigue en
+// UsuarioRepository.
+type CatalogoRepository struct {
+	db *gorm.DB
+}
+
+func NewCatalogoRepository(db *gorm.DB) *CatalogoRepository {
+	return &CatalogoRepository{db: db}
+}
+
+// Transaccion corre fn con un CatalogoRepository dentro de una transacción:
+// si fn devuelve error no queda nada a medias.
+func (r *CatalogoRepository) Transaccion(fn func(repo *CatalogoRepository) error) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		return fn(&CatalogoRepository{db: tx})
+	})
+}
+
+// AsegurarRegional devuelve la regional con ese nombre, creándola si no
+// existe.
+func (r *CatalogoRepository) AsegurarRegional(nombre string) (*models.Regional, string, error) {
+	var regional models.Regional
+	err := r.db.Where("nombre = ?", nombre).First(&regional).Error
+	if err == nil {
+		return &regional, CatalogoSinCambios, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, "", fmt.Errorf("error buscando regional %s: %w", nombre, err)
+	}
+	regional = models.Regional{Nombre: nombre}
+	if err := r.db.Create(&regional).Error; err != nil {
+		return nil, "", fmt.Errorf("error creando regional %s: %w", nombre, err)
+	}
+	return &regional, CatalogoCreado, nil
+}
+
+// AsegurarSucursal deja la sucursal codigoSucursalSin con ese nombre y
+// regional: la crea si no existe, la corrige si difiere y la restaura si
+// estaba eliminada (el índice único de codigo_sucursal_sin incluye las
+// eliminadas, así que no se puede crear otra con el mismo código).
+func (r *CatalogoRepository) AsegurarSucursal(codigoSucursalSin int, nombre string, regionalID uint) (string, error) {
+	var sucursal models.SucursalCatalogo
+	err := r.db.Unscoped().Where("codigo_sucursal_sin = ?", codigoSucursalSin).First(&sucursal).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		sucursal = models.SucursalCatalogo{CodigoSucursalSin: codigoSucursalSin, Nombre: nombre, RegionalID: regionalID}
+		if err := r.db.Create(&sucursal).Error; err != nil {
+			return "", fmt.Errorf("error creando sucursal %d %s: %w", codigoSucursalSin, nombre, err)
+		}
+		return CatalogoCreado, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("error buscando sucursal %d: %w", codigoSucursalSin, err)
+	}
+
+	if sucursal.Nombre == nombre && sucursal.RegionalID == regionalID && !sucursal.DeletedAt.Valid {
+		return CatalogoSinCambios, nil
+	}
+	err = r.db.Unscoped().Model(&models.SucursalCatalogo{}).Where("id = ?", sucursal.ID).Updates(map[string]interface{}{
+		"nombre":      nombre,
+		"regional_id": regionalID,
+		"deleted_at":  nil,
+	}).Error
+	if err != nil {
+		return "", fmt.Errorf("error actualizando sucursal %d %s: %w", codigoSucursalSin, nombre, err)
+	}
+	return CatalogoActualizado, nil
+}
+
+// ContarSucursales cuenta las sucursales del catálogo (no eliminadas).
+func (r *CatalogoRepository) ContarSucursales() (int64, error) {
+	var total int64
+	if err := r.db.Model(&models.SucursalCatalogo{}).Count(&total).Error; err != nil {
+		return 0, fmt.Errorf("error contando sucursales del catálogo: %w", err)
+	}
+	return total, nil
+}
+
+// RegionalPorID busca una regional no eliminada; si no existe el error
+// envuelve gorm.ErrRecordNotFound.
+func (r *CatalogoRepository) RegionalPorID(id uint) (*models.Regional, error) {
+	var regional models.Regional
+	if err := r.db.First(&regional, id).Error; err != nil {
+		return nil, fmt.Errorf("error obteniendo regional %d: %w", id, err)
+	}
+	return &regional, nil
+}
+
+// RegionalPorNombre busca por nombre incluyendo las eliminadas (el índice
+// único de nombre las incluye). Devuelve nil si no hay ninguna.
+func (r *CatalogoRepository) RegionalPorNombre(nombre string) (*models.Regional, error) {
+	var regional models.Regional
+	err := r.db.Unscoped().Where("nombre = ?", nombre).First(&regional).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error buscando regional %s: %w", nombre, err)
+	}
+	return &regional, nil
+}
+
+// GuardarRegional crea o actualiza la regional; Unscoped para poder
+// restaurar una eliminada (DeletedAt en cero).
+func (r *CatalogoRepository) GuardarRegional(regional *models.Regional) error {
+	if err := r.db.Unscoped().Save(regional).Error; err != nil {
+		return fmt.Errorf("error guardando regional %s: %w", regional.Nombre, err)
+	}
+	return nil
+}
+
+func (r *CatalogoRepository) EliminarRegional(id uint) error {
+	if err := r.db.Delete(&models.Regional{}, id).Error; err != nil {
+		return fmt.Errorf("error eliminando regional %d: %w", id, err)
+	}
+	return nil
+}
+
+// ContarSucursalesDeRegional cuenta las sucursales (no eliminadas) de la
+// regional.
+func (r *CatalogoRepository) ContarSucursalesDeRegional(regionalID uint) (int64, error) {
+	var total int64
+	if err := r.db.Model(&models.SucursalCatalogo{}).Where("regional_id = ?", regionalID).Count(&total).Error; err != nil {
+		return 0, fmt.Errorf("error contando sucursales de la regional %d: %w", regionalID, err)
+	}
+	return total, nil
+}
+
+// SucursalPorID busca una sucursal no eliminada, con su regional; si no
+// existe el error envuelve gorm.ErrRecordNotFound.
+func (r *CatalogoRepository) SucursalPorID(id uint) (*models.SucursalCatalogo, error) {
+	var sucursal models.SucursalCatalogo
+	if err := r.db.Preload("Regional").First(&sucursal, id).Error; err != nil {
+		return nil, fmt.Errorf("error obteniendo sucursal %d: %w", id, err)
+	}
+	return &sucursal, nil
+}
+
+// SucursalPorCodigo busca por código SIN incluyendo las eliminadas.
+// Devuelve nil si no hay ninguna.
+func (r *CatalogoRepository) SucursalPorCodigo(codigoSucursalSin int) (*models.SucursalCatalogo, error) {
+	var sucursal models.SucursalCatalogo
+	err := r.db.Unscoped().Where("codigo_sucursal_sin = ?", codigoSucursalSin).First(&sucursal).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error buscando sucursal %d: %w", codigoSucursalSin, err)
+	}
+	return &sucursal, nil
+}
+
+// GuardarSucursal crea o actualiza la sucursal; Unscoped para poder
+// restaurar una eliminada. Omite la asociación Regional para no
+// reescribirla con lo que venga precargado.
+func (r *CatalogoRepository) GuardarSucursal(sucursal *models.SucursalCatalogo) error {
+	if err := r.db.Unscoped().Omit("Regional").Save(sucursal).Error; err != nil {
+		return fmt.Errorf("error guardando sucursal %d %s: %w", sucursal.CodigoSucursalSin, sucursal.Nombre, err)
+	}
+	return nil
+}
+
+func (r *CatalogoRepository) EliminarSucursal(id uint) error {
+	if err := r.db.Delete(&models.SucursalCatalogo{}, id).Error; err != nil {
+		return fmt.Errorf("error eliminando sucursal %d: %w", id, err)
+	}
+	return nil
+}
+
+// QuitarAccesosSucursal borra los accesos de todos los usuarios a la
+// sucursal (incluidos los eliminados, para que no lo recuperen si se
+// restauran). Devuelve cuántos usuarios lo perdieron.
+func (r *CatalogoRepository) QuitarAccesosSucursal(sucursalID uint) (int, error) {
+	resultado := r.db.Where("sucursal_catalogo_id = ?", sucursalID).Delete(&models.UsuarioSucursalAcceso{})
+	if resultado.Error != nil {
+		return 0, fmt.Errorf("error quitando accesos a la sucursal %d: %w", sucursalID, resultado.Error)
+	}
+	return int(resultado.RowsAffected), nil
+}
+
+// SucursalesConEliminadas lista todo el catálogo, incluidas las sucursales
+// eliminadas (para comparar contra SFE_SUCURSAL sin proponer crear un
+// código que ya existe eliminado).
+func (r *CatalogoRepository) SucursalesConEliminadas() ([]models.SucursalCatalogo, error) {
+	var sucursales []models.SucursalCatalogo
+	if err := r.db.Unscoped().Order("codigo_sucursal_sin ASC").Find(&sucursales).Error; err != nil {
+		return nil, fmt.Errorf("error obteniendo catálogo de sucursales: %w", err)
+	}
+	return sucursales, nil
+}
+
+func (r *CatalogoRepository) CrearSincronizacion(sincronizacion *models.SincronizacionCatalogo) error {
+	if err := r.db.Create(sincronizacion).Error; err != nil {
+		return fmt.Errorf("error guardando sincronización: %w", err)
+	}
+	return nil
+}
+
+// SincronizacionPorID busca una sincronización; con bloquear toma la fila
+// con FOR UPDATE (para aplicar dentro de Transaccion sin que otro aplicar
+// la pise). Si no existe el error envuelve gorm.ErrRecordNotFound.
+func (r *CatalogoRepository) SincronizacionPorID(id uint, bloquear bool) (*models.SincronizacionCatalogo, error) {
+	query := r.db
+	if bloquear {
+		query = query.Clauses(clause.Locking{Strength: "UPDATE"})
+	}
+	var sincronizacion models.SincronizacionCatalogo
+	if err := query.First(&sincronizacion, id).Error; err != nil {
+		return nil, fmt.Errorf("error obteniendo sincronización %d: %w", id, err)
+	}
+	return &sincronizacion, nil
+}
+
+// ListarSincronizaciones devuelve el historial, más nuevas primero.
+func (r *CatalogoRepository) ListarSincronizaciones(limit int) ([]models.SincronizacionCatalogo, error) {
+	var sincronizaciones []models.SincronizacionCatalogo
+	if err := r.db.Order("created_at DESC").Limit(limit).Find(&sincronizaciones).Error; err != nil {
+		return nil, fmt.Errorf("error obteniendo sincronizaciones: %w", err)
+	}
+	return sincronizaciones, nil
+}
+
+func (r *CatalogoRepository) GuardarSincronizacion(sincronizacion *models.SincronizacionCatalogo) error {
+	if err := r.db.Save(sincronizacion).Error; err != nil {
+		return fmt.Errorf("error guardando sincronización %d: %w", sincronizacion.ID, err)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package repositories
+
+import (
+	"fmt"
+	"managerfact/internal/domain/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type ChequeoSaludRepository struct {
+	db *gorm.DB
+}
+
+func NewChequeoSaludRepository(db *gorm.DB) *ChequeoSaludRepository {
+	return &ChequeoSaludRepository{db: db}
+}
+
+// CreateLote guarda los chequeos de un ciclo del MonitorSalud.
+func (r *ChequeoSaludRepository) CreateLote(chequeos []models.ChequeoSalud) error {
+	if len(chequeos) == 0 {
+		return nil
+	}
+	if err := r.db.Create(&chequeos).Error; err != nil {
+		return fmt.Errorf("error guardando chequeos de salud: %w", err)
+	}
+	return nil
+}
+
+// Historial lista los chequeos de una dependencia, los más recientes
+// primero. Limit <= 0 usa un tope por defecto de 100.
+func (r *ChequeoSaludRepository) Historial(tipo string, recursoID uint, limit int) ([]models.ChequeoSalud, error) {
+	if limit <= 0 {
+		limit = 100
+	}
+	chequeos := []models.ChequeoSalud{}
+	err := r.db.Where("tipo = ? AND recurso_id = ?", tipo, recursoID).
+		Order("created_at DESC").Limit(limit).Find(&chequeos).Error
+	if err != nil {
+		return nil, fmt.Errorf("error obteniendo historial de salud: %w", err)
+	}
+	return chequeos, nil
+}
+
+// ResumenChequeos agrega el historial de una dependencia desde una fecha.
+type ResumenChequeos struct {
+	Tipo               string     `json:"tipo"`
+	RecursoID          uint       `json:"recurso_id"`
+	Total              int64      `json:"total"`
+	Fallidos           int64      `json:"fallidos"`
+	LatenciaPromedioMs float64    `json:"latencia_promedio_ms"`
+	UltimoOk           *time.Time `json:"ultimo_ok"`
+}
+
+// Resumen agrega, por dependencia, los chequeos hechos desde desde: total,
+// fallidos, latencia promedio de los exitosos y el último chequeo exitoso.
+func (r *ChequeoSaludRepository) Resumen(desde time.Time) ([]ResumenChequeos, error) {
+	var resumen []ResumenChequeos
+	err := r.db.Model(&models.ChequeoSalud{}).
+		Select(`tipo, recurso_id, COUNT(*) AS total,
+			SUM(CASE WHEN ok THEN 0 ELSE 1 END) AS fallidos,
+			COALESCE(AVG(CASE WHEN ok THEN latencia_ms END), 0) AS latencia_promedio_ms,
+			MAX(CASE WHEN ok THEN created_at END) AS ultimo_ok`).
+		Where("created_at >= ?", desde).
+		Group("tipo, recurso_id").
+		Scan(&resumen).Error
+	if err != nil {
+		return nil, fmt.Errorf("error resumiendo chequeos de salud: %w", err)
+	}
+	return resumen, nil
+}
+
+// PurgarAnteriores borra los chequeos más viejos que antesDe y devuelve
+// cuántos se borraron.
+func (r *ChequeoSaludRepository) PurgarAnteriores(antesDe time.Time) (int64, error) {
+	result := r.db.Where("created_at < ?", antesDe).Delete(&models.ChequeoSalud{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("error purgando chequeos de salud: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
@@ -24,6 +24,7 @@ type DbConnectionRepository interface {
 	TestConnection(id uint) error
 	Count() (int64, error)
 	GetPaginated(offset, limit int) ([]models.DbConnection, int64, error)
+	UpdatePassword(id uint, anterior, passwordCifrado string) (bool, error)
 }
 
 // dbConnectionRepository implementación del repositorio
@@ -227,3 +228,19 @@ func (r *dbConnectionRepository) GetPaginated(offset, limit int) ([]models.DbCon
 
 	return connections, total, nil
 }
+
+// UpdatePassword reemplaza solo la contraseña cifrada (migración de
+// contraseñas en claro y rotación de claves), sin tocar updated_at ni pasar
+// por las validaciones de Update. Solo escribe si la contraseña guardada
+// sigue siendo anterior: devuelve false si alguien la editó entre la
+// lectura y la escritura.
+func (r *dbConnectionRepository) UpdatePassword(id uint, anterior, passwordCifrado string) (bool, error) {
+	result := r.db.Model(&models.DbConnection{}).Where("id = ? AND password = ?", id, anterior).UpdateColumns(map[string]interface{}{
+		"password":         passwordCifrado,
+		"password_cifrado": true,
+	})
+	if result.Error != nil {
+		return false, fmt.Errorf("error actualizando contraseña de conexión: %v", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
@@ -19,15 +19,20 @@ type LoteResumenAnulacion struct {
 	// CodigoSucursalSin no se serializa: solo se usa para filtrar el lote por
 	// las sucursales permitidas del usuario (ver
 	// FacturaAnulacionService.ListarLotes).
-	CodigoSucursalSin int       `json:"-"`
-	Observacion       string    `json:"observacion"`
-	Total             int64     `json:"total"`
-	Pendientes        int64     `json:"pendientes"`
-	Enviados          int64     `json:"enviados"`
-	Aceptados         int64     `json:"aceptados"`
-	Rechazados        int64     `json:"rechazados"`
-	ConError          int64     `json:"con_error"`
-	FechaImportacion  time.Time `json:"fecha_importacion"`
+	CodigoSucursalSin int `json:"-"`
+	// ImportadoPor es el usuario que importó el lote (nil en lotes
+	// anteriores a la migración 0011), con su código y nombre.
+	ImportadoPor       *uint     `json:"importado_por"`
+	ImportadoPorCodigo string    `json:"importado_por_codigo"`
+	ImportadoPorNombre string    `json:"importado_por_nombre"`
+	Observacion        string    `json:"observacion"`
+	Total              int64     `json:"total"`
+	Pendientes         int64     `json:"pendientes"`
+	Enviados           int64     `json:"enviados"`
+	Aceptados          int64     `json:"aceptados"`
+	Rechazados         int64     `json:"rechazados"`
+	ConError           int64     `json:"con_error"`
+	FechaImportacion   time.Time `json:"fecha_importacion"`
 }
 
 type FacturaAnulacionRepository struct {
@@ -86,11 +91,14 @@ func (r *FacturaAnulacionRepository) GetByID(id uint) (*models.FacturaAnulacion,
 	return &factura, nil
 }
 
-// GetAll lista facturas de anulación, filtrando opcionalmente por estado y/o
-// lote_id (ambos vacíos = sin filtro).
-func (r *FacturaAnulacionRepository) GetAll(estado, loteID string) ([]models.FacturaAnulacion, error) {
+// GetAll lista las facturas de anulación de sucursales que el usuario puede
+// ver, filtrando opcionalmente por estado y/o lote_id (ambos vacíos = sin
+// filtro).
+func (r *FacturaAnulacionRepository) GetAll(usuarioID uint, estado, loteID string) ([]models.FacturaAnulacion, error) {
 	facturas := []models.FacturaAnulacion{}
-	query := r.db.Preload("SucursalFacturador")
+	visibles := r.db.Model(&models.SucursalFacturador{}).Select("id").
+		Scopes(sucursalVisible("codigo_sucursal_sin", usuarioID))
+	query := r.db.Preload("SucursalFacturador").Where("sucursal_facturador_id IN (?)", visibles)
 	if estado != "" {
 		query = query.Where("estado = ?", estado)
 	}
@@ -120,9 +128,10 @@ func (r *FacturaAnulacionRepository) GetPendientesParaEnvio() ([]models.FacturaA
 }
 
 // GetLotes agrega las facturas de anulación por lote_id: sucursal y
-// observación con las que se cargó el lote, total de filas y desglose por
-// estado.
-func (r *FacturaAnulacionRepository) GetLotes() ([]LoteResumenAnulacion, error) {
+// observación con las que se cargó el lote, quién lo importó, total de filas
+// y desglose por estado. Solo incluye lotes de sucursales que el usuario
+// puede ver y, si importadoPor no es 0, los que importó ese usuario.
+func (r *FacturaAnulacionRepository) GetLotes(usuarioID, importadoPor uint) ([]LoteResumenAnulacion, error) {
 	lotes := []LoteResumenAnulacion{}
 	err := r.db.Table("facturas_anulacion AS fa").
 		Select(`
@@ -131,6 +140,9 @@ func (r *FacturaAnulacionRepository) GetLotes() ([]LoteResumenAnulacion, error)
 			sf.nombre AS sucursal_facturador_nombre,
 			sf.codigo_sucursal_sin,
 			MIN(fa.observacion) AS observacion,
+			fa.importado_por,
+			COALESCE(u.codigo_usuario, '') AS importado_por_codigo,
+			COALESCE(u.nombre, '') AS importado_por_nombre,
 			COUNT(*) AS total,
 			COUNT(*) FILTER (WHERE fa.estado = 'pendiente') AS pendientes,
 			COUNT(*) FILTER (WHERE fa.estado = 'enviado') AS enviados,
@@ -140,8 +152,10 @@ func (r *FacturaAnulacionRepository) GetLotes() ([]LoteResumenAnulacion, error)
 			MIN(fa.created_at) AS fecha_importacion
 		`).
 		Joins("JOIN sucursales_facturador AS sf ON sf.id = fa.sucursal_facturador_id").
+		Joins("LEFT JOIN usuarios AS u ON u.id = fa.importado_por").
 		Where("fa.deleted_at IS NULL").
-		Group("fa.lote_id, fa.sucursal_facturador_id, sf.nombre, sf.codigo_sucursal_sin").
+		Scopes(sucursalVisible("sf.codigo_sucursal_sin", usuarioID), importadoPorFiltro("fa.importado_por", importadoPor)).
+		Group("fa.lote_id, fa.sucursal_facturador_id, sf.nombre, sf.codigo_sucursal_sin, fa.importado_por, u.codigo_usuario, u.nombre").
 		Order("MIN(fa.created_at) DESC").
 		Scan(&lotes).Error
 	if err != nil {
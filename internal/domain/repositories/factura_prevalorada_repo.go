@@ -19,16 +19,21 @@ type LoteResumen struct {
 	// CodigoSucursalSin no se serializa: solo se usa para filtrar el lote por
 	// las sucursales permitidas del usuario (ver
 	// FacturaPrevaloradaService.ListarLotes).
-	CodigoSucursalSin int       `json:"-"`
-	Tipo              string    `json:"tipo"`
-	Observacion       string    `json:"observacion"`
-	Total             int64     `json:"total"`
-	Pendientes        int64     `json:"pendientes"`
-	Enviados          int64     `json:"enviados"`
-	Aceptados         int64     `json:"aceptados"`
-	Rechazados        int64     `json:"rechazados"`
-	ConError          int64     `json:"con_error"`
-	FechaImportacion  time.Time `json:"fecha_importacion"`
+	CodigoSucursalSin int `json:"-"`
+	// ImportadoPor es el usuario que importó el lote (nil en lotes
+	// anteriores a la migración 0011), con su código y nombre.
+	ImportadoPor       *uint     `json:"importado_por"`
+	ImportadoPorCodigo string    `json:"importado_por_codigo"`
+	ImportadoPorNombre string    `json:"importado_por_nombre"`
+	Tipo               string    `json:"tipo"`
+	Observacion        string    `json:"observacion"`
+	Total              int64     `json:"total"`
+	Pendientes         int64     `json:"pendientes"`
+	Enviados           int64     `json:"enviados"`
+	Aceptados          int64     `json:"aceptados"`
+	Rechazados         int64     `json:"rechazados"`
+	ConError           int64     `json:"con_error"`
+	FechaImportacion   time.Time `json:"fecha_importacion"`
 }
 
 type FacturaPrevaloradaRepository struct {
@@ -90,11 +95,14 @@ func (r *FacturaPrevaloradaRepository) GetByID(id uint) (*models.FacturaPrevalor
 	return &factura, nil
 }
 
-// GetAll lista facturas prevaloradas, filtrando opcionalmente por estado y/o
-// lote_id (ambos vacíos = sin filtro).
-func (r *FacturaPrevaloradaRepository) GetAll(estado, loteID string) ([]models.FacturaPrevalorada, error) {
+// GetAll lista las facturas prevaloradas de sucursales que el usuario puede
+// ver, filtrando opcionalmente por estado y/o lote_id (ambos vacíos = sin
+// filtro).
+func (r *FacturaPrevaloradaRepository) GetAll(usuarioID uint, estado, loteID string) ([]models.FacturaPrevalorada, error) {
 	facturas := []models.FacturaPrevalorada{}
-	query := r.db.Preload("SucursalFacturador")
+	visibles := r.db.Model(&models.SucursalFacturador{}).Select("id").
+		Scopes(sucursalVisible("codigo_sucursal_sin", usuarioID))
+	query := r.db.Preload("SucursalFacturador").Where("sucursal_facturador_id IN (?)", visibles)
 	if estado != "" {
 		query = query.Where("estado = ?", estado)
 	}
@@ -122,9 +130,23 @@ func (r *FacturaPrevaloradaRepository) GetPendientesParaEnvio() ([]models.Factur
 	return facturas, nil
 }
 
+// importadoPorFiltro es un scope que deja solo las filas de lotes que
+// importó el usuario importadoPor (0 = sin filtro). Lo usan los GetLotes de
+// prevaloradas y anulaciones.
+func importadoPorFiltro(columna string, importadoPor uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if importadoPor == 0 {
+			return db
+		}
+		return db.Where(columna+" = ?", importadoPor)
+	}
+}
+
 // GetLotes agrega las facturas prevaloradas por lote_id: sucursal/tipo con
-// los que se cargó el lote, total de filas y desglose por estado.
-func (r *FacturaPrevaloradaRepository) GetLotes() ([]LoteResumen, error) {
+// los que se cargó el lote, quién lo importó, total de filas y desglose por
+// estado. Solo incluye lotes de sucursales que el usuario puede ver y, si
+// importadoPor no es 0, los que importó ese usuario.
+func (r *FacturaPrevaloradaRepository) GetLotes(usuarioID, importadoPor uint) ([]LoteResumen, error) {
 	lotes := []LoteResumen{}
 	err := r.db.Table("facturas_prevaloradas AS fp").
 		Select(`
@@ -134,6 +156,9 @@ func (r *FacturaPrevaloradaRepository) GetLotes() ([]LoteResumen, error) {
 			sf.codigo_sucursal_sin,
 			fp.tipo,
 			MIN(fp.observacion) AS observacion,
+			fp.importado_por,
+			COALESCE(u.codigo_usuario, '') AS importado_por_codigo,
+			COALESCE(u.nombre, '') AS importado_por_nombre,
 			COUNT(*) AS total,
 			COUNT(*) FILTER (WHERE fp.estado = 'pendiente') AS pendientes,
 			COUNT(*) FILTER (WHERE fp.estado = 'enviado') AS enviados,
@@ -143,8 +168,10 @@ func (r *FacturaPrevaloradaRepository) GetLotes() ([]LoteResumen, error) {
 			MIN(fp.created_at) AS fecha_importacion
 		`).
 		Joins("JOIN sucursales_facturador AS sf ON sf.id = fp.sucursal_facturador_id").
+		Joins("LEFT JOIN usuarios AS u ON u.id = fp.importado_por").
 		Where("fp.deleted_at IS NULL").
-		Group("fp.lote_id, fp.sucursal_facturador_id, sf.nombre, sf.codigo_sucursal_sin, fp.tipo").
+		Scopes(sucursalVisible("sf.codigo_sucursal_sin", usuarioID), importadoPorFiltro("fp.importado_por", importadoPor)).
+		Group("fp.lote_id, fp.sucursal_facturador_id, sf.nombre, sf.codigo_sucursal_sin, fp.tipo, fp.importado_por, u.codigo_usuario, u.nombre").
 		Order("MIN(fp.created_at) DESC").
 		Scan(&lotes).Error
 	if err != nil {
@@ -0,0 +1,89 @@
+package repositories
+
+import (
+	"fmt"
+	"managerfact/internal/domain/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type IntentoLoginRepository struct {
+	db *gorm.DB
+}
+
+func NewIntentoLoginRepository(db *gorm.DB) *IntentoLoginRepository {
+	return &IntentoLoginRepository{db: db}
+}
+
+func (r *IntentoLoginRepository) Create(intento *models.IntentoLogin) error {
+	if err := r.db.Create(intento).Error; err != nil {
+		return fmt.Errorf("error registrando intento de login: %w", err)
+	}
+	return nil
+}
+
+// FallosDesdeIP cuenta los intentos fallidos desde la IP a partir de desde
+// y devuelve también la fecha del último (nil si no hubo).
+func (r *IntentoLoginRepository) FallosDesdeIP(ip string, desde time.Time) (int64, *time.Time, error) {
+	var resumen struct {
+		Total  int64
+		Ultimo *time.Time
+	}
+	err := r.db.Model(&models.IntentoLogin{}).
+		Select("COUNT(*) AS total, MAX(created_at) AS ultimo").
+		Where("ip = ? AND resultado = ? AND created_at >= ?", ip, models.LoginFallido, desde).
+		Scan(&resumen).Error
+	if err != nil {
+		return 0, nil, fmt.Errorf("error contando intentos fallidos de la IP: %w", err)
+	}
+	return resumen.Total, resumen.Ultimo, nil
+}
+
+// IntentoLoginFiltro filtra el historial de logins; los campos vacíos/nil
+// se ignoran.
+type IntentoLoginFiltro struct {
+	UsuarioID     uint
+	CodigoUsuario string
+	IP            string
+	Resultado     string
+	Desde         *time.Time
+	Hasta         *time.Time
+	Limit         int
+}
+
+// GetAll lista los intentos más recientes primero. Limit <= 0 usa un tope
+// por defecto de 200, como el listado de logs de envío.
+func (r *IntentoLoginRepository) GetAll(filtro IntentoLoginFiltro) ([]models.IntentoLogin, error) {
+	intentos := []models.IntentoLogin{}
+	query := r.db.Model(&models.IntentoLogin{})
+
+	if filtro.UsuarioID != 0 {
+		query = query.Where("usuario_id = ?", filtro.UsuarioID)
+	}
+	if filtro.CodigoUsuario != "" {
+		query = query.Where("codigo_usuario = ?", filtro.CodigoUsuario)
+	}
+	if filtro.IP != "" {
+		query = query.Where("ip = ?", filtro.IP)
+	}
+	if filtro.Resultado != "" {
+		query = query.Where("resultado = ?", filtro.Resultado)
+	}
+	if filtro.Desde != nil {
+		query = query.Where("created_at >= ?", *filtro.Desde)
+	}
+	if filtro.Hasta != nil {
+		query = query.Where("created_at < ?", *filtro.Hasta)
+	}
+
+	limit := filtro.Limit
+	if limit <= 0 {
+		limit = 200
+	}
+
+	if err := query.Order("created_at DESC, id DESC").Limit(limit).Find(&intentos).Error; err != nil {
+		return nil, fmt.Errorf("error obteniendo intentos de login: %w", err)
+	}
+	return intentos, nil
+}
@@ -29,27 +29,39 @@ type LogEnvioFiltro struct {
 	Resultado            string
 	Origen               string
 	SucursalFacturadorID uint
-	Limit                int
+	// UsuarioID deja solo los envíos manuales de ese usuario.
+	UsuarioID uint
+	Limit     int
 }
 
 // GetAll lista los logs más recientes primero, aplicando los filtros no
 // vacíos de LogEnvioFiltro. Limit <= 0 usa un tope por defecto de 200 para
-// no cargar la tabla entera en cada refresco del front.
+// no cargar la tabla entera en cada refresco del front. Del usuario solo
+// trae código y nombre (vacíos en los envíos automáticos).
 func (r *LogEnvioRepository) GetAll(filtro LogEnvioFiltro) ([]models.LogEnvio, error) {
 	logs := []models.LogEnvio{}
-	query := r.db.Preload("SucursalFacturador")
+	query := r.db.Preload("SucursalFacturador").
+		Select(`
+			logs_envio.*,
+			COALESCE(u.codigo_usuario, '') AS usuario_codigo,
+			COALESCE(u.nombre, '') AS usuario_nombre
+		`).
+		Joins("LEFT JOIN usuarios AS u ON u.id = logs_envio.usuario_id")
 
 	if filtro.Tipo != "" {
-		query = query.Where("tipo = ?", filtro.Tipo)
+		query = query.Where("logs_envio.tipo = ?", filtro.Tipo)
 	}
 	if filtro.Resultado != "" {
-		query = query.Where("resultado = ?", filtro.Resultado)
+		query = query.Where("logs_envio.resultado = ?", filtro.Resultado)
 	}
 	if filtro.Origen != "" {
-		query = query.Where("origen = ?", filtro.Origen)
+		query = query.Where("logs_envio.origen = ?", filtro.Origen)
 	}
 	if filtro.SucursalFacturadorID != 0 {
-		query = query.Where("sucursal_facturador_id = ?", filtro.SucursalFacturadorID)
+		query = query.Where("logs_envio.sucursal_facturador_id = ?", filtro.SucursalFacturadorID)
+	}
+	if filtro.UsuarioID != 0 {
+		query = query.Where("logs_envio.usuario_id = ?", filtro.UsuarioID)
 	}
 
 	limit := filtro.Limit
@@ -57,7 +69,7 @@ func (r *LogEnvioRepository) GetAll(filtro LogEnvioFiltro) ([]models.LogEnvio, e
 		limit = 200
 	}
 
-	if err := query.Order("created_at DESC").Limit(limit).Find(&logs).Error; err != nil {
+	if err := query.Order("logs_envio.created_at DESC").Limit(limit).Find(&logs).Error; err != nil {
 		return nil, fmt.Errorf("error obteniendo logs de envío: %w", err)
 	}
 	return logs, nil
@@ -0,0 +1,85 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"managerfact/internal/domain/models"
+
+	"gorm.io/gorm"
+)
+
+type RolRepository struct {
+	db *gorm.DB
+}
+
+func NewRolRepository(db *gorm.DB) *RolRepository {
+	return &RolRepository{db: db}
+}
+
+func (r *RolRepository) GetAll() ([]models.Rol, error) {
+	roles := []models.Rol{}
+	if err := r.db.Order("sistema DESC, nombre ASC").Find(&roles).Error; err != nil {
+		return nil, fmt.Errorf("error obteniendo roles: %w", err)
+	}
+	return roles, nil
+}
+
+func (r *RolRepository) GetByID(id uint) (*models.Rol, error) {
+	var rol models.Rol
+	if err := r.db.First(&rol, id).Error; err != nil {
+		return nil, fmt.Errorf("error obteniendo rol %d: %w", id, err)
+	}
+	return &rol, nil
+}
+
+// GetByNombre devuelve el rol o nil si no existe.
+func (r *RolRepository) GetByNombre(nombre string) (*models.Rol, error) {
+	var rol models.Rol
+	err := r.db.Where("nombre = ?", nombre).First(&rol).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error obteniendo rol %q: %w", nombre, err)
+	}
+	return &rol, nil
+}
+
+// DeUsuario devuelve el rol del usuario (activo y no eliminado) en una sola
+// consulta; nil si el usuario no existe o su rol tampoco.
+func (r *RolRepository) DeUsuario(usuarioID uint) (*models.Rol, error) {
+	var rol models.Rol
+	err := r.db.Joins("JOIN usuarios ON usuarios.rol = roles.nombre").
+		Where("usuarios.id = ? AND usuarios.deleted_at IS NULL", usuarioID).
+		First(&rol).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error obteniendo el rol del usuario: %w", err)
+	}
+	return &rol, nil
+}
+
+func (r *RolRepository) Guardar(rol *models.Rol) error {
+	if err := r.db.Save(rol).Error; err != nil {
+		return fmt.Errorf("error guardando rol: %w", err)
+	}
+	return nil
+}
+
+func (r *RolRepository) Eliminar(id uint) error {
+	if err := r.db.Delete(&models.Rol{}, id).Error; err != nil {
+		return fmt.Errorf("error eliminando rol: %w", err)
+	}
+	return nil
+}
+
+// ContarUsuarios cuenta los usuarios (no eliminados) con ese rol.
+func (r *RolRepository) ContarUsuarios(nombre string) (int64, error) {
+	var total int64
+	if err := r.db.Model(&models.Usuario{}).Where("rol = ?", nombre).Count(&total).Error; err != nil {
+		return 0, fmt.Errorf("error contando usuarios del rol: %w", err)
+	}
+	return total, nil
+}
@@ -0,0 +1,124 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"managerfact/internal/domain/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+type SesionRepository struct {
+	db *gorm.DB
+}
+
+func NewSesionRepository(db *gorm.DB) *SesionRepository {
+	return &SesionRepository{db: db}
+}
+
+func (r *SesionRepository) Create(sesion *models.Sesion) error {
+	if err := r.db.Create(sesion).Error; err != nil {
+		return fmt.Errorf("error creando sesión: %w", err)
+	}
+	return nil
+}
+
+// GetByID devuelve la sesión o nil si no existe.
+func (r *SesionRepository) GetByID(id uint) (*models.Sesion, error) {
+	var sesion models.Sesion
+	err := r.db.First(&sesion, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error obteniendo sesión: %w", err)
+	}
+	return &sesion, nil
+}
+
+// PorRefreshHash busca la sesión cuyo refresh token actual (o, con
+// anterior, el previo a la última rotación) tiene ese hash; nil si no hay.
+func (r *SesionRepository) PorRefreshHash(hash string, anterior bool) (*models.Sesion, error) {
+	columna := "refresh_hash"
+	if anterior {
+		columna = "refresh_hash_anterior"
+	}
+	var sesion models.Sesion
+	err := r.db.Where(columna+" = ?", hash).First(&sesion).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error obteniendo sesión: %w", err)
+	}
+	return &sesion, nil
+}
+
+// Rotar reemplaza el refresh token de la sesión si hashActual sigue siendo
+// el vigente y la sesión está activa, en un solo UPDATE: de dos
+// renovaciones simultáneas con el mismo token solo una gana. Devuelve
+// false si no se rotó.
+func (r *SesionRepository) Rotar(id uint, hashActual, hashNuevo string, ahora, expiraEn time.Time) (bool, error) {
+	result := r.db.Model(&models.Sesion{}).
+		Where("id = ? AND refresh_hash = ? AND revocada_en IS NULL AND expira_en > ?", id, hashActual, ahora).
+		Updates(map[string]interface{}{
+			"refresh_hash":          hashNuevo,
+			"refresh_hash_anterior": hashActual,
+			"renovada_en":           ahora,
+			"expira_en":             expiraEn,
+		})
+	if result.Error != nil {
+		return false, fmt.Errorf("error renovando sesión: %w", result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// Revocar revoca la sesión si todavía está activa; devuelve false si no
+// existía o ya estaba revocada.
+func (r *SesionRepository) Revocar(id uint, motivo string, ahora time.Time) (bool, error) {
+	result := r.db.Model(&models.Sesion{}).
+		Where("id = ? AND revocada_en IS NULL", id).
+		Updates(map[string]interface{}{"revocada_en": ahora, "motivo_revocacion": motivo})
+	if result.Error != nil {
+		return false, fmt.Errorf("error revocando sesión: %w", result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// RevocarDeUsuario revoca todas las sesiones activas del usuario y
+// devuelve cuántas eran.
+func (r *SesionRepository) RevocarDeUsuario(usuarioID uint, motivo string, ahora time.Time) (int64, error) {
+	result := r.db.Model(&models.Sesion{}).
+		Where("usuario_id = ? AND revocada_en IS NULL AND expira_en > ?", usuarioID, ahora).
+		Updates(map[string]interface{}{"revocada_en": ahora, "motivo_revocacion": motivo})
+	if result.Error != nil {
+		return 0, fmt.Errorf("error revocando sesiones del usuario: %w", result.Error)
+	}
+	return result.RowsAffected, nil
+}
+
+// ListarDeUsuario lista las sesiones del usuario, más nuevas primero; sin
+// todas, solo las activas.
+func (r *SesionRepository) ListarDeUsuario(usuarioID uint, todas bool, ahora time.Time) ([]models.Sesion, error) {
+	sesiones := []models.Sesion{}
+	query := r.db.Where("usuario_id = ?", usuarioID)
+	if !todas {
+		query = query.Where("revocada_en IS NULL AND expira_en > ?", ahora)
+	}
+	if err := query.Order("created_at DESC").Limit(200).Find(&sesiones).Error; err != nil {
+		return nil, fmt.Errorf("error obteniendo sesiones: %w", err)
+	}
+	return sesiones, nil
+}
+
+// EliminarVencidas borra las sesiones del usuario vencidas o revocadas
+// antes de antesDe (ya no sirven ni como historial).
+func (r *SesionRepository) EliminarVencidas(usuarioID uint, antesDe time.Time) error {
+	err := r.db.Where("usuario_id = ? AND (expira_en < ? OR revocada_en < ?)", usuarioID, antesDe, antesDe).
+		Delete(&models.Sesion{}).Error
+	if err != nil {
+		return fmt.Errorf("error depurando sesiones: %w", err)
+	}
+	return nil
+}
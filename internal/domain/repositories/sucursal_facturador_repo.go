@@ -52,6 +52,20 @@ func (r *SucursalFacturadorRepository) Update(sucursal *models.SucursalFacturado
 	return nil
 }
 
+// ActualizarTokenAcceso reemplaza solo el token cifrado (rotación de
+// claves), sin tocar updated_at ni el resto de la configuración. Solo
+// escribe si el token guardado sigue siendo anterior: devuelve false si
+// alguien lo cambió entre la lectura y la escritura.
+func (r *SucursalFacturadorRepository) ActualizarTokenAcceso(id uint, anterior, tokenCifrado string) (bool, error) {
+	result := r.db.Model(&models.SucursalFacturador{}).
+		Where("id = ? AND token_acceso = ?", id, anterior).
+		UpdateColumn("token_acceso", tokenCifrado)
+	if result.Error != nil {
+		return false, fmt.Errorf("error actualizando token de sucursal facturador: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
 // ActualizarEstadoConexion registra el resultado (conectividad, no
 // resultado de negocio) del último intento de envío al facturador de esta
 // sucursal — usado por el circuit breaker del EnvioWorker.
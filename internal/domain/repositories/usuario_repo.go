@@ -5,8 +5,7 @@ import (
 	"fmt"
 	"managerfact/internal/domain/models"
 	"sort"
-	"strconv"
-	"strings"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -52,9 +51,21 @@ func (r *UsuarioRepository) GetByCodigoUsuario(codigoUsuario string) (*models.Us
 	return &usuario, nil
 }
 
+// ExisteCodigoUsuario indica si ya hay un usuario (incluso eliminado, el
+// índice único los incluye) con ese código.
+func (r *UsuarioRepository) ExisteCodigoUsuario(codigoUsuario string) (bool, error) {
+	var total int64
+	err := r.db.Unscoped().Model(&models.Usuario{}).Where("codigo_usuario = ?", codigoUsuario).Count(&total).Error
+	if err != nil {
+		return false, fmt.Errorf("error verificando código de usuario: %w", err)
+	}
+	return total > 0, nil
+}
+
+// GetAll lista los usuarios, sin las cuentas de servicio de las API keys.
 func (r *UsuarioRepository) GetAll() ([]models.Usuario, error) {
 	var usuarios []models.Usuario
-	err := r.db.Preload("Regional").Preload("Sucursal").Order("nombre ASC").Find(&usuarios).Error
+	err := r.db.Preload("Regional").Preload("Sucursal").Where("NOT es_servicio").Order("nombre ASC").Find(&usuarios).Error
 	if err != nil {
 		return nil, fmt.Errorf("error obteniendo usuarios: %w", err)
 	}
@@ -68,6 +79,232 @@ func (r *UsuarioRepository) Update(usuario *models.Usuario) error {
 	return nil
 }
 
+// HashesPasswordsAnteriores devuelve los hashes de las últimas limit
+// contraseñas del usuario (sin la actual), más nuevas primero.
+func (r *UsuarioRepository) HashesPasswordsAnteriores(usuarioID uint, limit int) ([]string, error) {
+	var hashes []string
+	if limit <= 0 {
+		return hashes, nil
+	}
+	err := r.db.Model(&models.HistorialPassword{}).
+		Where("usuario_id = ?", usuarioID).
+		Order("created_at DESC, id DESC").
+		Limit(limit).
+		Pluck("password_hash", &hashes).Error
+	if err != nil {
+		return nil, fmt.Errorf("error leyendo historial de contraseñas: %w", err)
+	}
+	return hashes, nil
+}
+
+// ActualizarPassword reemplaza la contraseña del usuario y pasa la anterior
+// al historial, conservando solo las últimas conservar. mustChange y
+// cambiadoEn son los nuevos valores de must_change_password y
+// password_cambiado_en (nil deja el que tenía).
+func (r *UsuarioRepository) ActualizarPassword(usuario *models.Usuario, hashNuevo string, mustChange bool, cambiadoEn *time.Time, conservar int) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		campos := map[string]interface{}{
+			"password_hash":        hashNuevo,
+			"must_change_password": mustChange,
+		}
+		if cambiadoEn != nil {
+			campos["password_cambiado_en"] = *cambiadoEn
+		}
+		if err := tx.Model(&models.Usuario{}).Where("id = ?", usuario.ID).Updates(campos).Error; err != nil {
+			return fmt.Errorf("error actualizando contraseña: %w", err)
+		}
+
+		if err := tx.Create(&models.HistorialPassword{UsuarioID: usuario.ID, PasswordHash: usuario.PasswordHash}).Error; err != nil {
+			return fmt.Errorf("error guardando historial de contraseñas: %w", err)
+		}
+		conservados := tx.Model(&models.HistorialPassword{}).Select("id").
+			Where("usuario_id = ?", usuario.ID).
+			Order("created_at DESC, id DESC").
+			Limit(conservar)
+		err := tx.Where("usuario_id = ? AND id NOT IN (?)", usuario.ID, conservados).Delete(&models.HistorialPassword{}).Error
+		if err != nil {
+			return fmt.Errorf("error depurando historial de contraseñas: %w", err)
+		}
+
+		usuario.PasswordHash = hashNuevo
+		usuario.MustChangePassword = mustChange
+		if cambiadoEn != nil {
+			usuario.PasswordCambiadoEn = cambiadoEn
+		}
+		return nil
+	})
+}
+
+// RegistrarLoginFallido suma un intento fallido al usuario y, si con ese
+// llega a maxIntentos, lo bloquea hasta ahora+bloqueo. Se hace en un solo
+// UPDATE para que dos intentos simultáneos no pisen el contador.
+func (r *UsuarioRepository) RegistrarLoginFallido(id uint, ahora time.Time, maxIntentos int, bloqueo time.Duration) error {
+	err := r.db.Model(&models.Usuario{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"intentos_fallidos":      gorm.Expr("intentos_fallidos + 1"),
+		"ultimo_intento_fallido": ahora,
+		"bloqueado_hasta":        gorm.Expr("CASE WHEN intentos_fallidos + 1 >= ? THEN ?::timestamptz ELSE bloqueado_hasta END", maxIntentos, ahora.Add(bloqueo)),
+	}).Error
+	if err != nil {
+		return fmt.Errorf("error registrando intento fallido: %w", err)
+	}
+	return nil
+}
+
+// ReiniciarIntentosLogin pone en cero los intentos fallidos y quita el
+// bloqueo (login exitoso o desbloqueo manual).
+func (r *UsuarioRepository) ReiniciarIntentosLogin(id uint) error {
+	result := r.db.Model(&models.Usuario{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"intentos_fallidos":      0,
+		"ultimo_intento_fallido": nil,
+		"bloqueado_hasta":        nil,
+	})
+	if result.Error != nil {
+		return fmt.Errorf("error reiniciando intentos de login: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return fmt.Errorf("usuario con ID %d no encontrado", id)
+	}
+	return nil
+}
+
+// IniciarTotp guarda el secreto (ya cifrado) de un enrolamiento TOTP
+// pendiente de confirmar; reemplaza al de un enrolamiento anterior sin
+// confirmar.
+func (r *UsuarioRepository) IniciarTotp(id uint, secreto string) error {
+	err := r.db.Model(&models.Usuario{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"totp_secreto":     secreto,
+		"totp_activo":      false,
+		"totp_activado_en": nil,
+		"totp_ultimo_paso": 0,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("error guardando secreto TOTP: %w", err)
+	}
+	return nil
+}
+
+// ActivarTotp activa el segundo factor con el paso del código que lo
+// confirmó y reemplaza los códigos de recuperación por los dados (hashes).
+func (r *UsuarioRepository) ActivarTotp(id uint, paso int64, ahora time.Time, hashesRecuperacion []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.Usuario{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"totp_activo":      true,
+			"totp_activado_en": ahora,
+			"totp_ultimo_paso": paso,
+		}).Error
+		if err != nil {
+			return fmt.Errorf("error activando TOTP: %w", err)
+		}
+		return (&UsuarioRepository{db: tx}).ReemplazarCodigosRecuperacion(id, hashesRecuperacion)
+	})
+}
+
+// QuitarTotp desactiva el segundo factor, borra el secreto y los códigos de
+// recuperación.
+func (r *UsuarioRepository) QuitarTotp(id uint) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.Usuario{}).Where("id = ?", id).Updates(map[string]interface{}{
+			"totp_secreto":     "",
+			"totp_activo":      false,
+			"totp_activado_en": nil,
+			"totp_ultimo_paso": 0,
+		}).Error
+		if err != nil {
+			return fmt.Errorf("error quitando TOTP: %w", err)
+		}
+		if err := tx.Where("usuario_id = ?", id).Delete(&models.CodigoRecuperacion{}).Error; err != nil {
+			return fmt.Errorf("error borrando códigos de recuperación: %w", err)
+		}
+		return nil
+	})
+}
+
+// AvanzarPasoTotp registra el paso del código TOTP aceptado. Devuelve false
+// si ya se había aceptado ese paso o uno posterior (código reusado); se
+// hace en un solo UPDATE para que dos requests con el mismo código no
+// pasen las dos.
+func (r *UsuarioRepository) AvanzarPasoTotp(id uint, paso int64) (bool, error) {
+	result := r.db.Model(&models.Usuario{}).
+		Where("id = ? AND totp_ultimo_paso < ?", id, paso).
+		UpdateColumn("totp_ultimo_paso", paso)
+	if result.Error != nil {
+		return false, fmt.Errorf("error registrando código TOTP: %w", result.Error)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// ReemplazarCodigosRecuperacion borra los códigos de recuperación del
+// usuario y guarda los nuevos (hashes).
+func (r *UsuarioRepository) ReemplazarCodigosRecuperacion(usuarioID uint, hashes []string) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("usuario_id = ?", usuarioID).Delete(&models.CodigoRecuperacion{}).Error; err != nil {
+			return fmt.Errorf("error borrando códigos de recuperación: %w", err)
+		}
+		codigos := make([]models.CodigoRecuperacion, len(hashes))
+		for i, hash := range hashes {
+			codigos[i] = models.CodigoRecuperacion{UsuarioID: usuarioID, Hash: hash}
+		}
+		if len(codigos) == 0 {
+			return nil
+		}
+		if err := tx.Create(&codigos).Error; err != nil {
+			return fmt.Errorf("error guardando códigos de recuperación: %w", err)
+		}
+		return nil
+	})
+}
+
+// UsarCodigoRecuperacion marca como usado el código sin usar del usuario
+// con ese hash; false si no hay.
+func (r *UsuarioRepository) UsarCodigoRecuperacion(usuarioID uint, hash string, ahora time.Time) (bool, error) {
+	result := r.db.Model(&models.CodigoRecuperacion{}).
+		Where("usuario_id = ? AND hash = ? AND usado_en IS NULL", usuarioID, hash).
+		UpdateColumn("usado_en", ahora)
+	if result.Error != nil {
+		return false, fmt.Errorf("error usando código de recuperación: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// CodigosRecuperacionRestantes cuenta los códigos sin usar del usuario.
+func (r *UsuarioRepository) CodigosRecuperacionRestantes(usuarioID uint) (int64, error) {
+	var total int64
+	err := r.db.Model(&models.CodigoRecuperacion{}).
+		Where("usuario_id = ? AND usado_en IS NULL", usuarioID).
+		Count(&total).Error
+	if err != nil {
+		return 0, fmt.Errorf("error contando códigos de recuperación: %w", err)
+	}
+	return total, nil
+}
+
+// ConSecretoTotp lista los usuarios (incluso eliminados) con secreto TOTP
+// guardado, para la rotación de la clave de cifrado.
+func (r *UsuarioRepository) ConSecretoTotp() ([]models.Usuario, error) {
+	var usuarios []models.Usuario
+	err := r.db.Unscoped().Select("id", "codigo_usuario", "totp_secreto").
+		Where("totp_secreto IS NOT NULL AND totp_secreto <> ''").
+		Find(&usuarios).Error
+	if err != nil {
+		return nil, fmt.Errorf("error obteniendo secretos TOTP: %w", err)
+	}
+	return usuarios, nil
+}
+
+// ActualizarSecretoTotp reemplaza el secreto cifrado (recifrado con otra
+// clave) sin tocar nada más. Solo escribe si el secreto guardado sigue
+// siendo anterior: devuelve false si cambió (p. ej. el usuario reconfiguró
+// su 2FA) entre la lectura y la escritura.
+func (r *UsuarioRepository) ActualizarSecretoTotp(id uint, anterior, secreto string) (bool, error) {
+	result := r.db.Unscoped().Model(&models.Usuario{}).
+		Where("id = ? AND totp_secreto = ?", id, anterior).
+		UpdateColumn("totp_secreto", secreto)
+	if result.Error != nil {
+		return false, fmt.Errorf("error actualizando secreto TOTP: %w", result.Error)
+	}
+	return result.RowsAffected > 0, nil
+}
+
 func (r *UsuarioRepository) SoftDelete(id uint) error {
 	result := r.db.Delete(&models.Usuario{}, id)
 	if result.Error != nil {
@@ -100,104 +337,111 @@ func (r *UsuarioRepository) GetSucursalesCatalogo() ([]models.SucursalCatalogo,
 	return sucursales, nil
 }
 
-// codigosATexto ordena, deduplica y concatena códigos SIN como "1,6,7".
-func codigosATexto(codigos []int) string {
-	if len(codigos) == 0 {
-		return ""
-	}
-	set := make(map[int]struct{}, len(codigos))
-	for _, c := range codigos {
-		set[c] = struct{}{}
-	}
-	unicos := make([]int, 0, len(set))
-	for c := range set {
-		unicos = append(unicos, c)
-	}
-	sort.Ints(unicos)
-	partes := make([]string, len(unicos))
-	for i, c := range unicos {
-		partes[i] = strconv.Itoa(c)
-	}
-	return strings.Join(partes, ",")
+// accesoVigente filtra usuario_sucursal_acceso (alias a) a los accesos
+// vigentes en un momento dado (se pasa dos veces).
+const accesoVigente = "(a.vigente_desde IS NULL OR a.vigente_desde <= ?) AND (a.vigente_hasta IS NULL OR a.vigente_hasta > ?)"
+
+// codigosPermitidos es la subconsulta con los códigos SIN de las sucursales
+// del catálogo a las que el usuario tiene acceso vigente (sin contar
+// acceso_total).
+func codigosPermitidos(db *gorm.DB, usuarioID uint, ahora time.Time) *gorm.DB {
+	return db.Table("usuario_sucursal_acceso AS a").
+		Select("sc.codigo_sucursal_sin").
+		Joins("JOIN sucursales_catalogo AS sc ON sc.id = a.sucursal_catalogo_id AND sc.deleted_at IS NULL").
+		Where("a.usuario_id = ?", usuarioID).
+		Where(accesoVigente, ahora, ahora)
 }
 
-// textoACodigos parsea "1,6,7" a un set de códigos SIN. Texto vacío = sin
-// accesos.
-func textoACodigos(texto string) map[int]struct{} {
-	set := map[int]struct{}{}
-	texto = strings.TrimSpace(texto)
-	if texto == "" {
-		return set
+// sucursalVisible es un scope que deja solo las filas cuya columna de
+// código SIN (ej. "sf.codigo_sucursal_sin") el usuario puede ver: todas si
+// tiene acceso_total, si no las de sus accesos vigentes. Se resuelve en la
+// misma consulta, sin traer los accesos a Go. Se compara por código SIN y
+// no por ID porque SucursalFacturador es independiente del catálogo.
+func sucursalVisible(columnaCodigo string, usuarioID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		nueva := db.Session(&gorm.Session{NewDB: true})
+		return db.Where(
+			"(EXISTS (SELECT 1 FROM usuarios WHERE id = ? AND acceso_total AND deleted_at IS NULL) OR "+columnaCodigo+" IN (?))",
+			usuarioID, codigosPermitidos(nueva, usuarioID, time.Now()),
+		)
 	}
-	for _, parte := range strings.Split(texto, ",") {
-		parte = strings.TrimSpace(parte)
-		if parte == "" {
-			continue
-		}
-		if codigo, err := strconv.Atoi(parte); err == nil {
-			set[codigo] = struct{}{}
-		}
-	}
-	return set
 }
 
 // SetAccesos reemplaza por completo la configuración de accesos de un
-// usuario: la bandera de acceso total y la colección de códigos SIN de
-// sucursal permitidos. regionalesIDs/sucursalesIDs son selección por
+// usuario: la bandera de acceso total y sus filas de
+// usuario_sucursal_acceso. regionalesIDs/sucursalesIDs son selección por
 // conveniencia desde el front (agrupada visualmente); acá se resuelven a
-// los códigos SIN de sus sucursales y se guardan ya aplanados en
-// sucursales_permitidas_codigos.
-func (r *UsuarioRepository) SetAccesos(usuarioID uint, accesoTotal bool, regionalesIDs, sucursalesIDs []uint) error {
-	var codigos []int
-
-	if len(regionalesIDs) > 0 {
-		var codigosRegionales []int
-		if err := r.db.Model(&models.SucursalCatalogo{}).
-			Where("regional_id IN ?", regionalesIDs).
-			Pluck("codigo_sucursal_sin", &codigosRegionales).Error; err != nil {
-			return fmt.Errorf("error resolviendo sucursales de las regionales: %w", err)
+// las sucursales del catálogo, que quedan todas con la misma vigencia
+// (desde/hasta, nil = sin límite).
+func (r *UsuarioRepository) SetAccesos(usuarioID uint, accesoTotal bool, regionalesIDs, sucursalesIDs []uint, desde, hasta *time.Time) error {
+	return r.db.Transaction(func(tx *gorm.DB) error {
+		resultado := tx.Model(&models.Usuario{}).Where("id = ?", usuarioID).Update("acceso_total", accesoTotal)
+		if resultado.Error != nil {
+			return fmt.Errorf("error guardando accesos: %w", resultado.Error)
 		}
-		codigos = append(codigos, codigosRegionales...)
-	}
-
-	if len(sucursalesIDs) > 0 {
-		var codigosDirectos []int
-		if err := r.db.Model(&models.SucursalCatalogo{}).
-			Where("id IN ?", sucursalesIDs).
-			Pluck("codigo_sucursal_sin", &codigosDirectos).Error; err != nil {
-			return fmt.Errorf("error resolviendo códigos de las sucursales: %w", err)
+		if resultado.RowsAffected == 0 {
+			return fmt.Errorf("usuario %d: %w", usuarioID, gorm.ErrRecordNotFound)
+		}
+		if err := tx.Where("usuario_id = ?", usuarioID).Delete(&models.UsuarioSucursalAcceso{}).Error; err != nil {
+			return fmt.Errorf("error borrando accesos anteriores: %w", err)
+		}
+		if len(regionalesIDs) == 0 && len(sucursalesIDs) == 0 {
+			return nil
 		}
-		codigos = append(codigos, codigosDirectos...)
-	}
 
-	err := r.db.Model(&models.Usuario{}).Where("id = ?", usuarioID).Updates(map[string]interface{}{
-		"acceso_total":                  accesoTotal,
-		"sucursales_permitidas_codigos": codigosATexto(codigos),
-	}).Error
-	if err != nil {
-		return fmt.Errorf("error guardando accesos: %w", err)
-	}
-	return nil
+		var ids []uint
+		if err := tx.Model(&models.SucursalCatalogo{}).
+			Where("regional_id IN ? OR id IN ?", regionalesIDs, sucursalesIDs).
+			Order("id ASC").
+			Pluck("id", &ids).Error; err != nil {
+			return fmt.Errorf("error resolviendo sucursales de los accesos: %w", err)
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+		accesos := make([]models.UsuarioSucursalAcceso, len(ids))
+		for i, id := range ids {
+			accesos[i] = models.UsuarioSucursalAcceso{UsuarioID: usuarioID, SucursalCatalogoID: id, VigenteDesde: desde, VigenteHasta: hasta}
+		}
+		if err := tx.Create(&accesos).Error; err != nil {
+			return fmt.Errorf("error guardando accesos: %w", err)
+		}
+		return nil
+	})
 }
 
-// AccesosResueltos es la selección por regional/sucursal derivada de la
-// colección de códigos SIN guardada — reconstruye lo que el front necesita
+// AccesosResueltos es la selección por regional/sucursal derivada de las
+// filas de usuario_sucursal_acceso — reconstruye lo que el front necesita
 // para precargar el modal de accesos (qué regionales aparecen "completas" y
-// qué sucursales sueltas quedan marcadas).
+// qué sucursales sueltas quedan marcadas). Accesos es el detalle con la
+// vigencia de cada una.
 type AccesosResueltos struct {
 	RegionalesIDs []uint
 	SucursalesIDs []uint
+	Accesos       []models.UsuarioSucursalAcceso
 }
 
-// GetAccesos deriva, a partir de sucursales_permitidas_codigos, qué
-// regionales están completamente cubiertas y qué sucursales sueltas quedan
-// marcadas individualmente.
+// GetAccesos deriva, a partir de los accesos configurados (vigentes o no),
+// qué regionales están completamente cubiertas y qué sucursales sueltas
+// quedan marcadas individualmente.
 func (r *UsuarioRepository) GetAccesos(usuarioID uint) (*AccesosResueltos, error) {
-	usuario, err := r.GetByID(usuarioID)
-	if err != nil {
+	if _, err := r.GetByID(usuarioID); err != nil {
 		return nil, err
 	}
-	permitidos := textoACodigos(usuario.SucursalesPermitidasCodigos)
+
+	var accesos []models.UsuarioSucursalAcceso
+	err := r.db.Preload("SucursalCatalogo").
+		Joins("JOIN sucursales_catalogo AS sc ON sc.id = usuario_sucursal_acceso.sucursal_catalogo_id AND sc.deleted_at IS NULL").
+		Where("usuario_sucursal_acceso.usuario_id = ?", usuarioID).
+		Order("sc.codigo_sucursal_sin ASC").
+		Find(&accesos).Error
+	if err != nil {
+		return nil, fmt.Errorf("error obteniendo accesos: %w", err)
+	}
+	permitidos := make(map[uint]struct{}, len(accesos))
+	for _, a := range accesos {
+		permitidos[a.SucursalCatalogoID] = struct{}{}
+	}
 
 	sucursales, err := r.GetSucursalesCatalogo()
 	if err != nil {
@@ -209,11 +453,11 @@ func (r *UsuarioRepository) GetAccesos(usuarioID uint) (*AccesosResueltos, error
 		porRegional[s.RegionalID] = append(porRegional[s.RegionalID], s)
 	}
 
-	resultado := &AccesosResueltos{RegionalesIDs: []uint{}, SucursalesIDs: []uint{}}
+	resultado := &AccesosResueltos{RegionalesIDs: []uint{}, SucursalesIDs: []uint{}, Accesos: accesos}
 	for regionalID, lista := range porRegional {
 		completa := len(lista) > 0
 		for _, s := range lista {
-			if _, ok := permitidos[s.CodigoSucursalSin]; !ok {
+			if _, ok := permitidos[s.ID]; !ok {
 				completa = false
 				break
 			}
@@ -223,7 +467,7 @@ func (r *UsuarioRepository) GetAccesos(usuarioID uint) (*AccesosResueltos, error
 			continue
 		}
 		for _, s := range lista {
-			if _, ok := permitidos[s.CodigoSucursalSin]; ok {
+			if _, ok := permitidos[s.ID]; ok {
 				resultado.SucursalesIDs = append(resultado.SucursalesIDs, s.ID)
 			}
 		}
@@ -233,9 +477,52 @@ func (r *UsuarioRepository) GetAccesos(usuarioID uint) (*AccesosResueltos, error
 	return resultado, nil
 }
 
+// AlcanceSucursales son las sucursales que ve un usuario: todas (Total) o
+// las de los códigos SIN de Codigos.
+type AlcanceSucursales struct {
+	Total   bool
+	Codigos map[int]bool
+}
+
+// Incluye indica si el alcance cubre la sucursal con ese código SIN.
+func (a *AlcanceSucursales) Incluye(codigoSucursalSin int) bool {
+	return a.Total || a.Codigos[codigoSucursalSin]
+}
+
+// AlcanceSucursales resuelve en una sola consulta acceso_total y los
+// códigos SIN con acceso vigente del usuario, para chequear varios códigos
+// sin ir a la base por cada uno.
+func (r *UsuarioRepository) AlcanceSucursales(usuarioID uint) (*AlcanceSucursales, error) {
+	ahora := time.Now()
+	var filas []struct {
+		AccesoTotal       bool
+		CodigoSucursalSin *int
+	}
+	err := r.db.Table("usuarios AS u").
+		Select("u.acceso_total, sc.codigo_sucursal_sin").
+		Joins("LEFT JOIN usuario_sucursal_acceso AS a ON a.usuario_id = u.id AND NOT u.acceso_total AND "+accesoVigente, ahora, ahora).
+		Joins("LEFT JOIN sucursales_catalogo AS sc ON sc.id = a.sucursal_catalogo_id AND sc.deleted_at IS NULL").
+		Where("u.id = ? AND u.deleted_at IS NULL", usuarioID).
+		Scan(&filas).Error
+	if err != nil {
+		return nil, fmt.Errorf("error resolviendo sucursales permitidas: %w", err)
+	}
+	if len(filas) == 0 {
+		return nil, fmt.Errorf("usuario %d: %w", usuarioID, gorm.ErrRecordNotFound)
+	}
+
+	alcance := &AlcanceSucursales{Total: filas[0].AccesoTotal, Codigos: map[int]bool{}}
+	for _, f := range filas {
+		if f.CodigoSucursalSin != nil {
+			alcance.Codigos[*f.CodigoSucursalSin] = true
+		}
+	}
+	return alcance, nil
+}
+
 // SucursalesPermitidas resuelve el catálogo efectivo de sucursales a las que
-// el usuario tiene acceso: todo el catálogo si tiene AccesoTotal, o las que
-// coincidan con sucursales_permitidas_codigos.
+// el usuario tiene acceso: todo el catálogo si tiene AccesoTotal, o las de
+// sus accesos vigentes.
 func (r *UsuarioRepository) SucursalesPermitidas(usuarioID uint) ([]models.SucursalCatalogo, error) {
 	usuario, err := r.GetByID(usuarioID)
 	if err != nil {
@@ -246,19 +533,9 @@ func (r *UsuarioRepository) SucursalesPermitidas(usuarioID uint) ([]models.Sucur
 		return r.GetSucursalesCatalogo()
 	}
 
-	permitidos := textoACodigos(usuario.SucursalesPermitidasCodigos)
-	if len(permitidos) == 0 {
-		return []models.SucursalCatalogo{}, nil
-	}
-
-	codigos := make([]int, 0, len(permitidos))
-	for c := range permitidos {
-		codigos = append(codigos, c)
-	}
-
 	var sucursales []models.SucursalCatalogo
 	if err := r.db.Preload("Regional").
-		Where("codigo_sucursal_sin IN ?", codigos).
+		Where("codigo_sucursal_sin IN (?)", codigosPermitidos(r.db, usuarioID, time.Now())).
 		Order("codigo_sucursal_sin ASC").
 		Find(&sucursales).Error; err != nil {
 		return nil, fmt.Errorf("error resolviendo sucursales permitidas: %w", err)
@@ -266,19 +543,8 @@ func (r *UsuarioRepository) SucursalesPermitidas(usuarioID uint) ([]models.Sucur
 	return sucursales, nil
 }
 
-// EsAdmin indica si el usuario tiene rol "admin" — usado por
-// middleware.RequireAdmin para bloquear los módulos de Usuarios y
-// Sucursales Facturador a los operadores.
-func (r *UsuarioRepository) EsAdmin(usuarioID uint) (bool, error) {
-	usuario, err := r.GetByID(usuarioID)
-	if err != nil {
-		return false, err
-	}
-	return usuario.Rol == models.RolAdmin, nil
-}
-
-// TieneAccesoTotal indica si el usuario tiene acceso nacional (bypass de
-// sucursales_permitidas_codigos).
+// TieneAccesoTotal indica si el usuario tiene acceso nacional (no depende
+// de sus filas de usuario_sucursal_acceso).
 func (r *UsuarioRepository) TieneAccesoTotal(usuarioID uint) (bool, error) {
 	usuario, err := r.GetByID(usuarioID)
 	if err != nil {
@@ -289,16 +555,15 @@ func (r *UsuarioRepository) TieneAccesoTotal(usuarioID uint) (bool, error) {
 
 // TieneAccesoSucursal verifica si el usuario puede acceder a la sucursal
 // identificada por su código SIN — el chequeo real usado al hacer consultas
-// de facturas de una sucursal puntual.
+// de facturas de una sucursal puntual. Es una sola consulta.
 func (r *UsuarioRepository) TieneAccesoSucursal(usuarioID uint, codigoSucursalSin int) (bool, error) {
-	usuario, err := r.GetByID(usuarioID)
+	var tiene bool
+	err := r.db.Raw(
+		"SELECT EXISTS (SELECT 1 FROM usuarios WHERE id = ? AND acceso_total AND deleted_at IS NULL) OR ? IN (?)",
+		usuarioID, codigoSucursalSin, codigosPermitidos(r.db, usuarioID, time.Now()),
+	).Scan(&tiene).Error
 	if err != nil {
-		return false, err
-	}
-	if usuario.AccesoTotal {
-		return true, nil
+		return false, fmt.Errorf("error verificando acceso a la sucursal %d: %w", codigoSucursalSin, err)
 	}
-	permitidos := textoACodigos(usuario.SucursalesPermitidasCodigos)
-	_, ok := permitidos[codigoSucursalSin]
-	return ok, nil
+	return tiene, nil
 }
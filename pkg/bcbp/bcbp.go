@@ -0,0 +1,350 @@
+// Package bcbp decodifica boarding passes en formato IATA BCBP (Bar Coded
+// Boarding Pass, Resolución 792), el texto que DUAS guarda en
+// TES_FACTURAITINERARIO.FAC_DETALLEFACTURA.
+//
+// Estructura del formato "M" (posiciones fijas, ASCII):
+//
+//	Únicos obligatorios (23): formato, cantidad de tramos, nombre, indicador e-ticket
+//	Por tramo, obligatorios (37): PNR, origen, destino, transportista, vuelo,
+//	  fecha juliana, compartimento, asiento, secuencia, estado, tamaño (hex)
+//	  del bloque condicional que sigue
+//	Por tramo, condicionales (tamaño variable): en el primer tramo empieza con
+//	  ">" + versión + bloque único (tamaño hex); en todos, bloque repetido
+//	  (tamaño hex) con número de ticket, viajero frecuente, etc.; el resto es
+//	  de uso individual de la aerolínea
+//	Seguridad (opcional, al final): "^" + tipo + tamaño (hex) + datos
+//
+// Los bloques condicionales traen su propio tamaño: versiones viejas del
+// formato traen menos campos y se leen hasta donde alcance.
+package bcbp
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	largoUnicosObligatorios = 23
+	largoTramoObligatorio   = 37
+)
+
+// ErrNoEsBCBP se devuelve cuando el texto no contiene un boarding pass BCBP
+// reconocible.
+var ErrNoEsBCBP = errors.New("el texto no contiene un boarding pass BCBP")
+
+// BoardingPass es el contenido decodificado de un BCBP.
+type BoardingPass struct {
+	Formato        string
+	CantidadTramos int
+	// NombrePasajero es el campo tal cual ("APELLIDO/NOMBRE MR"); Apellido y
+	// Nombre salen de separarlo por "/".
+	NombrePasajero   string
+	Apellido         string
+	Nombre           string
+	IndicadorETicket string
+
+	// Bloque condicional único (solo en el primer tramo). Version es 0 si
+	// el BCBP no trae parte condicional.
+	Version             int
+	DescripcionPasajero string
+	FuenteCheckin       string
+	FuenteEmision       string
+	FechaEmisionJuliana string
+	TipoDocumento       string
+	AerolineaEmisora    string
+	EtiquetasEquipaje   []string
+
+	Tramos []Tramo
+
+	TipoSeguridad  string
+	DatosSeguridad string
+}
+
+// Tramo es un segmento de vuelo del boarding pass.
+type Tramo struct {
+	PNR              string
+	Origen           string
+	Destino          string
+	Transportista    string
+	NumeroVuelo      string
+	FechaJuliana     int
+	Compartimento    string
+	Asiento          string
+	SecuenciaCheckin string
+	EstadoPasajero   string
+
+	// Bloque condicional repetido.
+	CodigoNumericoAerolinea   string
+	NumeroDocumento           string
+	Selectee                  string
+	VerificacionDocumentos    string
+	TransportistaComercial    string
+	AerolineaViajeroFrecuente string
+	NumeroViajeroFrecuente    string
+	IndicadorIDAD             string
+	FranquiciaEquipaje        string
+	FastTrack                 string
+
+	UsoAerolinea string
+}
+
+// NumeroTicket es el número de ticket electrónico de 13 dígitos (código
+// numérico de la aerolínea + número de documento), o "" si el BCBP no lo
+// trae.
+func (t Tramo) NumeroTicket() string {
+	if t.CodigoNumericoAerolinea == "" || t.NumeroDocumento == "" {
+		return ""
+	}
+	return t.CodigoNumericoAerolinea + t.NumeroDocumento
+}
+
+// Vuelo es transportista + número de vuelo sin ceros a la izquierda
+// ("OB 0760 " → "OB760").
+func (t Tramo) Vuelo() string {
+	numero := strings.TrimLeft(t.NumeroVuelo, "0")
+	if numero == "" {
+		numero = t.NumeroVuelo
+	}
+	return t.Transportista + numero
+}
+
+// FechaVuelo resuelve la fecha juliana (día del año, sin año) tomando el año
+// que la deja más cerca de referencia — normalmente la fecha de emisión de
+// la factura. Devuelve la fecha cero si el tramo no trae fecha.
+func (t Tramo) FechaVuelo(referencia time.Time) time.Time {
+	if t.FechaJuliana < 1 || t.FechaJuliana > 366 {
+		return time.Time{}
+	}
+	var mejor time.Time
+	for _, anio := range []int{referencia.Year() - 1, referencia.Year(), referencia.Year() + 1} {
+		fecha := time.Date(anio, 1, 1, 0, 0, 0, 0, referencia.Location()).AddDate(0, 0, t.FechaJuliana-1)
+		if fecha.Year() != anio {
+			continue // día 366 en año no bisiesto
+		}
+		if mejor.IsZero() || absDuracion(fecha.Sub(referencia)) < absDuracion(mejor.Sub(referencia)) {
+			mejor = fecha
+		}
+	}
+	return mejor
+}
+
+func absDuracion(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// lector recorre el texto por posiciones fijas.
+type lector struct {
+	texto string
+	pos   int
+}
+
+func (l *lector) quedan() int { return len(l.texto) - l.pos }
+
+// campo lee n caracteres (o los que queden) sin recortar espacios.
+func (l *lector) campo(n int) string {
+	if n > l.quedan() {
+		n = l.quedan()
+	}
+	valor := l.texto[l.pos : l.pos+n]
+	l.pos += n
+	return valor
+}
+
+// textoRecortado lee n caracteres y recorta los espacios de relleno.
+func (l *lector) textoRecortado(n int) string {
+	return strings.TrimSpace(l.campo(n))
+}
+
+// hex lee un tamaño de 2 dígitos hexadecimales.
+func (l *lector) hex() (int, error) {
+	if l.quedan() < 2 {
+		return 0, fmt.Errorf("BCBP truncado en la posición %d", l.pos)
+	}
+	crudo := l.campo(2)
+	valor, err := strconv.ParseUint(crudo, 16, 8)
+	if err != nil {
+		return 0, fmt.Errorf("tamaño '%s' inválido en la posición %d", crudo, l.pos-2)
+	}
+	return int(valor), nil
+}
+
+// sub devuelve un lector sobre los próximos n caracteres y avanza l.
+func (l *lector) sub(n int) (*lector, error) {
+	if n > l.quedan() {
+		return nil, fmt.Errorf("bloque de %d caracteres excede el BCBP en la posición %d", n, l.pos)
+	}
+	return &lector{texto: l.campo(n)}, nil
+}
+
+// Buscar localiza el inicio del BCBP dentro de texto (FAC_DETALLEFACTURA
+// puede traer otro contenido antes) y lo decodifica.
+func Buscar(texto string) (*BoardingPass, error) {
+	for i := 0; i+largoUnicosObligatorios+largoTramoObligatorio <= len(texto); i++ {
+		if pareceInicioBCBP(texto[i:]) {
+			return Parse(texto[i:])
+		}
+	}
+	return nil, ErrNoEsBCBP
+}
+
+// pareceInicioBCBP revisa formato "M", cantidad de tramos 1-9 y que origen y
+// destino del primer tramo sean códigos de aeropuerto de 3 letras.
+func pareceInicioBCBP(texto string) bool {
+	if len(texto) < largoUnicosObligatorios+largoTramoObligatorio {
+		return false
+	}
+	if texto[0] != 'M' || texto[1] < '1' || texto[1] > '9' {
+		return false
+	}
+	aeropuertos := texto[largoUnicosObligatorios+7 : largoUnicosObligatorios+13]
+	for i := 0; i < len(aeropuertos); i++ {
+		if aeropuertos[i] < 'A' || aeropuertos[i] > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// Parse decodifica un BCBP que empieza en la primera posición de texto.
+func Parse(texto string) (*BoardingPass, error) {
+	texto = strings.TrimRight(texto, "\r\n")
+	if len(texto) < largoUnicosObligatorios+largoTramoObligatorio || texto[0] != 'M' {
+		return nil, ErrNoEsBCBP
+	}
+	l := &lector{texto: texto}
+
+	bp := &BoardingPass{Formato: l.campo(1)}
+	tramos, err := strconv.Atoi(l.campo(1))
+	if err != nil || tramos < 1 {
+		return nil, fmt.Errorf("%w: cantidad de tramos inválida", ErrNoEsBCBP)
+	}
+	bp.CantidadTramos = tramos
+	bp.NombrePasajero = l.textoRecortado(20)
+	bp.Apellido, bp.Nombre = separarNombre(bp.NombrePasajero)
+	bp.IndicadorETicket = l.textoRecortado(1)
+
+	for i := 0; i < tramos; i++ {
+		if l.quedan() < largoTramoObligatorio {
+			return bp, fmt.Errorf("BCBP truncado: falta el tramo %d de %d", i+1, tramos)
+		}
+		tramo, err := leerTramo(l, bp, i == 0)
+		if err != nil {
+			return bp, fmt.Errorf("tramo %d: %w", i+1, err)
+		}
+		bp.Tramos = append(bp.Tramos, tramo)
+	}
+
+	if l.quedan() > 0 && l.texto[l.pos] == '^' {
+		l.campo(1)
+		bp.TipoSeguridad = l.campo(1)
+		if largo, err := l.hex(); err == nil {
+			bp.DatosSeguridad = l.campo(largo)
+		}
+	}
+	return bp, nil
+}
+
+func leerTramo(l *lector, bp *BoardingPass, primero bool) (Tramo, error) {
+	t := Tramo{
+		PNR:           l.textoRecortado(7),
+		Origen:        l.textoRecortado(3),
+		Destino:       l.textoRecortado(3),
+		Transportista: l.textoRecortado(3),
+		NumeroVuelo:   l.textoRecortado(5),
+	}
+	if dia, err := strconv.Atoi(strings.TrimSpace(l.campo(3))); err == nil {
+		t.FechaJuliana = dia
+	}
+	t.Compartimento = l.textoRecortado(1)
+	t.Asiento = strings.TrimLeft(l.textoRecortado(4), "0")
+	t.SecuenciaCheckin = l.textoRecortado(5)
+	t.EstadoPasajero = l.textoRecortado(1)
+
+	largoCondicional, err := l.hex()
+	if err != nil {
+		return t, err
+	}
+	condicional, err := l.sub(largoCondicional)
+	if err != nil {
+		return t, err
+	}
+
+	if primero && condicional.quedan() > 0 && condicional.texto[0] == '>' {
+		condicional.campo(1)
+		if version, err := strconv.Atoi(condicional.campo(1)); err == nil {
+			bp.Version = version
+		}
+		if err := leerUnicosCondicionales(condicional, bp); err != nil {
+			return t, err
+		}
+	}
+
+	if condicional.quedan() >= 2 {
+		if err := leerRepetidosCondicionales(condicional, &t); err != nil {
+			return t, err
+		}
+	}
+	t.UsoAerolinea = condicional.campo(condicional.quedan())
+	return t, nil
+}
+
+func leerUnicosCondicionales(l *lector, bp *BoardingPass) error {
+	largo, err := l.hex()
+	if err != nil {
+		return err
+	}
+	u, err := l.sub(largo)
+	if err != nil {
+		return err
+	}
+	bp.DescripcionPasajero = u.textoRecortado(1)
+	bp.FuenteCheckin = u.textoRecortado(1)
+	bp.FuenteEmision = u.textoRecortado(1)
+	bp.FechaEmisionJuliana = u.textoRecortado(4)
+	bp.TipoDocumento = u.textoRecortado(1)
+	bp.AerolineaEmisora = u.textoRecortado(3)
+	for u.quedan() > 0 {
+		if etiqueta := u.textoRecortado(13); etiqueta != "" {
+			bp.EtiquetasEquipaje = append(bp.EtiquetasEquipaje, etiqueta)
+		}
+	}
+	return nil
+}
+
+func leerRepetidosCondicionales(l *lector, t *Tramo) error {
+	largo, err := l.hex()
+	if err != nil {
+		return err
+	}
+	r, err := l.sub(largo)
+	if err != nil {
+		return err
+	}
+	t.CodigoNumericoAerolinea = r.textoRecortado(3)
+	t.NumeroDocumento = r.textoRecortado(10)
+	t.Selectee = r.textoRecortado(1)
+	t.VerificacionDocumentos = r.textoRecortado(1)
+	t.TransportistaComercial = r.textoRecortado(3)
+	t.AerolineaViajeroFrecuente = r.textoRecortado(3)
+	t.NumeroViajeroFrecuente = r.textoRecortado(16)
+	t.IndicadorIDAD = r.textoRecortado(1)
+	t.FranquiciaEquipaje = r.textoRecortado(3)
+	t.FastTrack = r.textoRecortado(1)
+	return nil
+}
+
+// separarNombre divide "APELLIDO/NOMBRE" en apellido y nombre. Sin "/" todo
+// el campo es apellido.
+func separarNombre(nombre string) (string, string) {
+	apellido, resto, ok := strings.Cut(nombre, "/")
+	if !ok {
+		return strings.TrimSpace(nombre), ""
+	}
+	return strings.TrimSpace(apellido), strings.TrimSpace(resto)
+}
@@ -0,0 +1,194 @@
+package bcbp
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// Ejemplos de la guía de implementación IATA BCBP (Resolución 792).
+const (
+	ejemploObligatorio = "M1DESMARAIS/LUC       EABC123 YULFRAAC 0834 226F001A0025 100"
+	ejemploMultiTramo  = "M2DESMARAIS/LUC       EABC123 YULFRAAC 0834 226F001A0025 14D>6181WW6225BAC 00141234560032A0141234567890 1AC AC 1234567890123    20KYLX58ZDEF456 FRAGVALH 3664 227C012C0002 12E2A0140987654321 1AC AC 1234567890123    2PCNWQ^164GIWVC5EH7JNT684FVNJ91W2QA4DVN5J8K4F0L0GEQ3DF5TGBN8709HKT5D3DW3GBHFCVHMY7J5T6HFR41W2QA4DVN5J8K4F0L0GE"
+)
+
+func TestParseSoloObligatorios(t *testing.T) {
+	bp, err := Parse(ejemploObligatorio)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if bp.CantidadTramos != 1 || len(bp.Tramos) != 1 {
+		t.Fatalf("tramos = %d/%d, se esperaba 1", bp.CantidadTramos, len(bp.Tramos))
+	}
+	if bp.Apellido != "DESMARAIS" || bp.Nombre != "LUC" || bp.IndicadorETicket != "E" {
+		t.Errorf("pasajero = %q/%q e-ticket %q", bp.Apellido, bp.Nombre, bp.IndicadorETicket)
+	}
+	if bp.Version != 0 {
+		t.Errorf("Version = %d, se esperaba 0 sin parte condicional", bp.Version)
+	}
+
+	esperado := Tramo{
+		PNR:              "ABC123",
+		Origen:           "YUL",
+		Destino:          "FRA",
+		Transportista:    "AC",
+		NumeroVuelo:      "0834",
+		FechaJuliana:     226,
+		Compartimento:    "F",
+		Asiento:          "1A",
+		SecuenciaCheckin: "0025",
+		EstadoPasajero:   "1",
+	}
+	if !reflect.DeepEqual(bp.Tramos[0], esperado) {
+		t.Errorf("tramo =\n%+v\nse esperaba\n%+v", bp.Tramos[0], esperado)
+	}
+	if got := bp.Tramos[0].Vuelo(); got != "AC834" {
+		t.Errorf("Vuelo() = %q", got)
+	}
+	if got := bp.Tramos[0].NumeroTicket(); got != "" {
+		t.Errorf("NumeroTicket() = %q, se esperaba vacío", got)
+	}
+}
+
+func TestParseMultiTramo(t *testing.T) {
+	bp, err := Parse(ejemploMultiTramo)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if bp.Version != 6 || bp.DescripcionPasajero != "1" || bp.FuenteCheckin != "W" || bp.FuenteEmision != "W" {
+		t.Errorf("únicos condicionales = %+v", bp)
+	}
+	if bp.FechaEmisionJuliana != "6225" || bp.TipoDocumento != "B" || bp.AerolineaEmisora != "AC" {
+		t.Errorf("emisión = %q %q %q", bp.FechaEmisionJuliana, bp.TipoDocumento, bp.AerolineaEmisora)
+	}
+	if !reflect.DeepEqual(bp.EtiquetasEquipaje, []string{"0014123456003"}) {
+		t.Errorf("EtiquetasEquipaje = %q", bp.EtiquetasEquipaje)
+	}
+	if len(bp.Tramos) != 2 {
+		t.Fatalf("tramos = %d, se esperaban 2", len(bp.Tramos))
+	}
+
+	casos := []struct {
+		nombre   string
+		tramo    Tramo
+		ruta     [2]string
+		vuelo    string
+		asiento  string
+		ticket   string
+		equipaje string
+		fast     string
+		uso      string
+	}{
+		{"primero", bp.Tramos[0], [2]string{"YUL", "FRA"}, "AC834", "1A", "0141234567890", "20K", "Y", "LX58Z"},
+		{"segundo", bp.Tramos[1], [2]string{"FRA", "GVA"}, "LH3664", "12C", "0140987654321", "2PC", "N", "WQ"},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			if c.tramo.Origen != c.ruta[0] || c.tramo.Destino != c.ruta[1] {
+				t.Errorf("ruta = %s-%s", c.tramo.Origen, c.tramo.Destino)
+			}
+			if got := c.tramo.Vuelo(); got != c.vuelo {
+				t.Errorf("Vuelo() = %q, se esperaba %q", got, c.vuelo)
+			}
+			if c.tramo.Asiento != c.asiento {
+				t.Errorf("Asiento = %q, se esperaba %q", c.tramo.Asiento, c.asiento)
+			}
+			if got := c.tramo.NumeroTicket(); got != c.ticket {
+				t.Errorf("NumeroTicket() = %q, se esperaba %q", got, c.ticket)
+			}
+			if c.tramo.FranquiciaEquipaje != c.equipaje || c.tramo.FastTrack != c.fast {
+				t.Errorf("equipaje/fast track = %q/%q", c.tramo.FranquiciaEquipaje, c.tramo.FastTrack)
+			}
+			if c.tramo.NumeroViajeroFrecuente != "1234567890123" || c.tramo.TransportistaComercial != "AC" {
+				t.Errorf("viajero frecuente = %q comercial %q", c.tramo.NumeroViajeroFrecuente, c.tramo.TransportistaComercial)
+			}
+			if c.tramo.UsoAerolinea != c.uso {
+				t.Errorf("UsoAerolinea = %q, se esperaba %q", c.tramo.UsoAerolinea, c.uso)
+			}
+		})
+	}
+
+	if bp.TipoSeguridad != "1" || len(bp.DatosSeguridad) != 0x64 {
+		t.Errorf("seguridad = %q (%d caracteres)", bp.TipoSeguridad, len(bp.DatosSeguridad))
+	}
+}
+
+func TestBuscar(t *testing.T) {
+	casos := []struct {
+		nombre  string
+		texto   string
+		pnr     string
+		errNoEs bool
+	}{
+		{"sin prefijo", ejemploObligatorio, "ABC123", false},
+		{"con texto antes", "PASE: " + ejemploMultiTramo, "ABC123", false},
+		{"con M antes del BCBP", "MANUAL M1 " + ejemploObligatorio, "ABC123", false},
+		{"sin BCBP", "FACTURA POR SERVICIOS AEROPORTUARIOS", "", true},
+		{"vacío", "", "", true},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			bp, err := Buscar(c.texto)
+			if c.errNoEs {
+				if !errors.Is(err, ErrNoEsBCBP) {
+					t.Fatalf("err = %v, se esperaba ErrNoEsBCBP", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Buscar: %v", err)
+			}
+			if bp.Tramos[0].PNR != c.pnr {
+				t.Errorf("PNR = %q, se esperaba %q", bp.Tramos[0].PNR, c.pnr)
+			}
+		})
+	}
+}
+
+func TestParseTruncado(t *testing.T) {
+	// Anuncia 2 tramos pero solo trae uno.
+	bp, err := Parse("M2" + ejemploObligatorio[2:])
+	if err == nil {
+		t.Fatal("se esperaba error por tramo faltante")
+	}
+	if bp == nil || len(bp.Tramos) != 1 || bp.Tramos[0].PNR != "ABC123" {
+		t.Errorf("se esperaba el primer tramo leído, bp = %+v", bp)
+	}
+
+	// El bloque condicional declara más caracteres de los que hay.
+	if _, err := Parse(ejemploMultiTramo[:120]); err == nil {
+		t.Error("se esperaba error por bloque condicional truncado")
+	}
+
+	if _, err := Parse(ejemploObligatorio[:40]); !errors.Is(err, ErrNoEsBCBP) {
+		t.Errorf("err = %v, se esperaba ErrNoEsBCBP", err)
+	}
+}
+
+func TestFechaVuelo(t *testing.T) {
+	casos := []struct {
+		nombre     string
+		juliana    int
+		referencia time.Time
+		esperado   time.Time
+	}{
+		{"mismo año", 226, fecha(2024, 8, 10), fecha(2024, 8, 13)},
+		{"vuelo de diciembre facturado en enero", 365, fecha(2025, 1, 2), fecha(2024, 12, 30)},
+		{"vuelo de enero facturado en diciembre", 2, fecha(2024, 12, 28), fecha(2025, 1, 2)},
+		{"día 366 solo en año bisiesto", 366, fecha(2025, 1, 5), fecha(2024, 12, 31)},
+		{"sin fecha", 0, fecha(2024, 8, 10), time.Time{}},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			got := Tramo{FechaJuliana: c.juliana}.FechaVuelo(c.referencia)
+			if !got.Equal(c.esperado) {
+				t.Errorf("FechaVuelo = %s, se esperaba %s", got.Format("2006-01-02"), c.esperado.Format("2006-01-02"))
+			}
+		})
+	}
+}
+
+func fecha(anio int, mes time.Month, dia int) time.Time {
+	return time.Date(anio, mes, dia, 0, 0, 0, 0, time.UTC)
+}
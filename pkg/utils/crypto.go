@@ -12,34 +12,100 @@ import (
 	"strings"
 )
 
-// claveCifrado deriva una clave AES-256 a partir de cualquier texto plano
-// en la variable de entorno FACTURADOR_TOKEN_KEY (sin necesidad de base64
-// ni de que tenga exactamente 32 bytes: se le aplica SHA-256).
-func claveCifrado() ([]byte, error) {
-	texto := strings.TrimSpace(os.Getenv("FACTURADOR_TOKEN_KEY"))
-	if texto == "" {
-		return nil, fmt.Errorf("FACTURADOR_TOKEN_KEY no está configurada")
-	}
-	clave := sha256.Sum256([]byte(texto))
-	return clave[:], nil
+// Los secretos guardados en la base (token de cada sucursal facturador,
+// contraseña de cada db_connection) se cifran con AES-256-GCM y se guardan
+// como "<id de clave>:<base64(nonce + ciphertext)>". El id permite tener
+// varias claves cargadas a la vez y rotarlas sin dejar secretos
+// indescifrables:
+//
+//	FACTURADOR_TOKEN_KEYS=v2=frase nueva,v1=frase vieja
+//
+// La primera clave de la lista es la actual (con la que se cifra); las demás
+// solo se usan para descifrar lo que todavía no se recifró (ver
+// CifradoService.Recifrar). Sin FACTURADOR_TOKEN_KEYS se usa
+// FACTURADOR_TOKEN_KEY como única clave, con id "v1". Los valores cifrados
+// antes de que existiera el prefijo no lo traen y se prueban contra todas
+// las claves cargadas.
+
+// IDClaveLegacy es el id que recibe FACTURADOR_TOKEN_KEY cuando no se
+// define FACTURADOR_TOKEN_KEYS.
+const IDClaveLegacy = "v1"
+
+type claveCifrado struct {
+	id    string
+	clave []byte
 }
 
-// Encrypt cifra un texto plano con AES-256-GCM y devuelve el resultado
-// (nonce + ciphertext) codificado en base64.
-func Encrypt(texto string) (string, error) {
-	clave, err := claveCifrado()
-	if err != nil {
-		return "", err
+// clavesCifrado carga las claves desde el entorno, la actual primero. Cada
+// frase puede ser cualquier texto plano (sin necesidad de base64 ni de que
+// tenga exactamente 32 bytes: se le aplica SHA-256).
+func clavesCifrado() ([]claveCifrado, error) {
+	lista := strings.TrimSpace(os.Getenv("FACTURADOR_TOKEN_KEYS"))
+	if lista == "" {
+		texto := strings.TrimSpace(os.Getenv("FACTURADOR_TOKEN_KEY"))
+		if texto == "" {
+			return nil, fmt.Errorf("FACTURADOR_TOKEN_KEY no está configurada")
+		}
+		clave := sha256.Sum256([]byte(texto))
+		return []claveCifrado{{id: IDClaveLegacy, clave: clave[:]}}, nil
 	}
 
+	var claves []claveCifrado
+	vistos := map[string]bool{}
+	for _, entrada := range strings.Split(lista, ",") {
+		id, texto, ok := strings.Cut(strings.TrimSpace(entrada), "=")
+		id, texto = strings.TrimSpace(id), strings.TrimSpace(texto)
+		if !ok || !idClaveValido(id) || texto == "" {
+			return nil, fmt.Errorf("FACTURADOR_TOKEN_KEYS: entrada inválida %q (se espera id=frase, id alfanumérico)", id)
+		}
+		if vistos[id] {
+			return nil, fmt.Errorf("FACTURADOR_TOKEN_KEYS: id de clave '%s' repetido", id)
+		}
+		vistos[id] = true
+		clave := sha256.Sum256([]byte(texto))
+		claves = append(claves, claveCifrado{id: id, clave: clave[:]})
+	}
+	return claves, nil
+}
+
+// idClaveValido limita el id a letras, dígitos, "_" y "-" (nunca ":", que
+// separa el id del valor, ni caracteres de base64).
+func idClaveValido(id string) bool {
+	if id == "" || len(id) > 16 {
+		return false
+	}
+	for _, r := range id {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+func nuevoGCM(clave []byte) (cipher.AEAD, error) {
 	bloque, err := aes.NewCipher(clave)
 	if err != nil {
-		return "", fmt.Errorf("error inicializando cifrado: %w", err)
+		return nil, fmt.Errorf("error inicializando cifrado: %w", err)
 	}
-
 	gcm, err := cipher.NewGCM(bloque)
 	if err != nil {
-		return "", fmt.Errorf("error inicializando GCM: %w", err)
+		return nil, fmt.Errorf("error inicializando GCM: %w", err)
+	}
+	return gcm, nil
+}
+
+// Encrypt cifra un texto plano con la clave actual y devuelve
+// "<id>:<base64(nonce + ciphertext)>".
+func Encrypt(texto string) (string, error) {
+	claves, err := clavesCifrado()
+	if err != nil {
+		return "", err
+	}
+	actual := claves[0]
+
+	gcm, err := nuevoGCM(actual.clave)
+	if err != nil {
+		return "", err
 	}
 
 	nonce := make([]byte, gcm.NonceSize())
@@ -48,29 +114,47 @@ func Encrypt(texto string) (string, error) {
 	}
 
 	cifrado := gcm.Seal(nonce, nonce, []byte(texto), nil)
-	return base64.StdEncoding.EncodeToString(cifrado), nil
+	return actual.id + ":" + base64.StdEncoding.EncodeToString(cifrado), nil
 }
 
-// Decrypt descifra un valor generado por Encrypt.
+// Decrypt descifra un valor generado por Encrypt con la clave que indica su
+// prefijo (o probando todas, si es un valor anterior al prefijo).
 func Decrypt(textoCifrado string) (string, error) {
-	clave, err := claveCifrado()
+	claves, err := clavesCifrado()
 	if err != nil {
 		return "", err
 	}
 
-	datos, err := base64.StdEncoding.DecodeString(textoCifrado)
+	id, datosBase64 := separarIDClave(textoCifrado)
+	datos, err := base64.StdEncoding.DecodeString(datosBase64)
 	if err != nil {
 		return "", fmt.Errorf("valor cifrado inválido (base64): %w", err)
 	}
 
-	bloque, err := aes.NewCipher(clave)
-	if err != nil {
-		return "", fmt.Errorf("error inicializando cifrado: %w", err)
+	if id != "" {
+		for _, clave := range claves {
+			if clave.id == id {
+				return abrir(clave.clave, datos)
+			}
+		}
+		return "", fmt.Errorf("la clave de cifrado '%s' no está cargada (FACTURADOR_TOKEN_KEYS)", id)
 	}
 
-	gcm, err := cipher.NewGCM(bloque)
+	var ultimoErr error
+	for _, clave := range claves {
+		texto, err := abrir(clave.clave, datos)
+		if err == nil {
+			return texto, nil
+		}
+		ultimoErr = err
+	}
+	return "", ultimoErr
+}
+
+func abrir(clave, datos []byte) (string, error) {
+	gcm, err := nuevoGCM(clave)
 	if err != nil {
-		return "", fmt.Errorf("error inicializando GCM: %w", err)
+		return "", err
 	}
 
 	tamanoNonce := gcm.NonceSize()
@@ -86,3 +170,55 @@ func Decrypt(textoCifrado string) (string, error) {
 
 	return string(texto), nil
 }
+
+// separarIDClave divide "<id>:<datos>". Un valor sin prefijo (anterior a la
+// rotación de claves) devuelve id vacío: base64 estándar nunca contiene ":".
+func separarIDClave(valor string) (string, string) {
+	id, datos, ok := strings.Cut(valor, ":")
+	if !ok {
+		return "", valor
+	}
+	return id, datos
+}
+
+// IDClaveDe devuelve el id de la clave con la que se cifró valor, o "" si es
+// un valor anterior al prefijo.
+func IDClaveDe(valor string) string {
+	id, _ := separarIDClave(valor)
+	return id
+}
+
+// IDsClavesCifrado devuelve los ids de las claves cargadas, la actual
+// primero.
+func IDsClavesCifrado() ([]string, error) {
+	claves, err := clavesCifrado()
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(claves))
+	for i, clave := range claves {
+		ids[i] = clave.id
+	}
+	return ids, nil
+}
+
+// Recifrar vuelve a cifrar valor con la clave actual. Devuelve cambiado en
+// false (y el mismo valor) si ya estaba cifrado con ella.
+func Recifrar(valor string) (nuevo string, cambiado bool, err error) {
+	ids, err := IDsClavesCifrado()
+	if err != nil {
+		return "", false, err
+	}
+	if IDClaveDe(valor) == ids[0] {
+		return valor, false, nil
+	}
+	plano, err := Decrypt(valor)
+	if err != nil {
+		return "", false, err
+	}
+	nuevo, err = Encrypt(plano)
+	if err != nil {
+		return "", false, err
+	}
+	return nuevo, true, nil
+}
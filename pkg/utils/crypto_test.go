@@ -0,0 +1,171 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"io"
+	"strings"
+	"testing"
+)
+
+// cifrarLegacy arma un valor como los que se guardaban antes del prefijo
+// de id: base64(nonce + ciphertext) sin "<id>:".
+func cifrarLegacy(t *testing.T, frase, texto string) string {
+	t.Helper()
+	clave := sha256.Sum256([]byte(frase))
+	gcm, err := nuevoGCM(clave[:])
+	if err != nil {
+		t.Fatalf("nuevoGCM: %v", err)
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		t.Fatalf("nonce: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(texto), nil))
+}
+
+func TestIDClaveDe(t *testing.T) {
+	casos := []struct {
+		nombre string
+		valor  string
+		id     string
+	}{
+		{"con prefijo", "v2:QUJD", "v2"},
+		{"id con guiones", "clave_2024-01:QUJD", "clave_2024-01"},
+		{"sin prefijo", "QUJDREVGR0g=", ""},
+		{"vacío", "", ""},
+	}
+	for _, c := range casos {
+		t.Run(c.nombre, func(t *testing.T) {
+			if id := IDClaveDe(c.valor); id != c.id {
+				t.Errorf("IDClaveDe(%q) = %q, se esperaba %q", c.valor, id, c.id)
+			}
+		})
+	}
+}
+
+func TestEncryptUsaClaveActual(t *testing.T) {
+	t.Setenv("FACTURADOR_TOKEN_KEYS", "v2=frase nueva,v1=frase vieja")
+
+	cifrado, err := Encrypt("secreto")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if !strings.HasPrefix(cifrado, "v2:") {
+		t.Errorf("valor cifrado = %q, se esperaba el prefijo v2:", cifrado)
+	}
+	plano, err := Decrypt(cifrado)
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if plano != "secreto" {
+		t.Errorf("Decrypt = %q, se esperaba %q", plano, "secreto")
+	}
+}
+
+func TestEncryptSinListaUsaClaveLegacy(t *testing.T) {
+	t.Setenv("FACTURADOR_TOKEN_KEYS", "")
+	t.Setenv("FACTURADOR_TOKEN_KEY", "frase única")
+
+	cifrado, err := Encrypt("secreto")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if id := IDClaveDe(cifrado); id != IDClaveLegacy {
+		t.Errorf("id de clave = %q, se esperaba %q", id, IDClaveLegacy)
+	}
+}
+
+func TestDecryptSinPrefijoPruebaTodasLasClaves(t *testing.T) {
+	t.Setenv("FACTURADOR_TOKEN_KEYS", "v2=frase nueva,v1=frase vieja")
+
+	legacy := cifrarLegacy(t, "frase vieja", "secreto")
+	plano, err := Decrypt(legacy)
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if plano != "secreto" {
+		t.Errorf("Decrypt = %q, se esperaba %q", plano, "secreto")
+	}
+
+	ajeno := cifrarLegacy(t, "otra frase", "secreto")
+	if _, err := Decrypt(ajeno); err == nil {
+		t.Error("Decrypt de un valor sin prefijo cifrado con una clave no cargada debería fallar")
+	}
+}
+
+func TestDecryptClaveDesconocida(t *testing.T) {
+	t.Setenv("FACTURADOR_TOKEN_KEYS", "v1=frase vieja")
+	cifrado, err := Encrypt("secreto")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	t.Setenv("FACTURADOR_TOKEN_KEYS", "v2=frase nueva")
+	_, err = Decrypt(cifrado)
+	if err == nil {
+		t.Fatal("Decrypt con una clave no cargada debería fallar")
+	}
+	if !strings.Contains(err.Error(), "'v1' no está cargada") {
+		t.Errorf("error = %q, se esperaba que nombre la clave v1", err)
+	}
+}
+
+func TestRecifrar(t *testing.T) {
+	t.Setenv("FACTURADOR_TOKEN_KEYS", "v1=frase vieja")
+	viejo, err := Encrypt("secreto")
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	legacy := cifrarLegacy(t, "frase vieja", "secreto")
+
+	t.Setenv("FACTURADOR_TOKEN_KEYS", "v2=frase nueva,v1=frase vieja")
+
+	for nombre, valor := range map[string]string{"con prefijo viejo": viejo, "sin prefijo": legacy} {
+		t.Run(nombre, func(t *testing.T) {
+			nuevo, cambiado, err := Recifrar(valor)
+			if err != nil {
+				t.Fatalf("Recifrar: %v", err)
+			}
+			if !cambiado {
+				t.Fatal("cambiado = false, se esperaba true")
+			}
+			if id := IDClaveDe(nuevo); id != "v2" {
+				t.Errorf("id de clave = %q, se esperaba v2", id)
+			}
+			plano, err := Decrypt(nuevo)
+			if err != nil {
+				t.Fatalf("Decrypt: %v", err)
+			}
+			if plano != "secreto" {
+				t.Errorf("Decrypt = %q, se esperaba %q", plano, "secreto")
+			}
+
+			otraVez, cambiado, err := Recifrar(nuevo)
+			if err != nil {
+				t.Fatalf("Recifrar (segunda vez): %v", err)
+			}
+			if cambiado || otraVez != nuevo {
+				t.Error("un valor ya cifrado con la clave actual no debería cambiar")
+			}
+		})
+	}
+}
+
+func TestClavesCifradoInvalidas(t *testing.T) {
+	casos := map[string]string{
+		"sin frase":         "v1=",
+		"id con dos puntos": "v:1=frase",
+		"id repetido":       "v1=a,v1=b",
+		"sin igual":         "v1",
+	}
+	for nombre, lista := range casos {
+		t.Run(nombre, func(t *testing.T) {
+			t.Setenv("FACTURADOR_TOKEN_KEYS", lista)
+			if _, err := IDsClavesCifrado(); err == nil {
+				t.Errorf("FACTURADOR_TOKEN_KEYS=%q debería ser inválida", lista)
+			}
+		})
+	}
+}
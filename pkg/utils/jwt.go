@@ -9,12 +9,14 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-// ClaimsUsuario es el contenido del JWT de sesión: solo el ID del usuario,
-// todo lo demás (accesos, acceso_total) se resuelve en cada request contra
-// la BD, así un cambio de accesos aplica de inmediato sin esperar a que el
-// token expire.
+// ClaimsUsuario es el contenido del JWT de acceso: el ID del usuario y el
+// de su sesión (models.Sesion). Todo lo demás (accesos, acceso_total) se
+// resuelve en cada request contra la BD, así un cambio de accesos aplica de
+// inmediato sin esperar a que el token expire; la sesión también se
+// verifica en cada request, así una revocación corta el acceso enseguida.
 type ClaimsUsuario struct {
 	UsuarioID uint `json:"usuario_id"`
+	SesionID  uint `json:"sid"`
 	jwt.RegisteredClaims
 }
 
@@ -26,35 +28,41 @@ func claveJWT() ([]byte, error) {
 	return []byte(secreto), nil
 }
 
-func horasExpiracion() time.Duration {
-	horas, err := strconv.Atoi(os.Getenv("JWT_EXPIRE_HOURS"))
-	if err != nil || horas <= 0 {
-		horas = 24
+// minutosExpiracion es la vida del token de acceso: corta, porque se
+// renueva con el refresh token (POST /auth/refresh).
+func minutosExpiracion() time.Duration {
+	minutos, err := strconv.Atoi(os.Getenv("JWT_EXPIRE_MINUTES"))
+	if err != nil || minutos <= 0 {
+		minutos = 15
 	}
-	return time.Duration(horas) * time.Hour
+	return time.Duration(minutos) * time.Minute
 }
 
-// GenerarTokenJWT firma un token de sesión para el usuario dado.
-func GenerarTokenJWT(usuarioID uint) (string, error) {
+// GenerarTokenJWT firma un token de acceso para la sesión dada y devuelve
+// también cuándo expira.
+func GenerarTokenJWT(usuarioID, sesionID uint) (string, time.Time, error) {
 	clave, err := claveJWT()
 	if err != nil {
-		return "", err
+		return "", time.Time{}, err
 	}
 
+	ahora := time.Now()
+	expira := ahora.Add(minutosExpiracion())
 	claims := ClaimsUsuario{
 		UsuarioID: usuarioID,
+		SesionID:  sesionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(horasExpiracion())),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(expira),
+			IssuedAt:  jwt.NewNumericDate(ahora),
 		},
 	}
 
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	firmado, err := token.SignedString(clave)
 	if err != nil {
-		return "", fmt.Errorf("error firmando token: %w", err)
+		return "", time.Time{}, fmt.Errorf("error firmando token: %w", err)
 	}
-	return firmado, nil
+	return firmado, expira, nil
 }
 
 // ValidarTokenJWT valida la firma y expiración de un token y devuelve sus
@@ -68,12 +76,80 @@ func ValidarTokenJWT(tokenString string) (*ClaimsUsuario, error) {
 	claims := &ClaimsUsuario{}
 	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
 		return clave, nil
-	})
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 	if err != nil {
 		return nil, fmt.Errorf("token inválido: %w", err)
 	}
 	if !token.Valid {
 		return nil, fmt.Errorf("token inválido")
 	}
+	if claims.SesionID == 0 {
+		// token emitido antes de las sesiones del lado del servidor
+		return nil, fmt.Errorf("token inválido: sin sesión")
+	}
 	return claims, nil
 }
+
+// propositoDesafio2FA distingue el token de desafío del de acceso.
+const propositoDesafio2FA = "2fa"
+
+// vidaDesafio2FA es cuánto tiene el usuario para mandar el código TOTP
+// después de la contraseña.
+const vidaDesafio2FA = 5 * time.Minute
+
+// ClaimsDesafio2FA es el token que devuelve el login cuando falta el
+// segundo factor: prueba que la contraseña ya se verificó. No lleva sesión,
+// así que ValidarTokenJWT lo rechaza como token de acceso.
+type ClaimsDesafio2FA struct {
+	UsuarioID uint   `json:"usuario_id"`
+	Proposito string `json:"proposito"`
+	jwt.RegisteredClaims
+}
+
+// GenerarTokenDesafio2FA firma el desafío del segundo paso del login y
+// devuelve también cuándo expira.
+func GenerarTokenDesafio2FA(usuarioID uint) (string, time.Time, error) {
+	clave, err := claveJWT()
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	ahora := time.Now()
+	expira := ahora.Add(vidaDesafio2FA)
+	claims := ClaimsDesafio2FA{
+		UsuarioID: usuarioID,
+		Proposito: propositoDesafio2FA,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(expira),
+			IssuedAt:  jwt.NewNumericDate(ahora),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	firmado, err := token.SignedString(clave)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("error firmando desafío: %w", err)
+	}
+	return firmado, expira, nil
+}
+
+// ValidarTokenDesafio2FA valida firma, expiración y propósito del desafío
+// y devuelve el usuario al que corresponde.
+func ValidarTokenDesafio2FA(tokenString string) (uint, error) {
+	clave, err := claveJWT()
+	if err != nil {
+		return 0, err
+	}
+
+	claims := &ClaimsDesafio2FA{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		return clave, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return 0, fmt.Errorf("desafío inválido: %w", err)
+	}
+	if !token.Valid || claims.Proposito != propositoDesafio2FA || claims.UsuarioID == 0 {
+		return 0, fmt.Errorf("desafío inválido")
+	}
+	return claims.UsuarioID, nil
+}
@@ -102,6 +102,38 @@ func ValidarFecha(errValidacion *[]string, campo, mensaje string) time.Time {
 	return fecha
 }
 
+// ValidarFechaOpcional valida una fecha "2006-01-02" solo si vino con
+// valor; vacía devuelve la fecha cero sin error.
+func ValidarFechaOpcional(errValidacion *[]string, campo, mensaje string) time.Time {
+	if strings.TrimSpace(campo) == "" {
+		return time.Time{}
+	}
+	return ValidarFecha(errValidacion, campo, mensaje)
+}
+
+// ValidarCodigoOpcional valida que campo, si vino con valor, tenga entre
+// min y max caracteres alfanuméricos (letras si soloLetras). Retorna el
+// código limpio en mayúsculas.
+func ValidarCodigoOpcional(errValidacion *[]string, campo, mensaje string, min, max int, soloLetras bool) string {
+	codigo := strings.ToUpper(strings.TrimSpace(campo))
+	if codigo == "" {
+		return ""
+	}
+	if len(codigo) < min || len(codigo) > max {
+		*errValidacion = append(*errValidacion, mensaje)
+		return ""
+	}
+	for _, r := range codigo {
+		letra := r >= 'A' && r <= 'Z'
+		digito := r >= '0' && r <= '9'
+		if !letra && (soloLetras || !digito) {
+			*errValidacion = append(*errValidacion, mensaje)
+			return ""
+		}
+	}
+	return codigo
+}
+
 // ValidarFechaConFormato valida fecha con formato personalizado
 func ValidarFechaConFormato(errValidacion *[]string, campo, formato, mensaje string) time.Time {
 	campoLimpio := strings.TrimSpace(campo)